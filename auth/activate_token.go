@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	activateSubClaim   = "activate"
+	emailClaim         = "email"
+	activateTokenClaim = "activate_token"
+)
+
+// 本人確認用リンクに埋め込むトークンの中身
+type ActivateToken struct {
+	Email string
+	Token string
+}
+
+// 本人確認用リンクのトークンを作成する。改ざんされないように、emailと本人確認用トークンを署名して埋め込む
+func (j *JwtBuilder) GenerateActivateToken(email, token string, expiration time.Time) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(activateSubClaim).
+		JwtID(jti).
+		IssuedAt(time.Now()).
+		Expiration(expiration).
+		Claim(emailClaim, email).
+		Claim(activateTokenClaim, token).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseActivateToken(token []byte) (*ActivateToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(activateSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	v, ok := tok.Get(emailClaim)
+	if !ok {
+		return nil, errors.New("failed to get email from token")
+	}
+	email, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("get invalid email: %v, %T", v, v)
+	}
+
+	v, ok = tok.Get(activateTokenClaim)
+	if !ok {
+		return nil, errors.New("failed to get activate_token from token")
+	}
+	at, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("get invalid activate_token: %v, %T", v, v)
+	}
+
+	return &ActivateToken{Email: email, Token: at}, nil
+}
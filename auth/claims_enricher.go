@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"fmt"
+	"login-example/entity"
+)
+
+// アクセストークンとリフレッシュトークンに、アプリケーション独自のクレームを追加する
+// テナントのIDやプラン、機能フラグなどを、JwtBuilderを変更せずにトークンに含めるために使う
+type ClaimsEnricher interface {
+	// tokenTypeはAccessTokenTypeかRefreshTokenType。エラーを返すとトークンを発行しない
+	EnrichClaims(u *entity.User, tokenType string) (map[string]any, error)
+}
+
+// 関数をClaimsEnricherとして使う
+type ClaimsEnricherFunc func(u *entity.User, tokenType string) (map[string]any, error)
+
+func (f ClaimsEnricherFunc) EnrichClaims(u *entity.User, tokenType string) (map[string]any, error) {
+	return f(u, tokenType)
+}
+
+// 検証に使うクレームは、追加するクレームで上書きできない
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	tokenTypeClaim: true, userIDClaim: true, roleClaim: true, sessionIDClaim: true, scopeClaim: true,
+	orgIDClaim: true, tokenVersionClaim: true,
+}
+
+func (j *JwtBuilder) SetClaimsEnricher(e ClaimsEnricher) {
+	j.enricher = e
+}
+
+func (p *PasetoBuilder) SetClaimsEnricher(e ClaimsEnricher) {
+	p.enricher = e
+}
+
+// eが追加するクレームをclaimsに加える。eがnilの場合は何もしない
+func enrichClaims(e ClaimsEnricher, u *entity.User, tokenType string, claims map[string]any) error {
+	if e == nil {
+		return nil
+	}
+	extra, err := e.EnrichClaims(u, tokenType)
+	if err != nil {
+		return fmt.Errorf("failed to enrich claims: %w", err)
+	}
+	for k, v := range extra {
+		if reservedClaims[k] {
+			return fmt.Errorf("failed to enrich claims: %s is reserved", k)
+		}
+		claims[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	deviceSubClaim = "device"
+	deviceIDClaim  = "device_id"
+)
+
+// 信頼済みの端末のcookieに保存するトークンの中身
+type DeviceToken struct {
+	UserID   entity.UserID
+	DeviceID entity.TrustedDeviceID
+}
+
+// 信頼済みの端末を識別するためのトークンを作成する。有効期限は端末の有効期限と同じ
+func (j *JwtBuilder) GenerateDeviceToken(d *entity.TrustedDevice) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(deviceSubClaim).
+		JwtID(jti).
+		IssuedAt(time.Now()).
+		Expiration(d.ExpiresAt).
+		Claim(userIDClaim, d.UserID).
+		Claim(deviceIDClaim, d.ID).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseDeviceToken(token []byte) (*DeviceToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(deviceSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+
+	id, ok = tok.Get(deviceIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get device_id from token")
+	}
+	did, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid device_id: %v, %T", id, id)
+	}
+
+	return &DeviceToken{
+		UserID:   entity.UserID(uid),
+		DeviceID: entity.TrustedDeviceID(did),
+	}, nil
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// A256GCMの鍵の長さ
+const encryptionKeyLength = 32
+
+// 署名したJWTをJWEで暗号化して、user_idやroleをクライアントや途中の経路から読めないようにする
+// 鍵はこのサービスだけが持つ共通鍵なので、他のサービスはトークンを検証できなくなる。その場合はイントロスペクションを使う
+func (j *JwtBuilder) EnableEncryption(key []byte) error {
+	if len(key) != encryptionKeyLength {
+		return fmt.Errorf("encryption key must be %d bytes", encryptionKeyLength)
+	}
+	j.encKey = key
+	return nil
+}
+
+// 署名して、暗号化が有効な場合は署名したJWTをJWEに入れる
+func (j *JwtBuilder) sign(tok jwt.Token) ([]byte, error) {
+	signed, err := jwt.Sign(tok, j.signKey())
+	if err != nil {
+		return nil, err
+	}
+	if j.encKey == nil {
+		return signed, nil
+	}
+
+	// 中身がJWTであることを示す(RFC 7519 5.2)
+	hdr := jwe.NewHeaders()
+	if err := hdr.Set(jwe.ContentTypeKey, "JWT"); err != nil {
+		return nil, fmt.Errorf("failed to set cty: %w", err)
+	}
+	encrypted, err := jwe.Encrypt(signed,
+		jwe.WithKey(jwa.DIRECT, j.encKey),
+		jwe.WithContentEncryption(jwa.A256GCM),
+		jwe.WithProtectedHeaders(hdr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return encrypted, nil
+}
+
+// 暗号化が有効な場合は復号してから、署名したJWTを検証する
+func (j *JwtBuilder) parse(token []byte, opts ...jwt.ParseOption) (jwt.Token, error) {
+	if j.encKey != nil {
+		decrypted, err := jwe.Decrypt(token, jwe.WithKey(jwa.DIRECT, j.encKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt: %w", err)
+		}
+		token = decrypted
+	}
+	return jwt.Parse(token, opts...)
+}
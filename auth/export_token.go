@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	exportSubClaim = "data-export"
+	exportIDClaim  = "export_id"
+)
+
+// データエクスポートのダウンロードリンクの有効期限
+var expExport = 24 * time.Hour
+
+// データエクスポートのダウンロードリンクに埋め込むトークンの中身
+type ExportToken struct {
+	UserID   entity.UserID
+	ExportID entity.DataExportID
+}
+
+// データエクスポートのダウンロード用のトークンを作成する
+func (j *JwtBuilder) GenerateExportToken(e *entity.DataExport) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(exportSubClaim).
+		JwtID(jti).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(expExport)).
+		Claim(userIDClaim, e.UserID).
+		Claim(exportIDClaim, e.ID).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseExportToken(token []byte) (*ExportToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(exportSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+
+	id, ok = tok.Get(exportIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get export_id from token")
+	}
+	eid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid export_id: %v, %T", id, id)
+	}
+
+	return &ExportToken{
+		UserID:   entity.UserID(uid),
+		ExportID: entity.DataExportID(eid),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var (
+	// IDトークンのiss。OpenID Connectのdiscoveryで公開するissuerと同じ値にする。configの値で上書きする
+	IDTokenIssuer = ""
+	// IDトークンの有効期限。RPはログイン時に一度検証するだけなので短くてよい。configの値で上書きする
+	IDTokenTTL = 5 * time.Minute
+)
+
+const (
+	nonceClaim         = "nonce"
+	emailVerifiedClaim = "email_verified"
+)
+
+// トークンの形式がPASETOの場合は、IDトークンを発行できない
+var ErrIDTokenUnsupported = errors.New("id token requires jwt format")
+
+// OpenID ConnectのIDトークンを作成する。audはRPのクライアントID、subはユーザーID
+// RPがJWKSの公開鍵だけで検証できるように、encryption_keyが設定されていても暗号化しない
+func (j *JwtBuilder) GenerateIDToken(u *entity.User, clientID, nonce string, scopes []string) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	b := jwt.NewBuilder().
+		Issuer(IDTokenIssuer).
+		Subject(strconv.FormatUint(uint64(u.ID), 10)).
+		Audience([]string{clientID}).
+		JwtID(jti).
+		IssuedAt(now).
+		Expiration(now.Add(IDTokenTTL))
+	if nonce != "" {
+		b = b.Claim(nonceClaim, nonce)
+	}
+	// 本人確認済みのユーザーしかログインできないので、emailは常に確認済み
+	if slices.Contains(scopes, entity.ScopeEmail) {
+		b = b.Claim(emailClaim, u.Email).Claim(emailVerifiedClaim, true)
+	}
+	tok, err := b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := jwt.Sign(tok, j.signKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
@@ -1,91 +1,404 @@
 package auth
 
 import (
-	_ "embed"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"login-example/entity"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 var (
-	//go:embed keys/secret.pem
-	secretKey []byte
-	//go:embed keys/public.pem
-	publicKey []byte
-	
-	// アクセストークンの有効期限
-	expAccess = 30 * time.Minute
-	// リフレッシュトークンの有効期限
-	expRefresh = 3 * 24 * time.Hour
+	// アクセストークンの有効期限。configの値で上書きする
+	AccessTokenTTL = 30 * time.Minute
+	// マジックリンク用トークンの有効期限。configの値で上書きする
+	MagicTokenTTL = 15 * time.Minute
+	// アクセストークンとリフレッシュトークンのaud。空の場合は付与も検証もしない。configの値で上書きする
+	Audience = "login-example"
+	// exp、iat、nbfを検証する時に許容する時計のずれ。configの値で上書きする
+	ClockSkew = 30 * time.Second
 )
 
 const (
 	userIDClaim      = "user_id"
+	roleClaim        = "role"
+	sessionIDClaim   = "sid"
 	issClaim         = "login-example"
 	accessSubClaim   = "access-token"
 	refreshSubClaim  = "refresh-token"
+	magicSubClaim    = "magic-link"
 	userIDContextKey = "user_id"
+	roleContextKey   = "role"
+	jwtIDContextKey  = "jti"
+	expContextKey    = "exp"
+)
+
+// 全端末からのログアウトで、それより前に発行したアクセストークンを無効にするためのバージョン
+const (
+	tokenVersionClaim      = "token_version"
+	tokenVersionContextKey = "token_version"
+)
+
+// アクセストークンで許可する操作。RFC 8693と同じく、スペース区切りの文字列にする
+const (
+	scopeClaim      = "scope"
+	scopeContextKey = "scope"
+)
+
+// アクセストークンとリフレッシュトークンを取り違えて使えないように、種類を明示する
+const (
+	tokenTypeClaim   = "token_type"
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
 )
 
 type IJwtGenerator interface {
 	GenerateAccessToken(u *entity.User) ([]byte, error)
-	GenerateRefreshToken(u *entity.User) ([]byte, error)
+	GenerateScopedAccessToken(u *entity.User, scopes []string) ([]byte, error)
+	GenerateOrgAccessToken(u *entity.User, orgID entity.OrganizationID) ([]byte, error)
+	GenerateRefreshToken(u *entity.User, s *entity.Session) ([]byte, error)
+	GenerateMagicToken(u *entity.User) ([]byte, error)
+	GenerateExportToken(e *entity.DataExport) ([]byte, error)
+	GenerateLoginAlertToken(h *entity.LoginHistory) ([]byte, error)
+	GenerateDeviceToken(d *entity.TrustedDevice) ([]byte, error)
+	GenerateActivateToken(email, token string, expiration time.Time) ([]byte, error)
+	GenerateSudoToken(u *entity.User) ([]byte, error)
+	GenerateClientToken(clientID string, scopes []string) ([]byte, error)
+	GenerateIDToken(u *entity.User, clientID, nonce string, scopes []string) ([]byte, error)
 }
 
 type IJwtParser interface {
 	SetAuthToContext(c echo.Context) error
 	GetUserIDFromJWT(token []byte) (entity.UserID, error)
+	ParseRefreshToken(token []byte) (*RefreshToken, error)
+	ParseMagicToken(token []byte) (*MagicToken, error)
+	ParseExportToken(token []byte) (*ExportToken, error)
+	ParseLoginAlertToken(token []byte) (*LoginAlertToken, error)
+	ParseDeviceToken(token []byte) (*DeviceToken, error)
+	ParseActivateToken(token []byte) (*ActivateToken, error)
+	ParseSudoToken(token []byte) (*SudoToken, error)
+	ParseToken(token []byte) (*TokenInfo, error)
+}
+
+// リフレッシュトークンの中身
+type RefreshToken struct {
+	UserID    entity.UserID
+	SessionID entity.SessionID
+	IssuedAt  time.Time
+}
+
+// アクセストークンかリフレッシュトークンの中身。イントロスペクションで返す
+type TokenInfo struct {
+	// AccessTokenType, RefreshTokenType
+	Type   string
+	UserID entity.UserID
+	Role   entity.UserRole
+	JwtID  string
+	// アクセストークンのscope。リフレッシュトークンの場合はroleのscope
+	Scopes []string
+	// リフレッシュトークンの場合のみ
+	SessionID  entity.SessionID
+	IssuedAt   time.Time
+	Expiration time.Time
+}
+
+// マジックリンクに埋め込む、一度だけ使えるトークンの中身
+type MagicToken struct {
+	UserID     entity.UserID
+	JwtID      string
+	Expiration time.Time
 }
 
+// トークンの形式(JWT、PASETO)ごとの実装
 type IJwtBuilder interface {
 	IJwtGenerator
 	IJwtParser
+	// 鍵が読み込まれていて、トークンを作成・検証できる状態か
+	Check(ctx context.Context) error
+	// JWKSとして公開する公開鍵のセット
+	PublicKeySet() (jwk.Set, error)
  }
 
 type JwtBuilder struct {
-	secretKey jwk.Key
-	publicKey jwk.Key
+	// 署名のアルゴリズム。signerの鍵の種類と一致している
+	alg jwa.SignatureAlgorithm
+	// 署名に使う秘密鍵。鍵を入れ替えた場合は最新の鍵
+	// PEMから読み込んだ場合はjwk.Key、KMSで署名する場合はcrypto.Signer
+	signer any
+	// 署名したJWTのヘッダーに付けるkid。検証に使う公開鍵のkidと同じ
+	kid string
+	// 検証に使う公開鍵。署名に使う鍵の公開鍵と、入れ替え中の鍵の公開鍵を含む
+	// HS256の場合は、署名に使う共有の秘密鍵
+	publicKeys jwk.Set
+	// 署名したJWTをJWEで暗号化する共通鍵。nilの場合は暗号化しない
+	encKey []byte
+	// アクセストークンとリフレッシュトークンに独自のクレームを追加する。nilの場合は追加しない
+	enricher ClaimsEnricher
 }
 
-func NewJwtBuilder() (*JwtBuilder, error) {
+// HS256の共有の秘密鍵の最低の長さ。SHA-256の出力と同じ長さ以上にする
+const minHMACSecretLength = 32
+
+// PEM形式の秘密鍵と公開鍵を使う。algはRS256、ES256、EdDSAのいずれかで、秘密鍵の種類と一致している必要がある
+// publicKeyが空の場合は、秘密鍵から公開鍵を作る
+// verifyKeysは検証にだけ使う公開鍵。鍵を入れ替える時は、新しい公開鍵を先にverifyKeysに追加して全てのサーバーに配ってから
+// 署名に使う鍵を新しい鍵にして、古い公開鍵は発行済みのトークンが期限切れになるまでverifyKeysに残しておく
+func NewJwtBuilderWithKeys(alg jwa.SignatureAlgorithm, secretKey, publicKey []byte, verifyKeys ...[]byte) (*JwtBuilder, error) {
 	secKey, err := jwk.ParseKey(secretKey, jwk.WithPEM(true))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JWK: %w", err)
 	}
-	pubKey, err := jwk.ParseKey(publicKey, jwk.WithPEM(true))
+	keyAlg, err := algorithmOf(secKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse JWK: %w", err)
+		return nil, err
+	}
+	if keyAlg != alg {
+		return nil, fmt.Errorf("secret key is for %s, not %s", keyAlg, alg)
+	}
+	var pubKey jwk.Key
+	if len(publicKey) == 0 {
+		pubKey, err = secKey.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get public key: %w", err)
+		}
+		err = preparePublicKey(pubKey)
+	} else {
+		pubKey, err = parsePublicKey(publicKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newJwtBuilder(alg, secKey, pubKey, verifyKeys)
+}
+
+// KMSなど、秘密鍵を取り出せない場所にある鍵で署名する。公開鍵はsigner.Publicから作る
+// algはRS256かES256で、鍵の種類と一致している必要がある。verifyKeysはNewJwtBuilderWithKeysと同じ
+func NewJwtBuilderWithSigner(alg jwa.SignatureAlgorithm, signer crypto.Signer, verifyKeys ...[]byte) (*JwtBuilder, error) {
+	pubKey, err := jwk.FromRaw(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWK: %w", err)
+	}
+	if err := preparePublicKey(pubKey); err != nil {
+		return nil, err
+	}
+	keyAlg, err := algorithmOf(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	// EdDSAはダイジェストではなくメッセージ全体に署名するので、KMSで使うRS256とES256だけに対応する
+	if keyAlg == jwa.EdDSA {
+		return nil, errors.New("signer does not support EdDSA")
+	}
+	if keyAlg != alg {
+		return nil, fmt.Errorf("signer key is for %s, not %s", keyAlg, alg)
+	}
+	return newJwtBuilder(alg, signer, pubKey, verifyKeys)
+}
+
+// 署名に使う鍵の公開鍵とverifyKeysを、検証に使う公開鍵のセットにする
+func newJwtBuilder(alg jwa.SignatureAlgorithm, signer any, pubKey jwk.Key, verifyKeys [][]byte) (*JwtBuilder, error) {
+	set := jwk.NewSet()
+	if err := set.AddKey(pubKey); err != nil {
+		return nil, fmt.Errorf("failed to add key: %w", err)
+	}
+	for _, vk := range verifyKeys {
+		k, err := parsePublicKey(vk)
+		if err != nil {
+			return nil, err
+		}
+		// 署名に使う鍵と同じ鍵が設定されていても重複させない
+		if _, ok := set.LookupKeyID(k.KeyID()); ok {
+			continue
+		}
+		if err := set.AddKey(k); err != nil {
+			return nil, fmt.Errorf("failed to add key: %w", err)
+		}
 	}
 
 	j := &JwtBuilder{}
-	j.secretKey = secKey
-	j.publicKey = pubKey
+	j.alg = alg
+	j.signer = signer
+	// 署名したJWTのヘッダーに、検証に使う公開鍵と同じkidが入るようにする
+	j.kid = pubKey.KeyID()
+	j.publicKeys = set
 	return j, nil
 }
 
+// 共有の秘密鍵を使ってHS256で署名・検証する。鍵ペアの管理が不要なので、1つのサービスだけで検証する場合に使う
+// 秘密鍵を知っていればトークンを作成できるので、他のサービスに検証させる場合は使わない
+func NewJwtBuilderWithSecret(secret []byte) (*JwtBuilder, error) {
+	if len(secret) < minHMACSecretLength {
+		return nil, fmt.Errorf("hmac secret must be at least %d bytes", minHMACSecretLength)
+	}
+	key, err := jwk.FromRaw(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWK: %w", err)
+	}
+	// kidから秘密鍵の手がかりを与えないように、kidは付けない
+	if err := key.Set(jwk.AlgorithmKey, jwa.HS256); err != nil {
+		return nil, fmt.Errorf("failed to set alg: %w", err)
+	}
+
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return nil, fmt.Errorf("failed to add key: %w", err)
+	}
+
+	j := &JwtBuilder{}
+	j.alg = jwa.HS256
+	j.signer = key
+	j.publicKeys = set
+	return j, nil
+}
+
+// PEM形式の公開鍵を読み込む
+func parsePublicKey(b []byte) (jwk.Key, error) {
+	k, err := jwk.ParseKey(b, jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWK: %w", err)
+	}
+	if err := preparePublicKey(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// 公開鍵のthumbprint(RFC 7638)をkidにする
+// アルゴリズムを変更する場合に備えて、アルゴリズムは署名に使う鍵ではなく公開鍵ごとの種類から決める
+func preparePublicKey(k jwk.Key) error {
+	alg, err := algorithmOf(k)
+	if err != nil {
+		return err
+	}
+	if err := jwk.AssignKeyID(k); err != nil {
+		return fmt.Errorf("failed to assign kid: %w", err)
+	}
+	// JWKSを取得したサービスが、鍵の用途とアルゴリズムを判断できるようにする
+	if err := k.Set(jwk.AlgorithmKey, alg); err != nil {
+		return fmt.Errorf("failed to set alg: %w", err)
+	}
+	if err := k.Set(jwk.KeyUsageKey, "sig"); err != nil {
+		return fmt.Errorf("failed to set use: %w", err)
+	}
+	return nil
+}
+
+// 鍵の種類から署名のアルゴリズムを決める。ECDSAはP-256だけに対応する
+func algorithmOf(k jwk.Key) (jwa.SignatureAlgorithm, error) {
+	var raw any
+	if err := k.Raw(&raw); err != nil {
+		return "", fmt.Errorf("failed to get raw key: %w", err)
+	}
+	switch key := raw.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwa.RS256, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve == elliptic.P256() {
+			return jwa.ES256, nil
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return jwa.ES256, nil
+		}
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwa.EdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported key type: %T", raw)
+}
+
+// 鍵が読み込まれていて、JWTを作成・検証できる状態か
+func (j *JwtBuilder) Check(ctx context.Context) error {
+	if j.signer == nil || j.publicKeys == nil || j.publicKeys.Len() == 0 {
+		return errors.New("jwt keys not loaded")
+	}
+	return nil
+}
+
+// JWKSとして公開する公開鍵のセット。他のサービスはkidで検証に使う鍵を選ぶ
+// HS256の場合は公開できる鍵がないので、空のセットを返す
+func (j *JwtBuilder) PublicKeySet() (jwk.Set, error) {
+	if j.alg == jwa.HS256 {
+		return jwk.NewSet(), nil
+	}
+	return j.publicKeys, nil
+}
+
+func (j *JwtBuilder) signKey() jwt.SignOption {
+	if j.kid == "" {
+		return jwt.WithKey(j.alg, j.signer)
+	}
+	// crypto.Signerにはkidがないので、ヘッダーに直接設定する
+	hdr := jws.NewHeaders()
+	_ = hdr.Set(jws.KeyIDKey, j.kid)
+	return jwt.WithKey(j.alg, j.signer, jws.WithProtectedHeaders(hdr))
+}
+
+// JWTのヘッダーのkidで検証に使う公開鍵を選ぶ
+// kidを付ける前に発行されたトークンも検証できるように、kidがない場合は全ての鍵で検証を試す
+func (j *JwtBuilder) verifyKeys() jwt.ParseOption {
+	return jwt.WithKeySet(j.publicKeys, jws.WithRequireKid(false))
+}
+
+// トークンを個別に失効させられるように、全てのトークンに付与するjti
+func newJwtID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create jti: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // JWTを作成する
-func (j *JwtBuilder) generateJWT(u *entity.User, subClaim string, exp time.Duration) ([]byte, error) {
+func (j *JwtBuilder) generateJWT(u *entity.User, subClaim, tokenType string, exp time.Duration, claims map[string]any) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		claims = map[string]any{}
+	}
+	if err := enrichClaims(j.enricher, u, tokenType, claims); err != nil {
+		return nil, err
+	}
 	// JWTを作成
-	tok, err := jwt.NewBuilder().
+	b := jwt.NewBuilder().
 		Issuer(issClaim).
-		Subject(accessSubClaim).
+		Subject(subClaim).
+		JwtID(jti).
 		IssuedAt(time.Now()).
 		Expiration(time.Now().Add(exp)).
+		Claim(tokenTypeClaim, tokenType).
 		Claim(userIDClaim, u.ID).
-		Build()
+		Claim(roleClaim, u.Role).
+		Claim(tokenVersionClaim, u.TokenVersion)
+	if Audience != "" {
+		b = b.Audience([]string{Audience})
+	}
+	for k, v := range claims {
+		b = b.Claim(k, v)
+	}
+	tok, err := b.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to jwt build: %w", err)
 	}
 
 	// JWTを秘密鍵で署名化
-	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, j.secretKey))
+	signed, err := j.sign(tok)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign: %w", err)
 	}
@@ -100,6 +413,24 @@ func (j *JwtBuilder) SetAuthToContext(c echo.Context) error {
 		return err
 	}
 
+	// リフレッシュトークンなどをアクセストークンとして使えないように、subとtoken_typeを確認する
+	typ, _ := tok.Get(tokenTypeClaim)
+	switch {
+	case typ == AccessTokenType && tok.Subject() == accessSubClaim:
+	case typ == ClientTokenType && tok.Subject() == clientSubClaim:
+		id, _ := tok.Get(clientIDClaim)
+		clientID, ok := id.(string)
+		if !ok || clientID == "" {
+			return fmt.Errorf("get invalid client_id: %v, %T", id, id)
+		}
+		s, _ := tok.Get(scopeClaim)
+		scope, _ := s.(string)
+		setClientContext(c, clientID, scope, tok.JwtID(), tok.Expiration())
+		return nil
+	default:
+		return fmt.Errorf("failed to parse request: unexpected token: sub=%q, token_type=%v", tok.Subject(), typ)
+	}
+
 	// JWTからuser_idを取得する
 	// idの型はtokenから取得した段階ではfloat64
 	id, ok := tok.Get(userIDClaim)
@@ -111,13 +442,49 @@ func (j *JwtBuilder) SetAuthToContext(c echo.Context) error {
 		return fmt.Errorf("get invalid user_id: %v, %T", id, id)
 	}
 
-	// ContextにUserIDをセットする
-	c.Set(userIDContextKey, entity.UserID(uid))
+	// JWTからroleを取得する
+	r, ok := tok.Get(roleClaim)
+	if !ok {
+		return errors.New("failed to get role from token")
+	}
+	role, ok := r.(string)
+	if !ok {
+		return fmt.Errorf("get invalid role: %v, %T", r, r)
+	}
+
+	s, _ := tok.Get(scopeClaim)
+	scope, _ := s.(string)
 
+	setAuthContext(c, entity.UserID(uid), entity.UserRole(role), scope, tok.JwtID(), tok.Expiration())
+	// token_versionを付ける前に発行されたトークンは0として扱う。型はuser_idと同じくfloat64
+	v, _ := tok.Get(tokenVersionClaim)
+	tv, _ := v.(float64)
+	c.Set(tokenVersionContextKey, int(tv))
+	// 組織のトークンの場合のみ。orgの型はuser_idと同じくfloat64
+	if org, ok := tok.Get(orgIDClaim); ok {
+		oid, ok := org.(float64)
+		if !ok {
+			return fmt.Errorf("get invalid org: %v, %T", org, org)
+		}
+		c.Set(orgIDContextKey, entity.OrganizationID(oid))
+	}
 	return nil
 }
 
+// ContextにUserIDとroleをセットする
+func setAuthContext(c echo.Context, uid entity.UserID, role entity.UserRole, scope, jti string, exp time.Time) {
+	c.Set(userIDContextKey, uid)
+	c.Set(roleContextKey, role)
+	c.Set(scopeContextKey, parseScope(scope, role))
+	// トークンを失効させる時のために、jtiと有効期限もセットする
+	c.Set(jwtIDContextKey, jti)
+	c.Set(expContextKey, exp)
+}
+
 func GetUserIDFromEchoCtx(c echo.Context) (entity.UserID, error) {
+	if _, ok := GetClientIDFromEchoCtx(c); ok {
+		return 0, ErrNoUser
+	}
 	got := c.Get(userIDContextKey)
 	uid, ok := got.(entity.UserID)
 	if !ok {
@@ -127,27 +494,90 @@ func GetUserIDFromEchoCtx(c echo.Context) (entity.UserID, error) {
 	return uid, nil
 }
 
+// リクエストのアクセストークンのjtiと有効期限。jtiを付ける前に発行されたトークンの場合は空になる
+func GetJwtIDFromEchoCtx(c echo.Context) (string, time.Time) {
+	jti, _ := c.Get(jwtIDContextKey).(string)
+	exp, _ := c.Get(expContextKey).(time.Time)
+	return jti, exp
+}
+
+// リクエストのアクセストークンのtoken_version。パーソナルアクセストークンなど、バージョンを持たない場合はfalseを返す
+func GetTokenVersionFromEchoCtx(c echo.Context) (int, bool) {
+	v, ok := c.Get(tokenVersionContextKey).(int)
+	return v, ok
+}
+
+// リクエストのアクセストークンのscope
+func GetScopesFromEchoCtx(c echo.Context) []string {
+	scopes, _ := c.Get(scopeContextKey).([]string)
+	return scopes
+}
+
+// scopeを付ける前に発行されたトークンの場合は、roleのscopeを使う
+func parseScope(scope string, role entity.UserRole) []string {
+	if scope == "" {
+		return role.Scopes()
+	}
+	return strings.Fields(scope)
+}
+
+func GetRoleFromEchoCtx(c echo.Context) (entity.UserRole, error) {
+	got := c.Get(roleContextKey)
+	role, ok := got.(entity.UserRole)
+	if !ok {
+		return "", fmt.Errorf("get invalid role: %v, %T", got, got)
+	}
+
+	return role, nil
+}
+
 // リクエストからJWTの取得し、検証を行う
 func (j *JwtBuilder) parseRequest(r *http.Request) (jwt.Token, error) {
 	// AuthorizationヘッダーからJWTを取得
-	// 公開鍵を用いてjwtを検証、issとsubも検証する
-	tok, err := jwt.ParseRequest(r,
-		jwt.WithKey(jwa.RS256, j.publicKey),
+	// 公開鍵を用いてjwtを検証、issも検証する。ユーザーとクライアントのトークンがあるので、subとtoken_typeは呼び出し側で検証する
+	opts := withAudience(
+		j.verifyKeys(),
 		jwt.WithIssuer(issClaim),
-		jwt.WithSubject(accessSubClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
 	)
+	// 暗号化したトークンも扱えるように、Authorizationヘッダーから取り出してから検証する
+	token, ok := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return nil, errors.New("failed to parse request: bearer token not found")
+	}
+	tok, err := j.parse([]byte(strings.TrimSpace(token)), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse request: %w", err)
 	}
 	return tok, nil
 }
 
+// 鍵を共有する他のサービス向けに発行されたトークンを受け付けないように、audの検証を加える
+// マジックリンク用のトークンにはaudを付けないので使わない
+func withAudience(opts ...jwt.ParseOption) []jwt.ParseOption {
+	if Audience != "" {
+		opts = append(opts, jwt.WithAudience(Audience))
+	}
+	return opts
+}
+
 func (j *JwtBuilder) GenerateAccessToken(u *entity.User) ([]byte, error) {
-	return j.generateJWT(u, accessSubClaim, expAccess)
+	return j.GenerateScopedAccessToken(u, u.Role.Scopes())
 }
 
-func (j *JwtBuilder) GenerateRefreshToken(u *entity.User) ([]byte, error) {
-	return j.generateJWT(u, refreshSubClaim, expRefresh)
+// roleのscopeではなく、指定したscopeのアクセストークンを作成する。OpenID ConnectのRPに発行する場合に使う
+func (j *JwtBuilder) GenerateScopedAccessToken(u *entity.User, scopes []string) ([]byte, error) {
+	return j.generateJWT(u, accessSubClaim, AccessTokenType, AccessTokenTTL, map[string]any{
+		scopeClaim: strings.Join(scopes, " "),
+	})
+}
+
+// リフレッシュトークンを作成する。どのセッションのトークンかを判別できるようにsidを付与する
+// 有効期限はセッションの有効期限に合わせる
+func (j *JwtBuilder) GenerateRefreshToken(u *entity.User, s *entity.Session) ([]byte, error) {
+	return j.generateJWT(u, refreshSubClaim, RefreshTokenType, time.Until(s.ExpiresAt), map[string]any{
+		sessionIDClaim: s.ID,
+	})
 }
 
 func (j *JwtBuilder) GetUserIDFromJWT(token []byte) (entity.UserID, error) {
@@ -166,13 +596,154 @@ func (j *JwtBuilder) GetUserIDFromJWT(token []byte) (entity.UserID, error) {
 	return entity.UserID(uid), nil
 }
 
+// リフレッシュトークンを検証して、user_idと発行日時を取得する
+func (j *JwtBuilder) ParseRefreshToken(token []byte) (*RefreshToken, error) {
+	tok, err := j.parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+	s, ok := tok.Get(sessionIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get sid from token")
+	}
+	sid, ok := s.(string)
+	if !ok {
+		return nil, fmt.Errorf("get invalid sid: %v, %T", s, s)
+	}
+	return &RefreshToken{
+		UserID:    entity.UserID(uid),
+		SessionID: entity.SessionID(sid),
+		IssuedAt:  tok.IssuedAt(),
+	}, nil
+}
+
+// リフレッシュトークンを検証する。アクセストークンを/refreshに使えないように、subとtoken_typeを確認する
 func (j *JwtBuilder) parseJWT(token []byte) (jwt.Token, error) {
-	tok, err := jwt.Parse(token,
-		jwt.WithKey(jwa.RS256, j.publicKey),
+	tok, err := j.parse(token, withAudience(
+		j.verifyKeys(),
 		jwt.WithIssuer(issClaim),
-		jwt.WithSubject(refreshSubClaim))
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(refreshSubClaim),
+		jwt.WithClaimValue(tokenTypeClaim, RefreshTokenType))...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 	return tok, err
-}
\ No newline at end of file
+}
+
+// マジックリンク用のトークンを作成する。一度だけ使えるようにjtiを付与する
+func (j *JwtBuilder) GenerateMagicToken(u *entity.User) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(magicSubClaim).
+		JwtID(jti).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(MagicTokenTTL)).
+		Claim(userIDClaim, u.ID).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseMagicToken(token []byte) (*MagicToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(magicSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if tok.JwtID() == "" {
+		return nil, errors.New("failed to get jti from token")
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+
+	return &MagicToken{
+		UserID:     entity.UserID(uid),
+		JwtID:      tok.JwtID(),
+		Expiration: tok.Expiration(),
+	}, nil
+}
+
+// アクセストークンかリフレッシュトークンを検証して、中身を取得する。どちらの種類かはtoken_typeで判断する
+// 失効しているかどうかは確認しないので、呼び出し側でユーザーやセッションの状態を確認する
+func (j *JwtBuilder) ParseToken(token []byte) (*TokenInfo, error) {
+	tok, err := j.parse(token, withAudience(
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	info := &TokenInfo{
+		JwtID:      tok.JwtID(),
+		IssuedAt:   tok.IssuedAt(),
+		Expiration: tok.Expiration(),
+	}
+	typ, _ := tok.Get(tokenTypeClaim)
+	switch {
+	case typ == AccessTokenType && tok.Subject() == accessSubClaim:
+		info.Type = AccessTokenType
+	case typ == RefreshTokenType && tok.Subject() == refreshSubClaim:
+		info.Type = RefreshTokenType
+		s, _ := tok.Get(sessionIDClaim)
+		sid, ok := s.(string)
+		if !ok {
+			return nil, fmt.Errorf("get invalid sid: %v, %T", s, s)
+		}
+		info.SessionID = entity.SessionID(sid)
+	default:
+		// マジックリンクなど、他の用途のトークンは扱わない
+		return nil, fmt.Errorf("unsupported token: sub=%q, token_type=%v", tok.Subject(), typ)
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+	info.UserID = entity.UserID(uid)
+	r, _ := tok.Get(roleClaim)
+	role, ok := r.(string)
+	if !ok {
+		return nil, fmt.Errorf("get invalid role: %v, %T", r, r)
+	}
+	info.Role = entity.UserRole(role)
+	s, _ := tok.Get(scopeClaim)
+	scope, _ := s.(string)
+	info.Scopes = parseScope(scope, info.Role)
+	return info, nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"login-example/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newTestJwtBuilder(t *testing.T) *JwtBuilder {
+	t.Helper()
+	j, err := NewJwtBuilderWithSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// Authorizationヘッダーにトークンを付けて、SetAuthToContextを呼ぶ
+func setAuth(j *JwtBuilder, token []byte) (echo.Context, error) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+string(token))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	return c, j.SetAuthToContext(c)
+}
+
+func testUser() *entity.User {
+	return &entity.User{ID: 100001, Email: "user@example.com", Role: entity.RoleUser}
+}
+
+func TestSetAuthToContext_AccessToken(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	tok, err := j.GenerateAccessToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := setAuth(j, tok)
+	if err != nil {
+		t.Fatalf("SetAuthToContext() error = %v", err)
+	}
+	uid, err := GetUserIDFromEchoCtx(c)
+	if err != nil || uid != 100001 {
+		t.Errorf("GetUserIDFromEchoCtx() = %v, %v, want 100001", uid, err)
+	}
+}
+
+func TestSetAuthToContext_RejectsRefreshToken(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	tok, err := j.GenerateRefreshToken(testUser(), &entity.Session{ID: "sid", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := setAuth(j, tok); err == nil {
+		t.Error("SetAuthToContext() accepted a refresh token")
+	}
+}
+
+func TestParseRefreshToken(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	tok, err := j.GenerateRefreshToken(testUser(), &entity.Session{ID: "sid", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := j.ParseRefreshToken(tok)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken() error = %v", err)
+	}
+	if rt.UserID != 100001 || rt.SessionID != "sid" {
+		t.Errorf("ParseRefreshToken() = %+v", rt)
+	}
+}
+
+func TestParseRefreshToken_RejectsAccessToken(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	tok, err := j.GenerateAccessToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.ParseRefreshToken(tok); err == nil {
+		t.Error("ParseRefreshToken() accepted an access token")
+	}
+}
+
+// 鍵を共有する他のサービス向けのトークンは、署名が正しくても受け付けない
+func TestAudienceMismatch(t *testing.T) {
+	orig := Audience
+	t.Cleanup(func() { Audience = orig })
+
+	j := newTestJwtBuilder(t)
+	Audience = "other-service"
+	access, err := j.GenerateAccessToken(testUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := j.GenerateRefreshToken(testUser(), &entity.Session{ID: "sid", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Audience = "login-example"
+	if _, err := setAuth(j, access); err == nil {
+		t.Error("SetAuthToContext() accepted a token for another audience")
+	}
+	if _, err := j.ParseRefreshToken(refresh); err == nil {
+		t.Error("ParseRefreshToken() accepted a token for another audience")
+	}
+}
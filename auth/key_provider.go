@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+// JWTの署名と検証に使うPEM形式の鍵
+type KeyMaterial struct {
+	SecretKey []byte
+	// 空の場合はSecretKeyから作る
+	PublicKey []byte
+	// 検証にだけ使う公開鍵。鍵の入れ替え中に使う
+	VerifyKeys [][]byte
+}
+
+// 鍵を取得する。Secrets ManagerやVaultなど、ファイルや環境変数以外から鍵を取得する場合に実装する
+type IKeyProvider interface {
+	LoadKeys(ctx context.Context) (*KeyMaterial, error)
+}
+
+// JwtBuilderの鍵の設定。Signer、Provider、PEM、ファイルのパスの順に優先する
+type KeyConfig struct {
+	// RS256, ES256, EdDSA, HS256
+	Algorithm string
+	// HS256の場合の共有の秘密鍵
+	HMACSecret string
+	// 環境変数などで渡すPEM形式の鍵
+	SecretKeyPEM string
+	PublicKeyPEM string
+	// PEM形式の鍵のファイルのパス
+	SecretKeyPath        string
+	PublicKeyPath        string
+	VerifyPublicKeyPaths []string
+	Provider             IKeyProvider
+	// KMSなどで署名する場合に設定する。秘密鍵は読み込まず、公開鍵はSignerから作る
+	Signer crypto.Signer
+	// 設定されている場合は、署名したJWTをこの鍵でJWEに暗号化する。32バイト
+	EncryptionKey []byte
+}
+
+// 設定に合わせて鍵を読み込んで、JwtBuilderを作成する
+func NewJwtBuilderFromConfig(ctx context.Context, cfg KeyConfig) (*JwtBuilder, error) {
+	j, err := loadJwtBuilder(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.EncryptionKey) > 0 {
+		if err := j.EnableEncryption(cfg.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// 署名と検証に使う鍵を読み込む
+func loadJwtBuilder(ctx context.Context, cfg KeyConfig) (*JwtBuilder, error) {
+	alg := jwa.SignatureAlgorithm(cfg.Algorithm)
+	if alg == jwa.HS256 {
+		return NewJwtBuilderWithSecret([]byte(cfg.HMACSecret))
+	}
+	if cfg.Signer != nil {
+		vks, err := readVerifyKeys(cfg.VerifyPublicKeyPaths)
+		if err != nil {
+			return nil, err
+		}
+		return NewJwtBuilderWithSigner(alg, cfg.Signer, vks...)
+	}
+
+	p := cfg.Provider
+	if p == nil {
+		p = &configKeyProvider{cfg: cfg}
+	}
+	km, err := p.LoadKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwt keys: %w", err)
+	}
+	return NewJwtBuilderWithKeys(alg, km.SecretKey, km.PublicKey, km.VerifyKeys...)
+}
+
+// KeyConfigのPEMかファイルから鍵を読み込む
+type configKeyProvider struct {
+	cfg KeyConfig
+}
+
+func (p *configKeyProvider) LoadKeys(ctx context.Context) (*KeyMaterial, error) {
+	km := &KeyMaterial{}
+	switch {
+	case p.cfg.SecretKeyPEM != "":
+		km.SecretKey = []byte(p.cfg.SecretKeyPEM)
+		km.PublicKey = []byte(p.cfg.PublicKeyPEM)
+	case p.cfg.SecretKeyPath != "":
+		b, err := os.ReadFile(p.cfg.SecretKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret key: %w", err)
+		}
+		km.SecretKey = b
+		if p.cfg.PublicKeyPath != "" {
+			if km.PublicKey, err = os.ReadFile(p.cfg.PublicKeyPath); err != nil {
+				return nil, fmt.Errorf("failed to read public key: %w", err)
+			}
+		}
+	default:
+		return nil, errors.New("no secret key configured")
+	}
+
+	vks, err := readVerifyKeys(p.cfg.VerifyPublicKeyPaths)
+	if err != nil {
+		return nil, err
+	}
+	km.VerifyKeys = vks
+	return km, nil
+}
+
+// 検証にだけ使う公開鍵のファイルを読み込む
+func readVerifyKeys(paths []string) ([][]byte, error) {
+	var vks [][]byte
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read verify public key: %w", err)
+		}
+		vks = append(vks, b)
+	}
+	return vks, nil
+}
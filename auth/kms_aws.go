@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+type AWSKMSConfig struct {
+	// 空の場合はAWS_REGIONなど、AWS SDKのデフォルトの設定を使う
+	Region string
+	// 鍵のID、ARN、またはエイリアス(alias/xxx)。鍵の仕様はRSA_2048以上かECC_NIST_P256、用途はSIGN_VERIFYにする
+	KeyID string
+}
+
+// AWS KMSの非対称鍵で署名するcrypto.Signerを作成する。秘密鍵はKMSの外に出ない
+// 公開鍵は作成時に一度だけ取得する。認証情報はAWS SDKのデフォルトの方法で取得する
+func NewAWSKMSSigner(ctx context.Context, cfg AWSKMSConfig) (crypto.Signer, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	client := kms.NewFromConfig(awsCfg)
+
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(cfg.KeyID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from aws kms: %w", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	var alg types.SigningAlgorithmSpec
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		alg = types.SigningAlgorithmSpecRsassaPkcs1V15Sha256
+	case *ecdsa.PublicKey:
+		alg = types.SigningAlgorithmSpecEcdsaSha256
+	default:
+		return nil, fmt.Errorf("unsupported aws kms key type: %T", pub)
+	}
+	return &awsKMSSigner{client: client, keyID: cfg.KeyID, pub: pub, alg: alg}, nil
+}
+
+type awsKMSSigner struct {
+	client *kms.Client
+	keyID  string
+	pub    crypto.PublicKey
+	alg    types.SigningAlgorithmSpec
+}
+
+func (s *awsKMSSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// jwxが計算したSHA-256のダイジェストに署名する。ECDSAの署名はASN.1形式で返り、jwxがJWSの形式に変換する
+func (s *awsKMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash: %v", opts.HashFunc())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kmsSignTimeout)
+	defer cancel()
+
+	out, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(s.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: s.alg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with aws kms: %w", err)
+	}
+	return out.Signature, nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+// KMSで署名する時のタイムアウト。crypto.Signerはcontextを受け取らないので、署名ごとに設定する
+var kmsSignTimeout = 5 * time.Second
+
+type GCPKMSConfig struct {
+	// 鍵のバージョンのリソース名
+	// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>
+	// 鍵のアルゴリズムはRSA_SIGN_PKCS1_2048_SHA256などのPKCS#1 v1.5かEC_SIGN_P256_SHA256にする
+	KeyName string
+}
+
+// Cloud KMSの非対称鍵で署名するcrypto.Signerを作成する。秘密鍵はKMSの外に出ない
+// 公開鍵は作成時に一度だけ取得する。認証情報はApplication Default Credentialsで取得する
+func NewGCPKMSSigner(ctx context.Context, cfg GCPKMSConfig) (crypto.Signer, error) {
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cloud kms client: %w", err)
+	}
+
+	res, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: cfg.KeyName})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to get public key from cloud kms: %w", err)
+	}
+	block, _ := pem.Decode([]byte(res.Pem))
+	if block == nil {
+		client.Close()
+		return nil, errors.New("failed to decode public key pem")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return &gcpKMSSigner{client: client, keyName: cfg.KeyName, pub: pub}, nil
+}
+
+type gcpKMSSigner struct {
+	client  *kms.KeyManagementClient
+	keyName string
+	pub     crypto.PublicKey
+}
+
+func (s *gcpKMSSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// jwxが計算したSHA-256のダイジェストに署名する。ECDSAの署名はASN.1形式で返り、jwxがJWSの形式に変換する
+func (s *gcpKMSSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash: %v", opts.HashFunc())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kmsSignTimeout)
+	defer cancel()
+
+	res, err := s.client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name:   s.keyName,
+		Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with cloud kms: %w", err)
+	}
+	return res.Signature, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	loginAlertSubClaim = "login-alert"
+	loginIDClaim       = "login_id"
+)
+
+// ログイン通知の「心当たりがない」リンクの有効期限
+var expLoginAlert = 7 * 24 * time.Hour
+
+// ログイン通知のリンクに埋め込むトークンの中身
+type LoginAlertToken struct {
+	UserID  entity.UserID
+	LoginID entity.LoginHistoryID
+}
+
+// ログイン通知の「心当たりがない」リンク用のトークンを作成する
+func (j *JwtBuilder) GenerateLoginAlertToken(h *entity.LoginHistory) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(loginAlertSubClaim).
+		JwtID(jti).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(expLoginAlert)).
+		Claim(userIDClaim, h.UserID).
+		Claim(loginIDClaim, h.ID).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseLoginAlertToken(token []byte) (*LoginAlertToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(loginAlertSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+
+	id, ok = tok.Get(loginIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get login_id from token")
+	}
+	lid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid login_id: %v, %T", id, id)
+	}
+
+	return &LoginAlertToken{
+		UserID:  entity.UserID(uid),
+		LoginID: entity.LoginHistoryID(lid),
+	}, nil
+}
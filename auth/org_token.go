@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"login-example/entity"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 組織のアクセストークン。通常のアクセストークンに、どの組織として操作するかを表すorgを付与する
+const (
+	orgIDClaim      = "org"
+	orgIDContextKey = "org"
+)
+
+// 組織のアクセストークンを作成する。scopeはユーザーのroleのscope
+// 組織から外されたユーザーのトークンは、組織のAPIでメンバーかどうかを確認して拒否する
+func (j *JwtBuilder) GenerateOrgAccessToken(u *entity.User, orgID entity.OrganizationID) ([]byte, error) {
+	return j.generateJWT(u, accessSubClaim, AccessTokenType, AccessTokenTTL, map[string]any{
+		scopeClaim: strings.Join(u.Role.Scopes(), " "),
+		orgIDClaim: orgID,
+	})
+}
+
+func (p *PasetoBuilder) GenerateOrgAccessToken(u *entity.User, orgID entity.OrganizationID) ([]byte, error) {
+	return p.generateToken(u, accessSubClaim, AccessTokenType, AccessTokenTTL, map[string]any{
+		scopeClaim: strings.Join(u.Role.Scopes(), " "),
+		orgIDClaim: orgID,
+	})
+}
+
+// リクエストのアクセストークンが組織のトークンの場合は、組織のIDを返す
+func GetOrgIDFromEchoCtx(c echo.Context) (entity.OrganizationID, bool) {
+	id, ok := c.Get(orgIDContextKey).(entity.OrganizationID)
+	return id, ok
+}
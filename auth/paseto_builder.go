@@ -0,0 +1,484 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"strings"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/labstack/echo/v4"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// PASETOのpurpose
+const (
+	// 共通鍵(XChaCha20 + BLAKE2b)で暗号化する。クライアントからは中身を読めない
+	PasetoLocal = "local"
+	// Ed25519で署名する
+	PasetoPublic = "public"
+)
+
+// IJwtBuilderのPASETO(v4)の実装
+// アルゴリズムがバージョンとpurposeで固定されていて、トークンのヘッダーで選べないので、JWTのalgの取り違えが起きない
+// クレームはJWTと同じ名前で、検証する内容も同じ
+type PasetoBuilder struct {
+	purpose   string
+	localKey  paseto.V4SymmetricKey
+	secretKey paseto.V4AsymmetricSecretKey
+	publicKey paseto.V4AsymmetricPublicKey
+	enricher  ClaimsEnricher
+}
+
+// purposeがlocalの場合はkeyは32バイトの共通鍵、publicの場合はEd25519の秘密鍵(64バイト)を16進数で渡す
+func NewPasetoBuilder(purpose, key string) (*PasetoBuilder, error) {
+	p := &PasetoBuilder{purpose: purpose}
+	switch purpose {
+	case PasetoLocal:
+		k, err := paseto.V4SymmetricKeyFromHex(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse paseto local key: %w", err)
+		}
+		p.localKey = k
+	case PasetoPublic:
+		k, err := paseto.NewV4AsymmetricSecretKeyFromHex(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse paseto secret key: %w", err)
+		}
+		p.secretKey = k
+		p.publicKey = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported paseto purpose: %q", purpose)
+	}
+	return p, nil
+}
+
+// 鍵は作成時に読み込み済みなので、常に作成・検証できる
+func (p *PasetoBuilder) Check(ctx context.Context) error {
+	return nil
+}
+
+// PASETOの鍵はJWKSでは公開しないので、空のセットを返す
+func (p *PasetoBuilder) PublicKeySet() (jwk.Set, error) {
+	return jwk.NewSet(), nil
+}
+
+// 全てのトークンに共通のクレームを設定したトークン
+func newPasetoToken(subClaim string, exp time.Time) (paseto.Token, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return paseto.Token{}, err
+	}
+	tok := paseto.NewToken()
+	tok.SetIssuer(issClaim)
+	tok.SetSubject(subClaim)
+	tok.SetJti(jti)
+	tok.SetIssuedAt(time.Now())
+	tok.SetNotBefore(time.Now())
+	tok.SetExpiration(exp)
+	return tok, nil
+}
+
+func (p *PasetoBuilder) seal(tok paseto.Token) []byte {
+	if p.purpose == PasetoLocal {
+		return []byte(tok.V4Encrypt(p.localKey, nil))
+	}
+	return []byte(tok.V4Sign(p.secretKey, nil))
+}
+
+// トークンを検証する。iss、expは常に検証し、rulesで用途ごとのクレームを検証する
+func (p *PasetoBuilder) open(token []byte, rules ...paseto.Rule) (*paseto.Token, error) {
+	// ClockSkewを許容するために、デフォルトのexpの検証は使わない
+	parser := paseto.NewParserWithoutExpiryCheck()
+	parser.AddRule(paseto.IssuedBy(issClaim), notExpired(ClockSkew))
+	parser.AddRule(rules...)
+
+	var tok *paseto.Token
+	var err error
+	if p.purpose == PasetoLocal {
+		tok, err = parser.ParseV4Local(p.localKey, string(token), nil)
+	} else {
+		tok, err = parser.ParseV4Public(p.publicKey, string(token), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	return tok, nil
+}
+
+// 有効期限を過ぎていないか。skewだけ時計のずれを許容する
+func notExpired(skew time.Duration) paseto.Rule {
+	return func(tok paseto.Token) error {
+		exp, err := tok.GetExpiration()
+		if err != nil {
+			return err
+		}
+		if time.Now().After(exp.Add(skew)) {
+			return errors.New("token has expired")
+		}
+		return nil
+	}
+}
+
+// 文字列のクレームが期待する値か。token_typeの検証に使う
+func claimEquals(key, want string) paseto.Rule {
+	return func(tok paseto.Token) error {
+		got, err := tok.GetString(key)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("invalid %s: %q", key, got)
+		}
+		return nil
+	}
+}
+
+// アクセストークンかリフレッシュトークンを作成する
+func (p *PasetoBuilder) generateToken(u *entity.User, subClaim, tokenType string, exp time.Duration, claims map[string]any) ([]byte, error) {
+	tok, err := newPasetoToken(subClaim, time.Now().Add(exp))
+	if err != nil {
+		return nil, err
+	}
+	if err := enrichClaims(p.enricher, u, tokenType, claims); err != nil {
+		return nil, err
+	}
+	tok.SetString(tokenTypeClaim, tokenType)
+	if Audience != "" {
+		tok.SetAudience(Audience)
+	}
+	claims[userIDClaim] = u.ID
+	claims[roleClaim] = u.Role
+	claims[tokenVersionClaim] = u.TokenVersion
+	for k, v := range claims {
+		if err := tok.Set(k, v); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", k, err)
+		}
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateAccessToken(u *entity.User) ([]byte, error) {
+	return p.GenerateScopedAccessToken(u, u.Role.Scopes())
+}
+
+func (p *PasetoBuilder) GenerateScopedAccessToken(u *entity.User, scopes []string) ([]byte, error) {
+	return p.generateToken(u, accessSubClaim, AccessTokenType, AccessTokenTTL, map[string]any{
+		scopeClaim: strings.Join(scopes, " "),
+	})
+}
+
+func (p *PasetoBuilder) GenerateRefreshToken(u *entity.User, s *entity.Session) ([]byte, error) {
+	return p.generateToken(u, refreshSubClaim, RefreshTokenType, time.Until(s.ExpiresAt), map[string]any{
+		sessionIDClaim: s.ID,
+	})
+}
+
+func (p *PasetoBuilder) GenerateMagicToken(u *entity.User) ([]byte, error) {
+	tok, err := newPasetoToken(magicSubClaim, time.Now().Add(MagicTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.Set(userIDClaim, u.ID); err != nil {
+		return nil, fmt.Errorf("failed to set user_id: %w", err)
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateExportToken(e *entity.DataExport) ([]byte, error) {
+	tok, err := newPasetoToken(exportSubClaim, time.Now().Add(expExport))
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.Set(userIDClaim, e.UserID); err != nil {
+		return nil, fmt.Errorf("failed to set user_id: %w", err)
+	}
+	if err := tok.Set(exportIDClaim, e.ID); err != nil {
+		return nil, fmt.Errorf("failed to set export_id: %w", err)
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateLoginAlertToken(h *entity.LoginHistory) ([]byte, error) {
+	tok, err := newPasetoToken(loginAlertSubClaim, time.Now().Add(expLoginAlert))
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.Set(userIDClaim, h.UserID); err != nil {
+		return nil, fmt.Errorf("failed to set user_id: %w", err)
+	}
+	if err := tok.Set(loginIDClaim, h.ID); err != nil {
+		return nil, fmt.Errorf("failed to set login_id: %w", err)
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateDeviceToken(d *entity.TrustedDevice) ([]byte, error) {
+	tok, err := newPasetoToken(deviceSubClaim, d.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.Set(userIDClaim, d.UserID); err != nil {
+		return nil, fmt.Errorf("failed to set user_id: %w", err)
+	}
+	if err := tok.Set(deviceIDClaim, d.ID); err != nil {
+		return nil, fmt.Errorf("failed to set device_id: %w", err)
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateActivateToken(email, token string, expiration time.Time) ([]byte, error) {
+	tok, err := newPasetoToken(activateSubClaim, expiration)
+	if err != nil {
+		return nil, err
+	}
+	tok.SetString(emailClaim, email)
+	tok.SetString(activateTokenClaim, token)
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateSudoToken(u *entity.User) ([]byte, error) {
+	now := time.Now()
+	tok, err := newPasetoToken(sudoSubClaim, now.Add(SudoTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	if err := tok.Set(userIDClaim, u.ID); err != nil {
+		return nil, fmt.Errorf("failed to set user_id: %w", err)
+	}
+	if err := tok.Set(authTimeClaim, now.Unix()); err != nil {
+		return nil, fmt.Errorf("failed to set auth_time: %w", err)
+	}
+	return p.seal(tok), nil
+}
+
+func (p *PasetoBuilder) GenerateClientToken(clientID string, scopes []string) ([]byte, error) {
+	tok, err := newPasetoToken(clientSubClaim, time.Now().Add(AccessTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	tok.SetString(tokenTypeClaim, ClientTokenType)
+	tok.SetString(clientIDClaim, clientID)
+	tok.SetString(scopeClaim, strings.Join(scopes, " "))
+	if Audience != "" {
+		tok.SetAudience(Audience)
+	}
+	return p.seal(tok), nil
+}
+
+// IDトークンはRPがJWTとして検証するので、PASETOでは発行できない
+func (p *PasetoBuilder) GenerateIDToken(u *entity.User, clientID, nonce string, scopes []string) ([]byte, error) {
+	return nil, ErrIDTokenUnsupported
+}
+
+// contextに認証情報をセットする
+func (p *PasetoBuilder) SetAuthToContext(c echo.Context) error {
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return errors.New("failed to parse request: bearer token not found")
+	}
+	var rules []paseto.Rule
+	if Audience != "" {
+		rules = append(rules, paseto.ForAudience(Audience))
+	}
+	tok, err := p.open([]byte(strings.TrimSpace(token)), rules...)
+	if err != nil {
+		return fmt.Errorf("failed to parse request: %w", err)
+	}
+
+	// リフレッシュトークンなどをアクセストークンとして使えないように、subとtoken_typeを確認する
+	typ, _ := tok.GetString(tokenTypeClaim)
+	sub, _ := tok.GetSubject()
+	scope, _ := tok.GetString(scopeClaim)
+	jti, _ := tok.GetJti()
+	exp, _ := tok.GetExpiration()
+	switch {
+	case typ == AccessTokenType && sub == accessSubClaim:
+	case typ == ClientTokenType && sub == clientSubClaim:
+		clientID, _ := tok.GetString(clientIDClaim)
+		if clientID == "" {
+			return errors.New("failed to get client_id from token")
+		}
+		setClientContext(c, clientID, scope, jti, exp)
+		return nil
+	default:
+		return fmt.Errorf("failed to parse request: unexpected token: sub=%q, token_type=%q", sub, typ)
+	}
+
+	var uid entity.UserID
+	if err := tok.Get(userIDClaim, &uid); err != nil {
+		return fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	var role entity.UserRole
+	if err := tok.Get(roleClaim, &role); err != nil {
+		return fmt.Errorf("failed to get role from token: %w", err)
+	}
+	setAuthContext(c, uid, role, scope, jti, exp)
+	// token_versionを付ける前に発行されたトークンは0として扱う
+	var tv int
+	_ = tok.Get(tokenVersionClaim, &tv)
+	c.Set(tokenVersionContextKey, tv)
+	// 組織のトークンの場合のみ
+	var oid entity.OrganizationID
+	if err := tok.Get(orgIDClaim, &oid); err == nil {
+		c.Set(orgIDContextKey, oid)
+	}
+	return nil
+}
+
+func (p *PasetoBuilder) GetUserIDFromJWT(token []byte) (entity.UserID, error) {
+	rt, err := p.ParseRefreshToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return rt.UserID, nil
+}
+
+// リフレッシュトークンを検証して、user_idと発行日時を取得する
+func (p *PasetoBuilder) ParseRefreshToken(token []byte) (*RefreshToken, error) {
+	tok, err := p.open(token, paseto.Subject(refreshSubClaim), claimEquals(tokenTypeClaim, RefreshTokenType))
+	if err != nil {
+		return nil, err
+	}
+	var rt RefreshToken
+	if err := tok.Get(userIDClaim, &rt.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	if err := tok.Get(sessionIDClaim, &rt.SessionID); err != nil {
+		return nil, fmt.Errorf("failed to get sid from token: %w", err)
+	}
+	rt.IssuedAt, _ = tok.GetIssuedAt()
+	return &rt, nil
+}
+
+func (p *PasetoBuilder) ParseMagicToken(token []byte) (*MagicToken, error) {
+	tok, err := p.open(token, paseto.Subject(magicSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	var mt MagicToken
+	if mt.JwtID, err = tok.GetJti(); err != nil || mt.JwtID == "" {
+		return nil, errors.New("failed to get jti from token")
+	}
+	if err := tok.Get(userIDClaim, &mt.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	mt.Expiration, _ = tok.GetExpiration()
+	return &mt, nil
+}
+
+func (p *PasetoBuilder) ParseExportToken(token []byte) (*ExportToken, error) {
+	tok, err := p.open(token, paseto.Subject(exportSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	var et ExportToken
+	if err := tok.Get(userIDClaim, &et.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	if err := tok.Get(exportIDClaim, &et.ExportID); err != nil {
+		return nil, fmt.Errorf("failed to get export_id from token: %w", err)
+	}
+	return &et, nil
+}
+
+func (p *PasetoBuilder) ParseLoginAlertToken(token []byte) (*LoginAlertToken, error) {
+	tok, err := p.open(token, paseto.Subject(loginAlertSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	var lt LoginAlertToken
+	if err := tok.Get(userIDClaim, &lt.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	if err := tok.Get(loginIDClaim, &lt.LoginID); err != nil {
+		return nil, fmt.Errorf("failed to get login_id from token: %w", err)
+	}
+	return &lt, nil
+}
+
+func (p *PasetoBuilder) ParseDeviceToken(token []byte) (*DeviceToken, error) {
+	tok, err := p.open(token, paseto.Subject(deviceSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	var dt DeviceToken
+	if err := tok.Get(userIDClaim, &dt.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	if err := tok.Get(deviceIDClaim, &dt.DeviceID); err != nil {
+		return nil, fmt.Errorf("failed to get device_id from token: %w", err)
+	}
+	return &dt, nil
+}
+
+func (p *PasetoBuilder) ParseActivateToken(token []byte) (*ActivateToken, error) {
+	tok, err := p.open(token, paseto.Subject(activateSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	email, err := tok.GetString(emailClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email from token: %w", err)
+	}
+	at, err := tok.GetString(activateTokenClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activate_token from token: %w", err)
+	}
+	return &ActivateToken{Email: email, Token: at}, nil
+}
+
+func (p *PasetoBuilder) ParseSudoToken(token []byte) (*SudoToken, error) {
+	tok, err := p.open(token, paseto.Subject(sudoSubClaim))
+	if err != nil {
+		return nil, err
+	}
+	var st SudoToken
+	if err := tok.Get(userIDClaim, &st.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	var at int64
+	if err := tok.Get(authTimeClaim, &at); err != nil {
+		return nil, fmt.Errorf("failed to get auth_time from token: %w", err)
+	}
+	st.AuthTime = time.Unix(at, 0)
+	return &st, nil
+}
+
+// アクセストークンかリフレッシュトークンを検証して、中身を取得する。どちらの種類かはtoken_typeで判断する
+func (p *PasetoBuilder) ParseToken(token []byte) (*TokenInfo, error) {
+	tok, err := p.open(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var info TokenInfo
+	typ, _ := tok.GetString(tokenTypeClaim)
+	sub, _ := tok.GetSubject()
+	switch {
+	case typ == AccessTokenType && sub == accessSubClaim:
+		info.Type = AccessTokenType
+	case typ == RefreshTokenType && sub == refreshSubClaim:
+		info.Type = RefreshTokenType
+		if err := tok.Get(sessionIDClaim, &info.SessionID); err != nil {
+			return nil, fmt.Errorf("failed to get sid from token: %w", err)
+		}
+	default:
+		// マジックリンクなど、他の用途のトークンは扱わない
+		return nil, fmt.Errorf("unsupported token: sub=%q, token_type=%q", sub, typ)
+	}
+	if err := tok.Get(userIDClaim, &info.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get user_id from token: %w", err)
+	}
+	if err := tok.Get(roleClaim, &info.Role); err != nil {
+		return nil, fmt.Errorf("failed to get role from token: %w", err)
+	}
+	scope, _ := tok.GetString(scopeClaim)
+	info.Scopes = parseScope(scope, info.Role)
+	info.JwtID, _ = tok.GetJti()
+	info.IssuedAt, _ = tok.GetIssuedAt()
+	info.Expiration, _ = tok.GetExpiration()
+	return &info, nil
+}
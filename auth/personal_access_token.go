@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// パーソナルアクセストークンの接頭辞。JWTと区別し、漏洩したトークンをシークレットスキャンで見つけやすくする
+const PersonalAccessTokenPrefix = "lxp_"
+
+// TokenInfo.Typeの値
+const PersonalAccessTokenType = "personal_access"
+
+// パーソナルアクセストークンを検証して、ユーザーとscopeを返す。失効や期限切れの場合はエラーを返す
+type IPersonalAccessTokenVerifier interface {
+	VerifyPersonalAccessToken(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+type personalAccessTokenParser struct {
+	IJwtParser
+	v IPersonalAccessTokenVerifier
+}
+
+// AuthMiddlewareでパーソナルアクセストークンも受け付けるIJwtParser
+// AuthorizationヘッダーのトークンがPersonalAccessTokenPrefixで始まる場合はvで検証し、それ以外はpでJWTとして検証する
+func WithPersonalAccessTokens(p IJwtParser, v IPersonalAccessTokenVerifier) IJwtParser {
+	return &personalAccessTokenParser{IJwtParser: p, v: v}
+}
+
+func (p *personalAccessTokenParser) SetAuthToContext(c echo.Context) error {
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return p.IJwtParser.SetAuthToContext(c)
+	}
+
+	info, err := p.v.VerifyPersonalAccessToken(c.Request().Context(), token)
+	if err != nil {
+		return fmt.Errorf("failed to verify personal access token: %w", err)
+	}
+	// jtiがないので、ログアウトでは失効させられない。トークンの削除で失効させる
+	setAuthContext(c, info.UserID, info.Role, strings.Join(info.Scopes, " "), "", info.Expiration)
+	return nil
+}
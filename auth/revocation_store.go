@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 失効させたトークンを記録するストア
+// 記録はトークンやセッションの有効期限まで保持すればよいので、expを過ぎたら削除してよい
+type IRevocationStore interface {
+	// jtiのアクセストークンを失効させる
+	RevokeAccessToken(ctx context.Context, jti string, exp time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// セッションを失効させて、そのセッションのリフレッシュトークンを使えなくする
+	RevokeSession(ctx context.Context, sid entity.SessionID, exp time.Time) error
+	IsSessionRevoked(ctx context.Context, sid entity.SessionID) (bool, error)
+	// ユーザーのtoken_versionがversionより小さいアクセストークンを失効させる
+	// expにはその時点で発行済みのアクセストークンの有効期限を渡す
+	RevokeUserTokens(ctx context.Context, uid entity.UserID, version int, exp time.Time) error
+	// 有効なアクセストークンの最小のtoken_version。失効させていない場合は0を返す
+	MinTokenVersion(ctx context.Context, uid entity.UserID) (int, error)
+}
+
+type memoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// ユーザーごとの有効なアクセストークンの最小のtoken_versionと、記録の有効期限
+	versions map[entity.UserID]tokenVersion
+}
+
+type tokenVersion struct {
+	min int
+	exp time.Time
+}
+
+// 単一のサーバーで動かす場合のインメモリのストア
+func NewMemoryRevocationStore() IRevocationStore {
+	return &memoryRevocationStore{revoked: map[string]time.Time{}, versions: map[entity.UserID]tokenVersion{}}
+}
+
+func (s *memoryRevocationStore) RevokeAccessToken(ctx context.Context, jti string, exp time.Time) error {
+	s.revoke(accessTokenRevocationKey(jti), exp)
+	return nil
+}
+
+func (s *memoryRevocationStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.isRevoked(accessTokenRevocationKey(jti)), nil
+}
+
+func (s *memoryRevocationStore) RevokeSession(ctx context.Context, sid entity.SessionID, exp time.Time) error {
+	s.revoke(sessionRevocationKey(sid), exp)
+	return nil
+}
+
+func (s *memoryRevocationStore) IsSessionRevoked(ctx context.Context, sid entity.SessionID) (bool, error) {
+	return s.isRevoked(sessionRevocationKey(sid)), nil
+}
+
+func (s *memoryRevocationStore) RevokeUserTokens(ctx context.Context, uid entity.UserID, version int, exp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range s.versions {
+		if !v.exp.After(now) {
+			delete(s.versions, k)
+		}
+	}
+	s.versions[uid] = tokenVersion{min: version, exp: exp}
+	return nil
+}
+
+func (s *memoryRevocationStore) MinTokenVersion(ctx context.Context, uid entity.UserID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.versions[uid]
+	if !ok || !v.exp.After(time.Now()) {
+		return 0, nil
+	}
+	return v.min, nil
+}
+
+func (s *memoryRevocationStore) revoke(key string, exp time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 有効期限の切れた記録を掃除する
+	now := time.Now()
+	for k, v := range s.revoked {
+		if !v.After(now) {
+			delete(s.revoked, k)
+		}
+	}
+	s.revoked[key] = exp
+}
+
+func (s *memoryRevocationStore) isRevoked(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[key]
+	return ok && exp.After(time.Now())
+}
+
+type redisRevocationStore struct {
+	client *redis.Client
+}
+
+// 複数のサーバーで失効したトークンを共有する場合のRedisのストア
+func NewRedisRevocationStore(client *redis.Client) IRevocationStore {
+	return &redisRevocationStore{client: client}
+}
+
+func (s *redisRevocationStore) RevokeAccessToken(ctx context.Context, jti string, exp time.Time) error {
+	return s.revoke(ctx, accessTokenRevocationKey(jti), exp)
+}
+
+func (s *redisRevocationStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.isRevoked(ctx, accessTokenRevocationKey(jti))
+}
+
+func (s *redisRevocationStore) RevokeSession(ctx context.Context, sid entity.SessionID, exp time.Time) error {
+	return s.revoke(ctx, sessionRevocationKey(sid), exp)
+}
+
+func (s *redisRevocationStore) IsSessionRevoked(ctx context.Context, sid entity.SessionID) (bool, error) {
+	return s.isRevoked(ctx, sessionRevocationKey(sid))
+}
+
+// バージョンは楽観的ロックで1つずつ増やしているので、常に新しい値で上書きしてよい
+func (s *redisRevocationStore) RevokeUserTokens(ctx context.Context, uid entity.UserID, version int, exp time.Time) error {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, "revoked:"+userTokenVersionKey(uid), version, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *redisRevocationStore) MinTokenVersion(ctx context.Context, uid entity.UserID) (int, error) {
+	v, err := s.client.Get(ctx, "revoked:"+userTokenVersionKey(uid)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return v, nil
+}
+
+// 有効期限が切れたらRedisが自動で削除する
+func (s *redisRevocationStore) revoke(ctx context.Context, key string, exp time.Time) error {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, "revoked:"+key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke: %w", err)
+	}
+	return nil
+}
+
+func (s *redisRevocationStore) isRevoked(ctx context.Context, key string) (bool, error) {
+	n, err := s.client.Exists(ctx, "revoked:"+key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check revocation: %w", err)
+	}
+	return n > 0, nil
+}
+
+func accessTokenRevocationKey(jti string) string {
+	return "access:" + jti
+}
+
+func sessionRevocationKey(sid entity.SessionID) string {
+	return "session:" + string(sid)
+}
+
+func userTokenVersionKey(uid entity.UserID) string {
+	return fmt.Sprintf("user:%d:token_version", uid)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	sudoSubClaim = "sudo"
+	// パスワードを再入力した日時。OpenID Connectと同じく、UNIX時間の秒
+	authTimeClaim = "auth_time"
+)
+
+// パスワードを再入力してから、メールアドレスの変更などの操作を行える時間。configの値で上書きする
+var SudoTokenTTL = 5 * time.Minute
+
+// sudoトークンがない、または期限切れの場合のエラー。パスワードを再入力してもらう
+var ErrSudoRequired = errors.New("re-authentication required")
+
+// 機密性の高い操作の前に、パスワードを再入力して発行するトークンの中身
+type SudoToken struct {
+	UserID   entity.UserID
+	AuthTime time.Time
+}
+
+// sudoトークンを作成する。アクセストークンが盗まれても、パスワードを知らなければ機密性の高い操作を行えない
+func (j *JwtBuilder) GenerateSudoToken(u *entity.User) ([]byte, error) {
+	jti, err := newJwtID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tok, err := jwt.NewBuilder().
+		Issuer(issClaim).
+		Subject(sudoSubClaim).
+		JwtID(jti).
+		IssuedAt(now).
+		Expiration(now.Add(SudoTokenTTL)).
+		Claim(userIDClaim, u.ID).
+		Claim(authTimeClaim, now.Unix()).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to jwt build: %w", err)
+	}
+
+	signed, err := j.sign(tok)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signed, nil
+}
+
+func (j *JwtBuilder) ParseSudoToken(token []byte) (*SudoToken, error) {
+	tok, err := j.parse(token,
+		j.verifyKeys(),
+		jwt.WithIssuer(issClaim),
+		jwt.WithAcceptableSkew(ClockSkew),
+		jwt.WithSubject(sudoSubClaim))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	id, ok := tok.Get(userIDClaim)
+	if !ok {
+		return nil, errors.New("failed to get user_id from token")
+	}
+	uid, ok := id.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid user_id: %v, %T", id, id)
+	}
+
+	v, ok := tok.Get(authTimeClaim)
+	if !ok {
+		return nil, errors.New("failed to get auth_time from token")
+	}
+	at, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("get invalid auth_time: %v, %T", v, v)
+	}
+
+	return &SudoToken{
+		UserID:   entity.UserID(uid),
+		AuthTime: time.Unix(int64(at), 0),
+	}, nil
+}
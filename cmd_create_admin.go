@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"login-example/db"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"login-example/usecase"
+	"os"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// 本人確認済みの管理者ユーザーを作成する
+func runCreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	configPath := configFlag(fs)
+	email := fs.String("email", "", "email of the admin user (required)")
+	password := fs.String("password", "", "password of the admin user. read from stdin if empty")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	vc, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from vault: %w", err)
+	}
+	if vc != nil {
+		defer vc.Close()
+	}
+
+	// シェルの履歴に残らないように、パスワードは標準入力からも受け付ける
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	// APIから登録する場合と同じく、前後の空白を除いて小文字で保存する
+	*email = strings.ToLower(strings.TrimSpace(*email))
+
+	// APIから登録する場合と同じ条件で検証する
+	v := validator.New()
+	if err := v.Var(*email, "required,email"); err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+	if err := v.Var(*password, "required,lte=128"); err != nil {
+		return fmt.Errorf("invalid password: %w", err)
+	}
+	if err := usecase.CheckPasswordStrength(*password, cfg.Password.MinScore, *email); err != nil {
+		return err
+	}
+
+	db, err := db.NewDB(cfg.DB.Driver, cfg.DB.DataSourceName())
+	if err != nil {
+		return fmt.Errorf("failed to connect db: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	ur := repository.NewUserRepository(db)
+	// APIから登録したユーザーと同じ設定でemail_keyを作る
+	ek := usecase.EmailKeyer{FoldGmailAliases: cfg.Registration.FoldGmailAliases}
+
+	if _, err := ur.GetByEmailKey(ctx, ek.Key(*email)); err == nil {
+		return fmt.Errorf("user already exists: %s", *email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	u := &entity.User{
+		Email:    *email,
+		EmailKey: ek.Key(*email),
+		Role:     entity.RoleAdmin,
+	}
+	salt := random.Alphanumeric(30)
+	hashed, err := u.CreateHashedPassword(*password, salt)
+	if err != nil {
+		return err
+	}
+	u.Password = hashed
+	u.Salt = salt
+
+	if err := ur.Register(ctx, u); err != nil {
+		return err
+	}
+
+	slog.Info("admin user created", slog.Any("user_id", u.ID), slog.String("email", u.Email))
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"login-example/db"
+	"login-example/entity"
+	"login-example/repository"
+	"login-example/usecase"
+	"strings"
+)
+
+// サービス間の呼び出しやOpenID Connectのログインに使う、OAuthクライアントを登録する
+// シークレットはハッシュ化して保存するので、表示されるのはこの1回だけ
+func runCreateClient(args []string) error {
+	fs := flag.NewFlagSet("create-client", flag.ExitOnError)
+	configPath := configFlag(fs)
+	name := fs.String("name", "", "name of the client (required)")
+	scopes := fs.String("scopes", strings.Join(entity.ClientScopes, ","), "comma separated scopes granted to the client")
+	redirectURIs := fs.String("redirect-uris", "", "comma separated redirect uris for the openid connect authorization code flow")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	vc, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from vault: %w", err)
+	}
+	if vc != nil {
+		defer vc.Close()
+	}
+
+	db, err := db.NewDB(cfg.DB.Driver, cfg.DB.DataSourceName())
+	if err != nil {
+		return fmt.Errorf("failed to connect db: %w", err)
+	}
+	defer db.Close()
+
+	// トークンは発行しないので、鍵は不要
+	cu := usecase.NewClientCredentialsUsecase(repository.NewOAuthClientRepository(db), nil)
+	cl, secret, err := cu.Register(context.Background(), *name, splitList(*scopes), splitList(*redirectURIs))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("oauth client created", slog.String("client_id", cl.ID), slog.String("name", cl.Name))
+	fmt.Printf("client_id:     %s\nclient_secret: %s\n", cl.ID, secret)
+	return nil
+}
+
+// カンマ区切りのフラグの値を分割する。空の場合は空のスライスを返す
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' })
+}
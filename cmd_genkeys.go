@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// JWTの署名用の鍵ペアをPEM形式で作成する
+func runGenKeys(args []string) error {
+	flags := flag.NewFlagSet("genkeys", flag.ExitOnError)
+	dir := flags.String("out", "auth/keys", "directory to write secret.pem and public.pem")
+	alg := flags.String("alg", "RS256", "signing algorithm: RS256, ES256 or EdDSA")
+	bits := flags.Int("bits", 2048, "RSA key size in bits")
+	force := flags.Bool("force", false, "overwrite existing keys")
+	pasetoPurpose := flags.String("paseto", "", "print a hex PASETO v4 key for keys.paseto_key instead: local or public")
+	flags.Parse(args)
+
+	if *pasetoPurpose != "" {
+		return printPasetoKey(*pasetoPurpose)
+	}
+
+	if *alg == "RS256" && *bits < 2048 {
+		return fmt.Errorf("key size must be at least 2048 bits: %d", *bits)
+	}
+
+	secretPath := filepath.Join(*dir, "secret.pem")
+	publicPath := filepath.Join(*dir, "public.pem")
+	// 既存の鍵を上書きすると、発行済みのトークンが全て検証できなくなる
+	if !*force {
+		for _, p := range []string{secretPath, publicPath} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("key already exists: %s (use -force to overwrite)", p)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	key, err := generateKey(*alg, *bits)
+	if err != nil {
+		return err
+	}
+	secretDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	// 秘密鍵は所有者以外から読めないようにする
+	if err := os.WriteFile(secretPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: secretDER}), 0o600); err != nil {
+		return fmt.Errorf("failed to write secret key: %w", err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	slog.Info("keys generated", slog.String("alg", *alg), slog.String("secret", secretPath), slog.String("public", publicPath))
+	return nil
+}
+
+// algで署名するための秘密鍵を作成する。ES256はP-256の曲線を使う
+func generateKey(alg string, bits int) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, bits)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("alg must be RS256, ES256 or EdDSA: %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// keys.paseto_keyに設定する鍵を16進数で標準出力に出力する。ファイルには書き込まない
+func printPasetoKey(purpose string) error {
+	var key []byte
+	switch purpose {
+	case "local":
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+	case "public":
+		_, sk, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		key = sk
+	default:
+		return fmt.Errorf("paseto must be local or public: %q", purpose)
+	}
+	fmt.Println(hex.EncodeToString(key))
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"login-example/migrations"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// 埋め込んだマイグレーションを適用する
+//
+//	migrate [up]           未適用のマイグレーションを全て適用する
+//	migrate down -steps N  直近のN個のマイグレーションを戻す
+//	migrate version        適用済みのバージョンを表示する
+//	migrate force V        失敗して dirty になったバージョンを V に設定する
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := configFlag(fs)
+	steps := fs.Int("steps", 1, "number of migrations to roll back with down")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	vc, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from vault: %w", err)
+	}
+	if vc != nil {
+		defer vc.Close()
+	}
+
+	m, err := migrations.New(cfg.DB.Driver, cfg.DB.DataSourceName())
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	action := "up"
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+
+	switch action {
+	case "up":
+		err = m.Up()
+	case "down":
+		// 全て戻すとデータが消えるので、戻す数を明示してもらう
+		if *steps <= 0 {
+			return fmt.Errorf("steps must be positive: %d", *steps)
+		}
+		err = m.Steps(-*steps)
+	case "version":
+	case "force":
+		v, perr := strconv.Atoi(fs.Arg(1))
+		if perr != nil {
+			return fmt.Errorf("invalid version: %q", fs.Arg(1))
+		}
+		err = m.Force(v)
+	default:
+		return fmt.Errorf("unknown migrate action: %s", action)
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate %s: %w", action, err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("failed to get version: %w", err)
+	}
+	slog.Info("migration finished", slog.String("action", action), slog.Any("version", version), slog.Bool("dirty", dirty))
+	return nil
+}
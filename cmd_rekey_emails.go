@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"login-example/db"
+	"login-example/repository"
+	"login-example/usecase"
+)
+
+// 既存のユーザーのemail_keyを、現在のregistration.fold_gmail_aliasesの設定で作り直す
+// 設定を変更した後にサーバーを起動する前に実行する
+func runRekeyEmails(args []string) error {
+	fs := flag.NewFlagSet("rekey-emails", flag.ExitOnError)
+	configPath := configFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "count users to update without updating")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	vc, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from vault: %w", err)
+	}
+	if vc != nil {
+		defer vc.Close()
+	}
+
+	db, err := db.NewDB(cfg.DB.Driver, cfg.DB.DataSourceName())
+	if err != nil {
+		return fmt.Errorf("failed to connect db: %w", err)
+	}
+	defer db.Close()
+
+	ek := usecase.EmailKeyer{FoldGmailAliases: cfg.Registration.FoldGmailAliases}
+	res, err := usecase.RekeyEmails(context.Background(), repository.NewUserRepository(db), ek, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("email keys rebuilt", slog.Int("updated", res.Updated), slog.Any("conflicts", res.Conflicts), slog.Bool("dry_run", *dryRun))
+	// 同じキーになるユーザーは自動で統合できないので、終了コードで知らせる
+	if len(res.Conflicts) > 0 {
+		return fmt.Errorf("%d users share an email key with another user", len(res.Conflicts))
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/db"
+	"login-example/disposable"
+	"login-example/logging"
+	"login-example/mail"
+	myMiddleware "login-example/middleware"
+	"login-example/migrations"
+	"login-example/repository"
+	"login-example/sms"
+	"login-example/tracing"
+	"login-example/usecase"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// 有効期限の切れたIdempotency-Keyを削除する間隔
+const idempotencySweepInterval = 10 * time.Minute
+
+// HTTPサーバーを起動する
+func runServe(args []string) error {
+	logger := slog.Default()
+
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := configFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	vc, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from vault: %w", err)
+	}
+	if vc != nil {
+		defer vc.Close()
+	}
+
+	// OTEL_EXPORTER_OTLP_ENDPOINTが設定されていれば、トレースを送信する
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to setup tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// 開発環境などでは、起動時にスキーマを最新にする
+	if cfg.DB.AutoMigrate {
+		if err := migrations.Up(cfg.DB.Driver, cfg.DB.DataSourceName()); err != nil {
+			return err
+		}
+		logger.Info("migrations applied")
+	}
+
+	// 読み込み用のレプリカ。マイグレーションはプライマリにだけ適用すればよい
+	replicas := make([]*sqlx.DB, 0, len(cfg.DB.Replicas))
+	for _, dsn := range cfg.DB.Replicas {
+		replica, err := db.NewDB(cfg.DB.Driver, dsn)
+		if err != nil {
+			return fmt.Errorf("failed to connect db replica: %w", err)
+		}
+		defer replica.Close()
+		replicas = append(replicas, replica)
+	}
+
+	db, err := db.NewDB(cfg.DB.Driver, cfg.DB.DataSourceName())
+	if err != nil {
+		return fmt.Errorf("failed to connect db: %w", err)
+	}
+	defer db.Close()
+
+	syncMailer, err := newMailer(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create mailer: %w", err)
+	}
+	// captureの場合は、送信したメールを/dev/mailsで確認できる
+	captured, _ := syncMailer.(*mail.CaptureMailer)
+	if captured != nil {
+		logger.Warn("mail capture mode enabled, mails are not delivered")
+	}
+	// ユーザーが設定した言語でメールを作成する
+	syncMailer = mail.NewLocalizingMailer(syncMailer, usecase.RecipientPreferences(repository.NewUserRepository(db)))
+	// バウンスや迷惑メールの報告があったemailには送信しない
+	syncMailer = mail.NewSuppressingMailer(syncMailer, usecase.SuppressUndeliverable(repository.NewUserRepository(db)))
+	// SMTPサーバーやAPIが遅くてもリクエストを待たせないように、メールはバックグラウンドで送信する
+	mailer := mail.NewAsyncMailer(syncMailer, mail.AsyncConfig{
+		Workers:     cfg.Mail.Workers,
+		QueueSize:   cfg.Mail.QueueSize,
+		MaxAttempts: cfg.Mail.MaxAttempts,
+	})
+
+	// 本人確認用のメールは、アウトボックスに保存してから送信する
+	// 送信済みにするのは実際に送信してからなので、非同期のmailerは使わない
+	mails := usecase.NewMailDispatcher(repository.NewMailOutboxRepository(db), repository.NewTransactor(db), syncMailer)
+
+	jwter, err := newJwtBuilder(context.Background(), cfg, vc)
+	if err != nil {
+		return fmt.Errorf("failed to load jwt keys: %w", err)
+	}
+
+	// Redisが設定されていれば、レートリミットのカウンターと失効させたトークンをRedisで共有する
+	rateStore := myMiddleware.NewMemoryRateLimitStore()
+	revocations := auth.NewMemoryRevocationStore()
+	userCache := repository.NewMemoryUserCache(cfg.Cache.UserSize, cfg.Cache.UserTTL)
+	if cfg.Redis.Addr != "" {
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
+		defer rdb.Close()
+		rateStore = myMiddleware.NewRedisRateLimitStore(rdb)
+		revocations = auth.NewRedisRevocationStore(rdb)
+		userCache = repository.NewRedisUserCache(rdb, cfg.Cache.UserTTL)
+	}
+	if cfg.Cache.UserTTL == 0 {
+		userCache = nil
+	}
+
+	// 使い捨てメールアドレスのドメインの一覧。URLが設定されていればバックグラウンドで更新する
+	disposables := disposable.NewList(cfg.Registration.DisposableListURL)
+
+	st, err := newStorage(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %w", err)
+	}
+
+	smsSender := newSmsSender(cfg)
+	if _, ok := smsSender.(*sms.FakeSender); ok {
+		logger.Warn("sms fake mode enabled, messages are not delivered")
+	}
+
+	e, err := NewRouter(cfg, db, replicas, mailer, mails, captured, jwter, rateStore, revocations, userCache, disposables, st, smsSender, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create router: %w", err)
+	}
+
+	// error_handler.goの内容を登録してます。
+	e.HTTPErrorHandler = customHTTPErrorHandler
+
+	// validator.goの内容を登録してます。
+	e.Validator = &CustomValidator{validator: newValidator()}
+
+	// アクセスログはRequestLoggerで出力するので、echoの起動時のメッセージは出さない
+	e.HideBanner = true
+	e.HidePort = true
+
+	// SIGINT, SIGTERMを受け取ったら、新しい接続の受け付けをやめて処理中のリクエストを待ってから終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		mails.Run(logging.WithLogger(ctx, logger))
+	}()
+	go disposables.Run(logging.WithLogger(ctx, logger), cfg.Registration.DisposableRefreshInterval)
+	go sweepIdempotencyKeys(logging.WithLogger(ctx, logger), repository.NewIdempotencyRepository(db), idempotencySweepInterval)
+
+	addr := cfg.Server.Addr()
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("server started", slog.String("addr", addr))
+		if err := e.Start(addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	timeout := cfg.Server.ShutdownTimeout
+	logger.Info("shutting down server", slog.Duration("timeout", timeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shutdown server: %w", err)
+	}
+	// 送信中のメールがあれば、送信し終わるのを待つ
+	<-dispatcherDone
+	if err := mailer.Close(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to flush mail queue: %w", err)
+	}
+	// DBやRedisの接続、トレースの送信はdeferで閉じる
+	return nil
+}
+
+// 有効期限の切れたIdempotency-Keyを、interval毎に削除する
+// 期限切れのキーはReserveで上書きできるので、削除はテーブルが大きくならないようにするだけ
+func sweepIdempotencyKeys(ctx context.Context, ir repository.IIdempotencyRepository, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := ir.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to delete expired idempotency keys", logging.Err(err))
+		} else if n > 0 {
+			logger.InfoContext(ctx, "deleted expired idempotency keys", slog.Int64("count", n))
+		}
+	}
+}
@@ -0,0 +1,803 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// アプリケーション全体の設定
+// デフォルト値 < YAMLファイル < 環境変数 の順に上書きする
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	DB       DBConfig       `yaml:"db"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+	Mail     MailConfig     `yaml:"mail"`
+	Token    TokenConfig    `yaml:"token"`
+	Cookie   CookieConfig   `yaml:"cookie"`
+	Keys     KeysConfig     `yaml:"keys"`
+	Password PasswordConfig `yaml:"password"`
+	Redis    RedisConfig    `yaml:"redis"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Vault    VaultConfig    `yaml:"vault"`
+	// POST /api/auth/introspectを呼び出せるクライアント
+	Introspection IntrospectionConfig `yaml:"introspection"`
+	// 他のファーストパーティのアプリに、OpenID Connectのプロバイダーとしてログインを提供する
+	OIDC OIDCConfig `yaml:"oidc"`
+	// 企業のIdPでログインできるようにする、SAML 2.0のSP
+	SAML SAMLConfig `yaml:"saml"`
+	// 企業のディレクトリからユーザーを同期する、SCIM 2.0のプロビジョニングAPI
+	SCIM SCIMConfig `yaml:"scim"`
+	// 設定されている場合は、ログインのパスワードをLDAP(Active Directory)のbindで検証する
+	LDAP LDAPConfig `yaml:"ldap"`
+	// 新規登録の制限
+	Registration RegistrationConfig `yaml:"registration"`
+	// 仮登録とログインでのCAPTCHAの検証
+	Captcha CaptchaConfig `yaml:"captcha"`
+	// 新しい環境からのログインの通知
+	LoginAlert LoginAlertConfig `yaml:"login_alert"`
+	// 接続元の位置からの不審なログインの検知
+	GeoIP GeoIPConfig `yaml:"geoip"`
+	// ユーザーが登録した信頼済みの端末
+	TrustedDevice TrustedDeviceConfig `yaml:"trusted_device"`
+	// アバター画像などのアップロードされたファイルの保存先
+	Storage StorageConfig `yaml:"storage"`
+	// 電話番号の確認などに使うSMSの送信
+	SMS SMSConfig `yaml:"sms"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+	// 終了時に、処理中のリクエストを待つ時間
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DSNが設定されていればそのまま使い、なければ個別の値から組み立てる
+type DBConfig struct {
+	// mysql, postgres, sqlite
+	Driver   string `yaml:"driver"`
+	DSN      string `yaml:"dsn"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	// 0の場合はドライバーのデフォルトのポート
+	Port int    `yaml:"port"`
+	Name string `yaml:"name"`
+	// 起動時に未適用のマイグレーションを適用する
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// 読み込み用のレプリカのDSN。形式はdriverのDSNと同じ
+	Replicas []string `yaml:"replicas"`
+	// この時間以上かかったクエリをログに出力する。0の場合は出力しない
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	// none, starttls, tls。tlsは接続時から暗号化する(SMTPS、通常は465番ポート)
+	TLS string `yaml:"tls"`
+	// 証明書を検証しない。自己署名の証明書を使う開発環境用
+	TLSSkipVerify bool `yaml:"tls_skip_verify"`
+	// none, plain, cram-md5
+	Auth        string        `yaml:"auth"`
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	SendTimeout time.Duration `yaml:"send_timeout"`
+	// 使い回すために残しておく接続の数。0の場合は1通ごとに接続を閉じる
+	MaxIdleConns int           `yaml:"max_idle_conns"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+}
+
+// メールの送信方法と非同期送信の設定。送信に失敗したメールは、待ち時間を2倍にしながら再送する
+type MailConfig struct {
+	// smtp, ses, sendgrid, mailgun, capture。送信元のアドレスはどれもsmtp.fromを使う
+	// captureは開発用で、メールを送信せずにメモリに保持して/dev/mailsで返す
+	Provider string `yaml:"provider"`
+	// trueの場合はメール配信サービスのテストモードで送信して、実際には配信しない。smtpでは使わない
+	Sandbox  bool               `yaml:"sandbox"`
+	SES      MailSESConfig      `yaml:"ses"`
+	SendGrid MailSendGridConfig `yaml:"sendgrid"`
+	Mailgun  MailMailgunConfig  `yaml:"mailgun"`
+	// バウンスなどのWebhookのURLに付けるtokenクエリパラメータ。空の場合はWebhookを受け付けない
+	WebhookSecret string `yaml:"webhook_secret"`
+
+	// 同時に送信するワーカーの数
+	Workers int `yaml:"workers"`
+	// 送信待ちのメールの上限
+	QueueSize int `yaml:"queue_size"`
+	// この回数失敗したメールは再送を諦める
+	MaxAttempts int `yaml:"max_attempts"`
+	// メールのテンプレートに表示するサービスの情報。空の場合は表示しない
+	ProductName  string `yaml:"product_name"`
+	SupportEmail string `yaml:"support_email"`
+	LogoURL      string `yaml:"logo_url"`
+	PrimaryColor string `yaml:"primary_color"`
+}
+
+type MailSESConfig struct {
+	// 空の場合はAWS_REGIONなど、AWS SDKのデフォルトの設定を使う
+	Region string `yaml:"region"`
+}
+
+type MailSendGridConfig struct {
+	APIKey string `yaml:"api_key"`
+}
+
+type MailMailgunConfig struct {
+	Domain string `yaml:"domain"`
+	APIKey string `yaml:"api_key"`
+	// 空の場合はhttps://api.mailgun.net。EUリージョンの場合はhttps://api.eu.mailgun.net
+	BaseURL string `yaml:"base_url"`
+}
+
+// トークンとセッションの有効期限
+type TokenConfig struct {
+	AccessTTL     time.Duration `yaml:"access_ttl"`
+	SessionTTL    time.Duration `yaml:"session_ttl"`
+	RememberMeTTL time.Duration `yaml:"remember_me_ttl"`
+	MagicLinkTTL  time.Duration `yaml:"magic_link_ttl"`
+	// 本人確認用トークンの形式(alphanumeric, numeric)と長さ。長さが0の場合は形式ごとのデフォルト値
+	ActivateMode   string        `yaml:"activate_mode"`
+	ActivateLength int           `yaml:"activate_length"`
+	ActivateTTL    time.Duration `yaml:"activate_ttl"`
+	// emailの変更の確認用トークンの有効期限
+	EmailChangeTTL time.Duration `yaml:"email_change_ttl"`
+	// アクセストークンとリフレッシュトークンのaud。アクセストークンのaudがこの値でなければ拒否する
+	// 鍵を共有する他のサービスとは別の値にして、トークンを使い回されないようにする。空の場合はaudを使わない
+	Audience string `yaml:"audience"`
+	// トークンの有効期限などを検証する時に許容する、クライアントやサーバー間の時計のずれ
+	ClockSkew time.Duration `yaml:"clock_skew"`
+	// パスワードを再入力してから、アカウントの削除などの操作を行える時間
+	SudoTTL time.Duration `yaml:"sudo_ttl"`
+	// 1人のユーザーが同時に持てるセッションの数。0の場合は制限しない
+	MaxSessions int `yaml:"max_sessions"`
+	// セッションの数が上限に達しているときにログインした場合の扱い(evict_oldest, reject)
+	SessionLimitAction string `yaml:"session_limit_action"`
+}
+
+// リフレッシュトークンとCSRFトークンのcookieの属性
+type CookieConfig struct {
+	// httpsで配信する場合はtrueにする
+	Secure bool   `yaml:"secure"`
+	Domain string `yaml:"domain"`
+	// strict, lax, none
+	SameSite string `yaml:"same_site"`
+}
+
+// JWTの署名と検証に使う鍵
+type KeysConfig struct {
+	// RS256, ES256, EdDSA, HS256。秘密鍵の種類と一致させる
+	Algorithm string `yaml:"algorithm"`
+	// HS256の場合の共有の秘密鍵。32バイト以上のランダムな文字列にする
+	HMACSecret string `yaml:"hmac_secret"`
+	// PEM形式の鍵。設定されている場合は鍵のファイルを読まない。環境変数で渡す場合に使う
+	// 公開鍵は空の場合、秘密鍵から作る
+	SecretKeyPEM  string `yaml:"secret_key_pem"`
+	PublicKeyPEM  string `yaml:"public_key_pem"`
+	SecretKeyPath string `yaml:"secret_key_path"`
+	// 空の場合は秘密鍵から作る
+	PublicKeyPath string `yaml:"public_key_path"`
+	// 署名には使わず、検証にだけ使う公開鍵。鍵の入れ替え中に、新しい鍵や古い鍵の公開鍵を設定する
+	VerifyPublicKeyPaths []string `yaml:"verify_public_key_paths"`
+	// local, aws_kms, gcp_kms。KMSの場合は秘密鍵を読み込まずにKMSで署名する
+	Signer string `yaml:"signer"`
+	// AWS KMSの鍵のID、ARN、エイリアス、またはCloud KMSの鍵のバージョンのリソース名
+	KMSKeyID string `yaml:"kms_key_id"`
+	// AWS KMSのリージョン。空の場合はAWS SDKのデフォルトの設定を使う
+	KMSRegion string `yaml:"kms_region"`
+	// 署名したJWTをJWE(dir, A256GCM)で暗号化する鍵。32バイトをbase64でエンコードした値。空の場合は暗号化しない
+	EncryptionKey string `yaml:"encryption_key"`
+	// jwt, paseto。pasetoの場合は上の設定は使わず、PASETO v4のトークンを発行する
+	Format string `yaml:"format"`
+	// local(共通鍵で暗号化), public(Ed25519で署名)
+	PasetoPurpose string `yaml:"paseto_purpose"`
+	// 16進数の鍵。localは32バイトの共通鍵、publicは64バイトのEd25519の秘密鍵
+	PasetoKey string `yaml:"paseto_key"`
+}
+
+type PasswordConfig struct {
+	// パスワード強度の最低スコア(0〜4)
+	MinScore int `yaml:"min_score"`
+	// argon2idのパラメータ。MemoryはKiB
+	Argon2Time    uint32 `yaml:"argon2_time"`
+	Argon2Memory  uint32 `yaml:"argon2_memory"`
+	Argon2Threads uint8  `yaml:"argon2_threads"`
+}
+
+type RedisConfig struct {
+	// レートリミットのカウンターと失効させたトークンの共有に使う。空の場合はRedisを使わずにメモリ上に保持する
+	Addr string `yaml:"addr"`
+}
+
+// ユーザーのキャッシュ。Redisが設定されていればRedisに、なければメモリ上にキャッシュする
+type CacheConfig struct {
+	// 0の場合はキャッシュしない
+	UserTTL time.Duration `yaml:"user_ttl"`
+	// メモリ上にキャッシュするユーザー数の上限
+	UserSize int `yaml:"user_size"`
+}
+
+type IntrospectionConfig struct {
+	// 空の場合はイントロスペクションを無効にする
+	Clients []IntrospectionClient `yaml:"clients"`
+}
+
+// HTTP Basic認証で確認するクライアントIDとシークレット
+type IntrospectionClient struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+type OIDCConfig struct {
+	// IDトークンのissと、discoveryで公開するエンドポイントのURLの基準(https://login.example.com など)
+	// 空の場合はOpenID Connectのエンドポイントを公開しない
+	Issuer string `yaml:"issuer"`
+	// 認可リクエストを受け取って、ログインと同意を行うフロントエンドの画面のURL。クエリパラメータはそのまま引き継ぐ
+	LoginURL string `yaml:"login_url"`
+	// 認可コードとIDトークンの有効期限
+	CodeTTL    time.Duration `yaml:"code_ttl"`
+	IDTokenTTL time.Duration `yaml:"id_token_ttl"`
+}
+
+type SAMLConfig struct {
+	// SPのentityID。空の場合はSAMLのエンドポイントを公開しない
+	EntityID string `yaml:"entity_id"`
+	// このサービスの外部から見たURL(https://login.example.com など)。ACSとメタデータのURLに使う
+	BaseURL string `yaml:"base_url"`
+	// AuthnRequestの署名とアサーションの復号に使う、SPの証明書と秘密鍵(PEM)
+	CertificatePath string `yaml:"certificate_path"`
+	KeyPath         string `yaml:"key_path"`
+	// IdPのメタデータ。URLが設定されていれば起動時に取得し、なければファイルから読み込む
+	IDPMetadataURL  string `yaml:"idp_metadata_url"`
+	IDPMetadataPath string `yaml:"idp_metadata_path"`
+	// emailを取り出す属性名。空の場合や属性がない場合はNameIDを使う
+	EmailAttribute string `yaml:"email_attribute"`
+	// IdPで認証されたemailのユーザーが存在しない場合に、自動で作成する
+	JITProvisioning bool `yaml:"jit_provisioning"`
+}
+
+type LDAPConfig struct {
+	// ldap://またはldaps://から始まるURL。空の場合はローカルのパスワードで認証する
+	URL string `yaml:"url"`
+	// ldap://の場合に、StartTLSで暗号化する
+	StartTLS bool `yaml:"start_tls"`
+	// ユーザーを検索するためのサービスアカウント。空の場合は匿名でbindする
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// ユーザーを検索するフィルター。%sはログインに入力したemailに置き換える
+	UserFilter string `yaml:"user_filter"`
+	// ローカルのユーザーと対応させるemailの属性名
+	EmailAttribute string        `yaml:"email_attribute"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+type SCIMConfig struct {
+	// ディレクトリがBearerで送るプロビジョニング用のトークン。空の場合はSCIMのエンドポイントを公開しない
+	Token string `yaml:"token"`
+}
+
+type RegistrationConfig struct {
+	// trueの場合は、adminが発行した招待コードがないと仮登録できない。OAuthなどの外部のログインでの登録は制限しない
+	InviteOnly bool `yaml:"invite_only"`
+	// 仮登録できるemailのドメイン。サブドメインも含む。空の場合は全てのドメインを許可する
+	AllowedDomains []string `yaml:"allowed_domains"`
+	// 仮登録できないemailのドメイン。サブドメインも含む。allowed_domainsより優先する
+	BlockedDomains []string `yaml:"blocked_domains"`
+	// 使い捨てメールアドレスでの仮登録の扱い。allow, flag(監査ログに記録する), block
+	DisposableEmail string `yaml:"disposable_email"`
+	// 使い捨てメールアドレスのドメインの一覧(1行に1つ)のURL。空の場合は埋め込んだ一覧だけを使う
+	DisposableListURL string `yaml:"disposable_list_url"`
+	// 一覧を取得し直す間隔
+	DisposableRefreshInterval time.Duration `yaml:"disposable_refresh_interval"`
+	// 組み込みの予約済みのもの(adminなど)に加えて、ユーザーに使わせないusername
+	ReservedUsernames []string `yaml:"reserved_usernames"`
+	// trueの場合は、Gmailの.や+によるエイリアスを同じemailとして扱い、別のアカウントを作らせない
+	FoldGmailAliases bool `yaml:"fold_gmail_aliases"`
+}
+
+type CaptchaConfig struct {
+	// recaptcha, hcaptcha, turnstile。空の場合はCAPTCHAを検証しない
+	Provider string `yaml:"provider"`
+	// トークンを検証するためのシークレットキー
+	Secret string `yaml:"secret"`
+	// reCAPTCHA v3のスコアの最低値(0〜1)。0の場合はスコアを確認しない
+	MinScore float64 `yaml:"min_score"`
+	// 空でない場合は、ウィジェットを表示したホスト名と一致することを確認する
+	Hostname string `yaml:"hostname"`
+}
+
+type LoginAlertConfig struct {
+	// trueの場合は、これまでにないIPアドレスかUser-Agentからログインされたときにメールで通知する
+	Enabled bool `yaml:"enabled"`
+}
+
+type GeoIPConfig struct {
+	// MaxMindのGeoLite2/GeoIP2のCityかCountryのDB(mmdb)のパス。空の場合はGeoIPを使わない
+	DatabasePath string `yaml:"database_path"`
+	// 直前のログインからの移動速度(km/h)がこれを超えたら、ありえない移動として検知する
+	MaxTravelSpeed float64 `yaml:"max_travel_speed"`
+	// trueの場合は、不審なパスワードでのログインでトークンを発行せず、マジックリンクをメールで送って本人確認する
+	StepUp bool `yaml:"step_up"`
+}
+
+type TrustedDeviceConfig struct {
+	// 登録してから信頼済みとして扱う期間。端末のcookieの有効期限も同じ
+	TTL time.Duration `yaml:"ttl"`
+	// trueの場合は、信頼済みの端末からのログインでは、geoip.step_upの本人確認をしない
+	SkipStepUp bool `yaml:"skip_step_up"`
+}
+
+type StorageConfig struct {
+	// local, s3
+	Provider string             `yaml:"provider"`
+	Local    StorageLocalConfig `yaml:"local"`
+	S3       StorageS3Config    `yaml:"s3"`
+	// アップロードできる画像の最大サイズ(バイト)
+	MaxUploadSize int64 `yaml:"max_upload_size"`
+}
+
+type StorageLocalConfig struct {
+	// 保存先のディレクトリ。/uploadsで配信する
+	Dir string `yaml:"dir"`
+	// /uploadsの公開URL。リバースプロキシの後ろで動かす場合は外から見えるURLにする
+	BaseURL string `yaml:"base_url"`
+}
+
+type StorageS3Config struct {
+	// 空の場合はAWS_REGIONなど、AWS SDKのデフォルトの設定を使う
+	Region string `yaml:"region"`
+	Bucket string `yaml:"bucket"`
+	// CloudFrontなどで配信する場合のURL。空の場合はバケットのURLを使う
+	PublicURL string `yaml:"public_url"`
+}
+
+type SMSConfig struct {
+	// twilio, fake。空の場合はSMSを送信せず、電話番号を登録できない
+	Provider string          `yaml:"provider"`
+	Twilio   SMSTwilioConfig `yaml:"twilio"`
+}
+
+type SMSTwilioConfig struct {
+	AccountSID string `yaml:"account_sid"`
+	AuthToken  string `yaml:"auth_token"`
+	// 送信元の電話番号(E.164形式)。messaging_service_sidが設定されている場合はそちらを使う
+	From                string `yaml:"from"`
+	MessagingServiceSID string `yaml:"messaging_service_sid"`
+}
+
+// 起動時にVaultから秘密情報を取得して、設定の値を上書きする
+type VaultConfig struct {
+	// 空の場合はVaultを使わない
+	Addr      string `yaml:"addr"`
+	Namespace string `yaml:"namespace"`
+	// トークンで認証する。空の場合はrole_idとsecret_idでAppRoleにログインする
+	Token    string `yaml:"token"`
+	RoleID   string `yaml:"role_id"`
+	SecretID string `yaml:"secret_id"`
+	// JWTの鍵を保存したパス。secret_key, public_key, verify_keysを読み込む
+	KeysPath string `yaml:"keys_path"`
+	// DBとSMTPの認証情報のパス。usernameとpasswordを読み込む
+	// database/creds/<role>のような動的なシークレットの場合は、リースを更新し続ける
+	DBCredsPath   string `yaml:"db_creds_path"`
+	SMTPCredsPath string `yaml:"smtp_creds_path"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            8000,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		DB: DBConfig{
+			Driver:             "mysql",
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		// mailhog
+		SMTP: SMTPConfig{
+			Host:     "mail",
+			Port:     1025,
+			Username: "user@example.com",
+			Password: "password",
+			From:     "info@login-example.app",
+			// mailhogはTLSに対応していない
+			TLS:          "none",
+			Auth:         "cram-md5",
+			DialTimeout:  10 * time.Second,
+			SendTimeout:  30 * time.Second,
+			MaxIdleConns: 2,
+			IdleTimeout:  30 * time.Second,
+		},
+		Mail: MailConfig{
+			Provider:     "smtp",
+			Workers:      4,
+			QueueSize:    100,
+			MaxAttempts:  5,
+			ProductName:  "login-example",
+			PrimaryColor: "#2563eb",
+		},
+		Token: TokenConfig{
+			AccessTTL:      30 * time.Minute,
+			SessionTTL:     3 * 24 * time.Hour,
+			RememberMeTTL:  30 * 24 * time.Hour,
+			MagicLinkTTL:   15 * time.Minute,
+			ActivateMode:   "alphanumeric",
+			ActivateTTL:    30 * time.Minute,
+			EmailChangeTTL: 30 * time.Minute,
+			Audience:       "login-example",
+			ClockSkew:      30 * time.Second,
+			SudoTTL:        5 * time.Minute,
+
+			SessionLimitAction: "evict_oldest",
+		},
+		Cookie: CookieConfig{
+			SameSite: "strict",
+		},
+		// go run . genkeys で作成した鍵
+		Keys: KeysConfig{
+			Algorithm:     "RS256",
+			SecretKeyPath: "auth/keys/secret.pem",
+			PublicKeyPath: "auth/keys/public.pem",
+			Signer:        "local",
+			Format:        "jwt",
+			PasetoPurpose: "local",
+		},
+		Password: PasswordConfig{
+			MinScore:      3,
+			Argon2Time:    3,
+			Argon2Memory:  64 * 1024,
+			Argon2Threads: 2,
+		},
+		Cache: CacheConfig{
+			UserSize: 10000,
+		},
+		OIDC: OIDCConfig{
+			CodeTTL:    time.Minute,
+			IDTokenTTL: 5 * time.Minute,
+		},
+		LDAP: LDAPConfig{
+			UserFilter:     "(mail=%s)",
+			EmailAttribute: "mail",
+			Timeout:        5 * time.Second,
+		},
+		Registration: RegistrationConfig{
+			DisposableEmail:           "allow",
+			DisposableRefreshInterval: 24 * time.Hour,
+		},
+		GeoIP: GeoIPConfig{
+			// 旅客機の巡航速度より少し速い程度
+			MaxTravelSpeed: 1000,
+		},
+		TrustedDevice: TrustedDeviceConfig{
+			TTL:        90 * 24 * time.Hour,
+			SkipStepUp: true,
+		},
+		Storage: StorageConfig{
+			Provider: "local",
+			Local: StorageLocalConfig{
+				Dir:     "uploads",
+				BaseURL: "http://localhost:8000/uploads",
+			},
+			MaxUploadSize: 5 << 20,
+		},
+	}
+}
+
+// 設定を読み込んで検証する。pathが空の場合はYAMLファイルを読まない
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	// 設定項目の書き間違いに気づけるように、未知のキーはエラーにする
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("failed to decode config file: %w", err)
+	}
+	return nil
+}
+
+// 設定の値が正しいか検証する。不正な値は全てまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port must be 1-65535: %d", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	switch c.DB.Driver {
+	case "mysql", "postgres":
+	case "sqlite":
+		// nameがファイルのパスになる。user, host, portは使わない
+		check(c.DB.DSN != "" || c.DB.Name != "", "db.name is required")
+	default:
+		errs = append(errs, fmt.Errorf("db.driver must be mysql, postgres or sqlite: %q", c.DB.Driver))
+	}
+	check(c.DB.SlowQueryThreshold >= 0, "db.slow_query_threshold must not be negative")
+	check(len(c.DB.Replicas) == 0 || c.DB.Driver != "sqlite", "db.replicas is not supported with sqlite")
+	if c.DB.DSN == "" && c.DB.Driver != "sqlite" {
+		check(c.DB.User != "", "db.user is required")
+		check(c.DB.Host != "", "db.host is required")
+		check(c.DB.Name != "", "db.name is required")
+		check(c.DB.Port == 0 || validPort(c.DB.Port), "db.port must be 1-65535: %d", c.DB.Port)
+	}
+
+	check(c.SMTP.From != "", "smtp.from is required")
+	switch c.Mail.Provider {
+	case "smtp":
+		check(c.SMTP.Host != "", "smtp.host is required")
+		check(validPort(c.SMTP.Port), "smtp.port must be 1-65535: %d", c.SMTP.Port)
+		check(c.SMTP.TLS == "none" || c.SMTP.TLS == "starttls" || c.SMTP.TLS == "tls",
+			"smtp.tls must be none, starttls or tls: %q", c.SMTP.TLS)
+		check(c.SMTP.Auth == "none" || c.SMTP.Auth == "plain" || c.SMTP.Auth == "cram-md5",
+			"smtp.auth must be none, plain or cram-md5: %q", c.SMTP.Auth)
+		check(c.SMTP.DialTimeout > 0, "smtp.dial_timeout must be positive")
+		check(c.SMTP.SendTimeout > 0, "smtp.send_timeout must be positive")
+		check(c.SMTP.MaxIdleConns >= 0, "smtp.max_idle_conns must not be negative: %d", c.SMTP.MaxIdleConns)
+		check(c.SMTP.IdleTimeout > 0, "smtp.idle_timeout must be positive")
+	case "ses", "capture":
+	case "sendgrid":
+		check(c.Mail.SendGrid.APIKey != "", "mail.sendgrid.api_key is required")
+	case "mailgun":
+		check(c.Mail.Mailgun.Domain != "", "mail.mailgun.domain is required")
+		check(c.Mail.Mailgun.APIKey != "", "mail.mailgun.api_key is required")
+	default:
+		errs = append(errs, fmt.Errorf("mail.provider must be smtp, ses, sendgrid, mailgun or capture: %q", c.Mail.Provider))
+	}
+
+	check(c.Mail.Workers > 0, "mail.workers must be positive: %d", c.Mail.Workers)
+	check(c.Mail.QueueSize > 0, "mail.queue_size must be positive: %d", c.Mail.QueueSize)
+	check(c.Mail.MaxAttempts > 0, "mail.max_attempts must be positive: %d", c.Mail.MaxAttempts)
+	check(c.Mail.ProductName != "", "mail.product_name is required")
+
+	check(c.Token.AccessTTL > 0, "token.access_ttl must be positive")
+	check(c.Token.SessionTTL > 0, "token.session_ttl must be positive")
+	check(c.Token.RememberMeTTL >= c.Token.SessionTTL, "token.remember_me_ttl must not be shorter than token.session_ttl")
+	check(c.Token.MagicLinkTTL > 0, "token.magic_link_ttl must be positive")
+	check(c.Token.ActivateTTL > 0, "token.activate_ttl must be positive")
+	check(c.Token.EmailChangeTTL > 0, "token.email_change_ttl must be positive")
+	check(c.Token.SudoTTL > 0 && c.Token.SudoTTL <= time.Hour, "token.sudo_ttl must be 1s-1h: %s", c.Token.SudoTTL)
+	check(c.Token.ClockSkew >= 0 && c.Token.ClockSkew <= 5*time.Minute, "token.clock_skew must be 0-5m: %s", c.Token.ClockSkew)
+	check(c.Token.MaxSessions >= 0, "token.max_sessions must not be negative")
+	check(c.Token.SessionLimitAction == "evict_oldest" || c.Token.SessionLimitAction == "reject",
+		"token.session_limit_action must be evict_oldest or reject: %q", c.Token.SessionLimitAction)
+	check(c.Token.ActivateMode == "alphanumeric" || c.Token.ActivateMode == "numeric",
+		"token.activate_mode must be alphanumeric or numeric: %q", c.Token.ActivateMode)
+	check(c.Token.ActivateLength == 0 || (c.Token.ActivateLength >= 4 && c.Token.ActivateLength <= 32),
+		"token.activate_length must be 4-32: %d", c.Token.ActivateLength)
+
+	switch strings.ToLower(c.Cookie.SameSite) {
+	case "strict", "lax":
+	case "none":
+		// SameSite=NoneはSecureでないとブラウザに拒否される
+		check(c.Cookie.Secure, "cookie.same_site=none requires cookie.secure")
+	default:
+		errs = append(errs, fmt.Errorf("cookie.same_site must be strict, lax or none: %q", c.Cookie.SameSite))
+	}
+
+	switch c.Keys.Format {
+	case "jwt":
+	case "paseto":
+		switch c.Keys.PasetoPurpose {
+		case "local":
+			key, err := hex.DecodeString(c.Keys.PasetoKey)
+			check(err == nil && len(key) == 32, "keys.paseto_key must be 32 bytes encoded in hex for keys.paseto_purpose=local")
+		case "public":
+			key, err := hex.DecodeString(c.Keys.PasetoKey)
+			check(err == nil && len(key) == 64, "keys.paseto_key must be an Ed25519 secret key (64 bytes) encoded in hex for keys.paseto_purpose=public")
+		default:
+			errs = append(errs, fmt.Errorf("keys.paseto_purpose must be local or public: %q", c.Keys.PasetoPurpose))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("keys.format must be jwt or paseto: %q", c.Keys.Format))
+	}
+	switch c.Keys.Signer {
+	case "local":
+	case "aws_kms", "gcp_kms":
+		check(c.Keys.Algorithm == "RS256" || c.Keys.Algorithm == "ES256",
+			"keys.signer=%s requires keys.algorithm RS256 or ES256: %q", c.Keys.Signer, c.Keys.Algorithm)
+		check(c.Keys.KMSKeyID != "", "keys.kms_key_id is required for keys.signer=%s", c.Keys.Signer)
+	default:
+		errs = append(errs, fmt.Errorf("keys.signer must be local, aws_kms or gcp_kms: %q", c.Keys.Signer))
+	}
+	if c.Keys.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.Keys.EncryptionKey)
+		check(err == nil && len(key) == 32, "keys.encryption_key must be 32 bytes encoded in base64")
+	}
+	switch c.Keys.Algorithm {
+	case "RS256", "ES256", "EdDSA":
+		check(c.Keys.Signer != "local" || c.Keys.SecretKeyPEM != "" || c.Keys.SecretKeyPath != "",
+			"keys.secret_key_pem or keys.secret_key_path is required")
+	case "HS256":
+		check(len(c.Keys.HMACSecret) >= 32, "keys.hmac_secret must be at least 32 bytes")
+	default:
+		errs = append(errs, fmt.Errorf("keys.algorithm must be RS256, ES256, EdDSA or HS256: %q", c.Keys.Algorithm))
+	}
+
+	check(c.Password.MinScore >= 0 && c.Password.MinScore <= 4, "password.min_score must be 0-4: %d", c.Password.MinScore)
+	check(c.Password.Argon2Time > 0, "password.argon2_time must be positive")
+	check(c.Password.Argon2Memory > 0, "password.argon2_memory must be positive")
+	check(c.Password.Argon2Threads > 0, "password.argon2_threads must be positive")
+
+	check(c.Cache.UserTTL >= 0, "cache.user_ttl must not be negative")
+	check(c.Cache.UserSize > 0, "cache.user_size must be positive: %d", c.Cache.UserSize)
+
+	for i, cl := range c.Introspection.Clients {
+		check(cl.ID != "", "introspection.clients[%d].id is required", i)
+		check(len(cl.Secret) >= 16, "introspection.clients[%d].secret must be at least 16 bytes", i)
+	}
+
+	if c.OIDC.Issuer != "" {
+		u, err := url.Parse(c.OIDC.Issuer)
+		// OpenID Connect Discovery 1.0 3. issuerはクエリとフラグメントを含まないhttpsのURL
+		check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.RawQuery == "" && u.Fragment == "",
+			"oidc.issuer must be an absolute url without query and fragment: %q", c.OIDC.Issuer)
+		check(!strings.HasSuffix(c.OIDC.Issuer, "/"), "oidc.issuer must not end with a slash: %q", c.OIDC.Issuer)
+		check(c.OIDC.LoginURL != "", "oidc.login_url is required for oidc.issuer")
+		check(c.OIDC.CodeTTL > 0 && c.OIDC.CodeTTL <= 10*time.Minute, "oidc.code_ttl must be 1s-10m: %s", c.OIDC.CodeTTL)
+		check(c.OIDC.IDTokenTTL > 0, "oidc.id_token_ttl must be positive")
+		// RPはJWKSの公開鍵でIDトークンを検証する
+		check(c.Keys.Format == "jwt", "oidc.issuer requires keys.format=jwt")
+		check(c.Keys.Algorithm != "HS256", "oidc.issuer cannot be used with keys.algorithm=HS256")
+	}
+
+	if c.SAML.EntityID != "" {
+		u, err := url.Parse(c.SAML.BaseURL)
+		check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "",
+			"saml.base_url must be an absolute url: %q", c.SAML.BaseURL)
+		check(c.SAML.CertificatePath != "" && c.SAML.KeyPath != "", "saml.certificate_path and saml.key_path are required")
+		check(c.SAML.IDPMetadataURL != "" || c.SAML.IDPMetadataPath != "", "saml.idp_metadata_url or saml.idp_metadata_path is required")
+	}
+
+	// ユーザーを作成、無効化できるトークンなので、推測できない長さにする
+	check(c.SCIM.Token == "" || len(c.SCIM.Token) >= 32, "scim.token must be at least 32 characters")
+
+	if c.LDAP.URL != "" {
+		u, err := url.Parse(c.LDAP.URL)
+		check(err == nil && (u.Scheme == "ldap" || u.Scheme == "ldaps") && u.Host != "",
+			"ldap.url must be ldap:// or ldaps:// url: %q", c.LDAP.URL)
+		// パスワードを平文で送らないようにする
+		check(err != nil || u.Scheme == "ldaps" || c.LDAP.StartTLS, "ldap.url with ldap:// requires ldap.start_tls")
+		check(c.LDAP.BaseDN != "", "ldap.base_dn is required")
+		check(strings.Count(c.LDAP.UserFilter, "%s") == 1, "ldap.user_filter must contain one %%s: %q", c.LDAP.UserFilter)
+		check(c.LDAP.EmailAttribute != "", "ldap.email_attribute is required")
+		check(c.LDAP.Timeout > 0, "ldap.timeout must be positive")
+	}
+
+	for i, d := range c.Registration.AllowedDomains {
+		check(validDomain(d), "registration.allowed_domains[%d] must be a domain: %q", i, d)
+	}
+	for i, d := range c.Registration.BlockedDomains {
+		check(validDomain(d), "registration.blocked_domains[%d] must be a domain: %q", i, d)
+	}
+	check(c.Registration.DisposableEmail == "allow" || c.Registration.DisposableEmail == "flag" || c.Registration.DisposableEmail == "block",
+		"registration.disposable_email must be allow, flag or block: %q", c.Registration.DisposableEmail)
+	if c.Registration.DisposableListURL != "" {
+		u, err := url.Parse(c.Registration.DisposableListURL)
+		check(err == nil && u.Scheme == "https" && u.Host != "",
+			"registration.disposable_list_url must be https url: %q", c.Registration.DisposableListURL)
+		// 一覧の配布元に負荷をかけないように、短すぎる間隔は許可しない
+		check(c.Registration.DisposableRefreshInterval >= time.Hour, "registration.disposable_refresh_interval must be at least 1h")
+	}
+
+	if c.Captcha.Provider != "" {
+		check(c.Captcha.Provider == "recaptcha" || c.Captcha.Provider == "hcaptcha" || c.Captcha.Provider == "turnstile",
+			"captcha.provider must be recaptcha, hcaptcha or turnstile: %q", c.Captcha.Provider)
+		check(c.Captcha.Secret != "", "captcha.secret is required")
+		check(c.Captcha.MinScore >= 0 && c.Captcha.MinScore <= 1, "captcha.min_score must be 0-1: %v", c.Captcha.MinScore)
+	}
+
+	check(c.GeoIP.MaxTravelSpeed > 0, "geoip.max_travel_speed must be positive")
+	check(!c.GeoIP.StepUp || c.GeoIP.DatabasePath != "", "geoip.database_path is required for geoip.step_up")
+	check(c.TrustedDevice.TTL > 0, "trusted_device.ttl must be positive")
+
+	switch c.Storage.Provider {
+	case "local":
+		check(c.Storage.Local.Dir != "", "storage.local.dir is required")
+		u, err := url.Parse(c.Storage.Local.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"storage.local.base_url must be http or https url: %q", c.Storage.Local.BaseURL)
+	case "s3":
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket is required")
+	default:
+		errs = append(errs, fmt.Errorf("storage.provider must be local or s3: %q", c.Storage.Provider))
+	}
+	check(c.Storage.MaxUploadSize > 0, "storage.max_upload_size must be positive: %d", c.Storage.MaxUploadSize)
+
+	switch c.SMS.Provider {
+	case "", "fake":
+	case "twilio":
+		check(c.SMS.Twilio.AccountSID != "", "sms.twilio.account_sid is required")
+		check(c.SMS.Twilio.AuthToken != "", "sms.twilio.auth_token is required")
+		check(c.SMS.Twilio.From != "" || c.SMS.Twilio.MessagingServiceSID != "",
+			"sms.twilio.from or sms.twilio.messaging_service_sid is required")
+	default:
+		errs = append(errs, fmt.Errorf("sms.provider must be twilio or fake: %q", c.SMS.Provider))
+	}
+
+	if c.Vault.Addr != "" {
+		check(c.Vault.Token != "" || (c.Vault.RoleID != "" && c.Vault.SecretID != ""),
+			"vault.token or vault.role_id and vault.secret_id is required")
+		// DSNが設定されているとdb.userとdb.passwordは使われない
+		check(c.Vault.DBCredsPath == "" || c.DB.DSN == "", "vault.db_creds_path cannot be used with db.dsn")
+	}
+
+	return errors.Join(errs...)
+}
+
+// ドライバーに渡すDSNを返す
+// mysqlはgo-sql-driver/mysqlの形式、postgresはpostgres://から始まるURL、sqliteはファイルのパス
+func (c DBConfig) DataSourceName() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+	if c.Driver == "sqlite" {
+		// 外部キー制約を有効にして、ロック中は待つようにする
+		return c.Name + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	}
+	if c.Driver == "postgres" {
+		port := c.Port
+		if port == 0 {
+			port = 5432
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.User, c.Password),
+			Host:     fmt.Sprintf("%s:%d", c.Host, port),
+			Path:     "/" + c.Name,
+			RawQuery: "sslmode=disable",
+		}
+		return u.String()
+	}
+	port := c.Port
+	if port == 0 {
+		port = 3306
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", c.User, c.Password, c.Host, port, c.Name)
+}
+
+// サーバーが待ち受けるアドレス
+func (c ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+func validPort(p int) bool {
+	return p > 0 && p <= 65535
+}
+
+// emailの@より後ろの部分として使えるか。@を含めて書いた場合は誤りとして扱う
+func validDomain(d string) bool {
+	return d != "" && !strings.ContainsAny(d, "@ ") && !strings.HasPrefix(d, ".")
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 環境変数で設定を上書きする。設定されていない環境変数は無視する
+//
+//	PORT, SHUTDOWN_TIMEOUT
+//	DB_DRIVER, DB_DSN, DB_USER, DB_PASSWORD, DB_HOST, DB_PORT, DB_NAME, DB_AUTO_MIGRATE
+//	DB_REPLICAS (カンマ区切り), DB_SLOW_QUERY_THRESHOLD
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+//	SMTP_TLS, SMTP_TLS_SKIP_VERIFY, SMTP_AUTH, SMTP_DIAL_TIMEOUT, SMTP_SEND_TIMEOUT, SMTP_MAX_IDLE_CONNS, SMTP_IDLE_TIMEOUT
+//	MAIL_PROVIDER, MAIL_SANDBOX, MAIL_WEBHOOK_SECRET, MAIL_WORKERS, MAIL_QUEUE_SIZE, MAIL_MAX_ATTEMPTS
+//	MAIL_SES_REGION, SENDGRID_API_KEY, MAILGUN_DOMAIN, MAILGUN_API_KEY, MAILGUN_BASE_URL
+//	MAIL_PRODUCT_NAME, MAIL_SUPPORT_EMAIL, MAIL_LOGO_URL, MAIL_PRIMARY_COLOR
+//	ACCESS_TOKEN_TTL, SESSION_TTL, REMEMBER_ME_TTL, MAGIC_LINK_TTL
+//	ACTIVATE_TOKEN_MODE, ACTIVATE_TOKEN_LENGTH, ACTIVATE_TOKEN_TTL, TOKEN_AUDIENCE, TOKEN_CLOCK_SKEW
+//	SUDO_TTL, MAX_SESSIONS, SESSION_LIMIT_ACTION
+//	COOKIE_SECURE, COOKIE_DOMAIN, COOKIE_SAME_SITE
+//	JWT_ALGORITHM, JWT_HMAC_SECRET, JWT_SECRET_KEY, JWT_PUBLIC_KEY (PEM形式)
+//	JWT_SECRET_KEY_PATH, JWT_PUBLIC_KEY_PATH, JWT_VERIFY_PUBLIC_KEY_PATHS (カンマ区切り)
+//	JWT_SIGNER, JWT_KMS_KEY_ID, JWT_KMS_REGION, JWT_ENCRYPTION_KEY (base64)
+//	TOKEN_FORMAT, PASETO_PURPOSE, PASETO_KEY (hex)
+//	PASSWORD_MIN_SCORE, ARGON2_TIME, ARGON2_MEMORY, ARGON2_THREADS
+//	REDIS_ADDR
+//	USER_CACHE_TTL, USER_CACHE_SIZE
+//	VAULT_ADDR, VAULT_NAMESPACE, VAULT_TOKEN, VAULT_ROLE_ID, VAULT_SECRET_ID
+//	VAULT_KEYS_PATH, VAULT_DB_CREDS_PATH, VAULT_SMTP_CREDS_PATH
+//	INTROSPECTION_CLIENTS (id:secretのカンマ区切り)
+//	OIDC_ISSUER, OIDC_LOGIN_URL, OIDC_CODE_TTL, OIDC_ID_TOKEN_TTL
+//	SAML_ENTITY_ID, SAML_BASE_URL, SAML_CERTIFICATE_PATH, SAML_KEY_PATH
+//	SAML_IDP_METADATA_URL, SAML_IDP_METADATA_PATH, SAML_EMAIL_ATTRIBUTE, SAML_JIT_PROVISIONING
+//	SCIM_TOKEN
+//	LDAP_URL, LDAP_START_TLS, LDAP_BIND_DN, LDAP_BIND_PASSWORD, LDAP_BASE_DN
+//	LDAP_USER_FILTER, LDAP_EMAIL_ATTRIBUTE, LDAP_TIMEOUT
+//	REGISTRATION_INVITE_ONLY, REGISTRATION_ALLOWED_DOMAINS, REGISTRATION_BLOCKED_DOMAINS (カンマ区切り)
+//	REGISTRATION_DISPOSABLE_EMAIL, REGISTRATION_DISPOSABLE_LIST_URL, REGISTRATION_DISPOSABLE_REFRESH_INTERVAL
+//	REGISTRATION_RESERVED_USERNAMES (カンマ区切り), REGISTRATION_FOLD_GMAIL_ALIASES
+//	CAPTCHA_PROVIDER, CAPTCHA_SECRET, CAPTCHA_MIN_SCORE, CAPTCHA_HOSTNAME
+//	LOGIN_ALERT_ENABLED
+//	GEOIP_DATABASE_PATH, GEOIP_MAX_TRAVEL_SPEED, GEOIP_STEP_UP
+//	TRUSTED_DEVICE_TTL, TRUSTED_DEVICE_SKIP_STEP_UP
+func (c *Config) loadEnv() error {
+	e := &envLoader{}
+
+	e.int("PORT", &c.Server.Port)
+	e.duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	e.string("DB_DRIVER", &c.DB.Driver)
+	e.string("DB_DSN", &c.DB.DSN)
+	e.string("DB_USER", &c.DB.User)
+	e.string("DB_PASSWORD", &c.DB.Password)
+	e.string("DB_HOST", &c.DB.Host)
+	e.int("DB_PORT", &c.DB.Port)
+	e.string("DB_NAME", &c.DB.Name)
+	e.bool("DB_AUTO_MIGRATE", &c.DB.AutoMigrate)
+	e.strings("DB_REPLICAS", &c.DB.Replicas)
+	e.duration("DB_SLOW_QUERY_THRESHOLD", &c.DB.SlowQueryThreshold)
+
+	e.string("SMTP_HOST", &c.SMTP.Host)
+	e.int("SMTP_PORT", &c.SMTP.Port)
+	e.string("SMTP_USERNAME", &c.SMTP.Username)
+	e.string("SMTP_PASSWORD", &c.SMTP.Password)
+	e.string("SMTP_FROM", &c.SMTP.From)
+	e.string("SMTP_TLS", &c.SMTP.TLS)
+	e.bool("SMTP_TLS_SKIP_VERIFY", &c.SMTP.TLSSkipVerify)
+	e.string("SMTP_AUTH", &c.SMTP.Auth)
+	e.duration("SMTP_DIAL_TIMEOUT", &c.SMTP.DialTimeout)
+	e.duration("SMTP_SEND_TIMEOUT", &c.SMTP.SendTimeout)
+	e.int("SMTP_MAX_IDLE_CONNS", &c.SMTP.MaxIdleConns)
+	e.duration("SMTP_IDLE_TIMEOUT", &c.SMTP.IdleTimeout)
+
+	e.string("MAIL_PROVIDER", &c.Mail.Provider)
+	e.bool("MAIL_SANDBOX", &c.Mail.Sandbox)
+	e.string("MAIL_WEBHOOK_SECRET", &c.Mail.WebhookSecret)
+	e.string("MAIL_SES_REGION", &c.Mail.SES.Region)
+	e.string("SENDGRID_API_KEY", &c.Mail.SendGrid.APIKey)
+	e.string("MAILGUN_DOMAIN", &c.Mail.Mailgun.Domain)
+	e.string("MAILGUN_API_KEY", &c.Mail.Mailgun.APIKey)
+	e.string("MAILGUN_BASE_URL", &c.Mail.Mailgun.BaseURL)
+	e.int("MAIL_WORKERS", &c.Mail.Workers)
+	e.int("MAIL_QUEUE_SIZE", &c.Mail.QueueSize)
+	e.int("MAIL_MAX_ATTEMPTS", &c.Mail.MaxAttempts)
+	e.string("MAIL_PRODUCT_NAME", &c.Mail.ProductName)
+	e.string("MAIL_SUPPORT_EMAIL", &c.Mail.SupportEmail)
+	e.string("MAIL_LOGO_URL", &c.Mail.LogoURL)
+	e.string("MAIL_PRIMARY_COLOR", &c.Mail.PrimaryColor)
+
+	e.duration("ACCESS_TOKEN_TTL", &c.Token.AccessTTL)
+	e.duration("SESSION_TTL", &c.Token.SessionTTL)
+	e.duration("REMEMBER_ME_TTL", &c.Token.RememberMeTTL)
+	e.duration("MAGIC_LINK_TTL", &c.Token.MagicLinkTTL)
+	e.string("ACTIVATE_TOKEN_MODE", &c.Token.ActivateMode)
+	e.int("ACTIVATE_TOKEN_LENGTH", &c.Token.ActivateLength)
+	e.duration("ACTIVATE_TOKEN_TTL", &c.Token.ActivateTTL)
+	e.duration("EMAIL_CHANGE_TOKEN_TTL", &c.Token.EmailChangeTTL)
+	e.string("TOKEN_AUDIENCE", &c.Token.Audience)
+	e.duration("TOKEN_CLOCK_SKEW", &c.Token.ClockSkew)
+	e.duration("SUDO_TTL", &c.Token.SudoTTL)
+	e.int("MAX_SESSIONS", &c.Token.MaxSessions)
+	e.string("SESSION_LIMIT_ACTION", &c.Token.SessionLimitAction)
+
+	e.bool("COOKIE_SECURE", &c.Cookie.Secure)
+	e.string("COOKIE_DOMAIN", &c.Cookie.Domain)
+	e.string("COOKIE_SAME_SITE", &c.Cookie.SameSite)
+
+	e.string("JWT_ALGORITHM", &c.Keys.Algorithm)
+	e.string("JWT_HMAC_SECRET", &c.Keys.HMACSecret)
+	e.string("JWT_SECRET_KEY", &c.Keys.SecretKeyPEM)
+	e.string("JWT_PUBLIC_KEY", &c.Keys.PublicKeyPEM)
+	e.string("JWT_SECRET_KEY_PATH", &c.Keys.SecretKeyPath)
+	e.string("JWT_PUBLIC_KEY_PATH", &c.Keys.PublicKeyPath)
+	e.strings("JWT_VERIFY_PUBLIC_KEY_PATHS", &c.Keys.VerifyPublicKeyPaths)
+	e.string("JWT_SIGNER", &c.Keys.Signer)
+	e.string("JWT_KMS_KEY_ID", &c.Keys.KMSKeyID)
+	e.string("JWT_KMS_REGION", &c.Keys.KMSRegion)
+	e.string("JWT_ENCRYPTION_KEY", &c.Keys.EncryptionKey)
+	e.string("TOKEN_FORMAT", &c.Keys.Format)
+	e.string("PASETO_PURPOSE", &c.Keys.PasetoPurpose)
+	e.string("PASETO_KEY", &c.Keys.PasetoKey)
+
+	e.int("PASSWORD_MIN_SCORE", &c.Password.MinScore)
+	e.uint32("ARGON2_TIME", &c.Password.Argon2Time)
+	e.uint32("ARGON2_MEMORY", &c.Password.Argon2Memory)
+	e.uint8("ARGON2_THREADS", &c.Password.Argon2Threads)
+
+	e.string("REDIS_ADDR", &c.Redis.Addr)
+
+	e.duration("USER_CACHE_TTL", &c.Cache.UserTTL)
+	e.int("USER_CACHE_SIZE", &c.Cache.UserSize)
+
+	e.string("VAULT_ADDR", &c.Vault.Addr)
+	e.string("VAULT_NAMESPACE", &c.Vault.Namespace)
+	e.string("VAULT_TOKEN", &c.Vault.Token)
+	e.string("VAULT_ROLE_ID", &c.Vault.RoleID)
+	e.string("VAULT_SECRET_ID", &c.Vault.SecretID)
+	e.string("VAULT_KEYS_PATH", &c.Vault.KeysPath)
+	e.string("VAULT_DB_CREDS_PATH", &c.Vault.DBCredsPath)
+	e.string("VAULT_SMTP_CREDS_PATH", &c.Vault.SMTPCredsPath)
+
+	e.clients("INTROSPECTION_CLIENTS", &c.Introspection.Clients)
+
+	e.string("OIDC_ISSUER", &c.OIDC.Issuer)
+	e.string("OIDC_LOGIN_URL", &c.OIDC.LoginURL)
+	e.duration("OIDC_CODE_TTL", &c.OIDC.CodeTTL)
+	e.duration("OIDC_ID_TOKEN_TTL", &c.OIDC.IDTokenTTL)
+
+	e.string("SAML_ENTITY_ID", &c.SAML.EntityID)
+	e.string("SAML_BASE_URL", &c.SAML.BaseURL)
+	e.string("SAML_CERTIFICATE_PATH", &c.SAML.CertificatePath)
+	e.string("SAML_KEY_PATH", &c.SAML.KeyPath)
+	e.string("SAML_IDP_METADATA_URL", &c.SAML.IDPMetadataURL)
+	e.string("SAML_IDP_METADATA_PATH", &c.SAML.IDPMetadataPath)
+	e.string("SAML_EMAIL_ATTRIBUTE", &c.SAML.EmailAttribute)
+	e.bool("SAML_JIT_PROVISIONING", &c.SAML.JITProvisioning)
+
+	e.string("SCIM_TOKEN", &c.SCIM.Token)
+
+	e.string("LDAP_URL", &c.LDAP.URL)
+	e.bool("LDAP_START_TLS", &c.LDAP.StartTLS)
+	e.string("LDAP_BIND_DN", &c.LDAP.BindDN)
+	e.string("LDAP_BIND_PASSWORD", &c.LDAP.BindPassword)
+	e.string("LDAP_BASE_DN", &c.LDAP.BaseDN)
+	e.string("LDAP_USER_FILTER", &c.LDAP.UserFilter)
+	e.string("LDAP_EMAIL_ATTRIBUTE", &c.LDAP.EmailAttribute)
+	e.duration("LDAP_TIMEOUT", &c.LDAP.Timeout)
+
+	e.bool("REGISTRATION_INVITE_ONLY", &c.Registration.InviteOnly)
+	e.strings("REGISTRATION_ALLOWED_DOMAINS", &c.Registration.AllowedDomains)
+	e.strings("REGISTRATION_BLOCKED_DOMAINS", &c.Registration.BlockedDomains)
+	e.string("REGISTRATION_DISPOSABLE_EMAIL", &c.Registration.DisposableEmail)
+	e.string("REGISTRATION_DISPOSABLE_LIST_URL", &c.Registration.DisposableListURL)
+	e.duration("REGISTRATION_DISPOSABLE_REFRESH_INTERVAL", &c.Registration.DisposableRefreshInterval)
+	e.strings("REGISTRATION_RESERVED_USERNAMES", &c.Registration.ReservedUsernames)
+	e.bool("REGISTRATION_FOLD_GMAIL_ALIASES", &c.Registration.FoldGmailAliases)
+
+	e.string("CAPTCHA_PROVIDER", &c.Captcha.Provider)
+	e.string("CAPTCHA_SECRET", &c.Captcha.Secret)
+	e.float("CAPTCHA_MIN_SCORE", &c.Captcha.MinScore)
+	e.string("CAPTCHA_HOSTNAME", &c.Captcha.Hostname)
+
+	e.bool("LOGIN_ALERT_ENABLED", &c.LoginAlert.Enabled)
+
+	e.string("GEOIP_DATABASE_PATH", &c.GeoIP.DatabasePath)
+	e.float("GEOIP_MAX_TRAVEL_SPEED", &c.GeoIP.MaxTravelSpeed)
+	e.bool("GEOIP_STEP_UP", &c.GeoIP.StepUp)
+
+	e.duration("TRUSTED_DEVICE_TTL", &c.TrustedDevice.TTL)
+	e.bool("TRUSTED_DEVICE_SKIP_STEP_UP", &c.TrustedDevice.SkipStepUp)
+
+	e.string("STORAGE_PROVIDER", &c.Storage.Provider)
+	e.string("STORAGE_LOCAL_DIR", &c.Storage.Local.Dir)
+	e.string("STORAGE_LOCAL_BASE_URL", &c.Storage.Local.BaseURL)
+	e.string("STORAGE_S3_REGION", &c.Storage.S3.Region)
+	e.string("STORAGE_S3_BUCKET", &c.Storage.S3.Bucket)
+	e.string("STORAGE_S3_PUBLIC_URL", &c.Storage.S3.PublicURL)
+	e.int64("STORAGE_MAX_UPLOAD_SIZE", &c.Storage.MaxUploadSize)
+
+	e.string("SMS_PROVIDER", &c.SMS.Provider)
+	e.string("TWILIO_ACCOUNT_SID", &c.SMS.Twilio.AccountSID)
+	e.string("TWILIO_AUTH_TOKEN", &c.SMS.Twilio.AuthToken)
+	e.string("TWILIO_FROM", &c.SMS.Twilio.From)
+	e.string("TWILIO_MESSAGING_SERVICE_SID", &c.SMS.Twilio.MessagingServiceSID)
+
+	return errors.Join(e.errs...)
+}
+
+// 環境変数をパースして、失敗した場合はエラーを溜めておく
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(key)
+	return v, ok && v != ""
+}
+
+func (e *envLoader) fail(key, v string, err error) {
+	e.errs = append(e.errs, fmt.Errorf("invalid %s: %q: %w", key, v, err))
+}
+
+func (e *envLoader) string(key string, dst *string) {
+	if v, ok := e.lookup(key); ok {
+		*dst = v
+	}
+}
+
+// カンマ区切りの値
+func (e *envLoader) strings(key string, dst *[]string) {
+	if v, ok := e.lookup(key); ok {
+		*dst = strings.Split(v, ",")
+	}
+}
+
+// id:secretのカンマ区切り
+func (e *envLoader) clients(key string, dst *[]IntrospectionClient) {
+	if v, ok := e.lookup(key); ok {
+		var cs []IntrospectionClient
+		for _, pair := range strings.Split(v, ",") {
+			id, secret, ok := strings.Cut(pair, ":")
+			if !ok {
+				// シークレットをエラーメッセージに含めないように、値は出さない
+				e.errs = append(e.errs, fmt.Errorf("invalid %s: expected id:secret", key))
+				return
+			}
+			cs = append(cs, IntrospectionClient{ID: id, Secret: secret})
+		}
+		*dst = cs
+	}
+}
+
+func (e *envLoader) int(key string, dst *int) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) int64(key string, dst *int64) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) float(key string, dst *float64) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) uint32(key string, dst *uint32) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = uint32(n)
+	}
+}
+
+func (e *envLoader) uint8(key string, dst *uint8) {
+	if v, ok := e.lookup(key); ok {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = uint8(n)
+	}
+}
+
+func (e *envLoader) bool(key string, dst *bool) {
+	if v, ok := e.lookup(key); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envLoader) duration(key string, dst *time.Duration) {
+	if v, ok := e.lookup(key); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.fail(key, v, err)
+			return
+		}
+		*dst = d
+	}
+}
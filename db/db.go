@@ -2,31 +2,48 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	_ "modernc.org/sqlite"
 )
 
-func NewDB() (*sqlx.DB, error) {
-	// 環境変数からDBの情報を取得します
-	dbUser := os.Getenv("DB_USER")         // login-user
-	dbPassword := os.Getenv("DB_PASSWORD") // login-pass
-	dbHost := os.Getenv("DB_HOST")         // db
-	dbName := os.Getenv("DB_NAME")         // login-db
-	dbPort := os.Getenv("DB_PORT")         // 3306
-	src := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
-
-	db, err := sql.Open("mysql", src)
+func init() {
+	// sqlxはmodernc.org/sqliteのドライバー名を知らないので、プレースホルダーの形式を登録する
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+// driverはmysql、postgres、sqliteのいずれか。srcはconfig.DBConfig.DataSourceNameで作成する
+func NewDB(driver, src string) (*sqlx.DB, error) {
+	// database/sqlに登録されているドライバー名
+	var (
+		driverName string
+		system     attribute.KeyValue
+	)
+	switch driver {
+	case "mysql":
+		driverName, system = "mysql", semconv.DBSystemMySQL
+	case "postgres":
+		driverName, system = "pgx", semconv.DBSystemPostgreSQL
+	case "sqlite":
+		driverName, system = "sqlite", semconv.DBSystemSqlite
+	default:
+		return nil, fmt.Errorf("unknown db driver: %q", driver)
+	}
+
+	// クエリごとにスパンを作成するため、otelsqlでドライバーをラップする
+	db, err := otelsql.Open(driverName, src, otelsql.WithAttributes(system))
 	if err != nil {
 		return nil, fmt.Errorf("failed to Open DB: %w", err)
 	}
 
-	// mysqlに実際に接続できているかpingで確認します。
+	// DBに実際に接続できているかpingで確認します。
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
@@ -34,6 +51,12 @@ func NewDB() (*sqlx.DB, error) {
 		return nil, fmt.Errorf("failed to Ping DB: %w", err)
 	}
 
-	xdb := sqlx.NewDb(db, "mysql")
+	// sqlxはドライバー名からプレースホルダーの形式を判定する
+	if driver == "sqlite" {
+		// SQLiteは同時に1つしか書き込めないので、接続を1つにしてロック待ちのエラーを避ける
+		db.SetMaxOpenConns(1)
+	}
+
+	xdb := sqlx.NewDb(db, driverName)
 	return xdb, nil
-}
\ No newline at end of file
+}
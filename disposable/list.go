@@ -0,0 +1,132 @@
+package disposable
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"log/slog"
+	"login-example/logging"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ビルド時に埋め込む使い捨てメールアドレスのドメインの一覧。更新できない環境でもこの一覧で判定する
+//
+//go:embed domains.txt
+var embeddedDomains string
+
+// 取得した一覧がこれより少ない場合は、取得に失敗したものとして更新しない
+// 空のファイルやエラーページで一覧を置き換えて、全て許可してしまわないようにする
+const minRefreshDomains = 100
+
+// 一覧の最大サイズ
+const maxListSize = 10 << 20
+
+// emailのドメインが使い捨てメールアドレスのサービスのものか判定する
+type IChecker interface {
+	IsDisposable(domain string) bool
+}
+
+// 使い捨てメールアドレスのドメインの一覧。URLが設定されている場合は、定期的に取得し直す
+type List struct {
+	domains atomic.Pointer[map[string]struct{}]
+	url     string
+	client  *http.Client
+}
+
+// urlが空の場合は、埋め込んだ一覧だけを使う
+func NewList(url string) *List {
+	l := &List{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+	domains, _ := parse(strings.NewReader(embeddedDomains))
+	l.domains.Store(&domains)
+	return l
+}
+
+// ドメインか、その親ドメインが一覧に含まれているか。サブドメインを使い捨てにするサービスもある
+func (l *List) IsDisposable(domain string) bool {
+	domains := *l.domains.Load()
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for domain != "" {
+		if _, ok := domains[domain]; ok {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	return false
+}
+
+// URLから一覧を取得して置き換える
+func (l *List) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "login-example")
+
+	res, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch disposable domains: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from disposable domains list: %d", res.StatusCode)
+	}
+
+	domains, err := parse(io.LimitReader(res.Body, maxListSize))
+	if err != nil {
+		return err
+	}
+	if len(domains) < minRefreshDomains {
+		return fmt.Errorf("too few disposable domains: %d", len(domains))
+	}
+	l.domains.Store(&domains)
+	return nil
+}
+
+// interval毎に一覧を取得し直す。URLが設定されていない場合は何もしない
+// 取得に失敗した場合は、前回の一覧を使い続ける
+func (l *List) Run(ctx context.Context, interval time.Duration) {
+	if l.url == "" {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Refresh(ctx); err != nil {
+			logger.WarnContext(ctx, "failed to refresh disposable domains", logging.Err(err))
+		} else {
+			logger.InfoContext(ctx, "disposable domains refreshed", slog.Int("count", len(*l.domains.Load())))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 1行に1つのドメイン。空行と#から始まる行は無視する
+func parse(r io.Reader) (map[string]struct{}, error) {
+	domains := map[string]struct{}{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read disposable domains: %w", err)
+	}
+	return domains, nil
+}
@@ -0,0 +1,11 @@
+// APIドキュメント(OpenAPI)とSwagger UI
+package docs
+
+import _ "embed"
+
+var (
+	//go:embed openapi.yaml
+	OpenAPI []byte
+	//go:embed swagger.html
+	SwaggerUI []byte
+)
@@ -0,0 +1,71 @@
+package entity
+
+import "time"
+
+// 認証に関するイベントの監査ログ
+type AuditLog struct {
+	ID AuditLogID `db:"id"`
+	// ユーザーが特定できないイベント(存在しないemailでのログインなど)の場合は0
+	UserID    UserID     `db:"user_id"`
+	Email     string     `db:"email"`
+	Event     AuditEvent `db:"event"`
+	Detail    string     `db:"detail"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type AuditLogs []*AuditLog
+
+type AuditLogID uint64
+
+type AuditEvent string
+
+const (
+	AuditPreRegister      = AuditEvent("pre_register")
+	AuditActivate         = AuditEvent("activate")
+	AuditLoginSuccess     = AuditEvent("login_success")
+	AuditLoginFailure     = AuditEvent("login_failure")
+	AuditRefresh          = AuditEvent("refresh")
+	AuditLogout           = AuditEvent("logout")
+	AuditLogoutAll        = AuditEvent("logout_all")
+	AuditPasswordChange   = AuditEvent("password_change")
+	AuditEmailChange      = AuditEvent("email_change")
+	AuditProfileUpdate    = AuditEvent("profile_update")
+	AuditAvatarUpdate     = AuditEvent("avatar_update")
+	AuditPreferenceUpdate = AuditEvent("preference_update")
+	AuditUsernameChange   = AuditEvent("username_change")
+	AuditUsernameDelete   = AuditEvent("username_delete")
+	AuditPhoneVerify      = AuditEvent("phone_verify")
+	AuditPhoneDelete      = AuditEvent("phone_delete")
+	AuditDelete           = AuditEvent("delete")
+	AuditEmailBounce      = AuditEvent("email_bounce")
+	AuditEmailComplaint   = AuditEvent("email_complaint")
+	AuditSudo             = AuditEvent("sudo")
+	AuditTokenCreate      = AuditEvent("token_create")
+	AuditTokenRevoke      = AuditEvent("token_revoke")
+	AuditOIDCAuthorize    = AuditEvent("oidc_authorize")
+	AuditSCIMCreate       = AuditEvent("scim_create")
+	AuditSCIMUpdate       = AuditEvent("scim_update")
+	AuditOrgCreate        = AuditEvent("org_create")
+	AuditOrgMemberRemove  = AuditEvent("org_member_remove")
+	AuditOrgInvite        = AuditEvent("org_invite")
+	AuditOrgInviteAccept  = AuditEvent("org_invite_accept")
+	AuditInviteCodeCreate = AuditEvent("invite_code_create")
+	AuditInviteCodeRevoke = AuditEvent("invite_code_revoke")
+	// 使い捨てメールアドレスで仮登録された
+	AuditDisposableEmail = AuditEvent("disposable_email")
+	// 新しい環境からのログインを通知した
+	AuditLoginAlert = AuditEvent("login_alert")
+	// ログインの通知から、心当たりがないとしてセッションが失効された
+	AuditLoginDenied = AuditEvent("login_denied")
+	// 過去にログインしたことがない国からログインされた
+	AuditLoginNewCountry = AuditEvent("login_new_country")
+	// 直前のログインの場所から、ありえない速さで移動してログインされた
+	AuditImpossibleTravel = AuditEvent("impossible_travel")
+	// 端末を信頼済みとして登録した、または登録を取り消した
+	AuditDeviceTrust  = AuditEvent("device_trust")
+	AuditDeviceRevoke = AuditEvent("device_revoke")
+	// 管理者がユーザーの利用を停止、禁止、または解除した
+	AuditUserSuspend   = AuditEvent("user_suspend")
+	AuditUserBan       = AuditEvent("user_ban")
+	AuditUserReinstate = AuditEvent("user_reinstate")
+)
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// OpenID Connectの認可コード。トークンエンドポイントで一度だけ交換できる
+// コード自体はRPへのリダイレクトでのみ返し、SHA-256のハッシュのみを保存する
+type AuthorizationCode struct {
+	CodeHash    string `db:"code_hash"`
+	ClientID    string `db:"client_id"`
+	UserID      UserID `db:"user_id"`
+	RedirectURI string `db:"redirect_uri"`
+	// スペース区切りのscope
+	Scopes string `db:"scopes"`
+	// IDトークンにそのまま含める。空の場合は含めない
+	Nonce string `db:"nonce"`
+	// PKCE(S256)のcode_challenge。空の場合はcode_verifierを確認しない
+	CodeChallenge string    `db:"code_challenge"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+func (c AuthorizationCode) IsExpired() bool {
+	return !c.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// ユーザーの個人データをまとめたエクスポート
+type DataExport struct {
+	ID        DataExportID `db:"id"`
+	UserID    UserID       `db:"user_id"`
+	Data      []byte       `db:"data"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+type DataExportID uint64
+
+func (e DataExport) IsExpired() bool {
+	return !e.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// Idempotency-Keyヘッダーを付けて受け付けたリクエストと、そのレスポンス
+// 再送されたリクエストには、保存したレスポンスをそのまま返す
+type IdempotencyKey struct {
+	// キー自体は保存せず、SHA-256のハッシュのみを保存する
+	KeyHash string `db:"key_hash"`
+	// 同じキーで別のリクエストが送られていないか確認するための、メソッド、パス、ボディなどのハッシュ
+	Fingerprint string `db:"fingerprint"`
+	// 0の場合は処理中
+	StatusCode int `db:"status_code"`
+	// トークンを含むことがあるので、リクエストから導出した鍵で暗号化したヘッダーとボディ
+	Response []byte `db:"response"`
+	// 処理中の場合に、この時刻まではほかのリクエストにキーを使わせない
+	LockedUntil time.Time `db:"locked_until"`
+	ExpiresAt   time.Time `db:"expires_at"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// レスポンスを保存済みで、再送されたリクエストに返せる
+func (k IdempotencyKey) IsCompleted() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// OAuth2のプロバイダーのアカウントとユーザーの紐付け
+type Identity struct {
+	ID        IdentityID `db:"id"`
+	UserID    UserID     `db:"user_id"`
+	Provider  string     `db:"provider"`
+	Subject   string     `db:"subject"`
+	Email     string     `db:"email"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type Identities []*Identity
+
+type IdentityID uint64
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// 招待制で登録する場合に、仮登録で入力する招待コード。adminが発行する
+// コード自体は発行時にだけ返し、SHA-256のハッシュのみを保存する
+type InviteCode struct {
+	ID       InviteCodeID `db:"id"`
+	CodeHash string       `db:"code_hash"`
+	// 誰に配布したかなど、adminが区別するためのメモ
+	Note string `db:"note"`
+	// 登録できる人数
+	MaxUses  int `db:"max_uses"`
+	UseCount int `db:"use_count"`
+	// nilの場合は無期限
+	ExpiresAt *time.Time `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+	CreatedBy UserID     `db:"created_by"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type InviteCodes []*InviteCode
+
+type InviteCodeID uint64
+
+// 取り消し済み、期限切れ、または使い切った招待コードは使えない
+func (c InviteCode) IsUsable() bool {
+	return c.RevokedAt == nil && c.UseCount < c.MaxUses && (c.ExpiresAt == nil || c.ExpiresAt.After(time.Now()))
+}
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// ログインしたクライアントの情報
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	// 信頼済みの端末のcookieのトークン。登録していない端末の場合は空
+	DeviceToken string
+}
+
+// ログインの履歴
+type LoginHistory struct {
+	ID        LoginHistoryID `db:"id"`
+	UserID    UserID         `db:"user_id"`
+	Method    string         `db:"method"`
+	IPAddress string         `db:"ip_address"`
+	UserAgent string         `db:"user_agent"`
+	// GeoIPで調べた接続元の位置。GeoIPが無効か、位置がわからない場合は空
+	Country   string    `db:"country"`
+	City      string    `db:"city"`
+	Latitude  *float64  `db:"latitude"`
+	Longitude *float64  `db:"longitude"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type LoginHistories []*LoginHistory
+
+type LoginHistoryID uint64
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// client credentialsグラントでアクセストークンを取得できる、登録済みのサービス
+// シークレットは登録時にだけ表示し、SHA-256のハッシュのみを保存する
+type OAuthClient struct {
+	ID         string `db:"id"`
+	Name       string `db:"name"`
+	SecretHash string `db:"secret_hash"`
+	// スペース区切りのscope。ClientScopesの中から選ぶ
+	Scopes string `db:"scopes"`
+	// OpenID Connectの認可コードを返せるURL。スペース区切り。空の場合は認可コードフローを使えない
+	RedirectURIs string    `db:"redirect_uris"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// 登録済みのリダイレクトURLか。オープンリダイレクトを防ぐため、完全一致で比較する
+func (c OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(strings.Fields(c.RedirectURIs), uri)
+}
+
+// クライアントに許可できるscope。ユーザーに紐づく操作のscopeは許可しない
+var ClientScopes = []string{ScopeAdminRead}
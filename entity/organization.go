@@ -0,0 +1,47 @@
+package entity
+
+import "time"
+
+// 顧客ごとのワークスペース。ユーザーは複数の組織に所属でき、組織のトークンでは所属する組織のデータだけを扱う
+type Organization struct {
+	ID        OrganizationID `db:"id"`
+	Name      string         `db:"name"`
+	CreatedAt time.Time      `db:"created_at"`
+	UpdatedAt time.Time      `db:"updated_at"`
+}
+
+type OrganizationID uint64
+
+// 組織の中でのrole。ユーザーのrole(UserRole)とは別に、組織ごとに持つ
+type OrganizationRole string
+
+const (
+	// 組織を作成したユーザー。組織に必ず1人以上いる
+	OrgOwner  = OrganizationRole("owner")
+	OrgAdmin  = OrganizationRole("admin")
+	OrgMember = OrganizationRole("member")
+)
+
+// メンバーの招待や削除ができるか
+func (r OrganizationRole) CanManageMembers() bool {
+	return r == OrgOwner || r == OrgAdmin
+}
+
+// 組織のメンバー。emailはuserテーブルから取得する
+type OrganizationMember struct {
+	OrganizationID OrganizationID   `db:"organization_id"`
+	UserID         UserID           `db:"user_id"`
+	Email          string           `db:"email"`
+	Role           OrganizationRole `db:"role"`
+	CreatedAt      time.Time        `db:"created_at"`
+}
+
+type OrganizationMembers []*OrganizationMember
+
+// ユーザーが所属する組織と、その組織でのrole
+type Membership struct {
+	Organization
+	Role OrganizationRole `db:"role"`
+}
+
+type Memberships []*Membership
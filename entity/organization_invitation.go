@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// 組織への招待。招待メールのトークンはSHA-256のハッシュのみを保存する
+// 招待されたemailのユーザーが承諾すると、Roleのメンバーとして追加する
+type OrganizationInvitation struct {
+	ID             OrganizationInvitationID `db:"id"`
+	OrganizationID OrganizationID           `db:"organization_id"`
+	Email          string                   `db:"email"`
+	Role           OrganizationRole         `db:"role"`
+	TokenHash      string                   `db:"token_hash"`
+	InvitedBy      UserID                   `db:"invited_by"`
+	ExpiresAt      time.Time                `db:"expires_at"`
+	// 承諾していない場合はnil
+	AcceptedAt *time.Time `db:"accepted_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+type OrganizationInvitationID uint64
+
+// 承諾済み、または期限切れの招待は使えない
+func (i OrganizationInvitation) IsUsable() bool {
+	return i.AcceptedAt == nil && i.ExpiresAt.After(time.Now())
+}
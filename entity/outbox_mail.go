@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// 送信待ちのメール。DBの更新と同じトランザクションで保存して、コミットしてから送信する
+type OutboxMail struct {
+	ID        OutboxMailID   `db:"id"`
+	Kind      OutboxMailKind `db:"kind"`
+	Recipient string         `db:"recipient"`
+	// 送信済みのメールは、トークンを残さないように空にする
+	Token     string `db:"token"`
+	Link      string `db:"link"`
+	Attempts  int    `db:"attempts"`
+	LastError string `db:"last_error"`
+	// 送信に失敗したメールを次に送信する時刻。nilの場合はすぐに送信する
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	SentAt        *time.Time `db:"sent_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+type OutboxMails []*OutboxMail
+
+type OutboxMailID uint64
+
+type OutboxMailKind string
+
+const (
+	OutboxActivateToken = OutboxMailKind("activate_token")
+	OutboxActivateCode  = OutboxMailKind("activate_code")
+)
@@ -0,0 +1,91 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idのパラメータ
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// パスワードのハッシュ化に使うパラメータ。変更すると、ログイン時に新しいパラメータで再ハッシュ化される
+var PasswordHashParams = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 2,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var ErrPasswordMismatch = errors.New("password mismatch")
+
+// Argon2idでハッシュ化して、PHC形式の文字列にする
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func hashArgon2id(pw []byte, p Argon2Params) (Password, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to read random: %w", err)
+	}
+	key := argon2.IDKey(pw, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return Password(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+// PHC形式の文字列から、パラメータとソルト、ハッシュを取り出す
+func decodeArgon2id(hashed Password) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(string(hashed), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("failed to parse version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("failed to parse params: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("failed to decode salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("failed to decode hash: %w", err)
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	return p, salt, key, nil
+}
+
+func compareArgon2id(hashed Password, pw []byte) error {
+	p, salt, key, err := decodeArgon2id(hashed)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey(pw, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+// ユーザーがAPIを使うために発行した、長期間有効なトークン
+// トークン自体は発行時にだけ返し、SHA-256のハッシュのみを保存する
+type PersonalAccessToken struct {
+	ID     PersonalAccessTokenID `db:"id"`
+	UserID UserID                `db:"user_id"`
+	// ユーザーが区別するための名前
+	Name      string `db:"name"`
+	TokenHash string `db:"token_hash"`
+	// スペース区切りのscope
+	Scopes string `db:"scopes"`
+	// nilの場合は無期限
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+type PersonalAccessTokens []*PersonalAccessToken
+
+type PersonalAccessTokenID uint64
+
+func (t PersonalAccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// リフレッシュトークンを発行したログインセッション
+type Session struct {
+	ID         SessionID `db:"id"`
+	UserID     UserID    `db:"user_id"`
+	IPAddress  string    `db:"ip_address"`
+	UserAgent  string    `db:"user_agent"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	LastUsedAt time.Time `db:"last_used_at"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type Sessions []*Session
+
+type SessionID string
+
+func (s Session) IsExpired() bool {
+	return !s.ExpiresAt.After(time.Now())
+}
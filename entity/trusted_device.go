@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// ユーザーが信頼済みとして登録した端末。端末には署名したcookieを保存して識別する
+type TrustedDevice struct {
+	ID     TrustedDeviceID `db:"id"`
+	UserID UserID          `db:"user_id"`
+	// ユーザーが区別するための名前
+	Name string `db:"name"`
+	// 登録したときの接続元
+	IPAddress  string     `db:"ip_address"`
+	UserAgent  string     `db:"user_agent"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+type TrustedDevices []*TrustedDevice
+
+type TrustedDeviceID uint64
+
+func (d TrustedDevice) IsExpired() bool {
+	return !d.ExpiresAt.After(time.Now())
+}
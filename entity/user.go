@@ -1,20 +1,96 @@
 package entity
 
-import "time"
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 type User struct {
-	ID            UserID    `db:"id"`
-	Email         string    `db:"email"`
-	Salt          string    `db:"salt"`
-	State         UserState `db:"state"`
-	Password      Password  `db:"password"`
-	ActivateToken string    `db:"activate_token"`
-	UpdatedAt     time.Time `db:"updated_at"`
-	CreatedAt     time.Time `db:"created_at"`
+	ID    UserID `db:"id"`
+	Email string `db:"email"`
+	// 重複の確認に使う正規化したemail。小文字にして、設定によってはGmailのエイリアスも畳み込む
+	EmailKey string `db:"email_key"`
+	// ログインにemailの代わりに使える名前。小文字で保存する。nilの場合は未設定
+	Username         *string    `db:"username"`
+	Salt             string     `db:"salt"`
+	State            UserState  `db:"state"`
+	Role             UserRole   `db:"role"`
+	Password         Password   `db:"password"`
+	ActivateToken    string     `db:"activate_token"`    // 本人確認用トークンのハッシュ
+	ActivateAttempts int        `db:"activate_attempts"` // 本人確認用トークンの検証に失敗した回数
+	TokenRevokedAt   *time.Time `db:"token_revoked_at"`  // この日時より前に発行されたリフレッシュトークンは無効
+	// アクセストークンに埋め込むバージョン。全端末からログアウトするたびに1増やし、それより前のアクセストークンを無効にする
+	TokenVersion int `db:"token_version"`
+	// 確認待ちの変更後のemail
+	PendingEmail            string     `db:"pending_email"`
+	PendingEmailToken       string     `db:"pending_email_token"` // 確認用トークンのハッシュ
+	PendingEmailRequestedAt *time.Time `db:"pending_email_requested_at"`
+	PendingEmailAttempts    int        `db:"pending_email_attempts"` // 確認用トークンの検証に失敗した回数
+	// SMSで確認済みの電話番号(E.164形式)。空の場合は未登録
+	Phone string `db:"phone"`
+	// 確認待ちの電話番号と、SMSで送った確認コードのハッシュ
+	PendingPhone            string     `db:"pending_phone"`
+	PendingPhoneCode        string     `db:"pending_phone_code"`
+	PendingPhoneRequestedAt *time.Time `db:"pending_phone_requested_at"`
+	PendingPhoneAttempts    int        `db:"pending_phone_attempts"` // 確認コードの検証に失敗した回数
+	// SMSで送ったログイン用コードのハッシュ。使用済みの場合は空
+	SmsLoginCode       string     `db:"sms_login_code"`
+	SmsLoginCodeSentAt *time.Time `db:"sms_login_code_sent_at"`
+	SmsLoginAttempts   int        `db:"sms_login_attempts"` // ログイン用コードの検証に失敗した回数
+	// メール配信サービスから通知されたemailの状態と、通知された日時
+	EmailStatus   EmailStatus `db:"email_status"`
+	EmailStatusAt *time.Time  `db:"email_status_at"`
+	Profile
+	Preferences
+	// アップロードしたアバター画像の公開URL。空の場合は未設定
+	AvatarURL string `db:"avatar_url"`
+	// ユーザーを作成した外部のディレクトリ。空の場合はこのサービスで登録したユーザー
+	ProvisionedBy string     `db:"provisioned_by"`
+	DeletedAt     *time.Time `db:"deleted_at"`
+	// 退会する前のstate。退会を取り消す時に、利用停止などの状態を元に戻す
+	StateBeforeDelete UserState `db:"state_before_delete"`
+	// 楽観的ロックのためのバージョン。更新するたびに1増やす
+	Version   int       `db:"version"`
+	UpdatedAt time.Time `db:"updated_at"`
+	CreatedAt time.Time `db:"created_at"`
 }
 
 type Users []*User
 
+// ユーザーが自分で設定するプロフィール。どれも空でもよい
+type Profile struct {
+	// 氏名
+	Name string `db:"name"`
+	// 他のユーザーに表示する名前
+	DisplayName string `db:"display_name"`
+	// 自己紹介
+	Bio string `db:"bio"`
+}
+
+// ユーザーが自分で設定する、言語やタイムゾーン、通知の設定
+type Preferences struct {
+	// メールの言語(ja, en)。空の場合はサービスのデフォルト
+	Locale string `db:"locale"`
+	// 通知に表示する日時のタイムゾーン。IANAの名前(Asia/Tokyo)で、空の場合は変換しない
+	TimeZone string `db:"timezone"`
+	// trueの場合は、新しい環境からに限らず、ログインのたびにメールで通知する
+	NotifyOnLogin bool `db:"notify_on_login"`
+	// trueの場合は、これまでにないIPアドレスかUser-Agentからのログインをメールで通知する
+	NotifyOnNewClient bool `db:"notify_on_new_client"`
+}
+
+// 前後の空白を取り除く
+func (p Profile) Trim() Profile {
+	return Profile{
+		Name:        strings.TrimSpace(p.Name),
+		DisplayName: strings.TrimSpace(p.DisplayName),
+		Bio:         strings.TrimSpace(p.Bio),
+	}
+}
+
 type UserID uint64
 
 type Password string
@@ -32,25 +108,125 @@ type UserState string
 const (
 	UserActive   = UserState("active")
 	UserInactive = UserState("inactive")
+	UserDeleted  = UserState("deleted")
+	// SCIMなどで管理者に無効化された。仮登録のユーザーと違い、作り直さずに再び有効にできる
+	UserDisabled = UserState("disabled")
+	// 管理者に一時的に利用を停止された。解除すると再び有効になる
+	UserSuspended = UserState("suspended")
+	// 規約違反などで管理者に利用を禁止された
+	UserBanned = UserState("banned")
+)
+
+// emailにメールを届けられるか
+type EmailStatus string
+
+const (
+	EmailDeliverable = EmailStatus("deliverable")
+	// 宛先が存在しないなどで、恒久的にバウンスした
+	EmailBouncing = EmailStatus("bouncing")
+	// 受信者が迷惑メールとして報告した
+	EmailComplained = EmailStatus("complained")
+)
+
+// SCIMで作成したユーザーのProvisionedBy。SCIMのAPIではこのユーザーだけを扱う
+const ProvisionedBySCIM = "scim"
+
+type UserRole string
+
+const (
+	RoleUser  = UserRole("user")
+	RoleAdmin = UserRole("admin")
 )
 
 func (u User) IsActive() bool {
 	return u.State == UserActive
 }
 
-// パスワード＋ソルトをハッシュ化する
+// 管理者に利用を停止、または禁止されているか
+func (u User) IsRestricted() bool {
+	return u.State == UserSuspended || u.State == UserBanned
+}
+
+// 本人確認が済んでいない仮登録のユーザーか。同じemailで登録し直す場合は削除して作り直す
+func (u User) IsPending() bool {
+	return u.State == UserInactive
+}
+
+// バウンスや迷惑メールの報告があったemailには、それ以上メールを送信しない
+func (u User) CanReceiveMail() bool {
+	return u.EmailStatus != EmailBouncing && u.EmailStatus != EmailComplained
+}
+
+func (u User) HasRole(role UserRole) bool {
+	return u.Role == role
+}
+
+// アクセストークンのscopeで許可する操作
+const (
+	ScopeUserRead  = "user:read"
+	ScopeUserWrite = "user:write"
+	ScopeAdminRead = "admin:read"
+	// 招待コードの発行など、/adminの変更。adminのユーザーにのみ付与する
+	ScopeAdminWrite = "admin:write"
+)
+
+// OpenID Connectで他のアプリにログインする場合に、RPに許可するscope
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// RPが要求できるscope
+var OIDCScopes = []string{ScopeOpenID, ScopeEmail}
+
+// roleのユーザーに発行するアクセストークンのscope
+func (r UserRole) Scopes() []string {
+	switch r {
+	case RoleAdmin:
+		return []string{ScopeUserRead, ScopeUserWrite, ScopeAdminRead, ScopeAdminWrite}
+	case RoleUser:
+		return []string{ScopeUserRead, ScopeUserWrite}
+	}
+	return nil
+}
+
+// パスワード＋ソルトをArgon2idでハッシュ化する
 func (u *User) CreateHashedPassword(pw, salt string) (Password, error) {
 	var b bytes.Buffer
 	b.Write([]byte(pw))
 	b.Write([]byte(salt))
-	hashed, err := bcrypt.GenerateFromPassword(b.Bytes(), bcrypt.DefaultCost)
-	return Password(hashed), err
+	return hashArgon2id(b.Bytes(), PasswordHashParams)
 }
 
 // パスワードが正しいか検証する。
+// Argon2id導入前に登録されたユーザーのために、bcryptのハッシュも検証できるようにしている
 func (u User) Authenticate(pw string) error {
 	var b bytes.Buffer
 	b.Write([]byte(pw))
 	b.Write([]byte(u.Salt))
-	return bcrypt.CompareHashAndPassword([]byte(u.Password), b.Bytes())
+	if !strings.HasPrefix(string(u.Password), argon2idPrefix) {
+		return bcrypt.CompareHashAndPassword([]byte(u.Password), b.Bytes())
+	}
+	return compareArgon2id(u.Password, b.Bytes())
+}
+
+// 保存されているハッシュが、bcryptや古いパラメータで作られていて、再ハッシュ化が必要か
+func (u User) NeedsRehash() bool {
+	if !strings.HasPrefix(string(u.Password), argon2idPrefix) {
+		return true
+	}
+	p, _, _, err := decodeArgon2id(u.Password)
+	if err != nil {
+		return true
+	}
+	return p != PasswordHashParams
+}
+
+// issuedAtに発行されたトークンが、失効させられていないか
+func (u User) IsTokenRevoked(issuedAt time.Time) bool {
+	if u.TokenRevokedAt == nil {
+		return false
+	}
+	// JWTのiatは秒単位なので、秒未満は切り捨てて比較する
+	return issuedAt.Before(u.TokenRevokedAt.Truncate(time.Second))
 }
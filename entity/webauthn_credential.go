@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// WebAuthn(パスキー)で登録された認証器の公開鍵情報
+type WebAuthnCredential struct {
+	ID              WebAuthnCredentialID `db:"id"`
+	UserID          UserID               `db:"user_id"`
+	CredentialID    []byte               `db:"credential_id"`
+	PublicKey       []byte               `db:"public_key"`
+	AttestationType string               `db:"attestation_type"`
+	AAGUID          []byte               `db:"aaguid"`
+	SignCount       uint32               `db:"sign_count"`
+	UpdatedAt       time.Time            `db:"updated_at"`
+	CreatedAt       time.Time            `db:"created_at"`
+}
+
+type WebAuthnCredentials []*WebAuthnCredential
+
+type WebAuthnCredentialID uint64
@@ -1,18 +1,250 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"login-example/auth"
+	"login-example/captcha"
+	"login-example/handler"
+	"login-example/logging"
+	"login-example/mail"
+	myMiddleware "login-example/middleware"
+	"login-example/repository"
+	"login-example/usecase"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
+// problem+jsonのtypeに使うURIのプレフィックス。後ろにエラーコードを付ける
+var problemTypeBase = "https://login-example.local/problems/"
+
+const mimeApplicationProblemJSON = "application/problem+json"
+
+// RFC 7807のproblem details
+type problem struct {
+	Type   string
+	Title  string
+	Status int
+	Detail string
+	// フロントエンドがエラーの種類で分岐するための、機械可読なエラーコード
+	Code string
+	// エラーの種類ごとの追加情報。トップレベルのメンバーとして出力する
+	Extensions map[string]any
+	// 問い合わせの際にサーバーのログと突き合わせるためのリクエストID
+	RequestID string
+}
+
+func (p *problem) MarshalJSON() ([]byte, error) {
+	m := map[string]any{}
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	m["code"] = p.Code
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.RequestID != "" {
+		m["request_id"] = p.RequestID
+	}
+	return json.Marshal(m)
+}
+
+// usecaseのエラーと、HTTPステータスコード、エラーコードの対応
+var errorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{usecase.ErrInvalidCredential, http.StatusUnauthorized, "invalid_credential"},
+	{usecase.ErrSessionExpired, http.StatusUnauthorized, "session_expired"},
+	{usecase.ErrUserInactive, http.StatusForbidden, "user_inactive"},
+	{usecase.ErrUserSuspended, http.StatusForbidden, "user_suspended"},
+	{usecase.ErrUserBanned, http.StatusForbidden, "user_banned"},
+	{usecase.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+	{usecase.ErrAuthenticatorClone, http.StatusForbidden, "authenticator_cloned"},
+	{auth.ErrSudoRequired, http.StatusForbidden, "sudo_required"},
+	{auth.ErrNoUser, http.StatusForbidden, "user_token_required"},
+	{usecase.ErrInvalidClient, http.StatusUnauthorized, "invalid_client"},
+	{usecase.ErrUnsupportedGrantType, http.StatusBadRequest, "unsupported_grant_type"},
+	{usecase.ErrInvalidAuthorizationRequest, http.StatusBadRequest, "invalid_request"},
+	{usecase.ErrInvalidGrant, http.StatusBadRequest, "invalid_grant"},
+	{usecase.ErrUserNotProvisioned, http.StatusForbidden, "user_not_provisioned"},
+	{usecase.ErrNotOrgMember, http.StatusForbidden, "not_org_member"},
+	{usecase.ErrOrgPermissionDenied, http.StatusForbidden, "org_permission_denied"},
+	{usecase.ErrLastOwner, http.StatusConflict, "last_owner"},
+	{repository.ErrAlreadyMember, http.StatusConflict, "already_member"},
+	{usecase.ErrInvitationEmailMismatch, http.StatusForbidden, "invitation_email_mismatch"},
+	{usecase.ErrInvalidInviteCode, http.StatusForbidden, "invalid_invite_code"},
+	{usecase.ErrDisposableEmail, http.StatusForbidden, "disposable_email"},
+	{usecase.ErrStepUpRequired, http.StatusForbidden, "step_up_required"},
+	{captcha.ErrVerificationFailed, http.StatusBadRequest, "captcha_failed"},
+	{usecase.ErrUserAlreadyActive, http.StatusConflict, "user_already_active"},
+	{usecase.ErrInvalidUserState, http.StatusConflict, "invalid_user_state"},
+	{usecase.ErrEmailAlreadyInUse, http.StatusConflict, "email_already_in_use"},
+	{usecase.ErrPhoneAlreadyInUse, http.StatusConflict, "phone_already_in_use"},
+	{repository.ErrVersionConflict, http.StatusConflict, "conflict"},
+	{usecase.ErrInvalidToken, http.StatusBadRequest, "invalid_token"},
+	{usecase.ErrTokenExpired, http.StatusBadRequest, "token_expired"},
+	{usecase.ErrPasswordBreached, http.StatusBadRequest, "password_breached"},
+	{usecase.ErrEmailNotChanged, http.StatusBadRequest, "email_not_changed"},
+	{usecase.ErrNoEmailChange, http.StatusBadRequest, "no_email_change"},
+	{usecase.ErrInvalidPhone, http.StatusBadRequest, "invalid_phone"},
+	{usecase.ErrPhoneNotChanged, http.StatusBadRequest, "phone_not_changed"},
+	{usecase.ErrNoPhoneChange, http.StatusBadRequest, "no_phone_change"},
+	{usecase.ErrInvalidUsername, http.StatusBadRequest, "invalid_username"},
+	{usecase.ErrUsernameReserved, http.StatusBadRequest, "username_reserved"},
+	{usecase.ErrUsernameAlreadyInUse, http.StatusConflict, "username_already_in_use"},
+	{usecase.ErrUnsupportedLocale, http.StatusBadRequest, "unsupported_locale"},
+	{usecase.ErrInvalidTimeZone, http.StatusBadRequest, "invalid_timezone"},
+	{usecase.ErrInvalidScope, http.StatusBadRequest, "invalid_scope"},
+	{usecase.ErrTooManyTokens, http.StatusConflict, "too_many_tokens"},
+	{usecase.ErrTooManyDevices, http.StatusConflict, "too_many_devices"},
+	{usecase.ErrTooManySessions, http.StatusConflict, "too_many_sessions"},
+	{usecase.ErrInvalidImage, http.StatusBadRequest, "invalid_image"},
+	{usecase.ErrImageTooLarge, http.StatusRequestEntityTooLarge, "image_too_large"},
+	{usecase.ErrUnknownProvider, http.StatusNotFound, "unknown_provider"},
+	{usecase.ErrInvalidOAuthState, http.StatusBadRequest, "invalid_state"},
+	{mail.ErrUnknownWebhookProvider, http.StatusNotFound, "unknown_provider"},
+	{myMiddleware.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency_key_reused"},
+	{myMiddleware.ErrIdempotencyInProgress, http.StatusConflict, "idempotency_in_progress"},
+	{usecase.ErrTooManyAttempts, http.StatusTooManyRequests, "too_many_attempts"},
+	{usecase.ErrResendTooSoon, http.StatusTooManyRequests, "resend_too_soon"},
+	// IDで指定したリソースが存在しない。ログインや本人確認では、登録されているかを知られないようにusecaseで別のエラーにする
+	{sql.ErrNoRows, http.StatusNotFound, "not_found"},
+}
+
 func customHTTPErrorHandler(err error, c echo.Context) {
-	c.Logger().Error(err)
-	
-	// エラーの内容をそのまま返すのは本当はNG
-	if err := c.JSON(http.StatusInternalServerError, echo.Map{
-		"message": err.Error(),
+	ctx := c.Request().Context()
+	logger := logging.FromContext(ctx)
+	if c.Response().Committed {
+		logger.ErrorContext(ctx, "error after response committed", logging.Err(err))
+		return
+	}
+
+	p := newProblem(err)
+	p.RequestID = myMiddleware.RequestIDFromContext(ctx)
+	// クライアント起因のエラーは、サーバーの障害と区別するためWarnにする
+	level := slog.LevelWarn
+	if p.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.Log(ctx, level, "request failed", slog.String("code", p.Code), logging.Err(err))
+
+	// SCIMのクライアントは、RFC 7644の形式でエラーを受け取る
+	if strings.HasPrefix(c.Request().URL.Path, "/scim/") {
+		writeSCIMError(c, p)
+		return
+	}
+
+	// c.JSONはContent-Typeが設定済みの場合は上書きしない
+	c.Response().Header().Set(echo.HeaderContentType, mimeApplicationProblemJSON)
+	if err := c.JSON(p.Status, p); err != nil {
+		logger.ErrorContext(ctx, "failed to write error response", logging.Err(err))
+	}
+}
+
+// validation_failedの場合に返す、違反した項目
+type fieldError struct {
+	// リクエストのjsonやクエリのキー
+	Field string `json:"field"`
+	// 違反したvalidateタグのルール(required, maxなど)
+	Rule string `json:"rule"`
+	// ルールのパラメーター。max=100なら"100"
+	Param string `json:"param,omitempty"`
+}
+
+// エラーをproblem detailsに変換する
+// 想定外のエラーの内容をそのまま返すのはNGなので、500の場合は詳細を返さない
+func newProblem(err error) *problem {
+	// パスワードが弱い場合は、理由の一覧を返してユーザーに修正してもらう
+	var wpe *usecase.WeakPasswordError
+	if errors.As(err, &wpe) {
+		p := buildProblem(http.StatusBadRequest, "weak_password", "password too weak")
+		p.Extensions = map[string]any{
+			"score":     wpe.Score,
+			"min_score": wpe.MinScore,
+			"reasons":   wpe.Reasons,
+		}
+		return p
+	}
+
+	// 登録できないドメインの場合は、どのドメインが拒否されたかを返す
+	var ede *usecase.EmailDomainError
+	if errors.As(err, &ede) {
+		p := buildProblem(http.StatusForbidden, "email_domain_not_allowed", "email domain not allowed for registration")
+		p.Extensions = map[string]any{"domain": ede.Domain}
+		return p
+	}
+
+	for _, es := range errorStatuses {
+		if errors.Is(err, es.err) {
+			return buildProblem(es.status, es.code, es.err.Error())
+		}
+	}
+
+	// リクエストボディのvalidateタグに違反している
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		p := buildProblem(http.StatusBadRequest, "validation_failed", ve.Error())
+		// フォームの項目ごとにエラーを表示できるように、違反した項目とルールを返す
+		fields := make([]fieldError, 0, len(ve))
+		for _, fe := range ve {
+			fields = append(fields, fieldError{Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()})
+		}
+		p.Extensions = map[string]any{"fields": fields}
+		return p
+	}
+
+	// Bindの失敗や存在しないルートなど、echoが返すエラー
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		detail, _ := he.Message.(string)
+		return buildProblem(he.Code, statusCode(he.Code), detail)
+	}
+
+	return buildProblem(http.StatusInternalServerError, "internal_error", "")
+}
+
+// SCIMのscimTypeに対応するエラーコード。ディレクトリは409のuniquenessで既存のユーザーと紐付ける
+var scimTypes = map[string]string{
+	"email_already_in_use": "uniqueness",
+	"validation_failed":    "invalidValue",
+	"bad_request":          "invalidSyntax",
+}
+
+func writeSCIMError(c echo.Context, p *problem) {
+	ctx := c.Request().Context()
+	c.Response().Header().Set(echo.HeaderContentType, handler.MIMEApplicationSCIMJSON)
+	if err := c.JSON(p.Status, handler.SCIMErrorResponse{
+		Schemas:  []string{handler.SCIMErrorSchema},
+		Status:   strconv.Itoa(p.Status),
+		ScimType: scimTypes[p.Code],
+		Detail:   p.Detail,
 	}); err != nil {
-		c.Logger().Error(err)
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to write error response", logging.Err(err))
+	}
+}
+
+func buildProblem(status int, code, detail string) *problem {
+	return &problem{
+		Type:   problemTypeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
 	}
-}
\ No newline at end of file
+}
+
+// ステータスコードからエラーコードを作成する。例: 404 -> not_found
+func statusCode(status int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
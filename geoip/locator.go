@@ -0,0 +1,93 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// IPアドレスがDBに含まれていないか、プライベートアドレスなどで位置がわからない
+var ErrNotFound = errors.New("location not found")
+
+// 地球の平均半径(km)
+const earthRadiusKm = 6371.0
+
+// IPアドレスから接続元のおおよその位置を調べる
+type ILocator interface {
+	// 位置がわからない場合はErrNotFoundを返す
+	Lookup(ip string) (*Location, error)
+}
+
+// IPアドレスから調べた接続元の位置
+type Location struct {
+	// ISO 3166-1 alpha-2の国コード
+	Country string
+	// 空の場合もある
+	City string
+	// 緯度と経度がわからない場合はnil
+	Latitude  *float64
+	Longitude *float64
+}
+
+// 2つの位置の間の距離(km)。どちらかの緯度と経度がわからない場合はfalseを返す
+func Distance(a, b *Location) (float64, bool) {
+	if a.Latitude == nil || a.Longitude == nil || b.Latitude == nil || b.Longitude == nil {
+		return 0, false
+	}
+	// haversineの公式
+	lat1, lat2 := radians(*a.Latitude), radians(*b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(*b.Longitude - *a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h))), true
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// MaxMindのGeoLite2/GeoIP2のCityかCountryのDB(mmdb)で位置を調べる
+type MaxMindLocator struct {
+	db *geoip2.Reader
+}
+
+// DBのファイルを開く。使い終わったらCloseする
+func OpenMaxMind(path string) (*MaxMindLocator, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	return &MaxMindLocator{db: db}, nil
+}
+
+func (l *MaxMindLocator) Lookup(ip string) (*Location, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, ErrNotFound
+	}
+	// CountryのDBでもCityとして読める。その場合は都市と緯度経度が空になる
+	rec, err := l.db.City(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup geoip: %w", err)
+	}
+	if rec.Country.IsoCode == "" {
+		return nil, ErrNotFound
+	}
+	loc := &Location{
+		Country: rec.Country.IsoCode,
+		City:    rec.City.Names["en"],
+	}
+	// 緯度経度がわからない場合は、精度の半径が0になる
+	if rec.Location.AccuracyRadius > 0 {
+		lat, lon := rec.Location.Latitude, rec.Location.Longitude
+		loc.Latitude, loc.Longitude = &lat, &lon
+	}
+	return loc, nil
+}
+
+func (l *MaxMindLocator) Close() error {
+	return l.db.Close()
+}
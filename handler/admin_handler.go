@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/repository"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IAdminHandler interface {
+	ListAuditLogs(c echo.Context) error
+	ListUsers(c echo.Context) error
+	SetUserState(c echo.Context) error
+}
+
+type adminHandler struct {
+	au usecase.IAdminUsecase
+}
+
+func NewAdminHandler(au usecase.IAdminUsecase) IAdminHandler {
+	return &adminHandler{au: au}
+}
+
+func (h *adminHandler) ListAuditLogs(c echo.Context) error {
+	qp := AuditLogQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ls, total, err := h.au.ListAuditLogs(ctx, repository.AuditListOptions{
+		Limit:  qp.Limit,
+		Offset: qp.Offset,
+		UserID: entity.UserID(qp.UserID),
+		Event:  entity.AuditEvent(qp.Event),
+	})
+	if err != nil {
+		return err
+	}
+
+	res := AuditLogsResponse{AuditLogs: make([]AuditLogResponse, 0, len(ls)), Total: total}
+	for _, l := range ls {
+		res.AuditLogs = append(res.AuditLogs, AuditLogResponse{
+			ID:        l.ID,
+			UserID:    l.UserID,
+			Email:     l.Email,
+			Event:     l.Event,
+			Detail:    l.Detail,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// emailの状態で絞り込んで、バウンスしているユーザーなどを確認できる
+func (h *adminHandler) ListUsers(c echo.Context) error {
+	qp := AdminUserQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	us, total, err := h.au.ListUsers(ctx, repository.ListOptions{
+		Limit:       qp.Limit,
+		Offset:      qp.Offset,
+		State:       entity.UserState(qp.State),
+		EmailStatus: entity.EmailStatus(qp.EmailStatus),
+	})
+	if err != nil {
+		return err
+	}
+
+	res := AdminUsersResponse{Users: make([]AdminUserResponse, 0, len(us)), Total: total}
+	for _, u := range us {
+		res.Users = append(res.Users, newAdminUserResponse(u))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ユーザーの利用を停止、禁止、または解除する
+func (h *adminHandler) SetUserState(c echo.Context) error {
+	adminID, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+
+	rb := SetUserStateRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.au.SetUserState(ctx, adminID, entity.UserID(id), entity.UserState(rb.State), rb.Reason)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAdminUserResponse(u))
+}
+
+func newAdminUserResponse(u *entity.User) AdminUserResponse {
+	return AdminUserResponse{
+		ID:            u.ID,
+		Email:         u.Email,
+		State:         u.State,
+		Role:          u.Role,
+		EmailStatus:   u.EmailStatus,
+		EmailStatusAt: u.EmailStatusAt,
+		UpdatedAt:     u.UpdatedAt,
+		CreatedAt:     u.CreatedAt,
+	}
+}
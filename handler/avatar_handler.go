@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"login-example/auth"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// multipartの境界やヘッダーの分として、ファイルの最大サイズに加えて許可するリクエストボディのサイズ
+const multipartOverhead = 64 << 10
+
+type IAvatarHandler interface {
+	Upload(c echo.Context) error
+}
+
+type avatarHandler struct {
+	au usecase.IAvatarUsecase
+	// アップロードできるファイルの最大サイズ(バイト)
+	maxSize int64
+}
+
+func NewAvatarHandler(au usecase.IAvatarUsecase, maxSize int64) IAvatarHandler {
+	return &avatarHandler{au: au, maxSize: maxSize}
+}
+
+// multipart/form-dataのavatarフィールドで画像を受け取る
+func (h *avatarHandler) Upload(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	// 大きすぎるリクエストは、一時ファイルに書き出す前に読むのをやめる
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.maxSize+multipartOverhead)
+	fh, err := c.FormFile("avatar")
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return usecase.ErrImageTooLarge
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "avatar file is required").SetInternal(err)
+	}
+	if fh.Size > h.maxSize {
+		return usecase.ErrImageTooLarge
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	u, err := h.au.Upload(req.Context(), uid, f)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newUserResponse(u))
+}
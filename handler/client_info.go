@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"login-example/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 信頼済みの端末を識別するトークンを保存するcookie名
+const deviceCookie = "device-token"
+
+// ログイン履歴などに記録するため、リクエストからクライアントの情報を取得する
+func newClientInfo(c echo.Context) entity.ClientInfo {
+	ci := entity.ClientInfo{
+		IPAddress: c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+	if cookie, err := c.Cookie(deviceCookie); err == nil {
+		ci.DeviceToken = cookie.Value
+	}
+	return ci
+}
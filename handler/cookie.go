@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"login-example/random"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// double-submit方式のCSRFトークンを保持するcookie名。middleware.DefaultCSRFConfigと合わせる
+const csrfCookie = "csrf-token"
+
+// リフレッシュトークンのcookieのPath。/api/v1/auth/refreshと、/api直下に残しているv1の/api/auth/refreshの両方に送られるようにする
+// Pathを指定しないと、ブラウザーは発行したリクエストのディレクトリをPathにするので、/auth/login/magicなどで発行したcookieが/auth/refreshに送られない
+const refreshCookiePath = "/api"
+
+// リフレッシュトークンとCSRFトークンのcookieの属性
+type CookieAttributes struct {
+	Secure   bool
+	Domain   string
+	SameSite http.SameSite
+}
+
+// configの値で上書きする。httpsで配信する場合はSecureをtrueにする
+var RefreshCookieAttributes = CookieAttributes{
+	SameSite: http.SameSiteStrictMode,
+}
+
+// リフレッシュトークンのcookieと、リフレッシュ時に使うCSRFトークンのcookieをセットする
+func setRefreshCookie(c echo.Context, refreshCookie *http.Cookie) {
+	refreshCookie.Path = refreshCookiePath
+	refreshCookie.Secure = RefreshCookieAttributes.Secure
+	refreshCookie.Domain = RefreshCookieAttributes.Domain
+	refreshCookie.SameSite = RefreshCookieAttributes.SameSite
+	c.SetCookie(refreshCookie)
+
+	cookie := new(http.Cookie)
+	cookie.Name = csrfCookie
+	cookie.Value = random.URLSafeToken(32)
+	cookie.Expires = refreshCookie.Expires
+	cookie.Path = "/"
+	cookie.Secure = RefreshCookieAttributes.Secure
+	cookie.Domain = RefreshCookieAttributes.Domain
+	cookie.SameSite = RefreshCookieAttributes.SameSite
+	// JavaScriptから読み取ってヘッダーに付けてもらうので、HttpOnlyにはしない
+	cookie.HttpOnly = false
+	c.SetCookie(cookie)
+}
+
+// 信頼済みの端末を識別するトークンのcookieをセットする。ログインのリクエストで送られるようにPathは/にする
+func setDeviceCookie(c echo.Context, token []byte, expires time.Time) {
+	cookie := new(http.Cookie)
+	cookie.Name = deviceCookie
+	cookie.Value = string(token)
+	cookie.Expires = expires
+	cookie.Path = "/"
+	cookie.Secure = RefreshCookieAttributes.Secure
+	cookie.Domain = RefreshCookieAttributes.Domain
+	cookie.SameSite = RefreshCookieAttributes.SameSite
+	cookie.HttpOnly = true
+	c.SetCookie(cookie)
+}
+
+// リフレッシュトークンとCSRFトークンのcookieを削除する
+// Pathを指定せずに発行していた頃のcookieも、/auth/loginで発行したものは/authの下からのログアウトで削除する
+func clearRefreshCookie(c echo.Context) {
+	for _, path := range []string{refreshCookiePath, ""} {
+		refreshCookie := &http.Cookie{Name: "refresh-token", Path: path, MaxAge: -1, HttpOnly: true}
+		refreshCookie.Secure = RefreshCookieAttributes.Secure
+		refreshCookie.Domain = RefreshCookieAttributes.Domain
+		refreshCookie.SameSite = RefreshCookieAttributes.SameSite
+		c.SetCookie(refreshCookie)
+	}
+
+	csrf := &http.Cookie{Name: csrfCookie, MaxAge: -1, Path: "/"}
+	csrf.Secure = RefreshCookieAttributes.Secure
+	csrf.Domain = RefreshCookieAttributes.Domain
+	csrf.SameSite = RefreshCookieAttributes.SameSite
+	c.SetCookie(csrf)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// どのルートで発行・削除しても、/api/v1/auth/refreshと/api/auth/refreshに送られるPathにする
+func TestRefreshCookiePath(t *testing.T) {
+	for _, path := range []string{"/api/v1/auth/login/magic", "/api/v1/auth/saml/acs", "/api/auth/login", "/api/v1/restricted/user/me/logout-all"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, path, nil), rec)
+			setRefreshCookie(c, &http.Cookie{Name: "refresh-token", Value: "token"})
+			if got := findCookie(rec, "refresh-token", "token"); got == nil || got.Path != refreshCookiePath {
+				t.Errorf("issued cookie = %v, want Path=%s", got, refreshCookiePath)
+			}
+
+			rec = httptest.NewRecorder()
+			c = echo.New().NewContext(httptest.NewRequest(http.MethodPost, path, nil), rec)
+			clearRefreshCookie(c)
+			if got := findCookie(rec, "refresh-token", ""); got == nil || got.Path != refreshCookiePath || got.MaxAge >= 0 {
+				t.Errorf("cleared cookie = %v, want Path=%s and Max-Age<0", got, refreshCookiePath)
+			}
+		})
+	}
+}
+
+func findCookie(rec *httptest.ResponseRecorder, name, value string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name && c.Value == value && c.Path != "" {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"login-example/mail"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 開発環境用。mail.providerがcaptureの場合だけルートを登録する
+type IDevMailHandler interface {
+	ListMails(c echo.Context) error
+	ClearMails(c echo.Context) error
+}
+
+type devMailHandler struct {
+	cm *mail.CaptureMailer
+}
+
+func NewDevMailHandler(cm *mail.CaptureMailer) IDevMailHandler {
+	return &devMailHandler{cm: cm}
+}
+
+// 送信したメールを新しい順に返す
+func (h *devMailHandler) ListMails(c echo.Context) error {
+	qp := DevMailQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+
+	ms := h.cm.Mails(qp.To)
+	res := DevMailsResponse{Mails: make([]DevMailResponse, 0, len(ms))}
+	for _, m := range ms {
+		res.Mails = append(res.Mails, DevMailResponse{
+			To:      m.To,
+			Subject: m.Subject,
+			Text:    m.Text,
+			HTML:    m.HTML,
+			SentAt:  m.SentAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *devMailHandler) ClearMails(c echo.Context) error {
+	h.cm.Reset()
+	return c.NoContent(http.StatusNoContent)
+}
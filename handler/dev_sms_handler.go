@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"login-example/sms"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 開発環境用。sms.providerがfakeの場合だけルートを登録する
+type IDevSmsHandler interface {
+	ListMessages(c echo.Context) error
+	ClearMessages(c echo.Context) error
+}
+
+type devSmsHandler struct {
+	fs *sms.FakeSender
+}
+
+func NewDevSmsHandler(fs *sms.FakeSender) IDevSmsHandler {
+	return &devSmsHandler{fs: fs}
+}
+
+// 送信したSMSを新しい順に返す
+func (h *devSmsHandler) ListMessages(c echo.Context) error {
+	qp := DevMailQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+
+	ms := h.fs.Messages(qp.To)
+	res := DevSmsListResponse{Messages: make([]DevSmsResponse, 0, len(ms))}
+	for _, m := range ms {
+		res.Messages = append(res.Messages, DevSmsResponse{
+			To:     m.To,
+			Body:   m.Body,
+			SentAt: m.SentAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *devSmsHandler) ClearMessages(c echo.Context) error {
+	h.fs.Reset()
+	return c.NoContent(http.StatusNoContent)
+}
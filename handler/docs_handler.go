@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"login-example/docs"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IDocsHandler interface {
+	SwaggerUI(c echo.Context) error
+	OpenAPI(c echo.Context) error
+}
+
+type docsHandler struct{}
+
+func NewDocsHandler() IDocsHandler {
+	return &docsHandler{}
+}
+
+func (h *docsHandler) SwaggerUI(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, docs.SwaggerUI)
+}
+
+func (h *docsHandler) OpenAPI(c echo.Context) error {
+	return c.Blob(http.StatusOK, "application/yaml", docs.OpenAPI)
+}
@@ -0,0 +1,583 @@
+package handler
+
+import (
+	"encoding/json"
+	"login-example/entity"
+	"time"
+)
+
+// リクエストとレスポンスの型。docs/openapi.yamlのschemasと対応させる
+// パスは/api/v1からの相対パス
+
+// POST /auth/register/initial
+type PreRegisterRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	// 長いパスフレーズも使えるように、長さは上限だけを確認する。弱いパスワードはusecaseで強度を推定して拒否する
+	Password string `json:"password" validate:"required,lte=128"`
+	// 招待制の場合のみ必要
+	InviteCode string `json:"invite_code" validate:"omitempty,alphanum,max=32"`
+	// CAPTCHAが有効な場合のみ必要
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
+// POST /auth/register/complete
+type ActivateRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	// トークンの形式と長さは設定によって変わるので、usecaseで検証する
+	Token string `json:"token" validate:"required,alphanum,max=32"`
+	ProfileRequest
+}
+
+// プロフィール。どれも省略できる
+type ProfileRequest struct {
+	Name        string `json:"name" validate:"max=100"`
+	DisplayName string `json:"display_name" validate:"max=50"`
+	Bio         string `json:"bio" validate:"max=500"`
+}
+
+// emailだけを受け取るリクエスト
+// POST /auth/register/resend, /auth/login/magic, /auth/webauthn/login/begin
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// POST /auth/login
+// emailかusernameのどちらかが必要。両方ある場合はemailを使う
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required_without=Username,omitempty,email"`
+	Username string `json:"username" validate:"required_without=Email,omitempty,max=32,excludes=@"`
+	// LDAPのディレクトリのパスワードなど、このサービスのルールで設定していないパスワードもあるので、長さは上限だけを確認する
+	Password string `json:"password" validate:"required,lte=128"`
+	// trueの場合はログイン状態を長期間保持する
+	RememberMe bool `json:"remember_me"`
+	// CAPTCHAが有効な場合のみ必要
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
+// POST /auth/login/sms
+type SmsLoginCodeRequest struct {
+	// SMSで確認済みの電話番号(E.164形式)
+	Phone string `json:"phone" validate:"required,e164"`
+	// CAPTCHAが有効な場合のみ必要
+	CaptchaToken string `json:"captcha_token" validate:"max=4096"`
+}
+
+// POST /auth/login/sms/verify
+type SmsLoginRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+	// trueの場合はログイン状態を長期間保持する
+	RememberMe bool `json:"remember_me"`
+}
+
+// メールのリンクに含まれるトークンを受け取るクエリパラメータ
+// GET /auth/register/activate, /auth/login/magic, /auth/login/deny, /auth/export/download, /auth/invitations
+type TokenQuery struct {
+	Token string `query:"token" validate:"required"`
+}
+
+// GET /auth/oauth/:provider/callback
+type OAuthCallbackQuery struct {
+	Code  string `query:"code" validate:"required"`
+	State string `query:"state" validate:"required"`
+}
+
+// POST /auth/saml/acs (IdPからのHTTP-POST binding)
+type SAMLResponseRequest struct {
+	SAMLResponse string `form:"SAMLResponse" validate:"required"`
+	RelayState   string `form:"RelayState"`
+}
+
+// PATCH /restricted/user/me
+// 省略した項目は変更しない。空文字列を送るとその項目を消す
+type UpdateProfileRequest struct {
+	// GET /restricted/user/meで取得したversion
+	Version     int     `json:"version" validate:"required,gte=1"`
+	Name        *string `json:"name" validate:"omitempty,max=100"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+}
+
+// PUT /restricted/user/me/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,lte=128"`
+}
+
+// PUT /restricted/user/me/login-notification
+type LoginNotificationRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// PUT /restricted/user/me/preferences
+// 全ての項目を置き換える。localeとtimezoneは空文字列でデフォルトに戻す
+type PreferencesRequest struct {
+	Locale        string                         `json:"locale" validate:"max=16"`
+	TimeZone      string                         `json:"timezone" validate:"max=64"`
+	Notifications NotificationPreferencesRequest `json:"notifications"`
+}
+
+type NotificationPreferencesRequest struct {
+	// ログインのたびの通知
+	Login *bool `json:"login" validate:"required"`
+	// 新しい環境からのログインの通知
+	NewClient *bool `json:"new_client" validate:"required"`
+}
+
+// PUT /restricted/user/me/username
+// 形式と予約済みかどうかはusecaseで検証する
+type UsernameRequest struct {
+	Username string `json:"username" validate:"required,max=32"`
+}
+
+// POST /restricted/user/me/sudo
+type SudoRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// POST /restricted/user/me/tokens
+type CreatePersonalAccessTokenRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,required"`
+	// 0の場合は無期限
+	ExpiresInDays int `json:"expires_in_days" validate:"gte=0,lte=365"`
+}
+
+// POST /restricted/user/me/devices, PATCH /restricted/user/me/devices/:id
+type TrustedDeviceRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+// POST /restricted/orgs
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+// POST /restricted/org/invitations
+type InviteMemberRequest struct {
+	Email string                  `json:"email" validate:"required,email,max=255"`
+	Role  entity.OrganizationRole `json:"role" validate:"required,oneof=admin member"`
+}
+
+// POST /restricted/invitations/accept
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// POST /restricted/user/me/email/confirm
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required,len=8"`
+}
+
+// POST /restricted/user/me/phone
+type PhoneRequest struct {
+	// E.164形式。例: +819012345678
+	Phone string `json:"phone" validate:"required,e164"`
+}
+
+// POST /restricted/user/me/phone/confirm
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// GET /admin/audit-logs
+type AuditLogQuery struct {
+	UserID uint64 `query:"user_id"`
+	Event  string `query:"event"`
+	Limit  int    `query:"limit" validate:"gte=0,lte=100"`
+	Offset int    `query:"offset" validate:"gte=0"`
+}
+
+// GET /admin/users
+type AdminUserQuery struct {
+	State       string `query:"state" validate:"omitempty,oneof=active inactive disabled suspended banned deleted"`
+	EmailStatus string `query:"email_status" validate:"omitempty,oneof=deliverable bouncing complained"`
+	Limit       int    `query:"limit" validate:"gte=0,lte=100"`
+	Offset      int    `query:"offset" validate:"gte=0"`
+}
+
+// PUT /admin/users/:id/state
+// activeを指定すると、利用停止や禁止を解除する
+type SetUserStateRequest struct {
+	State  string `json:"state" validate:"required,oneof=active suspended banned"`
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+// POST /admin/invite-codes
+type CreateInviteCodeRequest struct {
+	Note    string `json:"note" validate:"max=255"`
+	MaxUses int    `json:"max_uses" validate:"required,gte=1,lte=10000"`
+	// 0の場合は無期限
+	ExpiresInDays int `json:"expires_in_days" validate:"gte=0,lte=365"`
+}
+
+// GET /dev/mails (開発環境のみ)
+type DevMailQuery struct {
+	To string `query:"to"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// X-Sudo-Tokenヘッダーで送る。expires_inは秒
+type SudoResponse struct {
+	SudoToken string `json:"sudo_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// versionは、PATCH /restricted/user/meで読み込んだ時から更新されていないことの確認に使う
+type UserResponse struct {
+	ID            entity.UserID `json:"id"`
+	Email         string        `json:"email"`
+	Username      string        `json:"username"`
+	Phone         string        `json:"phone"`
+	Name          string        `json:"name"`
+	DisplayName   string        `json:"display_name"`
+	Bio           string        `json:"bio"`
+	AvatarURL     string        `json:"avatar_url"`
+	NotifyOnLogin bool          `json:"notify_on_login"`
+	Version       int           `json:"version"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+type PreferencesResponse struct {
+	Locale        string                          `json:"locale"`
+	TimeZone      string                          `json:"timezone"`
+	Notifications NotificationPreferencesResponse `json:"notifications"`
+}
+
+type NotificationPreferencesResponse struct {
+	Login     bool `json:"login"`
+	NewClient bool `json:"new_client"`
+}
+
+// countryとcityは、GeoIPが無効か位置がわからない場合は省略する
+type LoginHistoryResponse struct {
+	Method    string    `json:"method"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginsResponse struct {
+	Logins []LoginHistoryResponse `json:"logins"`
+}
+
+type SessionResponse struct {
+	ID         entity.SessionID `json:"id"`
+	IPAddress  string           `json:"ip_address"`
+	UserAgent  string           `json:"user_agent"`
+	ExpiresAt  time.Time        `json:"expires_at"`
+	LastUsedAt time.Time        `json:"last_used_at"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// トークン自体は作成時のレスポンスでしか返さない
+type PersonalAccessTokenResponse struct {
+	ID         entity.PersonalAccessTokenID `json:"id"`
+	Name       string                       `json:"name"`
+	Scopes     []string                     `json:"scopes"`
+	ExpiresAt  *time.Time                   `json:"expires_at"`
+	LastUsedAt *time.Time                   `json:"last_used_at"`
+	CreatedAt  time.Time                    `json:"created_at"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	PersonalAccessTokenResponse
+	Token string `json:"token"`
+}
+
+type PersonalAccessTokensResponse struct {
+	Tokens []PersonalAccessTokenResponse `json:"tokens"`
+}
+
+type TrustedDeviceResponse struct {
+	ID         entity.TrustedDeviceID `json:"id"`
+	Name       string                 `json:"name"`
+	IPAddress  string                 `json:"ip_address"`
+	UserAgent  string                 `json:"user_agent"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+	LastUsedAt *time.Time             `json:"last_used_at"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type TrustedDevicesResponse struct {
+	Devices []TrustedDeviceResponse `json:"devices"`
+}
+
+// roleはリクエストしたユーザーの、その組織でのrole
+type OrganizationResponse struct {
+	ID        entity.OrganizationID   `json:"id"`
+	Name      string                  `json:"name"`
+	Role      entity.OrganizationRole `json:"role"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+type OrganizationsResponse struct {
+	Organizations []OrganizationResponse `json:"organizations"`
+}
+
+type OrganizationMemberResponse struct {
+	UserID    entity.UserID           `json:"user_id"`
+	Email     string                  `json:"email"`
+	Role      entity.OrganizationRole `json:"role"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+type OrganizationMembersResponse struct {
+	Members []OrganizationMemberResponse `json:"members"`
+}
+
+type OrganizationInvitationResponse struct {
+	ID        entity.OrganizationInvitationID `json:"id"`
+	Email     string                          `json:"email"`
+	Role      entity.OrganizationRole         `json:"role"`
+	ExpiresAt time.Time                       `json:"expires_at"`
+}
+
+// 招待メールのリンクを開いたクライアントに返す招待の内容
+type InvitationDetailResponse struct {
+	OrganizationName string                  `json:"organization_name"`
+	Email            string                  `json:"email"`
+	Role             entity.OrganizationRole `json:"role"`
+	ExpiresAt        time.Time               `json:"expires_at"`
+	// falseの場合は、emailで登録してから承諾する
+	Registered bool `json:"registered"`
+}
+
+type AuditLogResponse struct {
+	ID        entity.AuditLogID `json:"id"`
+	UserID    entity.UserID     `json:"user_id"`
+	Email     string            `json:"email"`
+	Event     entity.AuditEvent `json:"event"`
+	Detail    string            `json:"detail"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type AuditLogsResponse struct {
+	AuditLogs []AuditLogResponse `json:"audit_logs"`
+	Total     int64              `json:"total"`
+}
+
+type AdminUserResponse struct {
+	ID            entity.UserID      `json:"id"`
+	Email         string             `json:"email"`
+	State         entity.UserState   `json:"state"`
+	Role          entity.UserRole    `json:"role"`
+	EmailStatus   entity.EmailStatus `json:"email_status"`
+	EmailStatusAt *time.Time         `json:"email_status_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+type AdminUsersResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Total int64               `json:"total"`
+}
+
+// コード自体は作成時のレスポンスでしか返さない
+type InviteCodeResponse struct {
+	ID        entity.InviteCodeID `json:"id"`
+	Note      string              `json:"note"`
+	MaxUses   int                 `json:"max_uses"`
+	UseCount  int                 `json:"use_count"`
+	Usable    bool                `json:"usable"`
+	ExpiresAt *time.Time          `json:"expires_at"`
+	RevokedAt *time.Time          `json:"revoked_at"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+type CreateInviteCodeResponse struct {
+	InviteCodeResponse
+	Code string `json:"code"`
+}
+
+type InviteCodesResponse struct {
+	InviteCodes []InviteCodeResponse `json:"invite_codes"`
+}
+
+type DevMailResponse struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	HTML    string    `json:"html"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+type DevMailsResponse struct {
+	Mails []DevMailResponse `json:"mails"`
+}
+
+type DevSmsResponse struct {
+	To     string    `json:"to"`
+	Body   string    `json:"body"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+type DevSmsListResponse struct {
+	Messages []DevSmsResponse `json:"messages"`
+}
+
+// POST /auth/introspect (RFC 7662)。application/x-www-form-urlencodedで受け取る
+type IntrospectRequest struct {
+	Token string `form:"token" validate:"required"`
+	// access_token, refresh_token。トークンのtoken_typeで判断するので使わない
+	TokenTypeHint string `form:"token_type_hint"`
+}
+
+// POST /auth/token (application/x-www-form-urlencoded)
+type TokenRequest struct {
+	GrantType string `form:"grant_type" validate:"required"`
+	// スペース区切り。空の場合はクライアントに許可された全てのscope
+	Scope string `form:"scope"`
+	// HTTP Basic認証を使わない場合
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	// authorization_codeグラントの場合のみ
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	// authorization_codeグラントの場合のみ
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// GET /oauth2/authorize (クエリパラメータ), POST /oauth2/authorize (JSON)
+// フロントエンドは、GETのリダイレクトで受け取ったクエリパラメータをそのままPOSTする
+type AuthorizeRequest struct {
+	ResponseType        string `query:"response_type" json:"response_type" validate:"required"`
+	ClientID            string `query:"client_id" json:"client_id" validate:"required"`
+	RedirectURI         string `query:"redirect_uri" json:"redirect_uri" validate:"required"`
+	Scope               string `query:"scope" json:"scope" validate:"required"`
+	State               string `query:"state" json:"state"`
+	Nonce               string `query:"nonce" json:"nonce"`
+	CodeChallenge       string `query:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// 認可コードを付与したRPのURL。フロントエンドはこのURLに遷移する
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// emailはemailのscopeがある場合のみ
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+}
+
+// GET /.well-known/openid-configuration (OpenID Connect Discovery 1.0)
+type OpenIDConfigurationResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// activeがfalseの場合は、他のフィールドを返さない
+type IntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	JwtID     string `json:"jti,omitempty"`
+}
+
+// SCIM 2.0のUserリソース(RFC 7643)。/scim/v2の下はapplication/scim+jsonで送受信する
+// POST /scim/v2/Users, PUT /scim/v2/Users/:id ではid, emails, metaは無視する
+type SCIMUser struct {
+	Schemas  []string    `json:"schemas"`
+	ID       string      `json:"id,omitempty"`
+	UserName string      `json:"userName" validate:"required,email"`
+	Emails   []SCIMEmail `json:"emails,omitempty"`
+	// 省略した場合は有効
+	Active *bool     `json:"active,omitempty"`
+	Meta   *SCIMMeta `json:"meta,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary"`
+}
+
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// GET /scim/v2/Users
+// filterは userName eq "..." のみ対応する。startIndexは1から始まる
+type SCIMListQuery struct {
+	Filter     string `query:"filter"`
+	StartIndex int    `query:"startIndex" validate:"gte=0"`
+	Count      int    `query:"count" validate:"gte=0,lte=100"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int64      `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []SCIMUser `json:"Resources"`
+}
+
+// PATCH /scim/v2/Users/:id
+// activeのreplaceのみ対応する。ディレクトリはユーザーの無効化と再有効化にPATCHを使う
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations" validate:"required,min=1,dive"`
+}
+
+type SCIMPatchOperation struct {
+	Op   string `json:"op" validate:"required"`
+	Path string `json:"path"`
+	// pathがない場合は {"active": false} のようなオブジェクト
+	Value json.RawMessage `json:"value"`
+}
+
+// SCIMのエラー(RFC 7644 3.12)
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// GET /healthz, /readyz (/api/v1の外)
+type HealthResponse struct {
+	Status string `json:"status"`
+	// チェック名ごとの結果。/readyzのみ
+	Checks map[string]string `json:"checks,omitempty"`
+}
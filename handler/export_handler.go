@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"login-example/auth"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IExportHandler interface {
+	RequestExport(c echo.Context) error
+	Download(c echo.Context) error
+}
+
+type exportHandler struct {
+	eu usecase.IExportUsecase
+}
+
+func NewExportHandler(eu usecase.IExportUsecase) IExportHandler {
+	return &exportHandler{eu: eu}
+}
+
+func (h *exportHandler) RequestExport(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.eu.RequestExport(ctx, uid); err != nil {
+		return err
+	}
+
+	// エクスポートは非同期で行うので、受け付けたことだけを返す
+	return c.JSON(http.StatusAccepted, MessageResponse{Message: "export started. a download link will be sent by email"})
+}
+
+func (h *exportHandler) Download(c echo.Context) error {
+	qp := TokenQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	e, err := h.eu.Download(ctx, []byte(qp.Token))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="login-example-export-%d.json"`, e.ID))
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, e.Data)
+}
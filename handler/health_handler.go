@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"login-example/logging"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readyzで確認する依存先のチェック。問題がなければnilを返す
+type HealthCheckFunc func(ctx context.Context) error
+
+// 1つのチェックにかけられる時間
+var healthCheckTimeout = 2 * time.Second
+
+type IHealthHandler interface {
+	Liveness(c echo.Context) error
+	Readiness(c echo.Context) error
+}
+
+type healthHandler struct {
+	checks map[string]HealthCheckFunc
+}
+
+func NewHealthHandler(checks map[string]HealthCheckFunc) IHealthHandler {
+	return &healthHandler{checks: checks}
+}
+
+// プロセスが動いていればOKを返す
+func (h *healthHandler) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// 依存先を全てチェックして、1つでも失敗すればトラフィックを受けられないとして503を返す
+func (h *healthHandler) Readiness(c echo.Context) error {
+	res := HealthResponse{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+	for name, check := range h.checks {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "readiness check failed", slog.String("check", name), logging.Err(err))
+			res.Checks[name] = "fail"
+			res.Status = "fail"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		res.Checks[name] = "ok"
+	}
+	return c.JSON(status, res)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IIntrospectionHandler interface {
+	Introspect(c echo.Context) error
+}
+
+type introspectionHandler struct {
+	iu usecase.IIntrospectionUsecase
+	// クライアントIDとシークレット。空の場合はイントロスペクションを受け付けない
+	clients map[string]string
+}
+
+func NewIntrospectionHandler(iu usecase.IIntrospectionUsecase, clients map[string]string) IIntrospectionHandler {
+	return &introspectionHandler{iu: iu, clients: clients}
+}
+
+// RFC 7662のトークンイントロスペクション
+// ゲートウェイなどのサービスが、トークンが失効していないかを確認するために使う
+func (h *introspectionHandler) Introspect(c echo.Context) error {
+	if len(h.clients) == 0 {
+		return echo.ErrNotFound
+	}
+	if !h.authenticate(c.Request()) {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="introspect"`)
+		return echo.ErrUnauthorized
+	}
+
+	req := IntrospectRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	in, err := h.iu.Introspect(ctx, []byte(req.Token))
+	if err != nil {
+		return err
+	}
+
+	// トークンの状態は変わるので、キャッシュさせない
+	c.Response().Header().Set("Cache-Control", "no-store")
+	if !in.Active {
+		return c.JSON(http.StatusOK, IntrospectResponse{Active: false})
+	}
+	t := in.Token
+	return c.JSON(http.StatusOK, IntrospectResponse{
+		Active:    true,
+		Scope:     strings.Join(t.Scopes, " "),
+		Subject:   strconv.FormatUint(uint64(t.UserID), 10),
+		TokenType: t.Type,
+		ExpiresAt: t.Expiration.Unix(),
+		IssuedAt:  t.IssuedAt.Unix(),
+		JwtID:     t.JwtID,
+	})
+}
+
+// HTTP Basic認証でクライアントを確認する
+func (h *introspectionHandler) authenticate(r *http.Request) bool {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, ok := h.clients[id]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(want)) == 1
+}
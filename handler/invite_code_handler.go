@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IInviteCodeHandler interface {
+	Create(c echo.Context) error
+	List(c echo.Context) error
+	Revoke(c echo.Context) error
+}
+
+type inviteCodeHandler struct {
+	iu usecase.IInviteCodeUsecase
+}
+
+func NewInviteCodeHandler(iu usecase.IInviteCodeUsecase) IInviteCodeHandler {
+	return &inviteCodeHandler{iu: iu}
+}
+
+func newInviteCodeResponse(ic *entity.InviteCode) InviteCodeResponse {
+	return InviteCodeResponse{
+		ID:        ic.ID,
+		Note:      ic.Note,
+		MaxUses:   ic.MaxUses,
+		UseCount:  ic.UseCount,
+		Usable:    ic.IsUsable(),
+		ExpiresAt: ic.ExpiresAt,
+		RevokedAt: ic.RevokedAt,
+		CreatedAt: ic.CreatedAt,
+	}
+}
+
+func (h *inviteCodeHandler) Create(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := CreateInviteCodeRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ttl := time.Duration(rb.ExpiresInDays) * 24 * time.Hour
+	ic, code, err := h.iu.Create(ctx, uid, rb.Note, rb.MaxUses, ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, CreateInviteCodeResponse{
+		InviteCodeResponse: newInviteCodeResponse(ic),
+		Code:               code,
+	})
+}
+
+func (h *inviteCodeHandler) List(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	cs, err := h.iu.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := InviteCodesResponse{InviteCodes: make([]InviteCodeResponse, 0, len(cs))}
+	for _, ic := range cs {
+		res.InviteCodes = append(res.InviteCodes, newInviteCodeResponse(ic))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *inviteCodeHandler) Revoke(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "invite code not found")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.iu.Revoke(ctx, uid, entity.InviteCodeID(id)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "invite code revoked"})
+}
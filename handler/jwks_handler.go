@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"login-example/auth"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JWKSをキャッシュしてよい時間。鍵を入れ替える時は、古い鍵のJWTが期限切れになるまでこの時間以上待つ
+var jwksCacheControl = "public, max-age=3600"
+
+type IJWKSHandler interface {
+	JWKS(c echo.Context) error
+}
+
+type jwksHandler struct {
+	jwter auth.IJwtBuilder
+}
+
+func NewJWKSHandler(jwter auth.IJwtBuilder) IJWKSHandler {
+	return &jwksHandler{jwter: jwter}
+}
+
+// アクセストークンの検証に使う公開鍵を、JWK Set(RFC 7517)の形式で返す
+func (h *jwksHandler) JWKS(c echo.Context) error {
+	set, err := h.jwter.PublicKeySet()
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Cache-Control", jwksCacheControl)
+	return c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"login-example/mail"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Webhookのボディの上限
+var maxWebhookBodySize int64 = 1 << 20
+
+type IMailWebhookHandler interface {
+	Receive(c echo.Context) error
+}
+
+type mailWebhookHandler struct {
+	mu usecase.IMailEventUsecase
+	// Webhookに設定するURLのtokenクエリパラメータ。空の場合はWebhookを受け付けない
+	secret string
+}
+
+func NewMailWebhookHandler(mu usecase.IMailEventUsecase, secret string) IMailWebhookHandler {
+	return &mailWebhookHandler{mu: mu, secret: secret}
+}
+
+// メール配信サービスからの配信結果の通知を受け取る
+// 署名の検証方法はサービスごとに異なるので、URLに含めた共有の秘密で送信元を確認する
+func (h *mailWebhookHandler) Receive(c echo.Context) error {
+	if h.secret == "" {
+		return echo.ErrNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(c.QueryParam("token")), []byte(h.secret)) != 1 {
+		return echo.ErrUnauthorized
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBodySize))
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	events, err := mail.ParseDeliveryEvents(ctx, c.Param("provider"), body)
+	if errors.Is(err, mail.ErrUnknownWebhookProvider) {
+		return err
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+
+	if err := h.mu.HandleDeliveryEvents(ctx, events); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
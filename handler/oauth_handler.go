@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"login-example/usecase"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CSRF対策のstateを保持するcookie名
+const oauthStateCookie = "oauth-state"
+
+type IOAuthHandler interface {
+	Redirect(c echo.Context) error
+	Callback(c echo.Context) error
+}
+
+type oauthHandler struct {
+	ou usecase.IOAuthUsecase
+}
+
+func NewOAuthHandler(ou usecase.IOAuthUsecase) IOAuthHandler {
+	return &oauthHandler{ou: ou}
+}
+
+// プロバイダーの認可画面にリダイレクトする
+func (h *oauthHandler) Redirect(c echo.Context) error {
+	url, state, err := h.ou.AuthCodeURL(c.Param("provider"))
+	if err != nil {
+		return err
+	}
+
+	cookie := new(http.Cookie)
+	cookie.Name = oauthStateCookie
+	cookie.Value = state
+	cookie.Expires = time.Now().Add(10 * time.Minute)
+	// /auth/oauth/:providerの下の、同じプロバイダーのコールバックにだけ送る
+	cookie.Path = c.Request().URL.Path
+	// プロバイダーからのリダイレクトでもcookieが送られるようにLaxを指定
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.HttpOnly = true
+	c.SetCookie(cookie)
+
+	return c.Redirect(http.StatusFound, url)
+}
+
+func (h *oauthHandler) Callback(c echo.Context) error {
+	qp := OAuthCallbackQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	// リダイレクト時に発行したstateと一致しなければエラー
+	// stateは一度だけ使えるように、確認したらcookieを削除する
+	cookie, err := c.Cookie(oauthStateCookie)
+	if err != nil {
+		return fmt.Errorf("%w: %w", usecase.ErrInvalidOAuthState, err)
+	}
+	clearOAuthStateCookie(c)
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(qp.State)) != 1 {
+		return usecase.ErrInvalidOAuthState
+	}
+
+	ctx := c.Request().Context()
+
+	tok, refreshCookie, err := h.ou.Login(ctx, c.Param("provider"), qp.Code, newClientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setRefreshCookie(c, refreshCookie)
+
+	// ログイン成功、としてJWTを返す
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
+
+// Redirectでセットしたstateのcookieを削除する。コールバックから呼び出して、Redirectと同じPathを指定する
+func clearOAuthStateCookie(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     strings.TrimSuffix(c.Request().URL.Path, "/callback"),
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"login-example/usecase"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+type testValidator struct{ v *validator.Validate }
+
+func (tv testValidator) Validate(i any) error { return tv.v.Struct(i) }
+
+func TestOAuthCallback_InvalidState(t *testing.T) {
+	const path = "/api/v1/auth/oauth/google/callback"
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"state mismatch", &http.Cookie{Name: oauthStateCookie, Value: "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Validator = testValidator{v: validator.New()}
+			req := httptest.NewRequest(http.MethodGet, path+"?code=code&state=state", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("provider")
+			c.SetParamValues("google")
+
+			// stateが一致しない場合は、usecaseを呼ばずにエラーを返す
+			err := NewOAuthHandler(nil).Callback(c)
+			if !errors.Is(err, usecase.ErrInvalidOAuthState) {
+				t.Fatalf("error = %v, want %v", err, usecase.ErrInvalidOAuthState)
+			}
+			if tt.cookie == nil {
+				return
+			}
+			// 確認したstateのcookieは、Redirectと同じPathで削除する
+			var cleared bool
+			for _, ck := range rec.Result().Cookies() {
+				if ck.Name == oauthStateCookie && ck.MaxAge < 0 && ck.Path == "/api/v1/auth/oauth/google" {
+					cleared = true
+				}
+			}
+			if !cleared {
+				t.Errorf("state cookie not cleared: %v", rec.Result().Cookies())
+			}
+		})
+	}
+}
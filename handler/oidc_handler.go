@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OpenID Connectのプロバイダーの設定。Issuerが空の場合は全てのエンドポイントが404を返す
+type OIDCHandlerConfig struct {
+	Issuer string
+	// 認可リクエストを受け取って、ログインと同意を行うフロントエンドの画面
+	LoginURL string
+	// IDトークンの署名のアルゴリズム(keys.algorithm)
+	Algorithm string
+}
+
+type IOIDCHandler interface {
+	Discovery(c echo.Context) error
+	Authorize(c echo.Context) error
+	Approve(c echo.Context) error
+	UserInfo(c echo.Context) error
+}
+
+type oidcHandler struct {
+	ou  usecase.IOIDCUsecase
+	cfg OIDCHandlerConfig
+}
+
+func NewOIDCHandler(ou usecase.IOIDCUsecase, cfg OIDCHandlerConfig) IOIDCHandler {
+	return &oidcHandler{ou: ou, cfg: cfg}
+}
+
+// RPがエンドポイントと署名のアルゴリズムを知るためのメタデータ
+func (h *oidcHandler) Discovery(c echo.Context) error {
+	if h.cfg.Issuer == "" {
+		return echo.ErrNotFound
+	}
+	c.Response().Header().Set("Cache-Control", jwksCacheControl)
+	return c.JSON(http.StatusOK, OpenIDConfigurationResponse{
+		Issuer:                            h.cfg.Issuer,
+		AuthorizationEndpoint:             h.cfg.Issuer + "/api/v1/oauth2/authorize",
+		TokenEndpoint:                     h.cfg.Issuer + "/api/v1/auth/token",
+		UserInfoEndpoint:                  h.cfg.Issuer + "/api/v1/oauth2/userinfo",
+		JWKSURI:                           h.cfg.Issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   entity.OIDCScopes,
+		ResponseTypesSupported:            []string{usecase.ResponseTypeCode},
+		GrantTypesSupported:               []string{usecase.GrantTypeAuthorizationCode, usecase.GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{h.cfg.Algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{usecase.CodeChallengeS256},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "email_verified"},
+	})
+}
+
+// 認可エンドポイント。RPからリダイレクトされてきたリクエストを検証して、フロントエンドのログイン画面に引き継ぐ
+// リダイレクト先が確認できない場合はRPに戻さず、エラーを表示する
+func (h *oidcHandler) Authorize(c echo.Context) error {
+	if h.cfg.Issuer == "" {
+		return echo.ErrNotFound
+	}
+	req := AuthorizeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.ou.ValidateAuthorizationRequest(ctx, toAuthorizationRequest(req)); err != nil {
+		return err
+	}
+
+	login, err := url.Parse(h.cfg.LoginURL)
+	if err != nil {
+		return err
+	}
+	login.RawQuery = c.QueryParams().Encode()
+	return c.Redirect(http.StatusFound, login.String())
+}
+
+// ログイン済みのユーザーがRPへのログインを許可した。認可コードを付与したRPのURLを返す
+func (h *oidcHandler) Approve(c echo.Context) error {
+	if h.cfg.Issuer == "" {
+		return echo.ErrNotFound
+	}
+	req := AuthorizeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	redirect, err := h.ou.Authorize(ctx, uid, toAuthorizationRequest(req))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, AuthorizeResponse{RedirectTo: redirect})
+}
+
+// RPに発行したアクセストークンで、ログインしたユーザーの情報を返す
+func (h *oidcHandler) UserInfo(c echo.Context) error {
+	if h.cfg.Issuer == "" {
+		return echo.ErrNotFound
+	}
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.ou.UserInfo(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := UserInfoResponse{Subject: strconv.FormatUint(uint64(u.ID), 10)}
+	if slices.Contains(auth.GetScopesFromEchoCtx(c), entity.ScopeEmail) {
+		res.Email = u.Email
+		res.EmailVerified = true
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, res)
+}
+
+func toAuthorizationRequest(req AuthorizeRequest) *usecase.AuthorizationRequest {
+	return &usecase.AuthorizationRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IOrganizationHandler interface {
+	Create(c echo.Context) error
+	List(c echo.Context) error
+	IssueToken(c echo.Context) error
+	// 以下は組織のトークンで、トークンの組織に対して操作する
+	GetCurrent(c echo.Context) error
+	ListMembers(c echo.Context) error
+	RemoveMember(c echo.Context) error
+	Invite(c echo.Context) error
+	// 以下は招待メールのリンクから使う
+	GetInvitation(c echo.Context) error
+	AcceptInvitation(c echo.Context) error
+}
+
+type organizationHandler struct {
+	ou usecase.IOrganizationUsecase
+}
+
+func NewOrganizationHandler(ou usecase.IOrganizationUsecase) IOrganizationHandler {
+	return &organizationHandler{ou: ou}
+}
+
+func newOrganizationResponse(m *entity.Membership) OrganizationResponse {
+	return OrganizationResponse{
+		ID:        m.ID,
+		Name:      m.Name,
+		Role:      m.Role,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+func (h *organizationHandler) Create(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := CreateOrganizationRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	m, err := h.ou.Create(ctx, uid, rb.Name)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newOrganizationResponse(m))
+}
+
+func (h *organizationHandler) List(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ms, err := h.ou.List(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := OrganizationsResponse{Organizations: make([]OrganizationResponse, 0, len(ms))}
+	for _, m := range ms {
+		res.Organizations = append(res.Organizations, newOrganizationResponse(m))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// 組織を切り替える。フロントエンドは以降、組織のAPIをこのトークンで呼び出す
+func (h *organizationHandler) IssueToken(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "organization not found")
+	}
+
+	ctx := c.Request().Context()
+
+	tok, err := h.ou.IssueToken(ctx, uid, entity.OrganizationID(id))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
+
+func (h *organizationHandler) GetCurrent(c echo.Context) error {
+	uid, orgID, err := orgFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	m, err := h.ou.Get(ctx, uid, orgID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newOrganizationResponse(m))
+}
+
+func (h *organizationHandler) ListMembers(c echo.Context) error {
+	uid, orgID, err := orgFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ms, err := h.ou.ListMembers(ctx, uid, orgID)
+	if err != nil {
+		return err
+	}
+
+	res := OrganizationMembersResponse{Members: make([]OrganizationMemberResponse, 0, len(ms))}
+	for _, m := range ms {
+		res.Members = append(res.Members, OrganizationMemberResponse{
+			UserID:    m.UserID,
+			Email:     m.Email,
+			Role:      m.Role,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *organizationHandler) RemoveMember(c echo.Context) error {
+	uid, orgID, err := orgFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	target, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "member not found")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.ou.RemoveMember(ctx, uid, orgID, entity.UserID(target)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "member removed"})
+}
+
+func (h *organizationHandler) Invite(c echo.Context) error {
+	uid, orgID, err := orgFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := InviteMemberRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	inv, err := h.ou.Invite(ctx, uid, orgID, rb.Email, rb.Role)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, OrganizationInvitationResponse{
+		ID:        inv.ID,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		ExpiresAt: inv.ExpiresAt,
+	})
+}
+
+// ログインしていなくても招待の内容を確認できる。フロントエンドはregisteredによってログインか登録に進む
+func (h *organizationHandler) GetInvitation(c echo.Context) error {
+	qp := TokenQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	inv, o, registered, err := h.ou.GetInvitation(ctx, qp.Token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, InvitationDetailResponse{
+		OrganizationName: o.Name,
+		Email:            inv.Email,
+		Role:             inv.Role,
+		ExpiresAt:        inv.ExpiresAt,
+		Registered:       registered,
+	})
+}
+
+func (h *organizationHandler) AcceptInvitation(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := AcceptInvitationRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	m, err := h.ou.AcceptInvitation(ctx, uid, rb.Token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newOrganizationResponse(m))
+}
+
+// 組織のトークンのユーザーと組織。RequireOrgの後に使う
+func orgFromEchoCtx(c echo.Context) (entity.UserID, entity.OrganizationID, error) {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	orgID, ok := auth.GetOrgIDFromEchoCtx(c)
+	if !ok {
+		return 0, 0, echo.NewHTTPError(http.StatusForbidden, "organization token required")
+	}
+	return uid, orgID, nil
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPersonalAccessTokenHandler interface {
+	Create(c echo.Context) error
+	List(c echo.Context) error
+	Revoke(c echo.Context) error
+}
+
+type personalAccessTokenHandler struct {
+	pu usecase.IPersonalAccessTokenUsecase
+}
+
+func NewPersonalAccessTokenHandler(pu usecase.IPersonalAccessTokenUsecase) IPersonalAccessTokenHandler {
+	return &personalAccessTokenHandler{pu: pu}
+}
+
+func newPersonalAccessTokenResponse(t *entity.PersonalAccessToken) PersonalAccessTokenResponse {
+	return PersonalAccessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     strings.Fields(t.Scopes),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func (h *personalAccessTokenHandler) Create(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := CreatePersonalAccessTokenRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ttl := time.Duration(rb.ExpiresInDays) * 24 * time.Hour
+	t, token, err := h.pu.Create(ctx, uid, rb.Name, rb.Scopes, ttl)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, CreatePersonalAccessTokenResponse{
+		PersonalAccessTokenResponse: newPersonalAccessTokenResponse(t),
+		Token:                       token,
+	})
+}
+
+func (h *personalAccessTokenHandler) List(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ts, err := h.pu.List(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := PersonalAccessTokensResponse{Tokens: make([]PersonalAccessTokenResponse, 0, len(ts))}
+	for _, t := range ts {
+		res.Tokens = append(res.Tokens, newPersonalAccessTokenResponse(t))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *personalAccessTokenHandler) Revoke(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "personal access token not found")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.pu.Revoke(ctx, uid, entity.PersonalAccessTokenID(id)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "personal access token revoked"})
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPhoneHandler interface {
+	RequestVerification(c echo.Context) error
+	Verify(c echo.Context) error
+	Delete(c echo.Context) error
+}
+
+type phoneHandler struct {
+	// SMSの送信が設定されていない場合はnil
+	pu usecase.IPhoneUsecase
+}
+
+func NewPhoneHandler(pu usecase.IPhoneUsecase) IPhoneHandler {
+	return &phoneHandler{pu: pu}
+}
+
+// 電話番号に確認コードをSMSで送る
+func (h *phoneHandler) RequestVerification(c echo.Context) error {
+	if h.pu == nil {
+		return echo.ErrNotFound
+	}
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := PhoneRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.pu.RequestVerification(ctx, uid, rb.Phone); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "verification code sent"})
+}
+
+func (h *phoneHandler) Verify(c echo.Context) error {
+	if h.pu == nil {
+		return echo.ErrNotFound
+	}
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := ConfirmPhoneRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.pu.Verify(ctx, uid, rb.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newUserResponse(u))
+}
+
+func (h *phoneHandler) Delete(c echo.Context) error {
+	if h.pu == nil {
+		return echo.ErrNotFound
+	}
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.pu.Delete(ctx, uid); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "phone number deleted"})
+}
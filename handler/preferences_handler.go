@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPreferencesHandler interface {
+	Get(c echo.Context) error
+	Update(c echo.Context) error
+}
+
+type preferencesHandler struct {
+	pu usecase.IPreferencesUsecase
+}
+
+func NewPreferencesHandler(pu usecase.IPreferencesUsecase) IPreferencesHandler {
+	return &preferencesHandler{pu: pu}
+}
+
+func (h *preferencesHandler) Get(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	p, err := h.pu.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newPreferencesResponse(p))
+}
+
+func (h *preferencesHandler) Update(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := PreferencesRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	p, err := h.pu.Update(ctx, uid, entity.Preferences{
+		Locale:            rb.Locale,
+		TimeZone:          rb.TimeZone,
+		NotifyOnLogin:     *rb.Notifications.Login,
+		NotifyOnNewClient: *rb.Notifications.NewClient,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newPreferencesResponse(p))
+}
+
+func newPreferencesResponse(p *entity.Preferences) PreferencesResponse {
+	return PreferencesResponse{
+		Locale:   p.Locale,
+		TimeZone: p.TimeZone,
+		Notifications: NotificationPreferencesResponse{
+			Login:     p.NotifyOnLogin,
+			NewClient: p.NotifyOnNewClient,
+		},
+	}
+}
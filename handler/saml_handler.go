@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"login-example/usecase"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ACSで照合するAuthnRequestのIDを保持するcookie名
+const samlRequestCookie = "saml-request"
+
+type ISAMLHandler interface {
+	Metadata(c echo.Context) error
+	Login(c echo.Context) error
+	ACS(c echo.Context) error
+}
+
+type samlHandler struct {
+	// SAMLが無効な場合はnil
+	su usecase.ISAMLUsecase
+}
+
+func NewSAMLHandler(su usecase.ISAMLUsecase) ISAMLHandler {
+	return &samlHandler{su: su}
+}
+
+// IdPに登録するSPのメタデータ
+func (h *samlHandler) Metadata(c echo.Context) error {
+	if h.su == nil {
+		return echo.ErrNotFound
+	}
+	b, err := h.su.Metadata()
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "application/samlmetadata+xml", b)
+}
+
+// IdPの認証画面にリダイレクトする
+func (h *samlHandler) Login(c echo.Context) error {
+	if h.su == nil {
+		return echo.ErrNotFound
+	}
+	url, id, err := h.su.AuthnRequestURL()
+	if err != nil {
+		return err
+	}
+
+	cookie := new(http.Cookie)
+	cookie.Name = samlRequestCookie
+	cookie.Value = id
+	cookie.Expires = time.Now().Add(10 * time.Minute)
+	// IdPからACSへのPOSTはクロスサイトなので、Laxでは送られない。SameSite=NoneにはSecureが必要
+	cookie.SameSite = http.SameSiteNoneMode
+	cookie.Secure = true
+	cookie.HttpOnly = true
+	c.SetCookie(cookie)
+
+	return c.Redirect(http.StatusFound, url)
+}
+
+// IdPからPOSTされたSAMLResponseでログインする(Assertion Consumer Service)
+func (h *samlHandler) ACS(c echo.Context) error {
+	if h.su == nil {
+		return echo.ErrNotFound
+	}
+	req := SAMLResponseRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	// 自分が送ったAuthnRequestへの応答かを確認する。IdPから直接送られたアサーションは受け付けない
+	cookie, err := c.Cookie(samlRequestCookie)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{Name: samlRequestCookie, MaxAge: -1, SameSite: http.SameSiteNoneMode, Secure: true, HttpOnly: true})
+
+	ctx := c.Request().Context()
+
+	tok, refreshCookie, err := h.su.Login(ctx, req.SAMLResponse, []string{cookie.Value}, newClientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setRefreshCookie(c, refreshCookie)
+
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
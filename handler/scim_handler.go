@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SCIM 2.0のリクエストとレスポンスのContent-Type(RFC 7644 3.1)
+const MIMEApplicationSCIMJSON = "application/scim+json"
+
+const (
+	SCIMUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMListSchema    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema   = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMのリクエストボディの上限
+const maxSCIMBodySize = 64 << 10
+
+// 対応するfilterは userName eq "..." のみ。ディレクトリは同期の前にこのfilterで既存のユーザーを探す
+var scimUserNameFilter = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"([^"]*)"\s*$`)
+
+type ISCIMHandler interface {
+	Create(c echo.Context) error
+	Get(c echo.Context) error
+	List(c echo.Context) error
+	Replace(c echo.Context) error
+	Patch(c echo.Context) error
+	Delete(c echo.Context) error
+}
+
+type scimHandler struct {
+	su usecase.ISCIMUsecase
+}
+
+func NewSCIMHandler(su usecase.ISCIMUsecase) ISCIMHandler {
+	return &scimHandler{su: su}
+}
+
+func (h *scimHandler) Create(c echo.Context) error {
+	req := SCIMUser{}
+	if err := bindSCIM(c, &req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.su.Create(ctx, req.UserName, req.Active == nil || *req.Active)
+	if err != nil {
+		return err
+	}
+
+	res := toSCIMUser(c, u)
+	c.Response().Header().Set(echo.HeaderLocation, res.Meta.Location)
+	return scimJSON(c, http.StatusCreated, res)
+}
+
+func (h *scimHandler) Get(c echo.Context) error {
+	uid, err := scimUserID(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.su.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, toSCIMUser(c, u))
+}
+
+func (h *scimHandler) List(c echo.Context) error {
+	qp := SCIMListQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	var email string
+	if qp.Filter != "" {
+		m := scimUserNameFilter.FindStringSubmatch(qp.Filter)
+		if m == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "unsupported filter")
+		}
+		email = m[1]
+	}
+	// startIndexは1から始まる。0以下は1として扱う(RFC 7644 3.4.2.4)
+	startIndex := max(qp.StartIndex, 1)
+
+	ctx := c.Request().Context()
+
+	us, total, err := h.su.List(ctx, email, startIndex-1, qp.Count)
+	if err != nil {
+		return err
+	}
+
+	res := SCIMListResponse{
+		Schemas:      []string{SCIMListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(us),
+		Resources:    make([]SCIMUser, 0, len(us)),
+	}
+	for _, u := range us {
+		res.Resources = append(res.Resources, toSCIMUser(c, u))
+	}
+	return scimJSON(c, http.StatusOK, res)
+}
+
+func (h *scimHandler) Replace(c echo.Context) error {
+	uid, err := scimUserID(c)
+	if err != nil {
+		return err
+	}
+	req := SCIMUser{}
+	if err := bindSCIM(c, &req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.su.Replace(ctx, uid, req.UserName, req.Active == nil || *req.Active)
+	if err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, toSCIMUser(c, u))
+}
+
+// userNameとactiveのreplaceのみ対応する。それ以外の属性はこのサービスで保持しないので無視する
+func (h *scimHandler) Patch(c echo.Context) error {
+	uid, err := scimUserID(c)
+	if err != nil {
+		return err
+	}
+	req := SCIMPatchRequest{}
+	if err := bindSCIM(c, &req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.su.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	email, active := u.Email, u.IsActive()
+	for _, op := range req.Operations {
+		if err := applySCIMPatch(op, &email, &active); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	if u, err = h.su.Replace(ctx, uid, email, active); err != nil {
+		return err
+	}
+	return scimJSON(c, http.StatusOK, toSCIMUser(c, u))
+}
+
+// ディレクトリからの削除は、ユーザーを無効化する。ログイン履歴や監査ログを残すため、削除はしない
+func (h *scimHandler) Delete(c echo.Context) error {
+	uid, err := scimUserID(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if _, err := h.su.SetActive(ctx, uid, false); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// PATCHの操作を、userNameとactiveに適用する
+// pathがない場合は、valueのオブジェクトの属性ごとに適用する(RFC 7644 3.5.2.3)
+func applySCIMPatch(op SCIMPatchOperation, email *string, active *bool) error {
+	switch strings.ToLower(op.Op) {
+	case "replace", "add":
+	default:
+		return fmt.Errorf("unsupported op: %s", op.Op)
+	}
+
+	values := map[string]json.RawMessage{}
+	if op.Path != "" {
+		values[op.Path] = op.Value
+	} else if err := json.Unmarshal(op.Value, &values); err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+
+	for path, v := range values {
+		switch strings.ToLower(path) {
+		case "active":
+			b, err := parseSCIMBool(v)
+			if err != nil {
+				return err
+			}
+			*active = b
+		case "username":
+			if err := json.Unmarshal(v, email); err != nil || !strings.Contains(*email, "@") {
+				return fmt.Errorf("invalid userName: %s", v)
+			}
+		}
+	}
+	return nil
+}
+
+// 一部のディレクトリは真偽値を"True"のような文字列で送る
+func parseSCIMBool(v json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(v, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("invalid active: %s", v)
+}
+
+// echoのBindはapplication/scim+jsonに対応していないので、JSONとしてデコードする
+func bindSCIM(c echo.Context, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(c.Response(), c.Request().Body, maxSCIMBodySize))
+	if err := dec.Decode(v); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	return nil
+}
+
+func scimUserID(c echo.Context) (entity.UserID, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusNotFound, "user not found")
+	}
+	return entity.UserID(id), nil
+}
+
+// c.JSONはContent-Typeが設定済みの場合は上書きしない
+func scimJSON(c echo.Context, status int, v any) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationSCIMJSON)
+	return c.JSON(status, v)
+}
+
+func toSCIMUser(c echo.Context, u *entity.User) SCIMUser {
+	id := strconv.FormatUint(uint64(u.ID), 10)
+	active := u.IsActive()
+	return SCIMUser{
+		Schemas:  []string{SCIMUserSchema},
+		ID:       id,
+		UserName: u.Email,
+		Emails:   []SCIMEmail{{Value: u.Email, Primary: true}},
+		Active:   &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     c.Scheme() + "://" + c.Request().Host + "/scim/v2/Users/" + id,
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"login-example/captcha"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ISmsLoginHandler interface {
+	RequestCode(c echo.Context) error
+	Login(c echo.Context) error
+}
+
+type smsLoginHandler struct {
+	// SMSの送信が設定されていない場合はnil
+	su usecase.ISmsLoginUsecase
+	// SMSの送信には費用がかかるので、送信の前にボットでないことを確認する
+	cv captcha.IVerifier
+}
+
+func NewSmsLoginHandler(su usecase.ISmsLoginUsecase, cv captcha.IVerifier) ISmsLoginHandler {
+	return &smsLoginHandler{su: su, cv: cv}
+}
+
+// 確認済みの電話番号に、ログイン用コードをSMSで送る
+func (h *smsLoginHandler) RequestCode(c echo.Context) error {
+	if h.su == nil {
+		return echo.ErrNotFound
+	}
+
+	rb := SmsLoginCodeRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.cv.Verify(ctx, rb.CaptchaToken, c.RealIP()); err != nil {
+		return err
+	}
+
+	if err := h.su.RequestCode(ctx, rb.Phone); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
+}
+
+func (h *smsLoginHandler) Login(c echo.Context) error {
+	if h.su == nil {
+		return echo.ErrNotFound
+	}
+
+	rb := SmsLoginRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	tok, cookie, err := h.su.Login(ctx, rb.Phone, rb.Code, rb.RememberMe, newClientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setRefreshCookie(c, cookie)
+
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
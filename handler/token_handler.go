@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/usecase"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ITokenHandler interface {
+	Token(c echo.Context) error
+}
+
+type tokenHandler struct {
+	cu usecase.IClientCredentialsUsecase
+	// OpenID Connectが無効な場合はnil
+	ou usecase.IOIDCUsecase
+}
+
+func NewTokenHandler(cu usecase.IClientCredentialsUsecase, ou usecase.IOIDCUsecase) ITokenHandler {
+	return &tokenHandler{cu: cu, ou: ou}
+}
+
+// RFC 6749のトークンエンドポイント。client credentialsとauthorization_codeグラントに対応する
+// client credentialsは、社内のサービスがユーザーになりすまさずに管理APIを呼び出すためのトークン
+// authorization_codeは、OpenID ConnectのRPが認可コードをIDトークンと交換するために使う
+func (h *tokenHandler) Token(c echo.Context) error {
+	req := TokenRequest{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	// クライアントの認証は、HTTP Basic認証かリクエストボディのどちらでもよい
+	id, secret, ok := c.Request().BasicAuth()
+	if !ok {
+		id, secret = req.ClientID, req.ClientSecret
+	}
+
+	ctx := c.Request().Context()
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+
+	if req.GrantType == usecase.GrantTypeAuthorizationCode && h.ou != nil {
+		t, err := h.ou.ExchangeCode(ctx, id, secret, req.Code, req.RedirectURI, req.CodeVerifier)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, TokenResponse{
+			AccessToken: string(t.AccessToken),
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(auth.AccessTokenTTL.Seconds()),
+			Scope:       strings.Join(t.Scopes, " "),
+			IDToken:     string(t.IDToken),
+		})
+	}
+
+	t, err := h.cu.IssueToken(ctx, req.GrantType, id, secret, strings.Fields(req.Scope))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, TokenResponse{
+		AccessToken: string(t.AccessToken),
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(auth.AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(t.Scopes, " "),
+	})
+}
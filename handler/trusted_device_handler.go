@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ITrustedDeviceHandler interface {
+	Trust(c echo.Context) error
+	List(c echo.Context) error
+	Rename(c echo.Context) error
+	Revoke(c echo.Context) error
+}
+
+type trustedDeviceHandler struct {
+	du usecase.ITrustedDeviceUsecase
+}
+
+func NewTrustedDeviceHandler(du usecase.ITrustedDeviceUsecase) ITrustedDeviceHandler {
+	return &trustedDeviceHandler{du: du}
+}
+
+func newTrustedDeviceResponse(d *entity.TrustedDevice) TrustedDeviceResponse {
+	return TrustedDeviceResponse{
+		ID:         d.ID,
+		Name:       d.Name,
+		IPAddress:  d.IPAddress,
+		UserAgent:  d.UserAgent,
+		ExpiresAt:  d.ExpiresAt,
+		LastUsedAt: d.LastUsedAt,
+		CreatedAt:  d.CreatedAt,
+	}
+}
+
+// 今の端末を信頼済みとして登録して、端末を識別するcookieをセットする
+func (h *trustedDeviceHandler) Trust(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := TrustedDeviceRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	d, tok, err := h.du.Trust(ctx, uid, rb.Name, newClientInfo(c))
+	if err != nil {
+		return err
+	}
+	setDeviceCookie(c, tok, d.ExpiresAt)
+
+	return c.JSON(http.StatusCreated, newTrustedDeviceResponse(d))
+}
+
+func (h *trustedDeviceHandler) List(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ds, err := h.du.List(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := TrustedDevicesResponse{Devices: make([]TrustedDeviceResponse, 0, len(ds))}
+	for _, d := range ds {
+		res.Devices = append(res.Devices, newTrustedDeviceResponse(d))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *trustedDeviceHandler) Rename(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "trusted device not found")
+	}
+
+	rb := TrustedDeviceRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.du.Rename(ctx, uid, entity.TrustedDeviceID(id), rb.Name); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "trusted device renamed"})
+}
+
+func (h *trustedDeviceHandler) Revoke(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "trusted device not found")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.du.Revoke(ctx, uid, entity.TrustedDeviceID(id)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "trusted device revoked"})
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"login-example/auth"
+	"login-example/captcha"
+	"login-example/entity"
 	"login-example/usecase"
 	"net/http"
 
@@ -10,25 +13,41 @@ import (
 type IUserHandler interface {
 	PreRegister(c echo.Context) error
 	Activate(c echo.Context) error
+	ActivateWithLink(c echo.Context) error
+	ResendActivateToken(c echo.Context) error
 	Login(c echo.Context) error
 	GetMe(c echo.Context) error
+	UpdateMe(c echo.Context) error
+	ListLogins(c echo.Context) error
+	ListSessions(c echo.Context) error
+	RevokeSession(c echo.Context) error
 	Refresh(c echo.Context) error
+	Logout(c echo.Context) error
+	LogoutAll(c echo.Context) error
+	SetLoginNotification(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	Sudo(c echo.Context) error
+	Delete(c echo.Context) error
+	RequestEmailChange(c echo.Context) error
+	ConfirmEmailChange(c echo.Context) error
+	RequestMagicLink(c echo.Context) error
+	LoginWithMagicLink(c echo.Context) error
+	DenyLogin(c echo.Context) error
 }
 
 type userHandler struct {
 	uu usecase.IUserUsecase
+	// 仮登録とログインの前に、ボットでないことを確認する
+	cv captcha.IVerifier
 }
 
-func NewUserHandler(uu usecase.IUserUsecase) IUserHandler {
-	return &userHandler{uu: uu}
+func NewUserHandler(uu usecase.IUserUsecase, cv captcha.IVerifier) IUserHandler {
+	return &userHandler{uu: uu, cv: cv}
 }
 
 func (h *userHandler) PreRegister(c echo.Context) error {
 	// リクエストボディを受け取るための構造体を作成します
-	rb := struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,gte=6,lte=20"`
-	}{}
+	rb := PreRegisterRequest{}
 
 	// リクエストボディの中身をrbに書き込みます
 	if err := c.Bind(&rb); err != nil {
@@ -42,22 +61,22 @@ func (h *userHandler) PreRegister(c echo.Context) error {
 	// context.ContextをPreRegisterに渡す必要があるので、echo.Contextから取得します。
 	ctx := c.Request().Context()
 
-	_, err := h.uu.PreRegister(ctx, rb.Email, rb.Password)
+	// パスワードのハッシュ化やメールの送信をボットに使わせないように、usecaseの前で確認する
+	if err := h.cv.Verify(ctx, rb.CaptchaToken, c.RealIP()); err != nil {
+		return err
+	}
+
+	_, err := h.uu.PreRegister(ctx, rb.Email, rb.Password, rb.InviteCode)
 	if err != nil {
 		return err
 	}
 
 	// 仮登録が完了したメッセージとしてokとクライアントに返します。
-	return c.JSON(http.StatusOK, echo.Map{
-		"message": "ok",
-	})
+	return c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
 }
 
 func (h *userHandler) Activate(c echo.Context) error {
-	rb := struct {
-		Email string `json:"email" validate:"required,email"`
-		Token string `json:"token" validate:"required,len=8"`
-	}{}
+	rb := ActivateRequest{}
 	if err := c.Bind(&rb); err != nil {
 		return err
 	}
@@ -67,21 +86,57 @@ func (h *userHandler) Activate(c echo.Context) error {
 
 	ctx := c.Request().Context()
 
-	if err := h.uu.Activate(ctx, rb.Email, rb.Token); err != nil {
+	if err := h.uu.Activate(ctx, rb.Email, rb.Token, entity.Profile{
+		Name:        rb.Name,
+		DisplayName: rb.DisplayName,
+		Bio:         rb.Bio,
+	}); err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"message": "activate ok",
-	})
+	return c.JSON(http.StatusOK, MessageResponse{Message: "activate ok"})
+}
+
+// メールの本人確認用リンクからアクティベートする
+func (h *userHandler) ActivateWithLink(c echo.Context) error {
+	qp := TokenQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.ActivateWithLink(ctx, []byte(qp.Token)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "activate ok"})
+}
+
+func (h *userHandler) ResendActivateToken(c echo.Context) error {
+	rb := EmailRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.ResendActivateToken(ctx, rb.Email); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
 }
 
 func (h *userHandler) Login(c echo.Context) error {
 	// リクエストボディを受け取るための構造体を作成
-	rb := struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,gte=6,lte=20"`
-	}{}
+	rb := LoginRequest{}
 
 	// リクエストボディの中身をrbに書き込みます
 	if err := c.Bind(&rb); err != nil {
@@ -95,17 +150,24 @@ func (h *userHandler) Login(c echo.Context) error {
 	// context.ContextをPreRegisterに渡す必要があるので、echo.Contextから取得します。
 	ctx := c.Request().Context()
 
-	tok, cookie, err := h.uu.Login(ctx, rb.Email, rb.Password)
+	// パスワードの総当たりやリスト型攻撃を防ぐため、パスワードを検証する前に確認する
+	if err := h.cv.Verify(ctx, rb.CaptchaToken, c.RealIP()); err != nil {
+		return err
+	}
+
+	login := rb.Email
+	if login == "" {
+		login = rb.Username
+	}
+	tok, cookie, err := h.uu.Login(ctx, login, rb.Password, rb.RememberMe, newClientInfo(c))
 	if err != nil {
 		return err
 	}
 
-	c.SetCookie(cookie)
+	setRefreshCookie(c, cookie)
 
 	// ログイン成功、としてJWTを返す
-	return c.JSON(http.StatusOK, echo.Map{
-		"access_token": string(tok),
-	})
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
 }
 
 func (h *userHandler) GetMe(c echo.Context) error {
@@ -122,12 +184,124 @@ func (h *userHandler) GetMe(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{
-		"id":         u.ID,
-		"email":      u.Email,
-		"updated_at": u.UpdatedAt,
-		"created_at": u.CreatedAt,
+	return c.JSON(http.StatusOK, newUserResponse(u))
+}
+
+// プロフィールを部分的に更新する。省略した項目は変更しない
+func (h *userHandler) UpdateMe(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := UpdateProfileRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.uu.UpdateProfile(ctx, uid, rb.Version, usecase.ProfileUpdate{
+		Name:        rb.Name,
+		DisplayName: rb.DisplayName,
+		Bio:         rb.Bio,
 	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newUserResponse(u))
+}
+
+func newUserResponse(u *entity.User) UserResponse {
+	return UserResponse{
+		ID:            u.ID,
+		Email:         u.Email,
+		Username:      usernameOf(u),
+		Phone:         u.Phone,
+		Name:          u.Name,
+		DisplayName:   u.DisplayName,
+		Bio:           u.Bio,
+		AvatarURL:     u.AvatarURL,
+		NotifyOnLogin: u.NotifyOnLogin,
+		Version:       u.Version,
+		UpdatedAt:     u.UpdatedAt,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+func (h *userHandler) ListLogins(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	hs, err := h.uu.ListLogins(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := LoginsResponse{Logins: make([]LoginHistoryResponse, 0, len(hs))}
+	for _, lh := range hs {
+		res.Logins = append(res.Logins, LoginHistoryResponse{
+			Method:    lh.Method,
+			IPAddress: lh.IPAddress,
+			UserAgent: lh.UserAgent,
+			Country:   lh.Country,
+			City:      lh.City,
+			CreatedAt: lh.CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *userHandler) ListSessions(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	ss, err := h.uu.ListSessions(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	res := SessionsResponse{Sessions: make([]SessionResponse, 0, len(ss))}
+	for _, s := range ss {
+		res.Sessions = append(res.Sessions, SessionResponse{
+			ID:         s.ID,
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+			ExpiresAt:  s.ExpiresAt,
+			LastUsedAt: s.LastUsedAt,
+			CreatedAt:  s.CreatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *userHandler) RevokeSession(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.RevokeSession(ctx, uid, entity.SessionID(c.Param("id"))); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "session revoked"})
 }
 
 func (h *userHandler) Refresh(c echo.Context) error {
@@ -143,7 +317,238 @@ func (h *userHandler) Refresh(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	return c.JSON(http.StatusOK, echo.Map{
-		"access_token": string(tok),
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
+
+// リクエストのアクセストークンと、cookieのリフレッシュトークンのセッションを失効させる
+func (h *userHandler) Logout(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	jti, exp := auth.GetJwtIDFromEchoCtx(c)
+	var refreshToken []byte
+	if cookie, err := c.Cookie("refresh-token"); err == nil {
+		refreshToken = []byte(cookie.Value)
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.Logout(ctx, uid, jti, exp, refreshToken); err != nil {
+		return err
+	}
+	clearRefreshCookie(c)
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "logged out"})
+}
+
+// 全ての端末からログアウトする。このリクエストのアクセストークンも無効になる
+func (h *userHandler) LogoutAll(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.LogoutAll(ctx, uid); err != nil {
+		return err
+	}
+	clearRefreshCookie(c)
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "logged out from all devices"})
+}
+
+func (h *userHandler) SetLoginNotification(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := LoginNotificationRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.SetNotifyOnLogin(ctx, uid, *rb.Enabled); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "login notification updated"})
+}
+
+func (h *userHandler) ChangePassword(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := ChangePasswordRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.ChangePassword(ctx, uid, rb.CurrentPassword, rb.NewPassword); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "password changed"})
+}
+
+// パスワードを再入力して、sudoトークンを取得する
+// メールアドレスの変更やアカウントの削除などは、X-Sudo-Tokenヘッダーでsudoトークンを送る必要がある
+func (h *userHandler) Sudo(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := SudoRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	token, err := h.uu.Sudo(ctx, uid, rb.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, SudoResponse{
+		SudoToken: string(token),
+		ExpiresIn: int64(auth.SudoTokenTTL.Seconds()),
 	})
-}
\ No newline at end of file
+}
+
+func (h *userHandler) Delete(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.Delete(ctx, uid); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "deleted"})
+}
+
+func (h *userHandler) RequestEmailChange(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := EmailRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.RequestEmailChange(ctx, uid, rb.Email); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
+}
+
+func (h *userHandler) ConfirmEmailChange(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := ConfirmEmailChangeRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.ConfirmEmailChange(ctx, uid, rb.Token); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "email changed"})
+}
+
+func (h *userHandler) RequestMagicLink(c echo.Context) error {
+	rb := EmailRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.RequestMagicLink(ctx, rb.Email); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "ok"})
+}
+
+func (h *userHandler) LoginWithMagicLink(c echo.Context) error {
+	qp := TokenQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	tok, cookie, err := h.uu.LoginWithMagicLink(ctx, []byte(qp.Token), newClientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setRefreshCookie(c, cookie)
+
+	// ログイン成功、としてJWTを返す
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
+
+func (h *userHandler) DenyLogin(c echo.Context) error {
+	qp := TokenQuery{}
+	if err := c.Bind(&qp); err != nil {
+		return err
+	}
+	if err := c.Validate(qp); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.DenyLogin(ctx, []byte(qp.Token)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "all sessions revoked, please change your password"})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IUsernameHandler interface {
+	Set(c echo.Context) error
+	Delete(c echo.Context) error
+}
+
+type usernameHandler struct {
+	uu usecase.IUsernameUsecase
+}
+
+func NewUsernameHandler(uu usecase.IUsernameUsecase) IUsernameHandler {
+	return &usernameHandler{uu: uu}
+}
+
+// ログインにemailの代わりに使えるusernameを設定する
+func (h *usernameHandler) Set(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	rb := UsernameRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	u, err := h.uu.Set(ctx, uid, rb.Username)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newUserResponse(u))
+}
+
+func (h *usernameHandler) Delete(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.uu.Delete(ctx, uid); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "username deleted"})
+}
+
+// 未設定の場合は空文字列
+func usernameOf(u *entity.User) string {
+	if u.Username == nil {
+		return ""
+	}
+	return *u.Username
+}
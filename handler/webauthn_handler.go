@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"fmt"
+	"login-example/auth"
+	"login-example/usecase"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/labstack/echo/v4"
+)
+
+// セレモニーのセッションIDを保持するcookie名
+const webAuthnSessionCookie = "webauthn-session"
+
+type IWebAuthnHandler interface {
+	BeginRegistration(c echo.Context) error
+	FinishRegistration(c echo.Context) error
+	BeginLogin(c echo.Context) error
+	FinishLogin(c echo.Context) error
+}
+
+type webAuthnHandler struct {
+	wu usecase.IWebAuthnUsecase
+}
+
+func NewWebAuthnHandler(wu usecase.IWebAuthnUsecase) IWebAuthnHandler {
+	return &webAuthnHandler{wu: wu}
+}
+
+func (h *webAuthnHandler) BeginRegistration(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	options, sessionID, err := h.wu.BeginRegistration(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(newWebAuthnSessionCookie(sessionID))
+	return c.JSON(http.StatusOK, options)
+}
+
+func (h *webAuthnHandler) FinishRegistration(c echo.Context) error {
+	uid, err := auth.GetUserIDFromEchoCtx(c)
+	if err != nil {
+		return err
+	}
+	// cookieがない場合は、セレモニーのセッションが見つからない場合と同じエラーにする
+	cookie, err := c.Cookie(webAuthnSessionCookie)
+	if err != nil {
+		return fmt.Errorf("%w: %w", usecase.ErrInvalidToken, err)
+	}
+
+	// 認証器からのレスポンスをパースする
+	res, err := protocol.ParseCredentialCreationResponseBody(c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.wu.FinishRegistration(ctx, uid, cookie.Value, res); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "register ok"})
+}
+
+func (h *webAuthnHandler) BeginLogin(c echo.Context) error {
+	rb := EmailRequest{}
+	if err := c.Bind(&rb); err != nil {
+		return err
+	}
+	if err := c.Validate(rb); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	options, sessionID, err := h.wu.BeginLogin(ctx, rb.Email)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(newWebAuthnSessionCookie(sessionID))
+	return c.JSON(http.StatusOK, options)
+}
+
+func (h *webAuthnHandler) FinishLogin(c echo.Context) error {
+	cookie, err := c.Cookie(webAuthnSessionCookie)
+	if err != nil {
+		return fmt.Errorf("%w: %w", usecase.ErrInvalidToken, err)
+	}
+
+	res, err := protocol.ParseCredentialRequestResponseBody(c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	tok, refreshCookie, err := h.wu.FinishLogin(ctx, cookie.Value, res, newClientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	setRefreshCookie(c, refreshCookie)
+
+	// ログイン成功、としてJWTを返す
+	return c.JSON(http.StatusOK, AccessTokenResponse{AccessToken: string(tok)})
+}
+
+func newWebAuthnSessionCookie(sessionID string) *http.Cookie {
+	cookie := new(http.Cookie)
+	cookie.Name = webAuthnSessionCookie
+	cookie.Value = sessionID
+	cookie.Expires = time.Now().Add(5 * time.Minute)
+	cookie.SameSite = http.SameSiteStrictMode
+	cookie.HttpOnly = true
+	return cookie
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+// セレモニーのセッションのcookieがない場合は、500ではなくinvalid_tokenにする
+func TestWebAuthnFinish_NoSessionCookie(t *testing.T) {
+	j, err := auth.NewJwtBuilderWithSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := j.GenerateAccessToken(&entity.User{ID: 100001, Role: entity.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewWebAuthnHandler(nil)
+
+	for name, finish := range map[string]echo.HandlerFunc{
+		"registration": h.FinishRegistration,
+		"login":        h.FinishLogin,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+string(tok))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			if err := j.SetAuthToContext(c); err != nil {
+				t.Fatal(err)
+			}
+			if err := finish(c); !errors.Is(err, usecase.ErrInvalidToken) {
+				t.Errorf("error = %v, want %v", err, usecase.ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package inmem
+
+import (
+	"context"
+	"login-example/entity"
+	"login-example/repository"
+	"sync"
+	"time"
+)
+
+var _ repository.IMailOutboxRepository = (*MailOutboxRepository)(nil)
+
+// repository.IMailOutboxRepositoryのメモリ上の実装
+type MailOutboxRepository struct {
+	mu     sync.Mutex
+	mails  []*entity.OutboxMail
+	nextID entity.OutboxMailID
+}
+
+func NewMailOutboxRepository() *MailOutboxRepository {
+	return &MailOutboxRepository{nextID: 1}
+}
+
+func (r *MailOutboxRepository) Create(ctx context.Context, m *entity.OutboxMail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m.CreatedAt = time.Now()
+	m.ID = r.nextID
+	r.nextID++
+	c := *m
+	r.mails = append(r.mails, &c)
+	return nil
+}
+
+func (r *MailOutboxRepository) ListPending(ctx context.Context, maxAttempts, limit int) (entity.OutboxMails, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ms := entity.OutboxMails{}
+	for _, m := range r.mails {
+		if len(ms) >= limit {
+			break
+		}
+		if m.SentAt == nil && m.Attempts < maxAttempts && (m.NextAttemptAt == nil || !m.NextAttemptAt.After(time.Now())) {
+			c := *m
+			ms = append(ms, &c)
+		}
+	}
+	return ms, nil
+}
+
+func (r *MailOutboxRepository) MarkSent(ctx context.Context, id entity.OutboxMailID) error {
+	return r.update(id, func(m *entity.OutboxMail) {
+		now := time.Now()
+		m.SentAt = &now
+		m.Token = ""
+		m.Link = ""
+	})
+}
+
+func (r *MailOutboxRepository) MarkFailed(ctx context.Context, id entity.OutboxMailID, reason string, nextAttemptAt time.Time) error {
+	return r.update(id, func(m *entity.OutboxMail) {
+		m.Attempts++
+		m.LastError = reason
+		m.NextAttemptAt = &nextAttemptAt
+	})
+}
+
+func (r *MailOutboxRepository) update(id entity.OutboxMailID, f func(m *entity.OutboxMail)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.mails {
+		if m.ID == id {
+			f(m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package inmem
+
+import (
+	"context"
+	"login-example/mail"
+	"sync"
+)
+
+var _ mail.IMailer = (*Mailer)(nil)
+
+// 送信したメールの種類
+type MailKind string
+
+const (
+	MailActivateToken     = MailKind("activate_token")
+	MailActivateCode      = MailKind("activate_code")
+	MailMagicLink         = MailKind("magic_link")
+	MailEmailChangeToken  = MailKind("email_change_token")
+	MailEmailChangeNotice = MailKind("email_change_notice")
+	MailExportLink        = MailKind("export_link")
+	MailInvitation        = MailKind("organization_invitation")
+	MailLoginAlert        = MailKind("login_alert")
+	MailLoginNotice       = MailKind("login_notice")
+)
+
+// 送信したメールの内容。メールの種類によって使わないフィールドは空になる
+type SentMail struct {
+	Kind     MailKind
+	To       string
+	Token    string
+	Link     string
+	NewEmail string
+	OrgName  string
+	Login    mail.LoginNotice
+}
+
+// mail.IMailerのメモリ上の実装。メールを送信せずに記録する
+// テストでは送信されたトークンやリンクを取り出して、後続のリクエストに使う
+type Mailer struct {
+	mu   sync.Mutex
+	sent []SentMail
+}
+
+func NewMailer() *Mailer {
+	return &Mailer{}
+}
+
+func (m *Mailer) SendWithActivateToken(ctx context.Context, email, token, link string) error {
+	return m.record(SentMail{Kind: MailActivateToken, To: email, Token: token, Link: link})
+}
+
+func (m *Mailer) SendWithActivateCode(ctx context.Context, email, code, link string) error {
+	return m.record(SentMail{Kind: MailActivateCode, To: email, Token: code, Link: link})
+}
+
+func (m *Mailer) SendWithMagicLink(ctx context.Context, email, link string) error {
+	return m.record(SentMail{Kind: MailMagicLink, To: email, Link: link})
+}
+
+func (m *Mailer) SendWithEmailChangeToken(ctx context.Context, email, token string) error {
+	return m.record(SentMail{Kind: MailEmailChangeToken, To: email, Token: token})
+}
+
+func (m *Mailer) SendEmailChangeNotice(ctx context.Context, email, newEmail string) error {
+	return m.record(SentMail{Kind: MailEmailChangeNotice, To: email, NewEmail: newEmail})
+}
+
+func (m *Mailer) SendWithExportLink(ctx context.Context, email, link string) error {
+	return m.record(SentMail{Kind: MailExportLink, To: email, Link: link})
+}
+
+func (m *Mailer) SendWithInvitation(ctx context.Context, email, orgName, link string) error {
+	return m.record(SentMail{Kind: MailInvitation, To: email, Link: link, OrgName: orgName})
+}
+
+func (m *Mailer) SendLoginAlert(ctx context.Context, email string, login mail.LoginNotice, link string) error {
+	return m.record(SentMail{Kind: MailLoginAlert, To: email, Link: link, Login: login})
+}
+
+func (m *Mailer) SendLoginNotice(ctx context.Context, email string, login mail.LoginNotice) error {
+	return m.record(SentMail{Kind: MailLoginNotice, To: email, Login: login})
+}
+
+func (m *Mailer) record(s SentMail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, s)
+	return nil
+}
+
+// 送信したメールを送信順に返す
+func (m *Mailer) Sent() []SentMail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]SentMail(nil), m.sent...)
+}
+
+// toに最後に送信したメールを返す
+func (m *Mailer) Last(to string) (SentMail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			return m.sent[i], true
+		}
+	}
+	return SentMail{}, false
+}
+
+// 記録したメールを消去する
+func (m *Mailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = nil
+}
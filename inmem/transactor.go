@@ -0,0 +1,15 @@
+package inmem
+
+import (
+	"context"
+	"login-example/repository"
+)
+
+var _ repository.ITransactor = Transactor{}
+
+// repository.ITransactorのメモリ上の実装。fnをそのまま実行するだけで、ロールバックはしない
+type Transactor struct{}
+
+func (Transactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
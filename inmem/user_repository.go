@@ -0,0 +1,615 @@
+package inmem
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"login-example/repository"
+	"slices"
+	"sync"
+	"time"
+)
+
+var _ repository.IUserRepository = (*UserRepository)(nil)
+
+// repository.IUserRepositoryのメモリ上の実装。テストやデモ用
+// DBと同じく、保存・取得したユーザーは呼び出し元と共有しないようにコピーする
+type UserRepository struct {
+	mu     sync.Mutex
+	users  map[entity.UserID]*entity.User
+	nextID entity.UserID
+}
+
+func NewUserRepository() *UserRepository {
+	// マイグレーションのAUTO_INCREMENTに合わせる
+	return &UserRepository{users: map[entity.UserID]*entity.User{}, nextID: 100001}
+}
+
+func (r *UserRepository) PreRegister(ctx context.Context, u *entity.User) error {
+	u.State = entity.UserInactive
+	return r.insert(u)
+}
+
+func (r *UserRepository) Register(ctx context.Context, u *entity.User) error {
+	u.State = entity.UserActive
+	return r.insert(u)
+}
+
+func (r *UserRepository) insert(u *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// emailとemail_keyは退会済みのユーザーも含めて一意
+	if u.EmailKey == "" {
+		u.EmailKey = u.Email
+	}
+	if r.emailTaken(u) {
+		return repository.ErrEmailTaken
+	}
+
+	u.UpdatedAt = time.Now()
+	u.CreatedAt = time.Now()
+	if u.Role == "" {
+		u.Role = entity.RoleUser
+	}
+	u.EmailStatus = entity.EmailDeliverable
+	u.NotifyOnNewClient = true
+	u.Version = 1
+	u.ID = r.nextID
+	r.nextID++
+	r.users[u.ID] = clone(u)
+	return nil
+}
+
+// DBと同じく、退会済みのユーザーは取得しない
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email && u.DeletedAt == nil {
+			return clone(u), nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get: %w", sql.ErrNoRows)
+}
+
+// DBと同じく、退会済みのユーザーは取得しない
+func (r *UserRepository) GetByEmailKey(ctx context.Context, key string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.EmailKey == key && u.DeletedAt == nil {
+			return clone(u), nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get: %w", sql.ErrNoRows)
+}
+
+// DBと同じく、退会済みのユーザーも含めてid順に返す
+func (r *UserRepository) ListEmailKeys(ctx context.Context, after entity.UserID, limit int) (entity.Users, error) {
+	r.mu.Lock()
+	us := entity.Users{}
+	for _, u := range r.users {
+		if u.ID > after {
+			us = append(us, clone(u))
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(us, func(a, b *entity.User) int { return cmp.Compare(a.ID, b.ID) })
+	if len(us) > limit {
+		us = us[:limit]
+	}
+	return us, nil
+}
+
+func (r *UserRepository) UpdateEmailKey(ctx context.Context, u *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.users {
+		if v.ID != u.ID && v.EmailKey == u.EmailKey {
+			return repository.ErrEmailTaken
+		}
+	}
+	v, ok := r.users[u.ID]
+	if !ok {
+		return nil
+	}
+	u.UpdatedAt = time.Now()
+	v.EmailKey = u.EmailKey
+	v.UpdatedAt = u.UpdatedAt
+	v.Version++
+	u.Version = v.Version
+	return nil
+}
+
+// r.muをロックしてから呼ぶ
+func (r *UserRepository) emailTaken(u *entity.User) bool {
+	for _, v := range r.users {
+		if v.ID != u.ID && (v.Email == u.Email || v.EmailKey == u.EmailKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// DBと同じく、退会済みのユーザーは取得しない
+func (r *UserRepository) GetByPhone(ctx context.Context, phone string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Phone == phone && u.DeletedAt == nil {
+			return clone(u), nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get: %w", sql.ErrNoRows)
+}
+
+// DBと同じく、退会済みのユーザーは取得しない
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Username != nil && *u.Username == username && u.DeletedAt == nil {
+			return clone(u), nil
+		}
+	}
+	return nil, fmt.Errorf("failed to get: %w", sql.ErrNoRows)
+}
+
+// usernameは退会済みのユーザーも含めて一意
+func (r *UserRepository) UpdateUsername(ctx context.Context, u *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u.Username != nil {
+		for _, v := range r.users {
+			if v.ID != u.ID && v.Username != nil && *v.Username == *u.Username {
+				return repository.ErrUsernameTaken
+			}
+		}
+	}
+	v, ok := r.users[u.ID]
+	if !ok || v.Version != u.Version {
+		return repository.ErrVersionConflict
+	}
+	u.UpdatedAt = time.Now()
+	v.Username = clonePtr(u.Username)
+	v.UpdatedAt = u.UpdatedAt
+	v.Version++
+	u.Version = v.Version
+	return nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, id entity.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, id)
+	return nil
+}
+
+func (r *UserRepository) Activate(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.State = entity.UserActive
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.State = u.State
+		v.Profile = u.Profile
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[uid]
+	if !ok || u.DeletedAt != nil {
+		return nil, fmt.Errorf("failed to get: %w", sql.ErrNoRows)
+	}
+	return clone(u), nil
+}
+
+func (r *UserRepository) List(ctx context.Context, opts repository.ListOptions) (entity.Users, int64, error) {
+	opts = opts.Normalize()
+
+	r.mu.Lock()
+	us := entity.Users{}
+	for _, u := range r.users {
+		// DBと同じく、stateに退会済みを指定した場合だけ退会済みのユーザーを取得する
+		if (u.DeletedAt != nil) != (opts.State == entity.UserDeleted) {
+			continue
+		}
+		if opts.EmailStatus != "" && u.EmailStatus != opts.EmailStatus {
+			continue
+		}
+		if opts.ProvisionedBy != "" && u.ProvisionedBy != opts.ProvisionedBy {
+			continue
+		}
+		if opts.State == "" || u.State == opts.State {
+			us = append(us, clone(u))
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(us, func(a, b *entity.User) int {
+		c := 0
+		switch opts.SortBy {
+		case repository.SortByEmail:
+			c = cmp.Compare(a.Email, b.Email)
+		case repository.SortByCreatedAt:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case repository.SortByUpdatedAt:
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if opts.SortOrder == repository.SortDesc {
+			c = -c
+		}
+		return c
+	})
+
+	total := int64(len(us))
+	start := min(opts.Offset, len(us))
+	end := min(start+opts.Limit, len(us))
+	return us[start:end], total, nil
+}
+
+func (r *UserRepository) UpdateActivateToken(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.ActivateAttempts = 0
+	return r.updateAndBump(u, func(v *entity.User) {
+		v.ActivateToken = u.ActivateToken
+		v.ActivateAttempts = u.ActivateAttempts
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+// トークンの有効期限の計算に使うので、updated_atは更新しない
+func (r *UserRepository) IncrementActivateAttempts(ctx context.Context, u *entity.User) error {
+	if err := r.update(u.ID, func(v *entity.User) {
+		v.ActivateAttempts++
+	}); err != nil {
+		return err
+	}
+	u.ActivateAttempts++
+	return nil
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.TokenRevokedAt = &now
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.Password = u.Password
+		v.Salt = u.Salt
+		v.TokenRevokedAt = u.TokenRevokedAt
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	return r.updateAndBump(u, func(v *entity.User) {
+		v.Password = u.Password
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) RequestEmailChange(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.PendingEmailRequestedAt = &now
+	u.PendingEmailAttempts = 0
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.PendingEmail = u.PendingEmail
+		v.PendingEmailToken = u.PendingEmailToken
+		v.PendingEmailRequestedAt = u.PendingEmailRequestedAt
+		v.PendingEmailAttempts = u.PendingEmailAttempts
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) IncrementEmailChangeAttempts(ctx context.Context, u *entity.User) error {
+	if err := r.update(u.ID, func(v *entity.User) {
+		v.PendingEmailAttempts++
+	}); err != nil {
+		return err
+	}
+	u.PendingEmailAttempts++
+	return nil
+}
+
+func (r *UserRepository) ConfirmEmailChange(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Email = u.PendingEmail
+	u.PendingEmail = ""
+	u.PendingEmailToken = ""
+	u.PendingEmailRequestedAt = nil
+	u.PendingEmailAttempts = 0
+	u.EmailStatus = entity.EmailDeliverable
+	u.EmailStatusAt = nil
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(u) {
+		return repository.ErrEmailTaken
+	}
+	v, ok := r.users[u.ID]
+	if !ok || v.Version != u.Version {
+		return repository.ErrVersionConflict
+	}
+	v.Email = u.Email
+	v.EmailKey = u.EmailKey
+	v.PendingEmail = u.PendingEmail
+	v.PendingEmailToken = u.PendingEmailToken
+	v.PendingEmailRequestedAt = u.PendingEmailRequestedAt
+	v.PendingEmailAttempts = u.PendingEmailAttempts
+	v.EmailStatus = u.EmailStatus
+	v.EmailStatusAt = u.EmailStatusAt
+	v.UpdatedAt = u.UpdatedAt
+	v.Version++
+	u.Version = v.Version
+	return nil
+}
+
+func (r *UserRepository) UpdateEmailStatus(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.EmailStatusAt = &now
+	return r.updateAndBump(u, func(v *entity.User) {
+		v.EmailStatus = u.EmailStatus
+		v.EmailStatusAt = u.EmailStatusAt
+	})
+}
+
+func (r *UserRepository) UpdateState(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	if !u.IsActive() {
+		u.TokenRevokedAt = &now
+	}
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.State = u.State
+		v.TokenRevokedAt = clonePtr(u.TokenRevokedAt)
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) UpdateProfile(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.Profile = u.Profile
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) RequestPhoneChange(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.PendingPhoneRequestedAt = &now
+	u.PendingPhoneAttempts = 0
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.PendingPhone = u.PendingPhone
+		v.PendingPhoneCode = u.PendingPhoneCode
+		v.PendingPhoneRequestedAt = u.PendingPhoneRequestedAt
+		v.PendingPhoneAttempts = u.PendingPhoneAttempts
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) IncrementPhoneAttempts(ctx context.Context, u *entity.User) error {
+	if err := r.update(u.ID, func(v *entity.User) {
+		v.PendingPhoneAttempts++
+	}); err != nil {
+		return err
+	}
+	u.PendingPhoneAttempts++
+	return nil
+}
+
+func (r *UserRepository) ConfirmPhoneChange(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Phone = u.PendingPhone
+	return r.savePhone(u)
+}
+
+func (r *UserRepository) DeletePhone(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Phone = ""
+	return r.savePhone(u)
+}
+
+// 電話番号を保存して、確認待ちの電話番号を消す
+func (r *UserRepository) savePhone(u *entity.User) error {
+	u.PendingPhone = ""
+	u.PendingPhoneCode = ""
+	u.PendingPhoneRequestedAt = nil
+	u.PendingPhoneAttempts = 0
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.Phone = u.Phone
+		v.PendingPhone = u.PendingPhone
+		v.PendingPhoneCode = u.PendingPhoneCode
+		v.PendingPhoneRequestedAt = u.PendingPhoneRequestedAt
+		v.PendingPhoneAttempts = u.PendingPhoneAttempts
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) UpdateSmsLoginCode(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.SmsLoginCodeSentAt = &now
+	u.SmsLoginAttempts = 0
+	return r.updateAndBump(u, func(v *entity.User) {
+		v.SmsLoginCode = u.SmsLoginCode
+		v.SmsLoginCodeSentAt = u.SmsLoginCodeSentAt
+		v.SmsLoginAttempts = u.SmsLoginAttempts
+	})
+}
+
+func (r *UserRepository) IncrementSmsLoginAttempts(ctx context.Context, u *entity.User) error {
+	if err := r.update(u.ID, func(v *entity.User) {
+		v.SmsLoginAttempts++
+	}); err != nil {
+		return err
+	}
+	u.SmsLoginAttempts++
+	return nil
+}
+
+func (r *UserRepository) ConsumeSmsLoginCode(ctx context.Context, u *entity.User) error {
+	u.SmsLoginCode = ""
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.SmsLoginCode = u.SmsLoginCode
+	})
+}
+
+func (r *UserRepository) UpdateAvatar(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.AvatarURL = u.AvatarURL
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) UpdateNotifyOnLogin(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.NotifyOnLogin = u.NotifyOnLogin
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) UpdatePreferences(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.Preferences = u.Preferences
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) RevokeTokens(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.TokenRevokedAt = &now
+	u.TokenVersion++
+	return r.updateWithVersion(u, func(v *entity.User) {
+		v.TokenRevokedAt = clonePtr(u.TokenRevokedAt)
+		v.TokenVersion = u.TokenVersion
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) Delete(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.DeletedAt = &now
+	u.TokenRevokedAt = &now
+	u.StateBeforeDelete = u.State
+	u.State = entity.UserDeleted
+	return r.updateAndBump(u, func(v *entity.User) {
+		v.State = u.State
+		v.StateBeforeDelete = u.StateBeforeDelete
+		v.DeletedAt = u.DeletedAt
+		v.TokenRevokedAt = u.TokenRevokedAt
+		v.UpdatedAt = u.UpdatedAt
+	})
+}
+
+func (r *UserRepository) Restore(ctx context.Context, uid entity.UserID, deletedSince time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.users[uid]
+	if !ok || v.DeletedAt == nil || v.DeletedAt.Before(deletedSince) {
+		return sql.ErrNoRows
+	}
+	v.State = v.StateBeforeDelete
+	if v.State == "" {
+		v.State = entity.UserActive
+	}
+	v.StateBeforeDelete = ""
+	v.DeletedAt = nil
+	v.Version++
+	v.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *UserRepository) PurgeOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, v := range r.users {
+		if v.DeletedAt != nil && v.DeletedAt.Before(before) {
+			delete(r.users, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// 保存済みのユーザーを更新する。DBのUPDATEと同じく、存在しない場合は何もしない
+func (r *UserRepository) update(uid entity.UserID, f func(v *entity.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.users[uid]; ok {
+		f(v)
+	}
+	return nil
+}
+
+// 更新して、バージョンを1増やす
+func (r *UserRepository) updateAndBump(u *entity.User, f func(v *entity.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v, ok := r.users[u.ID]; ok {
+		f(v)
+		v.Version++
+		u.Version = v.Version
+	}
+	return nil
+}
+
+// DBの実装と同じく、読み込んだ時からバージョンが変わっていればErrVersionConflictを返す
+func (r *UserRepository) updateWithVersion(u *entity.User, f func(v *entity.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.users[u.ID]
+	if !ok || v.Version != u.Version {
+		return repository.ErrVersionConflict
+	}
+	f(v)
+	v.Version++
+	u.Version = v.Version
+	return nil
+}
+
+func clone(u *entity.User) *entity.User {
+	c := *u
+	c.Username = clonePtr(u.Username)
+	c.TokenRevokedAt = clonePtr(u.TokenRevokedAt)
+	c.PendingEmailRequestedAt = clonePtr(u.PendingEmailRequestedAt)
+	c.DeletedAt = clonePtr(u.DeletedAt)
+	return &c
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
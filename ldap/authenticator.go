@@ -0,0 +1,126 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// ユーザーが見つからない、またはパスワードが違う
+var ErrInvalidCredentials = errors.New("invalid ldap credentials")
+
+// ディレクトリのエントリから取り出したユーザー情報
+type UserInfo struct {
+	DN    string
+	Email string
+}
+
+type IAuthenticator interface {
+	// ログインIDでユーザーのエントリを検索して、そのDNとパスワードでbindできるか確認する
+	Authenticate(ctx context.Context, username, password string) (*UserInfo, error)
+}
+
+type Config struct {
+	// ldap://またはldaps://から始まるURL
+	URL string
+	// ldap://の場合に、StartTLSで暗号化する
+	StartTLS bool
+	// ユーザーを検索するためのサービスアカウント。空の場合は匿名でbindする
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// ユーザーを検索するフィルター。%sはエスケープしたログインIDに置き換える
+	// 例: (mail=%s), (&(objectClass=user)(userPrincipalName=%s))
+	UserFilter string
+	// emailを取り出す属性名
+	EmailAttribute string
+	Timeout        time.Duration
+}
+
+type authenticator struct {
+	cfg Config
+}
+
+func NewAuthenticator(cfg Config) IAuthenticator {
+	return &authenticator{cfg: cfg}
+}
+
+func (a *authenticator) Authenticate(ctx context.Context, username, password string) (*UserInfo, error) {
+	// 空のパスワードでのbindは、多くのサーバーで匿名bindとして成功してしまう
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind service account: %w", err)
+		}
+	}
+
+	req := goldap.NewSearchRequest(a.cfg.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(a.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.UserFilter, goldap.EscapeFilter(username)),
+		[]string{a.cfg.EmailAttribute}, nil)
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+	// 複数のエントリが一致する場合は、どのユーザーか特定できないので認証しない
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind user: %w", err)
+	}
+
+	info := &UserInfo{DN: entry.DN, Email: entry.GetAttributeValue(a.cfg.EmailAttribute)}
+	if !strings.Contains(info.Email, "@") {
+		return nil, fmt.Errorf("ldap entry has no email: %s", entry.DN)
+	}
+	return info, nil
+}
+
+func (a *authenticator) dial(ctx context.Context) (*goldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ldap url: %w", err)
+	}
+	// StartTLSでは接続先のホスト名が設定されないので、証明書を検証するために指定する
+	tc := &tls.Config{ServerName: u.Hostname()}
+	d := &net.Dialer{Timeout: a.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.Deadline = deadline
+	}
+
+	conn, err := goldap.DialURL(a.cfg.URL, goldap.DialWithDialer(d), goldap.DialWithTLSConfig(tc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect ldap server: %w", err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tc); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
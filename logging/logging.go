@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// LOG_LEVEL(debug, info, warn, error)のレベルで、JSON形式で標準出力に書き込むロガーを作成する
+func NewFromEnv() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// loggerをcontextに保存する
+// リクエストIDなどを付与したロガーを保存しておくと、usecaseやrepositoryのログにも同じ属性が出力される
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// contextに保存されたloggerを取得する。保存されていない場合はslog.Default()を返す
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// contextのloggerに属性を追加したcontextを返す
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// エラーの属性。fmt.Errorfでラップされたエラーを1つずつ展開して、型の一覧もchainとして出力する
+func Err(err error) slog.Attr {
+	return slog.Group("error",
+		slog.String("message", err.Error()),
+		slog.Any("chain", errorChain(err)),
+	)
+}
+
+func errorChain(err error) []string {
+	chain := []string{}
+	for err != nil {
+		chain = append(chain, fmt.Sprintf("%T", err))
+		// errors.Joinなど複数のエラーをラップしている場合は、それぞれの型を並べる
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			types := []string{}
+			for _, e := range joined.Unwrap() {
+				types = append(types, strings.Join(errorChain(e), " > "))
+			}
+			chain = append(chain, "["+strings.Join(types, ", ")+"]")
+			break
+		}
+		err = errors.Unwrap(err)
+	}
+	return chain
+}
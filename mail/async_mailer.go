@@ -0,0 +1,259 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"login-example/logging"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Closeした後に送信しようとした
+var ErrMailerClosed = errors.New("mailer is closed")
+
+// 非同期で送信する時の設定。0の場合はデフォルト値を使う
+type AsyncConfig struct {
+	// 同時に送信するワーカーの数
+	Workers int
+	// 送信待ちのメールの上限。いっぱいの場合は空くまで待つ
+	QueueSize int
+	// この回数失敗したメールは、再送を諦めてデッドレターにする
+	MaxAttempts int
+	// 再送までの待ち時間。失敗するたびに2倍にして、MaxBackoffを上限にする
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// 再送を諦めたメールを受け取る。nilの場合はログに出力するだけ
+	DeadLetter func(ctx context.Context, dl DeadLetter)
+}
+
+// 再送を諦めたメール
+type DeadLetter struct {
+	Kind     string
+	To       string
+	Attempts int
+	Err      error
+}
+
+func (c AsyncConfig) withDefaults() AsyncConfig {
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 100
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.BaseBackoff <= 0 {
+		c.BaseBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	return c
+}
+
+// リクエストを待たせずにバックグラウンドで送信するIMailer
+type IAsyncMailer interface {
+	IMailer
+	// 新しいメールを受け付けるのをやめて、送信待ちのメールを送信し終わるまで待つ
+	// ctxがキャンセルされたら、再送を待っているメールは諦める
+	Close(ctx context.Context) error
+}
+
+// nextでの送信をワーカーで非同期に行う。送信に失敗した場合は、待ち時間を増やしながら再送する
+func NewAsyncMailer(next IMailer, cfg AsyncConfig) IAsyncMailer {
+	cfg = cfg.withDefaults()
+	m := &asyncMailer{
+		next:  next,
+		cfg:   cfg,
+		jobs:  make(chan *asyncJob, cfg.QueueSize),
+		abort: make(chan struct{}),
+	}
+	m.wg.Add(cfg.Workers)
+	for range cfg.Workers {
+		go m.work()
+	}
+	return m
+}
+
+type asyncMailer struct {
+	next IMailer
+	cfg  AsyncConfig
+	jobs chan *asyncJob
+	wg   sync.WaitGroup
+	// Closeのctxがキャンセルされたら閉じて、再送の待機をやめさせる
+	abort     chan struct{}
+	abortOnce sync.Once
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type asyncJob struct {
+	kind   string
+	to     string
+	send   func(ctx context.Context) error
+	logger *slog.Logger
+	// 送信を受け付けたリクエストのスパン
+	link trace.Link
+}
+
+func (m *asyncMailer) SendWithActivateToken(ctx context.Context, email, token, link string) error {
+	return m.enqueue(ctx, "activate_token", email, func(ctx context.Context) error {
+		return m.next.SendWithActivateToken(ctx, email, token, link)
+	})
+}
+
+func (m *asyncMailer) SendWithActivateCode(ctx context.Context, email, code, link string) error {
+	return m.enqueue(ctx, "activate_code", email, func(ctx context.Context) error {
+		return m.next.SendWithActivateCode(ctx, email, code, link)
+	})
+}
+
+func (m *asyncMailer) SendWithMagicLink(ctx context.Context, email, link string) error {
+	return m.enqueue(ctx, "magic_link", email, func(ctx context.Context) error {
+		return m.next.SendWithMagicLink(ctx, email, link)
+	})
+}
+
+func (m *asyncMailer) SendWithEmailChangeToken(ctx context.Context, email, token string) error {
+	return m.enqueue(ctx, "email_change_token", email, func(ctx context.Context) error {
+		return m.next.SendWithEmailChangeToken(ctx, email, token)
+	})
+}
+
+func (m *asyncMailer) SendEmailChangeNotice(ctx context.Context, email, newEmail string) error {
+	return m.enqueue(ctx, "email_change_notice", email, func(ctx context.Context) error {
+		return m.next.SendEmailChangeNotice(ctx, email, newEmail)
+	})
+}
+
+func (m *asyncMailer) SendWithExportLink(ctx context.Context, email, link string) error {
+	return m.enqueue(ctx, "export_link", email, func(ctx context.Context) error {
+		return m.next.SendWithExportLink(ctx, email, link)
+	})
+}
+
+func (m *asyncMailer) SendWithInvitation(ctx context.Context, email, orgName, link string) error {
+	return m.enqueue(ctx, "organization_invitation", email, func(ctx context.Context) error {
+		return m.next.SendWithInvitation(ctx, email, orgName, link)
+	})
+}
+
+func (m *asyncMailer) SendLoginAlert(ctx context.Context, email string, login LoginNotice, link string) error {
+	return m.enqueue(ctx, "login_alert", email, func(ctx context.Context) error {
+		return m.next.SendLoginAlert(ctx, email, login, link)
+	})
+}
+
+func (m *asyncMailer) SendLoginNotice(ctx context.Context, email string, login LoginNotice) error {
+	return m.enqueue(ctx, "login_notice", email, func(ctx context.Context) error {
+		return m.next.SendLoginNotice(ctx, email, login)
+	})
+}
+
+func (m *asyncMailer) enqueue(ctx context.Context, kind, to string, send func(ctx context.Context) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrMailerClosed
+	}
+
+	j := &asyncJob{
+		kind:   kind,
+		to:     to,
+		send:   send,
+		logger: logging.FromContext(ctx),
+		link:   trace.LinkFromContext(ctx),
+	}
+	select {
+	case m.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *asyncMailer) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.jobs)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		m.abortOnce.Do(func() { close(m.abort) })
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (m *asyncMailer) work() {
+	defer m.wg.Done()
+	for j := range m.jobs {
+		m.deliver(j)
+	}
+}
+
+// 成功するか、MaxAttempts回失敗するまで送信する
+func (m *asyncMailer) deliver(j *asyncJob) {
+	// リクエストのcontextはレスポンスを返すとキャンセルされるので、新しいcontextで送信する
+	ctx := logging.WithLogger(context.Background(), j.logger.With(slog.String("mail_kind", j.kind)))
+	ctx, span := tracer.Start(ctx, "AsyncMailer.deliver", trace.WithLinks(j.link))
+	defer span.End()
+
+	var err error
+	attempt := 0
+	for {
+		attempt++
+		if err = j.send(ctx); err == nil {
+			return
+		}
+		// 宛先が存在しないなど、再送しても成功しない場合はすぐに諦める
+		if errors.Is(err, ErrPermanent) || attempt >= m.cfg.MaxAttempts || !m.wait(ctx, attempt, err) {
+			break
+		}
+	}
+
+	logging.FromContext(ctx).ErrorContext(ctx, "failed to send mail, giving up",
+		slog.Int("attempts", attempt), logging.Err(err))
+	if m.cfg.DeadLetter != nil {
+		m.cfg.DeadLetter(ctx, DeadLetter{Kind: j.kind, To: j.to, Attempts: attempt, Err: err})
+	}
+}
+
+// 再送するまで待つ。Closeがタイムアウトした場合はfalseを返す
+func (m *asyncMailer) wait(ctx context.Context, attempt int, err error) bool {
+	wait := m.backoff(attempt)
+	logging.FromContext(ctx).WarnContext(ctx, "failed to send mail, retrying",
+		slog.Int("attempt", attempt), slog.Duration("wait", wait), logging.Err(err))
+	select {
+	case <-time.After(wait):
+		return true
+	case <-m.abort:
+		return false
+	}
+}
+
+// attempt回目に失敗した後の待ち時間。同時に失敗したメールの再送が重ならないように、ばらつきを持たせる
+func (m *asyncMailer) backoff(attempt int) time.Duration {
+	d := m.cfg.BaseBackoff << (attempt - 1)
+	if d <= 0 || d > m.cfg.MaxBackoff {
+		d = m.cfg.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 保持しておくメールの上限。超えた場合は古いものから捨てる
+var captureLimit = 100
+
+// CaptureMailerで送信したメール
+type CapturedMail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	SentAt  time.Time
+}
+
+// メールを送信せずにメモリ上に保持するIMailer
+// 開発環境でSMTPサーバーを用意せずに、送信されたメールを確認するために使う
+type CaptureMailer struct {
+	IMailer
+	t *captureTransport
+}
+
+// brandはメールのテンプレートに表示するサービスの情報
+func NewCaptureMailer(brand Branding) *CaptureMailer {
+	t := &captureTransport{}
+	return &CaptureMailer{IMailer: &templateMailer{t: t, brand: brand}, t: t}
+}
+
+// 保持しているメールを新しい順に返す。toが空でない場合はその宛先のメールだけを返す
+func (m *CaptureMailer) Mails(to string) []CapturedMail {
+	m.t.mu.Lock()
+	defer m.t.mu.Unlock()
+
+	ms := make([]CapturedMail, 0, len(m.t.mails))
+	for i := len(m.t.mails) - 1; i >= 0; i-- {
+		if to == "" || m.t.mails[i].To == to {
+			ms = append(ms, m.t.mails[i])
+		}
+	}
+	return ms
+}
+
+// toに最後に送信したメールを返す。テストで送信されたトークンやリンクを確認するために使う
+func (m *CaptureMailer) Last(to string) (CapturedMail, bool) {
+	ms := m.Mails(to)
+	if len(ms) == 0 {
+		return CapturedMail{}, false
+	}
+	return ms[0], true
+}
+
+// 保持しているメールを全て削除する
+func (m *CaptureMailer) Reset() {
+	m.t.mu.Lock()
+	defer m.t.mu.Unlock()
+
+	m.t.mails = nil
+}
+
+type captureTransport struct {
+	mu    sync.Mutex
+	mails []CapturedMail
+}
+
+func (t *captureTransport) send(ctx context.Context, to string, msg *message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.mails = append(t.mails, CapturedMail{
+		To:      to,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		SentAt:  time.Now(),
+	})
+	if len(t.mails) > captureLimit {
+		t.mails = t.mails[len(t.mails)-captureLimit:]
+	}
+	return nil
+}
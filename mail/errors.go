@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// 宛先が存在しない、送信元が認証されていないなど、再送しても成功しない
+	ErrPermanent = errors.New("mail rejected permanently")
+	// 送信数の上限に達した。時間を空けて再送すれば成功する
+	ErrThrottled = errors.New("mail sending throttled")
+)
+
+// SMTPサーバーやメール配信サービスが返したエラー
+// 再送しても成功しない場合はErrPermanent、送信数の上限の場合はErrThrottledとしても扱える
+type ProviderError struct {
+	Provider string
+	// SMTPの応答コード、HTTPのステータスコード、APIのエラーコードのいずれか
+	Code    string
+	Message string
+	kind    error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Provider, e.Code, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.kind
+}
+
+// HTTPのAPIのステータスコードからエラーの種類を判定する
+// 429は送信数の上限、それ以外の4xxはリクエストの内容が不正なので再送しても成功しない
+func httpErrorKind(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrThrottled
+	case status == http.StatusRequestTimeout:
+		return nil
+	case status >= 400 && status < 500:
+		return ErrPermanent
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// メール配信サービスのAPIを呼び出すHTTPクライアント
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// APIを呼び出して、2xx以外の場合はProviderErrorを返す
+// errorMessageはレスポンスボディからエラーメッセージを取り出す
+func callAPI(req *http.Request, provider string, errorMessage func(body []byte) string) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s api: %w", provider, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		// コネクションを再利用できるように、ボディは読み捨てる
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	return &ProviderError{
+		Provider: provider,
+		Code:     strconv.Itoa(res.StatusCode),
+		Message:  errorMessage(body),
+		kind:     httpErrorKind(res.StatusCode),
+	}
+}
@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"context"
+	"login-example/logging"
+	"time"
+)
+
+// メールの言語。templates/<言語>/の下のテンプレートを使う
+const (
+	LocaleJa = "ja"
+	LocaleEn = "en"
+)
+
+// 対応している言語
+var Locales = []string{LocaleJa, LocaleEn}
+
+// 受信者の言語がわからないか、対応していない場合の言語
+const DefaultLocale = LocaleJa
+
+// メールの受信者ごとの設定
+type Recipient struct {
+	// 空の場合はDefaultLocale
+	Locale string
+	// ログインの日時などを表示するタイムゾーン。nilの場合は変換しない
+	Location *time.Location
+}
+
+type recipientKey struct{}
+
+// 送信するメールの受信者の設定をcontextに入れる
+func WithRecipient(ctx context.Context, r Recipient) context.Context {
+	return context.WithValue(ctx, recipientKey{}, r)
+}
+
+func recipientFromContext(ctx context.Context) Recipient {
+	r, _ := ctx.Value(recipientKey{}).(Recipient)
+	return r
+}
+
+// emailの受信者の設定を返す。受信者がわからない場合はゼロ値を返す
+type RecipientFunc func(ctx context.Context, email string) (Recipient, error)
+
+// 受信者の設定をlookupで取得して、その言語とタイムゾーンでnextにメールを作成させる
+// 設定を取得できなくてもメールは届けたいので、エラーの場合はログに出力してデフォルトの設定で送信する
+func NewLocalizingMailer(next IMailer, lookup RecipientFunc) IMailer {
+	return &localizingMailer{next: next, lookup: lookup}
+}
+
+type localizingMailer struct {
+	next   IMailer
+	lookup RecipientFunc
+}
+
+func (m *localizingMailer) SendWithActivateToken(ctx context.Context, email, token, link string) error {
+	return m.next.SendWithActivateToken(m.with(ctx, email), email, token, link)
+}
+
+func (m *localizingMailer) SendWithActivateCode(ctx context.Context, email, code, link string) error {
+	return m.next.SendWithActivateCode(m.with(ctx, email), email, code, link)
+}
+
+func (m *localizingMailer) SendWithMagicLink(ctx context.Context, email, link string) error {
+	return m.next.SendWithMagicLink(m.with(ctx, email), email, link)
+}
+
+func (m *localizingMailer) SendWithEmailChangeToken(ctx context.Context, email, token string) error {
+	return m.next.SendWithEmailChangeToken(m.with(ctx, email), email, token)
+}
+
+func (m *localizingMailer) SendEmailChangeNotice(ctx context.Context, email, newEmail string) error {
+	return m.next.SendEmailChangeNotice(m.with(ctx, email), email, newEmail)
+}
+
+func (m *localizingMailer) SendWithExportLink(ctx context.Context, email, link string) error {
+	return m.next.SendWithExportLink(m.with(ctx, email), email, link)
+}
+
+func (m *localizingMailer) SendWithInvitation(ctx context.Context, email, orgName, link string) error {
+	return m.next.SendWithInvitation(m.with(ctx, email), email, orgName, link)
+}
+
+func (m *localizingMailer) SendLoginAlert(ctx context.Context, email string, login LoginNotice, link string) error {
+	return m.next.SendLoginAlert(m.with(ctx, email), email, login, link)
+}
+
+func (m *localizingMailer) SendLoginNotice(ctx context.Context, email string, login LoginNotice) error {
+	return m.next.SendLoginNotice(m.with(ctx, email), email, login)
+}
+
+func (m *localizingMailer) with(ctx context.Context, email string) context.Context {
+	r, err := m.lookup(ctx, email)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to look up mail recipient, using default locale", logging.Err(err))
+		return ctx
+	}
+	return WithRecipient(ctx, r)
+}
@@ -1,44 +1,112 @@
 package mail
 
 import (
-	"fmt"
-	"net/smtp"
-	"strings"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// SMTPの送信のスパンを作成する
+var tracer = otel.Tracer("login-example/mail")
+
 type IMailer interface {
-	SendWithActivateToken(email, token string) error
+	SendWithActivateToken(ctx context.Context, email, token, link string) error
+	SendWithActivateCode(ctx context.Context, email, code, link string) error
+	SendWithMagicLink(ctx context.Context, email, link string) error
+	SendWithEmailChangeToken(ctx context.Context, email, token string) error
+	SendEmailChangeNotice(ctx context.Context, email, newEmail string) error
+	SendWithExportLink(ctx context.Context, email, link string) error
+	SendWithInvitation(ctx context.Context, email, orgName, link string) error
+	SendLoginAlert(ctx context.Context, email string, login LoginNotice, link string) error
+	// ログインのたびの通知。新しい環境からのログインでなくても送る
+	SendLoginNotice(ctx context.Context, email string, login LoginNotice) error
 }
 
-func NewMailhogMailer() IMailer {
-	return &mailhogMailer{}
+// ログインの通知に表示する情報
+type LoginNotice struct {
+	Time      time.Time
+	IPAddress string
+	UserAgent string
+	// 空の場合は表示しない
+	Location string
 }
 
-type mailhogMailer struct {
+// レンダリングしたメールを宛先に送信する。SMTPやメール配信サービスごとに実装する
+type transport interface {
+	send(ctx context.Context, to string, msg *message) error
 }
 
-// mailhog
-var (
-	hostname = "mail"
-	port     = 1025
-	username = "user@example.com"
-	password = "password"
-)
+// テンプレートからメールを作成して、transportで送信する
+type templateMailer struct {
+	t     transport
+	brand Branding
+}
 
-func (m *mailhogMailer) SendWithActivateToken(email, token string) error {
-	from := "info@login-example.app"
-	recipients := []string{email}
-	subject := "認証コード by login-example"
-	body := fmt.Sprintf("認証用トークンです。\nトークン: %s", token)
+func (m *templateMailer) SendWithActivateToken(ctx context.Context, email, token, link string) error {
+	return m.send(ctx, email, tmplActivateToken, templateData{Token: token, Link: link})
+}
 
-	smtpServer := fmt.Sprintf("%s:%d", hostname, port)
+func (m *templateMailer) SendWithActivateCode(ctx context.Context, email, code, link string) error {
+	return m.send(ctx, email, tmplActivateCode, templateData{Token: code, Link: link})
+}
 
-	auth := smtp.CRAMMD5Auth(username, password)
+func (m *templateMailer) SendWithMagicLink(ctx context.Context, email, link string) error {
+	return m.send(ctx, email, tmplMagicLink, templateData{Link: link})
+}
 
-	msg := []byte(strings.ReplaceAll(fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n\n%s", from, strings.Join(recipients, ","), subject, body), "\n", "\r\n"))
+func (m *templateMailer) SendWithEmailChangeToken(ctx context.Context, email, token string) error {
+	return m.send(ctx, email, tmplEmailChangeToken, templateData{Token: token})
+}
+
+func (m *templateMailer) SendEmailChangeNotice(ctx context.Context, email, newEmail string) error {
+	return m.send(ctx, email, tmplEmailChangeNotice, templateData{NewEmail: newEmail})
+}
 
-	if err := smtp.SendMail(smtpServer, auth, from, recipients, msg); err != nil {
+func (m *templateMailer) SendWithExportLink(ctx context.Context, email, link string) error {
+	return m.send(ctx, email, tmplExportLink, templateData{Link: link})
+}
+
+func (m *templateMailer) SendWithInvitation(ctx context.Context, email, orgName, link string) error {
+	return m.send(ctx, email, tmplInvitation, templateData{Link: link, OrgName: orgName})
+}
+
+func (m *templateMailer) SendLoginAlert(ctx context.Context, email string, login LoginNotice, link string) error {
+	return m.send(ctx, email, tmplLoginAlert, templateData{Link: link, Login: login})
+}
+
+func (m *templateMailer) SendLoginNotice(ctx context.Context, email string, login LoginNotice) error {
+	return m.send(ctx, email, tmplLoginNotice, templateData{Login: login})
+}
+
+func (m *templateMailer) send(ctx context.Context, email, tmpl string, data templateData) error {
+	data.Brand = m.brand
+	r := recipientFromContext(ctx)
+	if r.Location != nil {
+		data.Login.Time = data.Login.Time.In(r.Location)
+	}
+	rendered, err := render(r.Locale, tmpl, data)
+	if err != nil {
 		return err
 	}
-	return nil
-}
\ No newline at end of file
+	return m.t.send(ctx, email, rendered)
+}
+
+// 外部への送信のスパンを開始する。送信は遅くなりやすいので、かかった時間をスパンで記録する
+func startSendSpan(ctx context.Context, name string, msg *message, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("mail.subject", msg.Subject))
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// 送信に失敗した場合はスパンにエラーを記録する
+func endSendSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const mailgunDefaultBaseURL = "https://api.mailgun.net"
+
+type MailgunConfig struct {
+	// 送信に使うMailgunのドメイン
+	Domain string
+	APIKey string
+	From   string
+	// trueの場合はMailgunのテストモードで送信する。APIは成功するが、実際には配信されない
+	Sandbox bool
+	// 空の場合はhttps://api.mailgun.net。EUリージョンの場合はhttps://api.eu.mailgun.net
+	BaseURL string
+}
+
+func NewMailgunMailer(cfg MailgunConfig, brand Branding) IMailer {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = mailgunDefaultBaseURL
+	}
+	return &templateMailer{t: &mailgunTransport{cfg: cfg}, brand: brand}
+}
+
+type mailgunTransport struct {
+	cfg MailgunConfig
+}
+
+// https://documentation.mailgun.com/docs/mailgun/api-reference/send/mailgun/messages
+func (t *mailgunTransport) send(ctx context.Context, to string, msg *message) error {
+	form := url.Values{}
+	form.Set("from", t.cfg.From)
+	form.Set("to", to)
+	form.Set("subject", msg.Subject)
+	form.Set("text", msg.Text)
+	form.Set("html", msg.HTML)
+	if t.cfg.Sandbox {
+		form.Set("o:testmode", "yes")
+	}
+
+	ctx, span := startSendSpan(ctx, "mailgun.send", msg,
+		attribute.String("mail.domain", t.cfg.Domain),
+		attribute.Bool("mail.sandbox", t.cfg.Sandbox),
+	)
+	endpoint := t.cfg.BaseURL + "/v3/" + url.PathEscape(t.cfg.Domain) + "/messages"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return endSendSpan(span, err)
+	}
+	req.SetBasicAuth("api", t.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return endSendSpan(span, callAPI(req, "mailgun", mailgunErrorMessage))
+}
+
+func mailgunErrorMessage(body []byte) string {
+	var res struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Message == "" {
+		return string(body)
+	}
+	return res.Message
+}
@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// テキストとHTMLをmultipart/alternativeにまとめたメッセージを作成する
+// メールクライアントは表示できる最後のパートを使うので、HTMLを後にする
+func buildMIMEMessage(from string, to []string, msg *message) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mime part: %w", err)
+		}
+		// 改行はCRLFに変換される
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(p.content)); err != nil {
+			return nil, fmt.Errorf("failed to write mime part: %w", err)
+		}
+		if err := qw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write mime part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart: %w", err)
+	}
+
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	// 日本語の件名はエンコードしないと文字化けする
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const sendGridDefaultBaseURL = "https://api.sendgrid.com"
+
+type SendGridConfig struct {
+	APIKey string
+	From   string
+	// trueの場合はSendGridのサンドボックスモードで送信する。リクエストの検証だけで、実際には配信されない
+	Sandbox bool
+	// 空の場合はhttps://api.sendgrid.com
+	BaseURL string
+}
+
+func NewSendGridMailer(cfg SendGridConfig, brand Branding) IMailer {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = sendGridDefaultBaseURL
+	}
+	return &templateMailer{t: &sendGridTransport{cfg: cfg}, brand: brand}
+}
+
+type sendGridTransport struct {
+	cfg SendGridConfig
+}
+
+// https://www.twilio.com/docs/sendgrid/api-reference/mail-send/mail-send
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	MailSettings     *sendGridMailSettings     `json:"mail_settings,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridMailSettings struct {
+	SandboxMode struct {
+		Enable bool `json:"enable"`
+	} `json:"sandbox_mode"`
+}
+
+type sendGridErrorResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+	} `json:"errors"`
+}
+
+func (t *sendGridTransport) send(ctx context.Context, to string, msg *message) error {
+	body := sendGridRequest{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: to}}}},
+		From:             sendGridAddress{Email: t.cfg.From},
+		Subject:          msg.Subject,
+		// text/plainを先にする必要がある
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: msg.Text},
+			{Type: "text/html", Value: msg.HTML},
+		},
+	}
+	if t.cfg.Sandbox {
+		body.MailSettings = &sendGridMailSettings{}
+		body.MailSettings.SandboxMode.Enable = true
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sendgrid request: %w", err)
+	}
+
+	ctx, span := startSendSpan(ctx, "sendgrid.send", msg, attribute.Bool("mail.sandbox", t.cfg.Sandbox))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.BaseURL+"/v3/mail/send", bytes.NewReader(b))
+	if err != nil {
+		return endSendSpan(span, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return endSendSpan(span, callAPI(req, "sendgrid", sendGridErrorMessage))
+}
+
+func sendGridErrorMessage(body []byte) string {
+	var res sendGridErrorResponse
+	if err := json.Unmarshal(body, &res); err != nil || len(res.Errors) == 0 {
+		return string(body)
+	}
+	msgs := make([]string, 0, len(res.Errors))
+	for _, e := range res.Errors {
+		if e.Field != "" {
+			msgs = append(msgs, e.Field+": "+e.Message)
+		} else {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
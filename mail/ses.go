@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// サンドボックスモードの送信先。SESのメールボックスシミュレーターで、配信に成功した扱いになる
+const sesSimulatorSuccess = "success@simulator.amazonses.com"
+
+type SESConfig struct {
+	// 空の場合はAWS_REGIONなど、AWS SDKのデフォルトの設定を使う
+	Region string
+	From   string
+	// trueの場合は全てのメールをメールボックスシミュレーターに送信して、実際の宛先には配信しない
+	Sandbox bool
+}
+
+// 認証情報はAWS SDKのデフォルトの方法(環境変数、共有設定ファイル、IAMロールなど)で取得する
+func NewSESMailer(ctx context.Context, cfg SESConfig, brand Branding) (IMailer, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	return &templateMailer{t: &sesTransport{cfg: cfg, client: sesv2.NewFromConfig(awsCfg)}, brand: brand}, nil
+}
+
+type sesTransport struct {
+	cfg    SESConfig
+	client *sesv2.Client
+}
+
+func (t *sesTransport) send(ctx context.Context, to string, msg *message) error {
+	if t.cfg.Sandbox {
+		to = sesSimulatorSuccess
+	}
+	raw, err := buildMIMEMessage(t.cfg.From, []string{to}, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startSendSpan(ctx, "ses.send", msg, attribute.Bool("mail.sandbox", t.cfg.Sandbox))
+	_, err = t.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(t.cfg.From),
+		Destination:      &types.Destination{ToAddresses: []string{to}},
+		Content:          &types.EmailContent{Raw: &types.RawMessage{Data: raw}},
+	})
+	return endSendSpan(span, sesError(err))
+}
+
+// SESのエラーコードからエラーの種類を判定する
+func sesError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	pe := &ProviderError{Provider: "ses", Code: apiErr.ErrorCode(), Message: apiErr.ErrorMessage()}
+	switch apiErr.ErrorCode() {
+	case "TooManyRequestsException", "LimitExceededException":
+		pe.kind = ErrThrottled
+	case "MessageRejected", "MailFromDomainNotVerifiedException", "AccountSuspendedException",
+		"SendingPausedException", "BadRequestException", "NotFoundException":
+		pe.kind = ErrPermanent
+	}
+	return pe
+}
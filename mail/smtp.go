@@ -0,0 +1,272 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SMTPサーバーとの通信の暗号化の方法
+type SMTPTLSMode string
+
+const (
+	// 暗号化しない。ローカルのmailhogなどで使う
+	SMTPTLSNone = SMTPTLSMode("none")
+	// 平文で接続してからSTARTTLSで暗号化する。サーバーが対応していない場合はエラーにする
+	SMTPStartTLS = SMTPTLSMode("starttls")
+	// 接続時からTLSで暗号化する(SMTPS)
+	SMTPImplicitTLS = SMTPTLSMode("tls")
+)
+
+// SMTPサーバーの認証方式
+type SMTPAuthMethod string
+
+const (
+	SMTPAuthNone = SMTPAuthMethod("none")
+	// net/smtpのPLAIN認証は、暗号化されていない接続ではlocalhost以外に送らない
+	SMTPAuthPlain   = SMTPAuthMethod("plain")
+	SMTPAuthCRAMMD5 = SMTPAuthMethod("cram-md5")
+)
+
+// SMTPサーバーの接続情報
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// 空の場合はSMTPTLSNone
+	TLS SMTPTLSMode
+	// 証明書を検証しない。自己署名の証明書を使う開発環境用
+	TLSSkipVerify bool
+	// 空の場合はSMTPAuthCRAMMD5
+	Auth SMTPAuthMethod
+	// 接続してから認証が終わるまでの時間と、1通を送信する時間の上限。0の場合はデフォルト値を使う
+	DialTimeout time.Duration
+	SendTimeout time.Duration
+	// 使い回すために残しておく接続の数。0の場合は1通ごとに接続を閉じる
+	MaxIdleConns int
+	// この時間使われなかった接続は閉じる。0の場合はデフォルト値を使う
+	IdleTimeout time.Duration
+}
+
+func (c SMTPConfig) withDefaults() SMTPConfig {
+	if c.TLS == "" {
+		c.TLS = SMTPTLSNone
+	}
+	if c.Auth == "" {
+		c.Auth = SMTPAuthCRAMMD5
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 10 * time.Second
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = 30 * time.Second
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 30 * time.Second
+	}
+	return c
+}
+
+// brandはメールのテンプレートに表示するサービスの情報
+func NewSMTPMailer(cfg SMTPConfig, brand Branding) IMailer {
+	return &templateMailer{t: &smtpTransport{cfg: cfg.withDefaults()}, brand: brand}
+}
+
+type smtpTransport struct {
+	cfg SMTPConfig
+
+	mu sync.Mutex
+	// 送信が終わって使い回せる接続。最後に使ったものが末尾
+	idle []*smtpConn
+}
+
+type smtpConn struct {
+	conn     net.Conn
+	c        *smtp.Client
+	lastUsed time.Time
+}
+
+func (t *smtpTransport) send(ctx context.Context, to string, msg *message) error {
+	raw, err := buildMIMEMessage(t.cfg.From, []string{to}, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startSendSpan(ctx, "smtp.send", msg,
+		attribute.String("server.address", t.cfg.Host),
+		attribute.Int("server.port", t.cfg.Port),
+	)
+	sc, err := t.get(ctx)
+	if err != nil {
+		return endSendSpan(span, smtpError(err))
+	}
+	if err := t.deliver(ctx, sc, to, raw); err != nil {
+		// 途中で失敗した接続は状態がわからないので使い回さない
+		sc.close()
+		return endSendSpan(span, smtpError(err))
+	}
+	t.put(sc)
+	return endSendSpan(span, nil)
+}
+
+func (t *smtpTransport) deliver(ctx context.Context, sc *smtpConn, to string, raw []byte) error {
+	sc.conn.SetDeadline(deadline(ctx, t.cfg.SendTimeout))
+
+	if err := sc.c.Mail(t.cfg.From); err != nil {
+		return err
+	}
+	if err := sc.c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := sc.c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// 使い回せる接続があればそれを返し、なければ新しく接続する
+func (t *smtpTransport) get(ctx context.Context) (*smtpConn, error) {
+	for {
+		t.mu.Lock()
+		if len(t.idle) == 0 {
+			t.mu.Unlock()
+			return t.dial(ctx)
+		}
+		sc := t.idle[len(t.idle)-1]
+		t.idle = t.idle[:len(t.idle)-1]
+		t.mu.Unlock()
+
+		if time.Since(sc.lastUsed) > t.cfg.IdleTimeout {
+			sc.close()
+			continue
+		}
+		// サーバー側で切断されていないか確認する
+		sc.conn.SetDeadline(deadline(ctx, t.cfg.DialTimeout))
+		if err := sc.c.Noop(); err != nil {
+			sc.close()
+			continue
+		}
+		return sc, nil
+	}
+}
+
+func (t *smtpTransport) put(sc *smtpConn) {
+	sc.lastUsed = time.Now()
+
+	t.mu.Lock()
+	if len(t.idle) < t.cfg.MaxIdleConns {
+		t.idle = append(t.idle, sc)
+		sc = nil
+	}
+	t.mu.Unlock()
+
+	if sc != nil {
+		sc.close()
+	}
+}
+
+// 接続して、設定に合わせてTLSと認証を行う
+func (t *smtpTransport) dial(ctx context.Context) (*smtpConn, error) {
+	addr := net.JoinHostPort(t.cfg.Host, strconv.Itoa(t.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: t.cfg.Host, InsecureSkipVerify: t.cfg.TLSSkipVerify}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.DialTimeout)
+	defer cancel()
+
+	d := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if t.cfg.TLS == SMTPImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial smtp server: %w", err)
+	}
+	conn.SetDeadline(deadline(ctx, t.cfg.DialTimeout))
+
+	c, err := smtp.NewClient(conn, t.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	sc := &smtpConn{conn: conn, c: c}
+
+	if t.cfg.TLS == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			sc.close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			sc.close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	// smtp.SendMailと同じく、サーバーが対応している場合だけ認証する
+	if auth := t.auth(); auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(auth); err != nil {
+				sc.close()
+				return nil, fmt.Errorf("failed to authenticate: %w", err)
+			}
+		}
+	}
+	return sc, nil
+}
+
+func (t *smtpTransport) auth() smtp.Auth {
+	switch t.cfg.Auth {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host)
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(t.cfg.Username, t.cfg.Password)
+	default:
+		return nil
+	}
+}
+
+// QUITを送ってから接続を閉じる。QUITに失敗しても接続は閉じる
+func (sc *smtpConn) close() {
+	sc.conn.SetDeadline(time.Now().Add(time.Second))
+	_ = sc.c.Quit()
+	sc.conn.Close()
+}
+
+// ctxの期限とtimeoutの早い方
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	d := time.Now().Add(timeout)
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		return cd
+	}
+	return d
+}
+
+// SMTPの応答コードが5xxの場合は、再送しても成功しない
+func smtpError(err error) error {
+	var te *textproto.Error
+	if !errors.As(err, &te) {
+		return err
+	}
+	pe := &ProviderError{Provider: "smtp", Code: fmt.Sprint(te.Code), Message: te.Msg}
+	if te.Code >= 500 {
+		pe.kind = ErrPermanent
+	}
+	return pe
+}
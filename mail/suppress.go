@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+)
+
+// バウンスや迷惑メールの報告があった宛先には送信しない。再送しても成功しないのでErrPermanentとしても扱える
+var ErrSuppressed = fmt.Errorf("recipient is suppressed: %w", ErrPermanent)
+
+// 宛先への送信を止めるべきかを判定する
+type SuppressFunc func(ctx context.Context, email string) (bool, error)
+
+// 送信する前にsuppressedで宛先を確認して、送信を止めるべき宛先にはErrSuppressedを返すIMailer
+func NewSuppressingMailer(next IMailer, suppressed SuppressFunc) IMailer {
+	return &suppressingMailer{next: next, suppressed: suppressed}
+}
+
+type suppressingMailer struct {
+	next       IMailer
+	suppressed SuppressFunc
+}
+
+func (m *suppressingMailer) SendWithActivateToken(ctx context.Context, email, token, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithActivateToken(ctx, email, token, link)
+}
+
+func (m *suppressingMailer) SendWithActivateCode(ctx context.Context, email, code, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithActivateCode(ctx, email, code, link)
+}
+
+func (m *suppressingMailer) SendWithMagicLink(ctx context.Context, email, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithMagicLink(ctx, email, link)
+}
+
+func (m *suppressingMailer) SendWithEmailChangeToken(ctx context.Context, email, token string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithEmailChangeToken(ctx, email, token)
+}
+
+func (m *suppressingMailer) SendEmailChangeNotice(ctx context.Context, email, newEmail string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendEmailChangeNotice(ctx, email, newEmail)
+}
+
+func (m *suppressingMailer) SendWithExportLink(ctx context.Context, email, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithExportLink(ctx, email, link)
+}
+
+func (m *suppressingMailer) SendWithInvitation(ctx context.Context, email, orgName, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendWithInvitation(ctx, email, orgName, link)
+}
+
+func (m *suppressingMailer) SendLoginAlert(ctx context.Context, email string, login LoginNotice, link string) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendLoginAlert(ctx, email, login, link)
+}
+
+func (m *suppressingMailer) SendLoginNotice(ctx context.Context, email string, login LoginNotice) error {
+	if err := m.check(ctx, email); err != nil {
+		return err
+	}
+	return m.next.SendLoginNotice(ctx, email, login)
+}
+
+func (m *suppressingMailer) check(ctx context.Context, email string) error {
+	suppressed, err := m.suppressed(ctx, email)
+	if err != nil {
+		return fmt.Errorf("failed to check suppression: %w", err)
+	}
+	if suppressed {
+		return ErrSuppressed
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// メールの種類ごとに、件名(subject)、テキスト(text)、HTML(html)の3つのテンプレートを定義する
+// テキストとHTMLは、それぞれlayout.txtとlayout.htmlに埋め込む
+// 言語ごとにtemplates/<言語>/の下に同じ名前のテンプレートを置く
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+// テンプレートの名前。templates/<言語>/<名前>.tmplに対応する
+const (
+	tmplActivateToken     = "activate_token"
+	tmplActivateCode      = "activate_code"
+	tmplMagicLink         = "magic_link"
+	tmplEmailChangeToken  = "email_change_token"
+	tmplEmailChangeNotice = "email_change_notice"
+	tmplExportLink        = "export_link"
+	tmplInvitation        = "organization_invitation"
+	tmplLoginAlert        = "login_alert"
+	tmplLoginNotice       = "login_notice"
+)
+
+// メールに表示するサービスの情報
+type Branding struct {
+	ProductName string
+	// 空の場合はフッターにお問い合わせ先を表示しない
+	SupportEmail string
+	// 空の場合はロゴの代わりにProductNameを表示する
+	LogoURL string
+	// ボタンやヘッダーの色
+	PrimaryColor string
+}
+
+// テンプレートに渡す値。メールの種類によって使わないフィールドは空になる
+type templateData struct {
+	Brand    Branding
+	Token    string
+	Link     string
+	NewEmail string
+	// 招待された組織の名前
+	OrgName string
+	// ログインの通知に表示するログインの情報
+	Login LoginNotice
+}
+
+// レンダリングしたメール
+type message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type templateButton struct {
+	Label string
+	URL   string
+	Color string
+}
+
+var templateFuncs = map[string]any{
+	"button": func(label, url, color string) templateButton {
+		return templateButton{Label: label, URL: url, Color: color}
+	},
+}
+
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// 埋め込んだテンプレートはビルド時に決まるので、パースに失敗した場合は起動させない
+// 言語ごとの、テンプレートの名前からテンプレートへのマップ
+var templates = mustParseTemplates()
+
+func mustParseTemplates() map[string]map[string]*mailTemplate {
+	names := []string{
+		tmplActivateToken,
+		tmplActivateCode,
+		tmplMagicLink,
+		tmplEmailChangeToken,
+		tmplEmailChangeNotice,
+		tmplExportLink,
+		tmplInvitation,
+		tmplLoginAlert,
+		tmplLoginNotice,
+	}
+	ts := make(map[string]map[string]*mailTemplate, len(Locales))
+	for _, locale := range Locales {
+		dir := "templates/" + locale + "/"
+		ts[locale] = make(map[string]*mailTemplate, len(names))
+		for _, name := range names {
+			file := dir + name + ".tmpl"
+			ts[locale][name] = &mailTemplate{
+				text: texttemplate.Must(texttemplate.New(name).Funcs(templateFuncs).ParseFS(templateFS, dir+"layout.txt", file)),
+				html: htmltemplate.Must(htmltemplate.New(name).Funcs(templateFuncs).ParseFS(templateFS, dir+"layout.html", file)),
+			}
+		}
+	}
+	return ts
+}
+
+// テンプレートから件名、テキスト、HTMLを作成する。対応していない言語の場合はデフォルトの言語で作成する
+func render(locale, name string, data templateData) (*message, error) {
+	ts, ok := templates[locale]
+	if !ok {
+		ts = templates[DefaultLocale]
+	}
+	t, ok := ts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mail template: %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := t.text.ExecuteTemplate(&text, "layout.txt", data); err != nil {
+		return nil, fmt.Errorf("failed to render text: %w", err)
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render html: %w", err)
+	}
+	return &message{
+		// ヘッダーに改行が入らないようにする
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
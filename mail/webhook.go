@@ -0,0 +1,188 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Webhookのプロバイダー名が不明
+var ErrUnknownWebhookProvider = errors.New("unknown mail webhook provider")
+
+// メール配信サービスから通知された配信結果の種類
+type DeliveryEventKind string
+
+const (
+	// 恒久的なバウンス。一時的なバウンスは再送で届く可能性があるので通知しない
+	DeliveryBounce = DeliveryEventKind("bounce")
+	// 受信者が迷惑メールとして報告した
+	DeliveryComplaint = DeliveryEventKind("complaint")
+)
+
+// 配信結果の通知。1つのWebhookに複数の通知が含まれることがある
+type DeliveryEvent struct {
+	Kind  DeliveryEventKind
+	Email string
+	// バウンスの理由など。監査ログに残す
+	Reason string
+}
+
+// providerのWebhookのボディから、バウンスと迷惑メールの報告を取り出す
+// 関係のない通知(配信成功、開封など)は無視する
+// SESの場合、SNSのサブスクリプションの確認リクエストであれば、確認用のURLを呼び出す
+func ParseDeliveryEvents(ctx context.Context, provider string, body []byte) ([]DeliveryEvent, error) {
+	switch provider {
+	case "ses":
+		return parseSESEvents(ctx, body)
+	case "sendgrid":
+		return parseSendGridEvents(body)
+	case "mailgun":
+		return parseMailgunEvents(body)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownWebhookProvider, provider)
+	}
+}
+
+// SendGridのEvent Webhook。イベントの配列が送られてくる
+func parseSendGridEvents(body []byte) ([]DeliveryEvent, error) {
+	var events []struct {
+		Email  string `json:"email"`
+		Event  string `json:"event"`
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode sendgrid webhook: %w", err)
+	}
+
+	var des []DeliveryEvent
+	for _, e := range events {
+		switch {
+		// typeがblockedの場合は受信側サーバーの一時的な拒否なので、バウンスとして扱わない
+		case e.Event == "bounce" && e.Type != "blocked":
+			des = append(des, DeliveryEvent{Kind: DeliveryBounce, Email: e.Email, Reason: e.Reason})
+		case e.Event == "spamreport":
+			des = append(des, DeliveryEvent{Kind: DeliveryComplaint, Email: e.Email})
+		}
+	}
+	return des, nil
+}
+
+// MailgunのWebhook。1つのリクエストに1つのイベントが送られてくる
+func parseMailgunEvents(body []byte) ([]DeliveryEvent, error) {
+	var payload struct {
+		EventData struct {
+			Event          string `json:"event"`
+			Severity       string `json:"severity"`
+			Recipient      string `json:"recipient"`
+			DeliveryStatus struct {
+				Description string `json:"description"`
+				Message     string `json:"message"`
+			} `json:"delivery-status"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode mailgun webhook: %w", err)
+	}
+
+	e := payload.EventData
+	switch {
+	case e.Event == "failed" && e.Severity == "permanent":
+		reason := e.DeliveryStatus.Description
+		if reason == "" {
+			reason = e.DeliveryStatus.Message
+		}
+		return []DeliveryEvent{{Kind: DeliveryBounce, Email: e.Recipient, Reason: reason}}, nil
+	case e.Event == "complained":
+		return []DeliveryEvent{{Kind: DeliveryComplaint, Email: e.Recipient}}, nil
+	}
+	return nil, nil
+}
+
+// SESの通知はSNS経由で送られてくる。SNSのメッセージのMessageに、SESの通知がJSON文字列で入っている
+func parseSESEvents(ctx context.Context, body []byte) ([]DeliveryEvent, error) {
+	var sns struct {
+		Type         string `json:"Type"`
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	if err := json.Unmarshal(body, &sns); err != nil {
+		return nil, fmt.Errorf("failed to decode sns message: %w", err)
+	}
+	switch sns.Type {
+	case "SubscriptionConfirmation":
+		return nil, confirmSNSSubscription(ctx, sns.SubscribeURL)
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	// 通知の設定によって、notificationTypeとeventTypeのどちらかが入っている
+	var n struct {
+		NotificationType string `json:"notificationType"`
+		EventType        string `json:"eventType"`
+		Bounce           struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}
+	if err := json.Unmarshal([]byte(sns.Message), &n); err != nil {
+		return nil, fmt.Errorf("failed to decode ses notification: %w", err)
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+	var des []DeliveryEvent
+	switch kind {
+	case "Bounce":
+		if n.Bounce.BounceType != "Permanent" {
+			return nil, nil
+		}
+		for _, r := range n.Bounce.BouncedRecipients {
+			des = append(des, DeliveryEvent{Kind: DeliveryBounce, Email: r.EmailAddress, Reason: r.DiagnosticCode})
+		}
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			des = append(des, DeliveryEvent{Kind: DeliveryComplaint, Email: r.EmailAddress})
+		}
+	}
+	return des, nil
+}
+
+// SNSのトピックのサブスクリプションを確認する。AWS以外のURLは呼び出さない
+func confirmSNSSubscription(ctx context.Context, subscribeURL string) error {
+	u, err := url.Parse(subscribeURL)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Hostname(), ".amazonaws.com") {
+		return fmt.Errorf("invalid sns subscribe url: %q", subscribeURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to confirm sns subscription: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to confirm sns subscription: status %d", res.StatusCode)
+	}
+	return nil
+}
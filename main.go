@@ -1,36 +1,285 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"flag"
 	"fmt"
-	"login-example/db"
+	"log/slog"
+	"login-example/auth"
+	"login-example/config"
+	"login-example/entity"
+	"login-example/handler"
+	"login-example/logging"
 	"login-example/mail"
-
-	"github.com/go-playground/validator/v10"
+	"login-example/sms"
+	"login-example/storage"
+	"login-example/usecase"
+	"login-example/vault"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
 )
 
+// サブコマンドと、その処理
+var commands = map[string]struct {
+	usage string
+	run   func(args []string) error
+}{
+	"serve":         {"HTTPサーバーを起動する(デフォルト)", runServe},
+	"migrate":       {"DBのスキーマを作成する", runMigrate},
+	"create-admin":  {"管理者ユーザーを作成する", runCreateAdmin},
+	"create-client": {"OAuthクライアントを登録する", runCreateClient},
+	"genkeys":       {"JWTの署名用の鍵ペアを作成する", runGenKeys},
+	"rekey-emails":  {"既存のユーザーのemail_keyを現在の設定で作り直す", runRekeyEmails},
+}
+
 func main() {
-	db, err := db.NewDB()
+	// ログはJSON形式で出力する。usecaseなどでcontextにloggerがない場合もこのloggerを使う
+	logger := logging.NewFromEnv()
+	slog.SetDefault(logger)
+
+	// サブコマンドを省略した場合は、今まで通りサーバーを起動する
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		logger.Error("command failed", slog.String("command", name), logging.Err(err))
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].usage)
+	}
+}
+
+// 設定ファイルのパスを指定するフラグ。省略した場合はCONFIG_FILEを使う
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+}
+
+// 設定を読み込んで、各パッケージに反映する
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
-	defer db.Close()
+	applyConfig(cfg)
+	return cfg, nil
+}
 
-	mailer := mail.NewMailhogMailer()
+// 各パッケージのデフォルト値を、設定の値で上書きする
+func applyConfig(cfg *config.Config) {
+	auth.AccessTokenTTL = cfg.Token.AccessTTL
+	auth.MagicTokenTTL = cfg.Token.MagicLinkTTL
+	auth.Audience = cfg.Token.Audience
+	auth.ClockSkew = cfg.Token.ClockSkew
+	auth.SudoTokenTTL = cfg.Token.SudoTTL
+	auth.IDTokenIssuer = cfg.OIDC.Issuer
+	auth.IDTokenTTL = cfg.OIDC.IDTokenTTL
+	usecase.AuthorizationCodeTTL = cfg.OIDC.CodeTTL
+	usecase.SessionTTL = cfg.Token.SessionTTL
+	usecase.RememberMeSessionTTL = cfg.Token.RememberMeTTL
+	usecase.MaxSessions = cfg.Token.MaxSessions
+	usecase.SessionLimitPolicy = usecase.SessionLimitAction(cfg.Token.SessionLimitAction)
 
-	jwter, err := auth.NewJwtBuilder()
+	handler.RefreshCookieAttributes = handler.CookieAttributes{
+		Secure:   cfg.Cookie.Secure,
+		Domain:   cfg.Cookie.Domain,
+		SameSite: sameSite(cfg.Cookie.SameSite),
+	}
+
+	// パスワードのハッシュ化パラメータ。変更すると次回ログイン時に再ハッシュ化される
+	p := entity.PasswordHashParams
+	p.Time = cfg.Password.Argon2Time
+	p.Memory = cfg.Password.Argon2Memory
+	p.Threads = cfg.Password.Argon2Threads
+	entity.PasswordHashParams = p
+}
+
+// Vaultが設定されていれば、DBとSMTPの認証情報をVaultの値で上書きする
+// 返したクライアントはリースを更新し続けるので、終了時にCloseする。Vaultを使わない場合はnilを返す
+func loadSecrets(ctx context.Context, cfg *config.Config) (*vault.Client, error) {
+	if cfg.Vault.Addr == "" {
+		return nil, nil
+	}
+	vc, err := vault.NewClient(ctx, vault.Config{
+		Addr:      cfg.Vault.Addr,
+		Namespace: cfg.Vault.Namespace,
+		Token:     cfg.Vault.Token,
+		RoleID:    cfg.Vault.RoleID,
+		SecretID:  cfg.Vault.SecretID,
+	})
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
 	}
+	if cfg.Vault.DBCredsPath != "" {
+		creds, err := vc.Credentials(ctx, cfg.Vault.DBCredsPath)
+		if err != nil {
+			vc.Close()
+			return nil, err
+		}
+		cfg.DB.User = creds.Username
+		cfg.DB.Password = creds.Password
+	}
+	if cfg.Vault.SMTPCredsPath != "" {
+		creds, err := vc.Credentials(ctx, cfg.Vault.SMTPCredsPath)
+		if err != nil {
+			vc.Close()
+			return nil, err
+		}
+		cfg.SMTP.Username = creds.Username
+		cfg.SMTP.Password = creds.Password
+	}
+	return vc, nil
+}
+
+// 環境変数のPEMか鍵のファイルから、JWTの署名と検証に使う鍵を読み込む
+// KMSで署名する場合は、秘密鍵を読み込まずにKMSの鍵で署名する
+// vcがnilでなくvault.keys_pathが設定されていれば、Vaultから鍵を読み込む
+// keys.format=pasetoの場合は、JWTの代わりにPASETOのトークンを発行する
+func newJwtBuilder(ctx context.Context, cfg *config.Config, vc *vault.Client) (auth.IJwtBuilder, error) {
+	if cfg.Keys.Format == "paseto" {
+		return auth.NewPasetoBuilder(cfg.Keys.PasetoPurpose, cfg.Keys.PasetoKey)
+	}
+
+	var provider auth.IKeyProvider
+	if vc != nil && cfg.Vault.KeysPath != "" {
+		provider = vc.KeyProvider(cfg.Vault.KeysPath)
+	}
+
+	kc := cfg.Keys
+	var signer crypto.Signer
+	var err error
+	switch kc.Signer {
+	case "aws_kms":
+		signer, err = auth.NewAWSKMSSigner(ctx, auth.AWSKMSConfig{Region: kc.KMSRegion, KeyID: kc.KMSKeyID})
+	case "gcp_kms":
+		signer, err = auth.NewGCPKMSSigner(ctx, auth.GCPKMSConfig{KeyName: kc.KMSKeyID})
+	}
+	if err != nil {
+		return nil, err
+	}
+	// configで検証済み
+	encKey, _ := base64.StdEncoding.DecodeString(kc.EncryptionKey)
+	return auth.NewJwtBuilderFromConfig(ctx, auth.KeyConfig{
+		Algorithm:            kc.Algorithm,
+		HMACSecret:           kc.HMACSecret,
+		SecretKeyPEM:         kc.SecretKeyPEM,
+		PublicKeyPEM:         kc.PublicKeyPEM,
+		SecretKeyPath:        kc.SecretKeyPath,
+		PublicKeyPath:        kc.PublicKeyPath,
+		VerifyPublicKeyPaths: kc.VerifyPublicKeyPaths,
+		Provider:             provider,
+		Signer:               signer,
+		EncryptionKey:        encKey,
+	})
+}
+
+// 設定されたプロバイダーでメールを送信するmailerを作成する
+func newMailer(ctx context.Context, cfg *config.Config) (mail.IMailer, error) {
+	brand := mail.Branding{
+		ProductName:  cfg.Mail.ProductName,
+		SupportEmail: cfg.Mail.SupportEmail,
+		LogoURL:      cfg.Mail.LogoURL,
+		PrimaryColor: cfg.Mail.PrimaryColor,
+	}
+	from := cfg.SMTP.From
+	switch cfg.Mail.Provider {
+	case "ses":
+		return mail.NewSESMailer(ctx, mail.SESConfig{
+			Region:  cfg.Mail.SES.Region,
+			From:    from,
+			Sandbox: cfg.Mail.Sandbox,
+		}, brand)
+	case "sendgrid":
+		return mail.NewSendGridMailer(mail.SendGridConfig{
+			APIKey:  cfg.Mail.SendGrid.APIKey,
+			From:    from,
+			Sandbox: cfg.Mail.Sandbox,
+		}, brand), nil
+	case "capture":
+		return mail.NewCaptureMailer(brand), nil
+	case "mailgun":
+		return mail.NewMailgunMailer(mail.MailgunConfig{
+			Domain:  cfg.Mail.Mailgun.Domain,
+			APIKey:  cfg.Mail.Mailgun.APIKey,
+			From:    from,
+			Sandbox: cfg.Mail.Sandbox,
+			BaseURL: cfg.Mail.Mailgun.BaseURL,
+		}, brand), nil
+	default:
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:          cfg.SMTP.Host,
+			Port:          cfg.SMTP.Port,
+			Username:      cfg.SMTP.Username,
+			Password:      cfg.SMTP.Password,
+			From:          from,
+			TLS:           mail.SMTPTLSMode(cfg.SMTP.TLS),
+			TLSSkipVerify: cfg.SMTP.TLSSkipVerify,
+			Auth:          mail.SMTPAuthMethod(cfg.SMTP.Auth),
+			DialTimeout:   cfg.SMTP.DialTimeout,
+			SendTimeout:   cfg.SMTP.SendTimeout,
+			MaxIdleConns:  cfg.SMTP.MaxIdleConns,
+			IdleTimeout:   cfg.SMTP.IdleTimeout,
+		}, brand), nil
+	}
+}
 
-	e := NewRouter(db, mailer, jwter)
+// 設定されたプロバイダーで、アップロードされたファイルの保存先を作成する
+func newStorage(ctx context.Context, cfg *config.Config) (storage.IStorage, error) {
+	if cfg.Storage.Provider == "s3" {
+		return storage.NewS3Storage(ctx, storage.S3Config{
+			Region:    cfg.Storage.S3.Region,
+			Bucket:    cfg.Storage.S3.Bucket,
+			PublicURL: cfg.Storage.S3.PublicURL,
+		})
+	}
+	return storage.NewLocalStorage(cfg.Storage.Local.Dir, cfg.Storage.Local.BaseURL)
+}
 
-	// error_handler.goの内容を登録してます。
-	e.HTTPErrorHandler = customHTTPErrorHandler
-	
-	// validator.goの内容を登録してます。
-	e.Validator = &CustomValidator{validator: validator.New()}
+// 設定されたプロバイダーでSMSを送信するsenderを作成する。SMSを使わない場合はnilを返す
+func newSmsSender(cfg *config.Config) sms.ISmsSender {
+	switch cfg.SMS.Provider {
+	case "twilio":
+		return sms.NewTwilioSender(sms.TwilioConfig{
+			AccountSID:          cfg.SMS.Twilio.AccountSID,
+			AuthToken:           cfg.SMS.Twilio.AuthToken,
+			From:                cfg.SMS.Twilio.From,
+			MessagingServiceSID: cfg.SMS.Twilio.MessagingServiceSID,
+		})
+	case "fake":
+		return sms.NewFakeSender()
+	default:
+		return nil
+	}
+}
 
-	e.Logger.Fatal(e.Start(":8000"))
-}
\ No newline at end of file
+func sameSite(v string) http.SameSite {
+	switch strings.ToLower(v) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
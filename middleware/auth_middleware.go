@@ -1,16 +1,22 @@
 package middleware
 
 import (
+	"errors"
+	"log/slog"
 	"login-example/auth"
+	"login-example/logging"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 )
 
-func AuthMiddleware(jwter auth.IJwtParser) func(next echo.HandlerFunc) echo.HandlerFunc {
+// rsに記録された失効済みのアクセストークンは、有効期限内でも拒否する
+func AuthMiddleware(jwter auth.IJwtParser, rs auth.IRevocationStore) func(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// 本来の処理の前に行いたい処理
-			if err := jwter.SetAuthToContext(c); err != nil {
+			// トークンがない、または不正な場合は401を返す
+			if err := authenticate(c, jwter, rs); err != nil {
 				return err
 			}
 			
@@ -18,4 +24,58 @@ func AuthMiddleware(jwter auth.IJwtParser) func(next echo.HandlerFunc) echo.Hand
 			return next(c)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// ログインしていなくても使えるが、ログインしている場合はユーザーに合わせた内容を返すエンドポイント向け
+// Authorizationヘッダーがない場合は、認証情報をセットせずに通す。auth.GetUserIDFromEchoCtxがエラーになるかで判断する
+// トークンが不正、または失効している場合は、クライアントがリフレッシュできるように401を返す
+func OptionalAuthMiddleware(jwter auth.IJwtParser, rs auth.IRevocationStore) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+				if err := authenticate(c, jwter, rs); err != nil {
+					return err
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// トークンを検証して、contextに認証情報をセットする
+func authenticate(c echo.Context, jwter auth.IJwtParser, rs auth.IRevocationStore) error {
+	if err := jwter.SetAuthToContext(c); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "unauthorized").SetInternal(err)
+	}
+	// ログアウトなどで失効させたトークン
+	if jti, _ := auth.GetJwtIDFromEchoCtx(c); jti != "" {
+		revoked, err := rs.IsAccessTokenRevoked(c.Request().Context(), jti)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return echo.NewHTTPError(http.StatusUnauthorized, "unauthorized").SetInternal(errors.New("access token revoked"))
+		}
+	}
+	// 全端末からのログアウトより前に発行されたトークン
+	if tv, ok := auth.GetTokenVersionFromEchoCtx(c); ok {
+		uid, err := auth.GetUserIDFromEchoCtx(c)
+		if err != nil {
+			return err
+		}
+		minVersion, err := rs.MinTokenVersion(c.Request().Context(), uid)
+		if err != nil {
+			return err
+		}
+		if tv < minVersion {
+			return echo.NewHTTPError(http.StatusUnauthorized, "unauthorized").SetInternal(errors.New("access token version revoked"))
+		}
+	}
+	// 以降のログにuser_idを出力する
+	if uid, err := auth.GetUserIDFromEchoCtx(c); err == nil {
+		c.SetRequest(c.Request().WithContext(logging.With(c.Request().Context(), slog.Any("user_id", uid))))
+	} else if id, ok := auth.GetClientIDFromEchoCtx(c); ok {
+		c.SetRequest(c.Request().WithContext(logging.With(c.Request().Context(), slog.String("client_id", id))))
+	}
+	return nil
+}
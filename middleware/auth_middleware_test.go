@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"login-example/auth"
+	"login-example/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	j, err := auth.NewJwtBuilderWithSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := auth.NewMemoryRevocationStore()
+	u := &entity.User{ID: 100001, Role: entity.RoleUser}
+	valid, err := j.GenerateAccessToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := j.GenerateAccessToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := j.ParseToken(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.RevokeAccessToken(context.Background(), info.JwtID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+		wantUID entity.UserID
+	}{
+		{"no token", "", false, 0},
+		{"valid token", "Bearer " + string(valid), false, 100001},
+		{"invalid token", "Bearer invalid", true, 0},
+		{"revoked token", "Bearer " + string(revoked), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.header)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			called := false
+			var uid entity.UserID
+			err := OptionalAuthMiddleware(j, rs)(func(c echo.Context) error {
+				called = true
+				uid, _ = auth.GetUserIDFromEchoCtx(c)
+				return nil
+			})(c)
+
+			if tt.wantErr {
+				// 不正なトークンのユーザーとしては処理しない
+				var he *echo.HTTPError
+				if !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+					t.Errorf("error = %v, want 401", err)
+				}
+				if called {
+					t.Error("handler called with an untrusted token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !called || uid != tt.wantUID {
+				t.Errorf("handler called = %v with user %v, want user %v", called, uid, tt.wantUID)
+			}
+		})
+	}
+}
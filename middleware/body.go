@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ハンドラーより先に読み込むリクエストボディの上限
+var maxPeekBodySize int64 = 1 << 20
+
+// リクエストボディを読み込む。ボディはハンドラーでも読めるように元に戻しておく
+// 上限を超える場合は、メモリに読み込まずに413を返す
+func peekBody(c echo.Context) ([]byte, error) {
+	r := c.Request()
+	if r.Body == nil {
+		return nil, nil
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(c.Response(), r.Body, maxPeekBodySize))
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request body too large").SetInternal(err)
+	} else if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CSRFConfig struct {
+	// CSRFトークンを受け取るリクエストヘッダー名
+	HeaderName string
+	// ヘッダーの値と照合するcookie名(double-submit)
+	// 空の場合はヘッダーが付いていることだけを確認する。別サイトのフォームからはカスタムヘッダーを付けられないため
+	CookieName string
+}
+
+// double-submit方式。ログイン時にCSRFトークンのcookieを発行して、リクエストヘッダーにも同じ値を付けてもらう
+var DefaultCSRFConfig = CSRFConfig{
+	HeaderName: "X-CSRF-Token",
+	CookieName: "csrf-token",
+}
+
+// カスタムヘッダー方式。CSRFトークンのcookieを発行する前(ログイン前)のルートで使う
+var HeaderOnlyCSRFConfig = CSRFConfig{
+	HeaderName: "X-Requested-With",
+}
+
+// cookieで認証するルートをCSRFから守る
+func CSRF(conf CSRFConfig) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := c.Request().Header.Get(conf.HeaderName)
+			if token == "" {
+				return echo.NewHTTPError(http.StatusForbidden, "missing csrf token")
+			}
+
+			if conf.CookieName != "" {
+				cookie, err := c.Cookie(conf.CookieName)
+				if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+					return echo.NewHTTPError(http.StatusForbidden, "invalid csrf token")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
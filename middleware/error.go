@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+// エラーハンドラーを呼んだエラーを保存するキー
+const handledErrorContextKey = "handled_error"
+
+// エラーハンドラーを呼んで、レスポンスのステータスコードを確定させる
+// 内側のミドルウェアでエラーハンドラーを呼んだエラーは、レスポンスを二重に書き込まないように呼ばない
+func handleError(c echo.Context, err error) {
+	if err == nil {
+		return
+	}
+	if handled, ok := c.Get(handledErrorContextKey).(error); ok && errors.Is(err, handled) {
+		return
+	}
+	c.Set(handledErrorContextKey, err)
+	c.Error(err)
+}
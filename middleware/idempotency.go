@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"login-example/logging"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// 保存したレスポンスを返したことを示すヘッダー
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+var (
+	// 同じIdempotency-Keyで、内容の異なるリクエストが送られた
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with different request")
+	// 同じIdempotency-Keyのリクエストをまだ処理している
+	ErrIdempotencyInProgress = errors.New("request with same idempotency key in progress")
+)
+
+// Idempotency-Keyのリクエストとレスポンスを保存するストア。repository.IIdempotencyRepositoryが実装する
+type IIdempotencyStore interface {
+	// キーを処理中として保存する。有効期限内の同じキーがすでにある場合は、保存せずにそのキーを返す
+	// 処理中のまま保持期間を過ぎたキーは、処理していたサーバーが停止したものとして引き継ぐ
+	Reserve(ctx context.Context, k *entity.IdempotencyKey) (*entity.IdempotencyKey, error)
+	Complete(ctx context.Context, k *entity.IdempotencyKey) error
+	Delete(ctx context.Context, keyHash string) error
+}
+
+type IdempotencyConfig struct {
+	// 保存したレスポンスを返す期間。過ぎたキーは別のリクエストに使える
+	TTL time.Duration
+	// 処理中のキーを保持する期間。処理中にサーバーが停止しても、過ぎれば同じキーで再送できる
+	Lease time.Duration
+	// 同じリクエストかを判定するときに含める、認証情報のcookie
+	CredentialCookie string
+}
+
+var DefaultIdempotencyConfig = IdempotencyConfig{
+	TTL:              24 * time.Hour,
+	Lease:            time.Minute,
+	CredentialCookie: "refresh-token",
+}
+
+// 再送されたリクエストに返すレスポンスのヘッダー。リフレッシュトークンのcookieも返す
+var idempotentHeaders = []string{echo.HeaderContentType, echo.HeaderSetCookie, echo.HeaderLocation}
+
+// 保存するレスポンス
+type idempotentResponse struct {
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Idempotency-Keyヘッダーが付いたPOSTのレスポンスを保存して、同じキーで再送されたリクエストには処理せずに同じレスポンスを返す
+// 通信が不安定な端末からの再送で、仮登録やメールの送信が重複しないようにする
+// サーバーの障害(5xx)やレートリミット(429)の場合は保存せず、同じキーで再送できるようにする
+func Idempotency(store IIdempotencyStore, conf IdempotencyConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if c.Request().Method != http.MethodPost || key == "" {
+				return next(c)
+			}
+			if !validIdempotencyKey(key) {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid Idempotency-Key header")
+			}
+			ctx := c.Request().Context()
+
+			req, err := readIdempotentRequest(c, conf.CredentialCookie)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			k := &entity.IdempotencyKey{
+				KeyHash:     hashHex([]byte(key)),
+				Fingerprint: hashHex([]byte("fingerprint\n"), req),
+				LockedUntil: now.Add(conf.Lease),
+				ExpiresAt:   now.Add(conf.TTL),
+			}
+			old, err := store.Reserve(ctx, k)
+			if err != nil {
+				return err
+			}
+			// レスポンスにはトークンが含まれることがあるので、同じリクエストを送れる場合にだけ復号できる鍵で暗号化する
+			secret := sha256.Sum256(bytes.Join([][]byte{[]byte("response"), []byte(key), req}, []byte("\n")))
+			if old != nil {
+				return replayIdempotentResponse(c, old, k.Fingerprint, secret[:])
+			}
+
+			// パニックした場合も、同じキーで再送できるように削除する
+			defer func() {
+				if r := recover(); r != nil {
+					deleteIdempotencyKey(ctx, store, k)
+					panic(r)
+				}
+			}()
+			rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+			err = next(c)
+			// エラーハンドラーを先に呼んで、レスポンスを確定させる。エラーは外側のミドルウェアにもそのまま返す
+			handleError(c, err)
+			c.Response().Writer = rec.ResponseWriter
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				deleteIdempotencyKey(ctx, store, k)
+				return err
+			}
+			res := idempotentResponse{Header: http.Header{}, Body: rec.body.Bytes()}
+			for _, h := range idempotentHeaders {
+				if v := c.Response().Header().Values(h); len(v) > 0 {
+					res.Header[h] = v
+				}
+			}
+			sealed, sealErr := sealIdempotentResponse(res, secret[:])
+			if sealErr != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "failed to encrypt idempotent response", logging.Err(sealErr))
+				deleteIdempotencyKey(ctx, store, k)
+				return err
+			}
+			k.Response = sealed
+			k.StatusCode = status
+			// レスポンスは返し終わっているので、保存に失敗した場合はログだけ出す
+			if err := store.Complete(ctx, k); err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "failed to save idempotent response", logging.Err(err))
+			}
+			return err
+		}
+	}
+}
+
+// 保存したレスポンスを返す。別のリクエストに使われたキーや、処理中のキーの場合はエラーを返す
+func replayIdempotentResponse(c echo.Context, k *entity.IdempotencyKey, fingerprint string, secret []byte) error {
+	if k.Fingerprint != fingerprint {
+		return ErrIdempotencyKeyReused
+	}
+	if !k.IsCompleted() {
+		return ErrIdempotencyInProgress
+	}
+	res, err := openIdempotentResponse(k.Response, secret)
+	if err != nil {
+		return err
+	}
+
+	for h, v := range res.Header {
+		c.Response().Header()[h] = v
+	}
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	c.Response().WriteHeader(k.StatusCode)
+	_, err = c.Response().Write(res.Body)
+	return err
+}
+
+func deleteIdempotencyKey(ctx context.Context, store IIdempotencyStore, k *entity.IdempotencyKey) {
+	if err := store.Delete(ctx, k.KeyHash); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to delete idempotency key", logging.Err(err))
+	}
+}
+
+// クライアントが作成するUUIDなどを想定して、空白を含まない255文字までのASCII文字列のみ受け付ける
+func validIdempotencyKey(key string) bool {
+	if len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// 同じリクエストかを判定するための値。メソッド、パス、ボディと、別のユーザーのセッションで同じキーが使われても区別できるように認証情報を含める
+// 解析用のcookieなどは再送のたびに変わることがあるので、認証情報以外のcookieは含めない
+func readIdempotentRequest(c echo.Context, credentialCookie string) ([]byte, error) {
+	body, err := peekBody(c)
+	if err != nil {
+		return nil, err
+	}
+	var credential string
+	if credentialCookie != "" {
+		if cookie, err := c.Cookie(credentialCookie); err == nil {
+			credential = cookie.Value
+		}
+	}
+	r := c.Request()
+	return bytes.Join([][]byte{
+		[]byte(r.Method),
+		[]byte(r.URL.RequestURI()),
+		[]byte(r.Header.Get(echo.HeaderAuthorization)),
+		[]byte(credential),
+		body,
+	}, []byte("\n")), nil
+}
+
+func hashHex(b ...[]byte) string {
+	h := sha256.New()
+	for _, v := range b {
+		h.Write(v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AES-GCMで暗号化する。先頭にnonceを付ける
+func sealIdempotentResponse(res idempotentResponse, secret []byte) ([]byte, error) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newIdempotencyAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, b, nil), nil
+}
+
+func openIdempotentResponse(sealed, secret []byte) (idempotentResponse, error) {
+	var res idempotentResponse
+	aead, err := newIdempotencyAEAD(secret)
+	if err != nil {
+		return res, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return res, fmt.Errorf("idempotent response too short")
+	}
+	b, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return res, fmt.Errorf("failed to decrypt idempotent response: %w", err)
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func newIdempotencyAEAD(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ハンドラーが書き込んだレスポンスボディを、クライアントに返しながら保存する
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
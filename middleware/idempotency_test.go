@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"login-example/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+// repository.IIdempotencyRepositoryと同じく、有効期限と処理中のリースを扱うインメモリのストア
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]entity.IdempotencyKey
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: map[string]entity.IdempotencyKey{}}
+}
+
+func (s *memoryIdempotencyStore) Reserve(ctx context.Context, k *entity.IdempotencyKey) (*entity.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if old, ok := s.keys[k.KeyHash]; ok && !old.ExpiresAt.Before(now) && (old.IsCompleted() || !old.LockedUntil.Before(now)) {
+		return &old, nil
+	}
+	k.StatusCode = 0
+	k.Response = nil
+	s.keys[k.KeyHash] = *k
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, k *entity.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.KeyHash] = *k
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Delete(ctx context.Context, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, keyHash)
+	return nil
+}
+
+// handlerをIdempotencyで包んで、1件のリクエストを処理する
+func serveIdempotent(store IIdempotencyStore, handler echo.HandlerFunc, key, body string) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(HeaderIdempotencyKey, key)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	err := Idempotency(store, DefaultIdempotencyConfig)(handler)(c)
+	return rec, err
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]int{"calls": calls})
+	}
+
+	first, err := serveIdempotent(store, handler, "key-1", `{"email":"a@example.com"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := serveIdempotent(store, handler, "key-1", `{"email":"a@example.com"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replayed response = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(HeaderIdempotentReplayed) != "true" {
+		t.Errorf("%s header not set on replay", HeaderIdempotentReplayed)
+	}
+	if first.Header().Get(HeaderIdempotentReplayed) != "" {
+		t.Errorf("%s header set on first response", HeaderIdempotentReplayed)
+	}
+}
+
+func TestIdempotency_KeyReusedWithDifferentBody(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	}
+
+	if _, err := serveIdempotent(store, handler, "key-1", `{"email":"a@example.com"}`); err != nil {
+		t.Fatal(err)
+	}
+	_, err := serveIdempotent(store, handler, "key-1", `{"email":"b@example.com"}`)
+	if !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("error = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+// サーバーの障害の場合は保存せず、同じキーで再送したリクエストを処理する
+func TestIdempotency_ServerErrorIsNotStored(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := func(c echo.Context) error {
+		calls++
+		if calls == 1 {
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		return c.NoContent(http.StatusCreated)
+	}
+
+	if _, err := serveIdempotent(store, handler, "key-1", `{}`); err == nil {
+		t.Fatal("first request error = nil, want 500")
+	}
+	rec, err := serveIdempotent(store, handler, "key-1", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || rec.Code != http.StatusCreated {
+		t.Errorf("retry = %d after %d calls, want %d after 2 calls", rec.Code, calls, http.StatusCreated)
+	}
+}
+
+// ハンドラーのエラーは外側のミドルウェアに返し、4xxのレスポンスは保存して再送にも返す
+func TestIdempotency_ClientErrorIsReturnedAndStored(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	calls := 0
+	handler := func(c echo.Context) error {
+		calls++
+		return echo.NewHTTPError(http.StatusConflict, "already registered")
+	}
+
+	_, err := serveIdempotent(store, handler, "key-1", `{}`)
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusConflict {
+		t.Fatalf("error = %v, want 409", err)
+	}
+	rec, err := serveIdempotent(store, handler, "key-1", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 || rec.Code != http.StatusConflict {
+		t.Errorf("replay = %d after %d calls, want %d after 1 call", rec.Code, calls, http.StatusConflict)
+	}
+}
+
+// 処理中のキーで再送されたリクエストは、処理せずにエラーを返す
+func TestIdempotency_InProgress(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	var inner error
+	handler := func(c echo.Context) error {
+		_, inner = serveIdempotent(store, func(c echo.Context) error {
+			t.Error("handler called while the key is in progress")
+			return nil
+		}, "key-1", `{}`)
+		return c.NoContent(http.StatusCreated)
+	}
+
+	if _, err := serveIdempotent(store, handler, "key-1", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(inner, ErrIdempotencyInProgress) {
+		t.Errorf("error = %v, want %v", inner, ErrIdempotencyInProgress)
+	}
+}
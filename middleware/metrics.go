@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクス名のプレフィックス
+const metricsNamespace = "login_example"
+
+// ルートごとのリクエスト数、レイテンシ、処理中のリクエスト数をregに記録する
+// ルートのラベルにはパスのパラメータを埋める前の値を使い、ラベルの種類が増えすぎないようにする
+func Metrics(reg prometheus.Registerer) echo.MiddlewareFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests currently being served by route.",
+	}, []string{"method", "route"})
+	reg.MustRegister(requests, duration, inFlight)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			route := c.Path()
+			// 存在しないルートへのリクエスト
+			if route == "" {
+				route = "unmatched"
+			}
+
+			inFlight.WithLabelValues(method, route).Inc()
+			defer inFlight.WithLabelValues(method, route).Dec()
+
+			start := time.Now()
+			err := next(c)
+			// エラーハンドラーを先に呼んで、レスポンスのステータスコードを確定させる
+			handleError(c, err)
+
+			status := strconv.Itoa(c.Response().Status)
+			requests.WithLabelValues(method, route, status).Inc()
+			duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"login-example/auth"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 組織のアクセストークンの場合のみ許可する。AuthMiddlewareの後に使う
+// メンバーから外されていないかは、usecaseで確認する
+func RequireOrg() func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := auth.GetOrgIDFromEchoCtx(c); !ok {
+				return echo.NewHTTPError(http.StatusForbidden, "organization token required")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ディレクトリがBearerで送るプロビジョニング用のトークンを確認する
+// トークンが設定されていない場合は、エンドポイントが存在しないものとして404を返す
+func RequireProvisioningToken(token string) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return echo.ErrNotFound
+			}
+			got, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="scim"`)
+				return echo.ErrUnauthorized
+			}
+
+			return next(c)
+		}
+	}
+}
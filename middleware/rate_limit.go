@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RateLimitConfig struct {
+	// windowの間に同一IPから受け付けるリクエスト数
+	IPLimit int64
+	// windowの間に同一のemail、電話番号、usernameに対して受け付けるリクエスト数
+	EmailLimit int64
+	Window     time.Duration
+	// カウンターのキーの接頭辞。ルートごとに分けて、別のルートへのリクエストで上限に達しないようにする
+	Scope string
+	// emailを同じ人のものとして数えるためのキーにする。nilの場合は前後の空白を除いて小文字にするだけ
+	EmailKey func(email string) string
+}
+
+var DefaultRateLimitConfig = RateLimitConfig{
+	IPLimit:    30,
+	EmailLimit: 5,
+	Window:     time.Minute,
+}
+
+// IPアドレスと、リクエストボディのemail、電話番号、usernameごとにリクエスト数を制限する
+// カウンターはconf.Scopeごとに分ける
+func RateLimit(store IRateLimitStore, conf RateLimitConfig) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			id, err := peekIdentifiers(c, conf.EmailKey)
+			if err != nil {
+				return err
+			}
+			keys := rateLimitKeys(conf, c.RealIP(), id)
+
+			for key, limit := range keys {
+				count, reset, err := store.Incr(ctx, key, conf.Window)
+				if err != nil {
+					return err
+				}
+				if count > limit {
+					c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// リクエストボディでユーザーを識別する値。大文字と小文字を区別しないものは小文字にする
+type identifiers struct {
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Username string `json:"username"`
+}
+
+// カウンターのキーと上限
+func rateLimitKeys(conf RateLimitConfig, ip string, id identifiers) map[string]int64 {
+	prefix := ""
+	if conf.Scope != "" {
+		prefix = conf.Scope + ":"
+	}
+	keys := map[string]int64{
+		prefix + "ip:" + ip: conf.IPLimit,
+	}
+	if id.Email != "" {
+		keys[prefix+"email:"+id.Email] = conf.EmailLimit
+	}
+	if id.Phone != "" {
+		keys[prefix+"phone:"+id.Phone] = conf.EmailLimit
+	}
+	if id.Username != "" {
+		keys[prefix+"username:"+id.Username] = conf.EmailLimit
+	}
+	return keys
+}
+
+// リクエストボディのJSONからユーザーを識別する値を取得する。ボディはハンドラーでも読めるように元に戻しておく
+func peekIdentifiers(c echo.Context, emailKey func(string) string) (identifiers, error) {
+	var id identifiers
+	r := c.Request()
+	if r.Body == nil || !strings.HasPrefix(r.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return id, nil
+	}
+
+	b, err := peekBody(c)
+	if err != nil {
+		return id, err
+	}
+
+	// 取得できないリクエストはIPでのみ制限する
+	if err := json.Unmarshal(b, &id); err != nil {
+		return identifiers{}, nil
+	}
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+	if emailKey != nil && id.Email != "" {
+		id.Email = emailKey(id.Email)
+	}
+	id.Username = strings.ToLower(strings.TrimSpace(id.Username))
+	return id, nil
+}
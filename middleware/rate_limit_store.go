@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// レートリミットのカウンターを保持するストア
+type IRateLimitStore interface {
+	// keyのカウンターを1増やし、windowの間に何回目のアクセスかと、カウンターがリセットされるまでの時間を返す
+	Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// 期限切れのカウンターを掃除する間隔
+const rateLimitSweepInterval = time.Minute
+
+type memoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*rateLimitCounter
+	sweptAt  time.Time
+}
+
+type rateLimitCounter struct {
+	count   int64
+	resetAt time.Time
+}
+
+// 単一のサーバーで動かす場合のインメモリのストア
+func NewMemoryRateLimitStore() IRateLimitStore {
+	return &memoryRateLimitStore{counters: map[string]*rateLimitCounter{}}
+}
+
+func (s *memoryRateLimitStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !c.resetAt.After(now) {
+		// 期限切れのカウンターを掃除する。キーが多い場合に毎回全件を見ないように、一定の間隔をあける
+		if now.Sub(s.sweptAt) >= rateLimitSweepInterval {
+			for k, v := range s.counters {
+				if !v.resetAt.After(now) {
+					delete(s.counters, k)
+				}
+			}
+			s.sweptAt = now
+		}
+		c = &rateLimitCounter{resetAt: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+
+	return c.count, c.resetAt.Sub(now), nil
+}
+
+type redisRateLimitStore struct {
+	client *redis.Client
+}
+
+// 複数のサーバーでカウンターを共有する場合のRedisのストア
+func NewRedisRateLimitStore(client *redis.Client) IRateLimitStore {
+	return &redisRateLimitStore{client: client}
+}
+
+func (s *redisRateLimitStore) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	key = "ratelimit:" + key
+
+	// INCRと有効期限の設定をまとめて実行する。有効期限は最初のアクセスの時のみ設定する
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to incr rate limit counter: %w", err)
+	}
+
+	return incr.Val(), ttl.Val(), nil
+}
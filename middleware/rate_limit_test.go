@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimitKeys(t *testing.T) {
+	conf := RateLimitConfig{IPLimit: 30, EmailLimit: 5, Scope: "auth"}
+	got := rateLimitKeys(conf, "192.0.2.1", identifiers{Email: "a@example.com", Username: "alice"})
+	want := map[string]int64{
+		"auth:ip:192.0.2.1":        30,
+		"auth:email:a@example.com": 5,
+		"auth:username:alice":      5,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rateLimitKeys() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("rateLimitKeys()[%q] = %d, want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestRateLimitKeys_NoScope(t *testing.T) {
+	got := rateLimitKeys(RateLimitConfig{IPLimit: 30}, "192.0.2.1", identifiers{})
+	if _, ok := got["ip:192.0.2.1"]; !ok || len(got) != 1 {
+		t.Errorf("rateLimitKeys() = %v, want only ip:192.0.2.1", got)
+	}
+}
+
+func newJSONContext(body string) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestPeekIdentifiers(t *testing.T) {
+	fold := func(email string) string { return "key:" + email }
+	tests := []struct {
+		name     string
+		body     string
+		emailKey func(string) string
+		want     identifiers
+	}{
+		{"normalize", `{"email":" A@Example.COM ","username":" Alice "}`, nil, identifiers{Email: "a@example.com", Username: "alice"}},
+		{"email key", `{"email":" A@Example.COM "}`, fold, identifiers{Email: "key:a@example.com"}},
+		{"empty email", `{"phone":"+819012345678"}`, fold, identifiers{Phone: "+819012345678"}},
+		{"invalid json", `{`, fold, identifiers{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newJSONContext(tt.body)
+			got, err := peekIdentifiers(c, tt.emailKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("peekIdentifiers() = %+v, want %+v", got, tt.want)
+			}
+			// ハンドラーでもボディを読める
+			b, err := io.ReadAll(c.Request().Body)
+			if err != nil || string(b) != tt.body {
+				t.Errorf("body after peek = %q, %v, want %q", b, err, tt.body)
+			}
+		})
+	}
+}
+
+func TestPeekIdentifiers_BodyTooLarge(t *testing.T) {
+	orig := maxPeekBodySize
+	maxPeekBodySize = 16
+	t.Cleanup(func() { maxPeekBodySize = orig })
+
+	_, err := peekIdentifiers(newJSONContext(`{"email":"a@example.com"}`), nil)
+	var he *echo.HTTPError
+	if !errors.As(err, &he) || he.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("error = %v, want 413", err)
+	}
+}
+
+// 表記の違うemailも同じカウンターで数え、別のスコープのカウンターには影響しない
+func TestRateLimit(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	conf := RateLimitConfig{IPLimit: 100, EmailLimit: 2, Window: time.Minute, EmailKey: strings.ToLower}
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	serve := func(scope, email string) error {
+		conf := conf
+		conf.Scope = scope
+		return RateLimit(store, conf)(ok)(newJSONContext(`{"email":"` + email + `"}`))
+	}
+
+	for _, email := range []string{"a@example.com", " A@example.com "} {
+		if err := serve("auth", email); err != nil {
+			t.Fatalf("serve(%q) error = %v", email, err)
+		}
+	}
+	var he *echo.HTTPError
+	if err := serve("auth", "a@EXAMPLE.com"); !errors.As(err, &he) || he.Code != http.StatusTooManyRequests {
+		t.Errorf("3rd request error = %v, want 429", err)
+	}
+	if err := serve("phone", "a@example.com"); err != nil {
+		t.Errorf("other scope error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"login-example/random"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+)
+
+type requestIDKey struct{}
+
+// クライアントやロードバランサーから受け取るリクエストIDの形式
+// ログに出力するので、想定外の文字や長すぎる値は受け付けずに作り直す
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// X-Request-IDヘッダーのリクエストIDを引き継ぐか、なければ新しく作成する
+// リクエストIDはcontextに保存して、レスポンスのヘッダーにも付与する
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID.MatchString(id) {
+				id = random.Alphanumeric(20)
+			}
+
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+// contextに保存されたリクエストIDを取得する。RequestIDを通っていない場合は空文字を返す
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
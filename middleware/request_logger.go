@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"log/slog"
+	"login-example/logging"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// リクエストごとにアクセスログを出力する
+// ルートなどの属性を付与したロガーをcontextに保存して、usecaseやrepositoryのログと関連付けられるようにする
+func RequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			start := time.Now()
+
+			attrs := []any{
+				slog.String("method", req.Method),
+				slog.String("route", c.Path()),
+				slog.String("remote_ip", c.RealIP()),
+			}
+			if id := RequestIDFromContext(req.Context()); id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+				// トレースからもリクエストIDで検索できるようにする
+				trace.SpanFromContext(req.Context()).SetAttributes(attribute.String("request_id", id))
+			}
+			// トレースから該当するログを探せるようにする
+			if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+				attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+			}
+			ctx := logging.WithLogger(req.Context(), logger.With(attrs...))
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			// エラーハンドラーを先に呼んで、レスポンスのステータスコードを確定させる
+			handleError(c, err)
+
+			// 認証済みのリクエストなら、AuthMiddlewareでuser_idが追加されている
+			ctx = c.Request().Context()
+			status := c.Response().Status
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+			logging.FromContext(ctx).LogAttrs(ctx, level, "request",
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int64("bytes_out", c.Response().Size),
+			)
+			return nil
+		}
+	}
+}
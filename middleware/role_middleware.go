@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"login-example/auth"
+	"login-example/entity"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 指定したroleのユーザーのみ許可する。AuthMiddlewareの後に使う
+// roleを持たないクライアントのトークンは拒否する
+func RequireRole(role entity.UserRole) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			got, err := auth.GetRoleFromEchoCtx(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden").SetInternal(err)
+			}
+			if got != role {
+				return echo.NewHTTPError(http.StatusForbidden, "forbidden")
+			}
+
+			return next(c)
+		}
+	}
+}
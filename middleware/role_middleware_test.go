@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"login-example/auth"
+	"login-example/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequireRole(t *testing.T) {
+	j, err := auth.NewJwtBuilderWithSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := j.GenerateAccessToken(&entity.User{ID: 100001, Role: entity.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := j.GenerateAccessToken(&entity.User{ID: 100002, Role: entity.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// admin:readを許可したクライアントのトークン。roleを持たない
+	client, err := j.GenerateClientToken("service", []string{entity.ScopeAdminRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token []byte
+		want  int
+	}{
+		{"admin", admin, http.StatusOK},
+		{"user", user, http.StatusForbidden},
+		{"client", client, http.StatusForbidden},
+	}
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+string(tt.token))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			err := AuthMiddleware(j, auth.NewMemoryRevocationStore())(RequireRole(entity.RoleAdmin)(ok))(c)
+
+			got := rec.Code
+			var he *echo.HTTPError
+			if errors.As(err, &he) {
+				got = he.Code
+			} else if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
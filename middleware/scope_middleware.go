@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"login-example/auth"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// アクセストークンのscopeにscopeが含まれる場合のみ許可する。AuthMiddlewareの後に使う
+func RequireScope(scope string) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !slices.Contains(auth.GetScopesFromEchoCtx(c), scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient scope")
+			}
+
+			return next(c)
+		}
+	}
+}
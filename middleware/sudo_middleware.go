@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"login-example/auth"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sudoトークンを送るヘッダー
+const HeaderSudoToken = "X-Sudo-Token"
+
+// パスワードを再入力して発行したsudoトークンがある場合のみ許可する。AuthMiddlewareの後に使う
+// トークンがない、または古い場合はauth.ErrSudoRequiredを返すので、クライアントはパスワードを再入力してもらう
+func RequireSudo(jwter auth.IJwtParser) func(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			uid, err := auth.GetUserIDFromEchoCtx(c)
+			if err != nil {
+				return err
+			}
+			token := c.Request().Header.Get(HeaderSudoToken)
+			if token == "" {
+				return auth.ErrSudoRequired
+			}
+			st, err := jwter.ParseSudoToken([]byte(token))
+			if err != nil {
+				return fmt.Errorf("%w: %w", auth.ErrSudoRequired, err)
+			}
+			// 他のユーザーのsudoトークンは使えない
+			if st.UserID != uid {
+				return fmt.Errorf("%w: sudo token for another user", auth.ErrSudoRequired)
+			}
+			if time.Since(st.AuthTime) > auth.SudoTokenTTL+auth.ClockSkew {
+				return fmt.Errorf("%w: auth_time too old", auth.ErrSudoRequired)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/mysql"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// スキーマの変更はドライバーごとのディレクトリに連番のSQLファイルとして追加する
+// 例: mysql/000002_add_user_name.up.sql, mysql/000002_add_user_name.down.sql
+// 全てのドライバーでバージョンを揃えておく
+//
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// 埋め込んだSQLファイルを、dsnのDBに適用するためのMigrateを作成する。使い終わったらCloseする
+// driverはmysql、postgres、sqliteのいずれか。dsnはconfig.DBConfig.DataSourceNameの形式
+func New(driver, dsn string) (*migrate.Migrate, error) {
+	dir, err := fs.Sub(files, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	src, err := iofs.New(dir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+
+	url, err := databaseURL(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate: %w", err)
+	}
+	return m, nil
+}
+
+// 未適用のマイグレーションを全て適用する。適用済みの場合は何もしない
+func Up(driver, dsn string) error {
+	m, err := New(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to migrate up: %w", err)
+	}
+	return nil
+}
+
+// DSNをgolang-migrateのデータベースURLに変換する
+func databaseURL(driver, dsn string) (string, error) {
+	switch driver {
+	case "mysql":
+		// 1つのファイルに複数の文を書けるようにする
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse dsn: %w", err)
+		}
+		cfg.MultiStatements = true
+		return "mysql://" + cfg.FormatDSN(), nil
+	case "postgres":
+		// key=value形式のDSNには対応しない
+		for _, scheme := range []string{"postgres://", "postgresql://"} {
+			if rest, ok := strings.CutPrefix(dsn, scheme); ok {
+				return "pgx5://" + rest, nil
+			}
+		}
+		return "", fmt.Errorf("postgres dsn must be a URL: %q", dsn)
+	case "sqlite":
+		// DSNはファイルのパス。クエリパラメータはそのまま渡す
+		return "sqlite://" + dsn, nil
+	default:
+		return "", fmt.Errorf("unknown db driver: %q", driver)
+	}
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS `session`;
+DROP TABLE IF EXISTS `login_history`;
+DROP TABLE IF EXISTS `audit_log`;
+DROP TABLE IF EXISTS `data_export`;
+DROP TABLE IF EXISTS `identity`;
+DROP TABLE IF EXISTS `used_magic_token`;
+DROP TABLE IF EXISTS `webauthn_credential`;
+DROP TABLE IF EXISTS `user`;
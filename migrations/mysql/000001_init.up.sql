@@ -0,0 +1,103 @@
+CREATE TABLE `user` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `email` VARCHAR(255) NOT NULL UNIQUE,
+  `password` VARCHAR(255) NOT NULL,
+  `salt` VARCHAR(30) NOT NULL,
+  `state` VARCHAR(8) NOT NULL,
+  `role` VARCHAR(16) NOT NULL DEFAULT 'user',
+  `activate_token` VARCHAR(64) NOT NULL,
+  `activate_attempts` INT UNSIGNED NOT NULL DEFAULT 0,
+  `token_revoked_at` DATETIME(6) NULL,
+  `pending_email` VARCHAR(255) NOT NULL DEFAULT '',
+  `pending_email_token` VARCHAR(8) NOT NULL DEFAULT '',
+  `pending_email_requested_at` DATETIME(6) NULL,
+  `deleted_at` DATETIME(6) NULL,
+  `updated_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX email_idx (email)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4 AUTO_INCREMENT=100001;
+
+CREATE TABLE `webauthn_credential` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `credential_id` VARBINARY(1023) NOT NULL UNIQUE,
+  `public_key` BLOB NOT NULL,
+  `attestation_type` VARCHAR(32) NOT NULL,
+  `aaguid` VARBINARY(16) NOT NULL,
+  `sign_count` INT UNSIGNED NOT NULL,
+  `updated_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX user_id_idx (user_id),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `used_magic_token` (
+  `jti` VARCHAR(64) NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`jti`),
+  INDEX expires_at_idx (expires_at)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `identity` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `provider` VARCHAR(32) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `email` VARCHAR(255) NOT NULL,
+  `updated_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE provider_subject_idx (provider, subject),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `data_export` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `data` LONGBLOB NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX expires_at_idx (expires_at),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `audit_log` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL DEFAULT 0,
+  `email` VARCHAR(255) NOT NULL DEFAULT '',
+  `event` VARCHAR(32) NOT NULL,
+  `detail` VARCHAR(255) NOT NULL DEFAULT '',
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX user_id_idx (user_id),
+  INDEX event_idx (event)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `login_history` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `method` VARCHAR(32) NOT NULL,
+  `ip_address` VARCHAR(45) NOT NULL,
+  `user_agent` VARCHAR(512) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX user_id_idx (user_id),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `session` (
+  `id` VARCHAR(64) NOT NULL,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `ip_address` VARCHAR(45) NOT NULL,
+  `user_agent` VARCHAR(512) NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `last_used_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX user_id_idx (user_id),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
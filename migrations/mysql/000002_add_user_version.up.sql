@@ -0,0 +1 @@
+ALTER TABLE `user` ADD COLUMN `version` INT UNSIGNED NOT NULL DEFAULT 1 AFTER `deleted_at`;
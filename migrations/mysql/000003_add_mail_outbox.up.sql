@@ -0,0 +1,13 @@
+CREATE TABLE `mail_outbox` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `kind` VARCHAR(32) NOT NULL,
+  `recipient` VARCHAR(255) NOT NULL,
+  `token` VARCHAR(64) NOT NULL DEFAULT '',
+  `link` VARCHAR(2048) NOT NULL DEFAULT '',
+  `attempts` INT UNSIGNED NOT NULL DEFAULT 0,
+  `last_error` VARCHAR(255) NOT NULL DEFAULT '',
+  `sent_at` DATETIME(6) NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX sent_at_idx (sent_at, id)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+ALTER TABLE `mail_outbox` ADD COLUMN `next_attempt_at` DATETIME(6) NULL AFTER `last_error`;
@@ -0,0 +1,2 @@
+ALTER TABLE `user` ADD COLUMN `email_status` VARCHAR(16) NOT NULL DEFAULT 'deliverable' AFTER `pending_email_requested_at`;
+ALTER TABLE `user` ADD COLUMN `email_status_at` DATETIME(6) NULL AFTER `email_status`;
@@ -0,0 +1,14 @@
+CREATE TABLE `personal_access_token` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `expires_at` DATETIME(6) NULL,
+  `last_used_at` DATETIME(6) NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE token_hash_idx (token_hash),
+  INDEX user_id_idx (user_id),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,8 @@
+CREATE TABLE `oauth_client` (
+  `id` VARCHAR(64) NOT NULL,
+  `name` VARCHAR(64) NOT NULL,
+  `secret_hash` CHAR(64) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
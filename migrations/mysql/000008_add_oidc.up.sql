@@ -0,0 +1,17 @@
+ALTER TABLE `oauth_client` ADD COLUMN `redirect_uris` VARCHAR(1024) NOT NULL DEFAULT '' AFTER `scopes`;
+
+CREATE TABLE `authorization_code` (
+  `code_hash` CHAR(64) NOT NULL,
+  `client_id` VARCHAR(64) NOT NULL,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `redirect_uri` VARCHAR(512) NOT NULL,
+  `scopes` VARCHAR(255) NOT NULL,
+  `nonce` VARCHAR(255) NOT NULL,
+  `code_challenge` VARCHAR(128) NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`code_hash`),
+  INDEX expires_at_idx (expires_at),
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE,
+  FOREIGN KEY (`client_id`) REFERENCES `oauth_client` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,18 @@
+CREATE TABLE `organization` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(64) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  `updated_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `organization_member` (
+  `organization_id` BIGINT UNSIGNED NOT NULL,
+  `user_id` BIGINT UNSIGNED NOT NULL,
+  `role` VARCHAR(8) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`organization_id`, `user_id`),
+  INDEX user_id_idx (user_id),
+  FOREIGN KEY (`organization_id`) REFERENCES `organization` (`id`) ON DELETE CASCADE,
+  FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
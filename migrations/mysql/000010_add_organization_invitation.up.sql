@@ -0,0 +1,16 @@
+CREATE TABLE `organization_invitation` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `organization_id` BIGINT UNSIGNED NOT NULL,
+  `email` VARCHAR(255) NOT NULL,
+  `role` VARCHAR(8) NOT NULL,
+  `token_hash` CHAR(64) NOT NULL,
+  `invited_by` BIGINT UNSIGNED NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `accepted_at` DATETIME(6) NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE token_hash_idx (token_hash),
+  INDEX organization_id_email_idx (organization_id, email),
+  FOREIGN KEY (`organization_id`) REFERENCES `organization` (`id`) ON DELETE CASCADE,
+  FOREIGN KEY (`invited_by`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+CREATE TABLE `invite_code` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `code_hash` CHAR(64) NOT NULL,
+  `note` VARCHAR(255) NOT NULL,
+  `max_uses` INT NOT NULL,
+  `use_count` INT NOT NULL DEFAULT 0,
+  `expires_at` DATETIME(6) NULL,
+  `revoked_at` DATETIME(6) NULL,
+  `created_by` BIGINT UNSIGNED NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE code_hash_idx (code_hash)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+ALTER TABLE `login_history` ADD COLUMN `country` VARCHAR(2) NOT NULL DEFAULT '' AFTER `user_agent`;
+ALTER TABLE `login_history` ADD COLUMN `city` VARCHAR(128) NOT NULL DEFAULT '' AFTER `country`;
+ALTER TABLE `login_history` ADD COLUMN `latitude` DOUBLE NULL AFTER `city`;
+ALTER TABLE `login_history` ADD COLUMN `longitude` DOUBLE NULL AFTER `latitude`;
@@ -0,0 +1 @@
+ALTER TABLE `user` ADD COLUMN `token_version` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `token_revoked_at`;
@@ -0,0 +1 @@
+ALTER TABLE `user` DROP COLUMN `notify_on_login`;
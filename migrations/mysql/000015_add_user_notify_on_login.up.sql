@@ -0,0 +1 @@
+ALTER TABLE `user` ADD COLUMN `notify_on_login` BOOLEAN NOT NULL DEFAULT FALSE AFTER `email_status_at`;
@@ -0,0 +1 @@
+ALTER TABLE `user` ADD COLUMN `avatar_url` VARCHAR(1024) NOT NULL DEFAULT '' AFTER `bio`;
@@ -0,0 +1,6 @@
+ALTER TABLE `user` ADD COLUMN `phone` VARCHAR(16) NOT NULL DEFAULT '' AFTER `email`;
+ALTER TABLE `user` ADD COLUMN `pending_phone` VARCHAR(16) NOT NULL DEFAULT '' AFTER `pending_email_requested_at`;
+ALTER TABLE `user` ADD COLUMN `pending_phone_code` VARCHAR(64) NOT NULL DEFAULT '' AFTER `pending_phone`;
+ALTER TABLE `user` ADD COLUMN `pending_phone_requested_at` DATETIME(6) NULL AFTER `pending_phone_code`;
+ALTER TABLE `user` ADD COLUMN `pending_phone_attempts` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `pending_phone_requested_at`;
+CREATE INDEX phone_idx ON `user` (`phone`);
@@ -0,0 +1,3 @@
+ALTER TABLE `user` DROP COLUMN `sms_login_attempts`;
+ALTER TABLE `user` DROP COLUMN `sms_login_code_sent_at`;
+ALTER TABLE `user` DROP COLUMN `sms_login_code`;
@@ -0,0 +1,3 @@
+ALTER TABLE `user` ADD COLUMN `sms_login_code` VARCHAR(64) NOT NULL DEFAULT '' AFTER `pending_phone_attempts`;
+ALTER TABLE `user` ADD COLUMN `sms_login_code_sent_at` DATETIME(6) NULL AFTER `sms_login_code`;
+ALTER TABLE `user` ADD COLUMN `sms_login_attempts` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `sms_login_code_sent_at`;
@@ -0,0 +1,3 @@
+ALTER TABLE `user` DROP COLUMN `notify_on_new_client`;
+ALTER TABLE `user` DROP COLUMN `timezone`;
+ALTER TABLE `user` DROP COLUMN `locale`;
@@ -0,0 +1,3 @@
+ALTER TABLE `user` ADD COLUMN `locale` VARCHAR(16) NOT NULL DEFAULT '' AFTER `notify_on_login`;
+ALTER TABLE `user` ADD COLUMN `timezone` VARCHAR(64) NOT NULL DEFAULT '' AFTER `locale`;
+ALTER TABLE `user` ADD COLUMN `notify_on_new_client` BOOLEAN NOT NULL DEFAULT TRUE AFTER `timezone`;
@@ -0,0 +1,2 @@
+DROP INDEX username_idx ON `user`;
+ALTER TABLE `user` DROP COLUMN `username`;
@@ -0,0 +1,2 @@
+ALTER TABLE `user` ADD COLUMN `username` VARCHAR(32) NULL AFTER `email`;
+CREATE UNIQUE INDEX username_idx ON `user` (`username`);
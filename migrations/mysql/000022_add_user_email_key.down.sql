@@ -0,0 +1,2 @@
+DROP INDEX email_key_idx ON `user`;
+ALTER TABLE `user` DROP COLUMN `email_key`;
@@ -0,0 +1,11 @@
+CREATE TABLE `idempotency_key` (
+  `key_hash` CHAR(64) NOT NULL,
+  `fingerprint` CHAR(64) NOT NULL,
+  `status_code` INT NOT NULL DEFAULT 0,
+  `response` MEDIUMBLOB NULL,
+  `locked_until` DATETIME(6) NOT NULL,
+  `expires_at` DATETIME(6) NOT NULL,
+  `created_at` DATETIME(6) NOT NULL,
+  PRIMARY KEY (`key_hash`),
+  INDEX expires_at_idx (expires_at)
+) Engine=InnoDB DEFAULT CHARSET=utf8mb4;
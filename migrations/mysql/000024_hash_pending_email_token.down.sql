@@ -0,0 +1,3 @@
+ALTER TABLE `user` DROP COLUMN `pending_email_attempts`;
+UPDATE `user` SET `pending_email` = '', `pending_email_token` = '', `pending_email_requested_at` = NULL;
+ALTER TABLE `user` MODIFY COLUMN `pending_email_token` VARCHAR(8) NOT NULL DEFAULT '';
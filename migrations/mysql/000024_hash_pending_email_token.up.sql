@@ -0,0 +1,4 @@
+-- 確認用トークンはハッシュで保存するので、平文で保存済みの変更のリクエストは破棄する
+UPDATE `user` SET `pending_email` = '', `pending_email_token` = '', `pending_email_requested_at` = NULL;
+ALTER TABLE `user` MODIFY COLUMN `pending_email_token` VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE `user` ADD COLUMN `pending_email_attempts` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `pending_email_requested_at`;
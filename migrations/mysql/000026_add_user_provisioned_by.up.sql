@@ -0,0 +1,3 @@
+-- SCIMのAPIではSCIMで作成したユーザーだけを扱う。既存のユーザーは、作成時の監査ログからSCIMで作成したものを埋める
+ALTER TABLE `user` ADD COLUMN `provisioned_by` VARCHAR(16) NOT NULL DEFAULT '' AFTER `notify_on_new_client`;
+UPDATE `user` SET `provisioned_by` = 'scim' WHERE `id` IN (SELECT `user_id` FROM `audit_log` WHERE `event` = 'scim_create');
@@ -0,0 +1,90 @@
+CREATE TABLE "user" (
+  id BIGSERIAL PRIMARY KEY,
+  email VARCHAR(255) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  salt VARCHAR(30) NOT NULL,
+  state VARCHAR(8) NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'user',
+  activate_token VARCHAR(64) NOT NULL,
+  activate_attempts INTEGER NOT NULL DEFAULT 0,
+  token_revoked_at TIMESTAMP(6) NULL,
+  pending_email VARCHAR(255) NOT NULL DEFAULT '',
+  pending_email_token VARCHAR(8) NOT NULL DEFAULT '',
+  pending_email_requested_at TIMESTAMP(6) NULL,
+  deleted_at TIMESTAMP(6) NULL,
+  updated_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+ALTER SEQUENCE user_id_seq RESTART WITH 100001;
+
+CREATE TABLE webauthn_credential (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  credential_id BYTEA NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  attestation_type VARCHAR(32) NOT NULL,
+  aaguid BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL,
+  updated_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX webauthn_credential_user_id_idx ON webauthn_credential (user_id);
+
+CREATE TABLE used_magic_token (
+  jti VARCHAR(64) PRIMARY KEY,
+  expires_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX used_magic_token_expires_at_idx ON used_magic_token (expires_at);
+
+CREATE TABLE identity (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  provider VARCHAR(32) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  updated_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL,
+  UNIQUE (provider, subject)
+);
+
+CREATE TABLE data_export (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  data BYTEA NOT NULL,
+  expires_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX data_export_expires_at_idx ON data_export (expires_at);
+
+CREATE TABLE audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL DEFAULT 0,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  event VARCHAR(32) NOT NULL,
+  detail VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX audit_log_user_id_idx ON audit_log (user_id);
+CREATE INDEX audit_log_event_idx ON audit_log (event);
+
+CREATE TABLE login_history (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  method VARCHAR(32) NOT NULL,
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX login_history_user_id_idx ON login_history (user_id);
+
+CREATE TABLE session (
+  id VARCHAR(64) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(512) NOT NULL,
+  expires_at TIMESTAMP(6) NOT NULL,
+  last_used_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX session_user_id_idx ON session (user_id);
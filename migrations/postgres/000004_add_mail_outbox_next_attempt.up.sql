@@ -0,0 +1 @@
+ALTER TABLE mail_outbox ADD COLUMN next_attempt_at TIMESTAMP(6) NULL;
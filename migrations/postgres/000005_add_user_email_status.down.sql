@@ -0,0 +1,2 @@
+ALTER TABLE "user" DROP COLUMN email_status_at;
+ALTER TABLE "user" DROP COLUMN email_status;
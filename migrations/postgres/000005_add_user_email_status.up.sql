@@ -0,0 +1,2 @@
+ALTER TABLE "user" ADD COLUMN email_status VARCHAR(16) NOT NULL DEFAULT 'deliverable';
+ALTER TABLE "user" ADD COLUMN email_status_at TIMESTAMP(6) NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE personal_access_token (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  name VARCHAR(64) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  scopes VARCHAR(255) NOT NULL,
+  expires_at TIMESTAMP(6) NULL,
+  last_used_at TIMESTAMP(6) NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX personal_access_token_user_id_idx ON personal_access_token (user_id);
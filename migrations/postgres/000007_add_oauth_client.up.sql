@@ -0,0 +1,7 @@
+CREATE TABLE oauth_client (
+  id VARCHAR(64) PRIMARY KEY,
+  name VARCHAR(64) NOT NULL,
+  secret_hash CHAR(64) NOT NULL,
+  scopes VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
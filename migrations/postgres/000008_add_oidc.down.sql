@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS authorization_code;
+ALTER TABLE oauth_client DROP COLUMN redirect_uris;
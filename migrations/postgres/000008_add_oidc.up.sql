@@ -0,0 +1,14 @@
+ALTER TABLE oauth_client ADD COLUMN redirect_uris VARCHAR(1024) NOT NULL DEFAULT '';
+
+CREATE TABLE authorization_code (
+  code_hash CHAR(64) PRIMARY KEY,
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  redirect_uri VARCHAR(512) NOT NULL,
+  scopes VARCHAR(255) NOT NULL,
+  nonce VARCHAR(255) NOT NULL,
+  code_challenge VARCHAR(128) NOT NULL,
+  expires_at TIMESTAMP(6) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX authorization_code_expires_at_idx ON authorization_code (expires_at);
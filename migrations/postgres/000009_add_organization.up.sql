@@ -0,0 +1,15 @@
+CREATE TABLE organization (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL,
+  updated_at TIMESTAMP(6) NOT NULL
+);
+
+CREATE TABLE organization_member (
+  organization_id BIGINT NOT NULL REFERENCES organization (id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  role VARCHAR(8) NOT NULL,
+  created_at TIMESTAMP(6) NOT NULL,
+  PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX organization_member_user_id_idx ON organization_member (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE organization_invitation (
+  id BIGSERIAL PRIMARY KEY,
+  organization_id BIGINT NOT NULL REFERENCES organization (id) ON DELETE CASCADE,
+  email VARCHAR(255) NOT NULL,
+  role VARCHAR(8) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  invited_by BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  expires_at TIMESTAMP(6) NOT NULL,
+  accepted_at TIMESTAMP(6) NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX organization_invitation_organization_id_email_idx ON organization_invitation (organization_id, email);
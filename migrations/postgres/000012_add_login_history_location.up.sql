@@ -0,0 +1,4 @@
+ALTER TABLE login_history ADD COLUMN country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN city VARCHAR(128) NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN latitude DOUBLE PRECISION NULL;
+ALTER TABLE login_history ADD COLUMN longitude DOUBLE PRECISION NULL;
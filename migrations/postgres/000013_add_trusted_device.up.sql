@@ -0,0 +1,11 @@
+CREATE TABLE trusted_device (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES "user" (id) ON DELETE CASCADE,
+  name VARCHAR(64) NOT NULL,
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(512) NOT NULL,
+  expires_at TIMESTAMP(6) NOT NULL,
+  last_used_at TIMESTAMP(6) NULL,
+  created_at TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX trusted_device_user_id_idx ON trusted_device (user_id);
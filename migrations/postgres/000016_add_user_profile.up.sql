@@ -0,0 +1,3 @@
+ALTER TABLE "user" ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN display_name VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+ALTER TABLE "user" ADD COLUMN phone VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN pending_phone VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN pending_phone_code VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN pending_phone_requested_at TIMESTAMP(6) NULL;
+ALTER TABLE "user" ADD COLUMN pending_phone_attempts INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX user_phone_idx ON "user" (phone);
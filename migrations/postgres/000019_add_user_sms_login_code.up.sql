@@ -0,0 +1,3 @@
+ALTER TABLE "user" ADD COLUMN sms_login_code VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE "user" ADD COLUMN sms_login_code_sent_at TIMESTAMP(6) NULL;
+ALTER TABLE "user" ADD COLUMN sms_login_attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX user_username_idx;
+ALTER TABLE "user" DROP COLUMN username;
@@ -0,0 +1,2 @@
+DROP INDEX user_email_key_idx;
+ALTER TABLE "user" DROP COLUMN email_key;
@@ -0,0 +1,5 @@
+-- 大文字小文字だけが違うemailの行がすでにある場合は、インデックスの作成に失敗するので先に統合しておくこと
+-- registration.fold_gmail_aliasesを有効にしている場合は、マイグレーションの後に rekey-emails を実行してGmailのエイリアスを畳み込む
+ALTER TABLE "user" ADD COLUMN email_key VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE "user" SET email = LOWER(TRIM(email)), email_key = LOWER(TRIM(email));
+CREATE UNIQUE INDEX user_email_key_idx ON "user" (email_key);
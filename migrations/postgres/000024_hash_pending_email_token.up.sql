@@ -0,0 +1,4 @@
+-- 確認用トークンはハッシュで保存するので、平文で保存済みの変更のリクエストは破棄する
+UPDATE "user" SET pending_email = '', pending_email_token = '', pending_email_requested_at = NULL;
+ALTER TABLE "user" ALTER COLUMN pending_email_token TYPE VARCHAR(64);
+ALTER TABLE "user" ADD COLUMN pending_email_attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE "user" DROP COLUMN state_before_delete;
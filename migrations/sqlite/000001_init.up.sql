@@ -0,0 +1,91 @@
+CREATE TABLE user (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email VARCHAR(255) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  salt VARCHAR(30) NOT NULL,
+  state VARCHAR(8) NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'user',
+  activate_token VARCHAR(64) NOT NULL,
+  activate_attempts INTEGER NOT NULL DEFAULT 0,
+  token_revoked_at DATETIME NULL,
+  pending_email VARCHAR(255) NOT NULL DEFAULT '',
+  pending_email_token VARCHAR(8) NOT NULL DEFAULT '',
+  pending_email_requested_at DATETIME NULL,
+  deleted_at DATETIME NULL,
+  updated_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+-- MySQLと同じくユーザーIDを100001から始める
+INSERT INTO sqlite_sequence (name, seq) VALUES ('user', 100000);
+
+CREATE TABLE webauthn_credential (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  credential_id BLOB NOT NULL UNIQUE,
+  public_key BLOB NOT NULL,
+  attestation_type VARCHAR(32) NOT NULL,
+  aaguid BLOB NOT NULL,
+  sign_count BIGINT NOT NULL,
+  updated_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX webauthn_credential_user_id_idx ON webauthn_credential (user_id);
+
+CREATE TABLE used_magic_token (
+  jti VARCHAR(64) PRIMARY KEY,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX used_magic_token_expires_at_idx ON used_magic_token (expires_at);
+
+CREATE TABLE identity (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  provider VARCHAR(32) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  updated_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL,
+  UNIQUE (provider, subject)
+);
+
+CREATE TABLE data_export (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  data BLOB NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX data_export_expires_at_idx ON data_export (expires_at);
+
+CREATE TABLE audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL DEFAULT 0,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  event VARCHAR(32) NOT NULL,
+  detail VARCHAR(255) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX audit_log_user_id_idx ON audit_log (user_id);
+CREATE INDEX audit_log_event_idx ON audit_log (event);
+
+CREATE TABLE login_history (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  method VARCHAR(32) NOT NULL,
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(512) NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX login_history_user_id_idx ON login_history (user_id);
+
+CREATE TABLE session (
+  id VARCHAR(64) PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  ip_address VARCHAR(45) NOT NULL,
+  user_agent VARCHAR(512) NOT NULL,
+  expires_at DATETIME NOT NULL,
+  last_used_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX session_user_id_idx ON session (user_id);
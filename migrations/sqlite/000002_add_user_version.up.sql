@@ -0,0 +1 @@
+ALTER TABLE user ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
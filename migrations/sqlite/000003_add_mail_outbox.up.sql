@@ -0,0 +1,12 @@
+CREATE TABLE mail_outbox (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind VARCHAR(32) NOT NULL,
+  recipient VARCHAR(255) NOT NULL,
+  token VARCHAR(64) NOT NULL DEFAULT '',
+  link VARCHAR(2048) NOT NULL DEFAULT '',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error VARCHAR(255) NOT NULL DEFAULT '',
+  sent_at DATETIME NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX mail_outbox_sent_at_idx ON mail_outbox (sent_at, id);
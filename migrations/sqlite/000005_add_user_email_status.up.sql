@@ -0,0 +1,2 @@
+ALTER TABLE user ADD COLUMN email_status TEXT NOT NULL DEFAULT 'deliverable';
+ALTER TABLE user ADD COLUMN email_status_at DATETIME NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE organization (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(64) NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE organization_member (
+  organization_id BIGINT NOT NULL REFERENCES organization (id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+  role VARCHAR(8) NOT NULL,
+  created_at DATETIME NOT NULL,
+  PRIMARY KEY (organization_id, user_id)
+);
+CREATE INDEX organization_member_user_id_idx ON organization_member (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE invite_code (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  code_hash CHAR(64) NOT NULL UNIQUE,
+  note VARCHAR(255) NOT NULL,
+  max_uses INT NOT NULL,
+  use_count INT NOT NULL DEFAULT 0,
+  expires_at DATETIME NULL,
+  revoked_at DATETIME NULL,
+  created_by BIGINT NOT NULL,
+  created_at DATETIME NOT NULL
+);
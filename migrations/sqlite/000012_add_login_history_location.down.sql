@@ -0,0 +1,4 @@
+ALTER TABLE login_history DROP COLUMN longitude;
+ALTER TABLE login_history DROP COLUMN latitude;
+ALTER TABLE login_history DROP COLUMN city;
+ALTER TABLE login_history DROP COLUMN country;
@@ -0,0 +1,4 @@
+ALTER TABLE login_history ADD COLUMN country TEXT NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN city TEXT NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN latitude REAL NULL;
+ALTER TABLE login_history ADD COLUMN longitude REAL NULL;
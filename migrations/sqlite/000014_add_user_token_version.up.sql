@@ -0,0 +1 @@
+ALTER TABLE user ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE user ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN bio TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP INDEX user_phone_idx;
+ALTER TABLE user DROP COLUMN pending_phone_attempts;
+ALTER TABLE user DROP COLUMN pending_phone_requested_at;
+ALTER TABLE user DROP COLUMN pending_phone_code;
+ALTER TABLE user DROP COLUMN pending_phone;
+ALTER TABLE user DROP COLUMN phone;
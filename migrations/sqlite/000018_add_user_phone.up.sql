@@ -0,0 +1,6 @@
+ALTER TABLE user ADD COLUMN phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN pending_phone TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN pending_phone_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN pending_phone_requested_at DATETIME NULL;
+ALTER TABLE user ADD COLUMN pending_phone_attempts INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX user_phone_idx ON user (phone);
@@ -0,0 +1,3 @@
+ALTER TABLE user ADD COLUMN sms_login_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN sms_login_code_sent_at DATETIME NULL;
+ALTER TABLE user ADD COLUMN sms_login_attempts INTEGER NOT NULL DEFAULT 0;
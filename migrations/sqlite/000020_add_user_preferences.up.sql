@@ -0,0 +1,3 @@
+ALTER TABLE user ADD COLUMN locale TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN notify_on_new_client BOOLEAN NOT NULL DEFAULT TRUE;
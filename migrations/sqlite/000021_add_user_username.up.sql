@@ -0,0 +1,2 @@
+ALTER TABLE user ADD COLUMN username TEXT NULL;
+CREATE UNIQUE INDEX user_username_idx ON user (username);
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_key (
+  key_hash CHAR(64) PRIMARY KEY,
+  fingerprint CHAR(64) NOT NULL,
+  status_code INT NOT NULL DEFAULT 0,
+  response BLOB NULL,
+  locked_until DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE user DROP COLUMN pending_email_attempts;
+UPDATE user SET pending_email = '', pending_email_token = '', pending_email_requested_at = NULL;
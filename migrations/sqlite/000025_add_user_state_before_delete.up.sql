@@ -0,0 +1,2 @@
+-- 退会を取り消す時に、退会する前のstateに戻す。すでに退会済みの行は不明なので空にしておく
+ALTER TABLE user ADD COLUMN state_before_delete TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	githubUserURL   = "https://api.github.com/user"
+	githubEmailsURL = "https://api.github.com/user/emails"
+)
+
+type githubProvider struct {
+	conf *oauth2.Config
+}
+
+func NewGitHubProvider(clientID, clientSecret string) IProvider {
+	return &githubProvider{
+		conf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://github.com/login/oauth/authorize",
+				TokenURL: "https://github.com/login/oauth/access_token",
+			},
+			RedirectURL: fmt.Sprintf(redirectURL, "github"),
+			Scopes:      []string{"read:user", "user:email"},
+		},
+	}
+}
+
+func (p *githubProvider) Name() string {
+	return "github"
+}
+
+func (p *githubProvider) AuthCodeURL(state string) string {
+	return p.conf.AuthCodeURL(state)
+}
+
+// 認可コードをアクセストークンに交換して、ユーザー情報を取得する
+// GitHubはユーザー情報にemailが含まれないことがあるので、emailは別のAPIから取得する
+func (p *githubProvider) Exchange(ctx context.Context, code string) (*UserInfo, error) {
+	tok, err := p.conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange: %w", err)
+	}
+	client := p.conf.Client(ctx, tok)
+
+	user := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := getJSON(ctx, client, githubUserURL, &user); err != nil {
+		return nil, err
+	}
+
+	emails := []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}{}
+	if err := getJSON(ctx, client, githubEmailsURL, &emails); err != nil {
+		return nil, err
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			return &UserInfo{
+				Subject:       strconv.FormatInt(user.ID, 10),
+				Email:         e.Email,
+				EmailVerified: e.Verified,
+			}, nil
+		}
+	}
+	return nil, errors.New("primary email not found")
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: status %d", url, res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
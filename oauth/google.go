@@ -0,0 +1,75 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+const googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+type googleProvider struct {
+	conf *oauth2.Config
+}
+
+func NewGoogleProvider(clientID, clientSecret string) IProvider {
+	return &googleProvider{
+		conf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+				TokenURL: "https://oauth2.googleapis.com/token",
+			},
+			RedirectURL: fmt.Sprintf(redirectURL, "google"),
+			Scopes:      []string{"openid", "email"},
+		},
+	}
+}
+
+func (p *googleProvider) Name() string {
+	return "google"
+}
+
+func (p *googleProvider) AuthCodeURL(state string) string {
+	return p.conf.AuthCodeURL(state)
+}
+
+// 認可コードをアクセストークンに交換して、ユーザー情報を取得する
+func (p *googleProvider) Exchange(ctx context.Context, code string) (*UserInfo, error) {
+	tok, err := p.conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleUserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.conf.Client(ctx, tok).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get userinfo: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get userinfo: status %d", res.StatusCode)
+	}
+
+	body := struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo: %w", err)
+	}
+
+	return &UserInfo{
+		Subject:       body.Sub,
+		Email:         body.Email,
+		EmailVerified: body.EmailVerified,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// 認可コードフローのコールバックURL。%sにはプロバイダー名が入る
+var redirectURL = "http://localhost:8000/api/v1/auth/oauth/%s/callback"
+
+// OAuth2のプロバイダーから取得したユーザー情報
+type UserInfo struct {
+	// プロバイダー内でユーザーを一意に識別するID
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type IProvider interface {
+	Name() string
+	AuthCodeURL(state string) string
+	Exchange(ctx context.Context, code string) (*UserInfo, error)
+}
+
+type Providers map[string]IProvider
+
+// 環境変数にクライアントIDが設定されているプロバイダーのみ有効にする
+func NewProviders() Providers {
+	ps := Providers{}
+	if id := os.Getenv("GOOGLE_CLIENT_ID"); id != "" {
+		p := NewGoogleProvider(id, os.Getenv("GOOGLE_CLIENT_SECRET"))
+		ps[p.Name()] = p
+	}
+	if id := os.Getenv("GITHUB_CLIENT_ID"); id != "" {
+		p := NewGitHubProvider(id, os.Getenv("GITHUB_CLIENT_SECRET"))
+		ps[p.Name()] = p
+	}
+	return ps
+}
+
+func (ps Providers) Get(name string) (IProvider, error) {
+	p, ok := ps[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown oauth provider: %s", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,84 @@
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Have I Been PwnedのRange API。SHA-1ハッシュの先頭5文字だけを送るので、パスワード自体は送信されない
+const rangeURL = "https://api.pwnedpasswords.com/range/"
+
+// パスワードが過去の漏洩データに含まれているかを確認する
+type IChecker interface {
+	IsPwned(ctx context.Context, pw string) (bool, error)
+}
+
+// 環境変数HIBP_ENABLEDがtrueの場合のみHIBPに問い合わせる
+func NewChecker() IChecker {
+	if os.Getenv("HIBP_ENABLED") == "true" {
+		return NewHIBPChecker(&http.Client{Timeout: 5 * time.Second})
+	}
+	return NewNopChecker()
+}
+
+type hibpChecker struct {
+	client *http.Client
+}
+
+func NewHIBPChecker(client *http.Client) IChecker {
+	return &hibpChecker{client: client}
+}
+
+func (hc *hibpChecker) IsPwned(ctx context.Context, pw string) (bool, error) {
+	sum := sha1.Sum([]byte(pw))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rangeURL+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "login-example")
+	// レスポンスサイズから問い合わせ内容を推測されないようにパディングを要求する
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := hc.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to request hibp: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status from hibp: %d", res.StatusCode)
+	}
+
+	// レスポンスは"ハッシュの残り:出現回数"の行の一覧。パディングの行は出現回数が0になっている
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		s, count, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if ok && s == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, fmt.Errorf("failed to read hibp response: %w", err)
+	}
+	return false, nil
+}
+
+// チェックを無効にするための、常に漏洩していないと判定するChecker
+type nopChecker struct{}
+
+func NewNopChecker() IChecker {
+	return nopChecker{}
+}
+
+func (nopChecker) IsPwned(ctx context.Context, pw string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,51 @@
+// crypto/randを使った、推測されにくいランダムな文字列を作成する
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+const (
+	alphanumericLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	numericLetters      = "0123456789"
+)
+
+// lengthの長さのランダムな文字列(a-zA-Z0-9)を作成する
+func Alphanumeric(length int) string {
+	return fromLetters(alphanumericLetters, length)
+}
+
+// lengthの長さのランダムな数字の文字列を作成する。ワンタイムパスワード用
+func Numeric(length int) string {
+	return fromLetters(numericLetters, length)
+}
+
+// nバイトのランダムな値を、URLに含められるbase64(パディングなし)にして返す
+func URLSafeToken(n int) string {
+	b := make([]byte, n)
+	// Go1.24以降、crypto/randのReadはエラーを返さない
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// lettersの文字からランダムに選んで、lengthの長さの文字列を作成する
+// 剰余による偏りが出ないように、lettersの長さの倍数に収まらない値は捨てる
+func fromLetters(letters string, length int) string {
+	max := 256 - 256%len(letters)
+	result := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(result) < length {
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) >= max {
+				continue
+			}
+			result = append(result, letters[int(b)%len(letters)])
+			if len(result) == length {
+				break
+			}
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IAuditRepository interface {
+	Create(ctx context.Context, l *entity.AuditLog) error
+	List(ctx context.Context, opts AuditListOptions) (entity.AuditLogs, int64, error)
+}
+
+// 監査ログを取得する時の条件。新しいものから順に取得する
+type AuditListOptions struct {
+	Limit  int
+	Offset int
+	// 0の場合は全てのユーザーのログを取得する
+	UserID entity.UserID
+	// 空の場合は全てのイベントを取得する
+	Event entity.AuditEvent
+}
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) IAuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(ctx context.Context, l *entity.AuditLog) error {
+	l.CreatedAt = time.Now()
+
+	query := `INSERT INTO audit_log (
+		user_id, email, event, detail, created_at
+	) VALUES (:user_id, :email, :event, :detail, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, l)
+	if err != nil {
+		return err
+	}
+
+	l.ID = entity.AuditLogID(id)
+	return nil
+}
+
+// 条件に一致する監査ログと、ページングする前の総件数を取得する
+func (r *auditRepository) List(ctx context.Context, opts AuditListOptions) (entity.AuditLogs, int64, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultListLimit
+	}
+	if opts.Limit > maxListLimit {
+		opts.Limit = maxListLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	conds := []string{}
+	args := []any{}
+	if opts.UserID != 0 {
+		conds = append(conds, "user_id = ?")
+		args = append(args, opts.UserID)
+	}
+	if opts.Event != "" {
+		conds = append(conds, "event = ?")
+		args = append(args, opts.Event)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int64
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), &total, r.db.Rebind(`SELECT COUNT(*) FROM audit_log `+where), args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count: %w", err)
+	}
+
+	query := `SELECT id, user_id, email, event, detail, created_at FROM audit_log ` +
+		where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	ls := entity.AuditLogs{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ls, r.db.Rebind(query), append(args, opts.Limit, opts.Offset)...); err != nil {
+		return nil, 0, fmt.Errorf("failed to select: %w", err)
+	}
+	return ls, total, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IAuthorizationCodeRepository interface {
+	Create(ctx context.Context, code *entity.AuthorizationCode) error
+	Consume(ctx context.Context, hash string) (*entity.AuthorizationCode, error)
+}
+
+type authorizationCodeRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuthorizationCodeRepository(db *sqlx.DB) IAuthorizationCodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+func (r *authorizationCodeRepository) Create(ctx context.Context, code *entity.AuthorizationCode) error {
+	// 交換されずに有効期限の切れたコードは使えないので削除しておく
+	res, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM authorization_code WHERE expires_at < ?`), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired code: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		logging.FromContext(ctx).DebugContext(ctx, "deleted expired authorization codes", slog.Int64("count", n))
+	}
+
+	code.CreatedAt = time.Now()
+
+	query := `INSERT INTO authorization_code (
+		code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at
+	) VALUES (:code_hash, :client_id, :user_id, :redirect_uri, :scopes, :nonce, :code_challenge, :expires_at, :created_at)`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, code); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// コードを取得して削除する。存在しない場合や、同時に他のリクエストで使われた場合はsql.ErrNoRowsを返す
+// 有効期限は呼び出し側で確認する
+func (r *authorizationCodeRepository) Consume(ctx context.Context, hash string) (*entity.AuthorizationCode, error) {
+	query := `SELECT code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at
+		FROM authorization_code WHERE code_hash = ?`
+	code := &entity.AuthorizationCode{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), code, r.db.Rebind(query), hash); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM authorization_code WHERE code_hash = ?`), hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete authorization code: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return code, nil
+}
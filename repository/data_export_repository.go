@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IDataExportRepository interface {
+	Create(ctx context.Context, e *entity.DataExport) error
+	Get(ctx context.Context, id entity.DataExportID) (*entity.DataExport, error)
+}
+
+type dataExportRepository struct {
+	db *sqlx.DB
+}
+
+func NewDataExportRepository(db *sqlx.DB) IDataExportRepository {
+	return &dataExportRepository{db: db}
+}
+
+// エクスポートしたデータを保存する。有効期限の切れたデータは削除しておく
+func (r *dataExportRepository) Create(ctx context.Context, e *entity.DataExport) error {
+	e.CreatedAt = time.Now()
+
+	res, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM data_export WHERE expires_at < ?`), e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired export: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		logging.FromContext(ctx).DebugContext(ctx, "deleted expired data exports", slog.Int64("count", n))
+	}
+
+	query := `INSERT INTO data_export (
+		user_id, data, expires_at, created_at
+	) VALUES (:user_id, :data, :expires_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, e)
+	if err != nil {
+		return err
+	}
+
+	e.ID = entity.DataExportID(id)
+	return nil
+}
+
+func (r *dataExportRepository) Get(ctx context.Context, id entity.DataExportID) (*entity.DataExport, error) {
+	query := `SELECT id, user_id, data, expires_at, created_at FROM data_export WHERE id = ?`
+	e := &entity.DataExport{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), e, r.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return e, nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// MySQL、PostgreSQL、SQLiteのSQLの違いを吸収する
+// プレースホルダーはクエリを?で書いて、実行前にsqlx.DB.Rebindで変換する
+type dialect string
+
+const (
+	dialectMySQL    = dialect("mysql")
+	dialectPostgres = dialect("postgres")
+	dialectSQLite   = dialect("sqlite")
+)
+
+// 重複したキーでINSERTした時のエラー番号
+const (
+	mysqlErrDuplicateEntry = 1062
+	pgErrUniqueViolation   = "23505"
+)
+
+// sqlx.DBのドライバー名から方言を判定する
+func dialectOf(db *sqlx.DB) dialect {
+	switch db.DriverName() {
+	case "pgx", "postgres":
+		return dialectPostgres
+	case "sqlite":
+		return dialectSQLite
+	default:
+		return dialectMySQL
+	}
+}
+
+// 予約語と同じ名前のテーブル名をクォートする。PostgreSQLではuserが予約語になっている
+// MySQLとSQLiteではクォートしなくてよい
+func (d dialect) table(name string) string {
+	if d == dialectPostgres {
+		return `"` + name + `"`
+	}
+	return name
+}
+
+// SELECTした行をロックして、他のトランザクションがロックしている行は飛ばす
+// SQLiteは書き込みが直列化されるので何もしない
+func (d dialect) forUpdateSkipLocked() string {
+	if d == dialectSQLite {
+		return ""
+	}
+	return ` FOR UPDATE SKIP LOCKED`
+}
+
+// 名前付きパラメータでINSERTして、自動採番されたidを返す
+// PostgreSQLはLastInsertIdに対応していないので、RETURNING句で取得する
+func insertReturningID(ctx context.Context, db *sqlx.DB, query string, arg any) (int64, error) {
+	if dialectOf(db) == dialectPostgres {
+		rows, err := sqlx.NamedQueryContext(ctx, conn(ctx, db), query+` RETURNING id`, arg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to Exec: %w", err)
+		}
+		defer rows.Close()
+
+		var id int64
+		if !rows.Next() {
+			return 0, fmt.Errorf("failed to get returning id: %w", rows.Err())
+		}
+		if err := rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("failed to scan returning id: %w", err)
+		}
+		return id, nil
+	}
+
+	result, err := sqlx.NamedExecContext(ctx, conn(ctx, db), query, arg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to Exec: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to LastInsertId: %w", err)
+	}
+	return id, nil
+}
+
+// 一意制約に違反したエラーか
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDuplicateEntry
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgErrUniqueViolation
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IIdempotencyRepository interface {
+	Reserve(ctx context.Context, k *entity.IdempotencyKey) (*entity.IdempotencyKey, error)
+	Complete(ctx context.Context, k *entity.IdempotencyKey) error
+	Delete(ctx context.Context, keyHash string) error
+	// 有効期限の切れたキーを削除して、削除した件数を返す
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyRepository(db *sqlx.DB) IIdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// キーを処理中として保存する。有効期限内の同じキーがすでにある場合は、保存せずにそのキーを返す
+// 有効期限の切れたキーと、処理中のままlocked_untilを過ぎたキーは上書きして引き継ぐ
+func (r *idempotencyRepository) Reserve(ctx context.Context, k *entity.IdempotencyKey) (*entity.IdempotencyKey, error) {
+	now := time.Now()
+	k.StatusCode = 0
+	k.Response = nil
+	k.CreatedAt = now
+	query := `INSERT INTO idempotency_key (
+		key_hash, fingerprint, status_code, response, locked_until, expires_at, created_at
+	) VALUES (:key_hash, :fingerprint, :status_code, :response, :locked_until, :expires_at, :created_at)`
+	_, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, k)
+	if err == nil {
+		return nil, nil
+	} else if !isDuplicateKey(err) {
+		return nil, fmt.Errorf("failed to Exec: %w", err)
+	}
+
+	// 同時に引き継ごうとした場合も、条件を満たすのは先に更新した1件だけ
+	query = `UPDATE idempotency_key SET
+		fingerprint = ?, status_code = 0, response = NULL, locked_until = ?, expires_at = ?, created_at = ?
+		WHERE key_hash = ? AND (expires_at < ? OR (status_code = 0 AND locked_until < ?))`
+	res, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query),
+		k.Fingerprint, k.LockedUntil, k.ExpiresAt, k.CreatedAt, k.KeyHash, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Exec: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil, nil
+	}
+
+	query = `SELECT key_hash, fingerprint, status_code, response, locked_until, expires_at, created_at
+		FROM idempotency_key WHERE key_hash = ?`
+	old := &entity.IdempotencyKey{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), old, r.db.Rebind(query), k.KeyHash); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return old, nil
+}
+
+// 処理中のキーにレスポンスを保存する
+func (r *idempotencyRepository) Complete(ctx context.Context, k *entity.IdempotencyKey) error {
+	query := `UPDATE idempotency_key SET status_code = :status_code, response = :response WHERE key_hash = :key_hash`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, k); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// 処理に失敗したリクエストを、同じキーで再送できるように削除する
+func (r *idempotencyRepository) Delete(ctx context.Context, keyHash string) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM idempotency_key WHERE key_hash = ?`), keyHash); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM idempotency_key WHERE expires_at < ?`), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to Exec: %w", err)
+	}
+	return res.RowsAffected()
+}
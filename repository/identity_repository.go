@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IIdentityRepository interface {
+	Create(ctx context.Context, i *entity.Identity) error
+	GetByProvider(ctx context.Context, provider, subject string) (*entity.Identity, error)
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.Identities, error)
+}
+
+type identityRepository struct {
+	db *sqlx.DB
+}
+
+func NewIdentityRepository(db *sqlx.DB) IIdentityRepository {
+	return &identityRepository{db: db}
+}
+
+// プロバイダーのアカウントをユーザーに紐付ける
+func (r *identityRepository) Create(ctx context.Context, i *entity.Identity) error {
+	i.UpdatedAt = time.Now()
+	i.CreatedAt = time.Now()
+
+	query := `INSERT INTO identity (
+		user_id, provider, subject, email, updated_at, created_at
+	) VALUES (:user_id, :provider, :subject, :email, :updated_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, i)
+	if err != nil {
+		return err
+	}
+
+	i.ID = entity.IdentityID(id)
+	return nil
+}
+
+// プロバイダー名とプロバイダー内のIDから紐付けを取得する。存在しない場合はsql.ErrNoRowsを返す
+func (r *identityRepository) GetByProvider(ctx context.Context, provider, subject string) (*entity.Identity, error) {
+	query := `SELECT
+		id, user_id, provider, subject, email, updated_at, created_at
+		FROM identity WHERE provider = ? AND subject = ?`
+	i := &entity.Identity{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), i, r.db.Rebind(query), provider, subject); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return i, nil
+}
+
+// ユーザーに紐づくプロバイダーのアカウントを全て取得する
+func (r *identityRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.Identities, error) {
+	query := `SELECT
+		id, user_id, provider, subject, email, updated_at, created_at
+		FROM identity WHERE user_id = ?`
+	is := entity.Identities{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &is, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return is, nil
+}
@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// リポジトリのメソッドの実行時間とエラーを記録する
+// DBが遅くなった時に、ログインなどのどの処理に影響しているか分かるようにする
+type Instrumentation struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	// この時間以上かかったメソッドはログに出力する。0の場合は出力しない
+	slowThreshold time.Duration
+}
+
+func NewInstrumentation(reg prometheus.Registerer, slowThreshold time.Duration) *Instrumentation {
+	in := &Instrumentation{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "login_example",
+			Name:      "repository_duration_seconds",
+			Help:      "Repository method latencies.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"repository", "method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "login_example",
+			Name:      "repository_errors_total",
+			Help:      "Number of repository method errors.",
+		}, []string{"repository", "method"}),
+		slowThreshold: slowThreshold,
+	}
+	reg.MustRegister(in.duration, in.errors)
+	return in
+}
+
+// メソッドの開始時にdeferで呼び出して、返り値のエラーを渡す
+// 例: defer r.in.observe(ctx, "user", "Get", uid)(&err)
+// uidが分からない場合は0を渡す
+func (in *Instrumentation) observe(ctx context.Context, repo, method string, uid entity.UserID) func(*error) {
+	start := time.Now()
+	return func(errp *error) {
+		d := time.Since(start)
+		in.duration.WithLabelValues(repo, method).Observe(d.Seconds())
+		// 見つからなかったのは正常な結果なので、エラーとして数えない
+		if err := *errp; err != nil && !errors.Is(err, sql.ErrNoRows) {
+			in.errors.WithLabelValues(repo, method).Inc()
+		}
+
+		if in.slowThreshold > 0 && d >= in.slowThreshold {
+			attrs := []any{slog.String("query", repo+"."+method), slog.Duration("duration", d)}
+			if uid != 0 {
+				attrs = append(attrs, slog.Any("user_id", uid))
+			}
+			logging.FromContext(ctx).WarnContext(ctx, "slow query", attrs...)
+		}
+	}
+}
+
+type instrumentedUserRepository struct {
+	next IUserRepository
+	in   *Instrumentation
+}
+
+// IUserRepositoryの全てのメソッドを計測するデコレーター
+func NewInstrumentedUserRepository(ur IUserRepository, in *Instrumentation) IUserRepository {
+	return &instrumentedUserRepository{next: ur, in: in}
+}
+
+func (r *instrumentedUserRepository) observe(ctx context.Context, method string, uid entity.UserID) func(*error) {
+	return r.in.observe(ctx, "user", method, uid)
+}
+
+func (r *instrumentedUserRepository) PreRegister(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "PreRegister", 0)(&err)
+	return r.next.PreRegister(ctx, u)
+}
+
+func (r *instrumentedUserRepository) Register(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "Register", 0)(&err)
+	return r.next.Register(ctx, u)
+}
+
+func (r *instrumentedUserRepository) GetByEmail(ctx context.Context, email string) (_ *entity.User, err error) {
+	defer r.observe(ctx, "GetByEmail", 0)(&err)
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *instrumentedUserRepository) GetByEmailKey(ctx context.Context, key string) (_ *entity.User, err error) {
+	defer r.observe(ctx, "GetByEmailKey", 0)(&err)
+	return r.next.GetByEmailKey(ctx, key)
+}
+
+func (r *instrumentedUserRepository) ListEmailKeys(ctx context.Context, after entity.UserID, limit int) (_ entity.Users, err error) {
+	defer r.observe(ctx, "ListEmailKeys", 0)(&err)
+	return r.next.ListEmailKeys(ctx, after, limit)
+}
+
+func (r *instrumentedUserRepository) UpdateEmailKey(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateEmailKey", u.ID)(&err)
+	return r.next.UpdateEmailKey(ctx, u)
+}
+
+func (r *instrumentedUserRepository) GetByPhone(ctx context.Context, phone string) (_ *entity.User, err error) {
+	defer r.observe(ctx, "GetByPhone", 0)(&err)
+	return r.next.GetByPhone(ctx, phone)
+}
+
+func (r *instrumentedUserRepository) GetByUsername(ctx context.Context, username string) (_ *entity.User, err error) {
+	defer r.observe(ctx, "GetByUsername", 0)(&err)
+	return r.next.GetByUsername(ctx, username)
+}
+
+func (r *instrumentedUserRepository) UpdateUsername(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateUsername", u.ID)(&err)
+	return r.next.UpdateUsername(ctx, u)
+}
+
+func (r *instrumentedUserRepository) RequestPhoneChange(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "RequestPhoneChange", u.ID)(&err)
+	return r.next.RequestPhoneChange(ctx, u)
+}
+
+func (r *instrumentedUserRepository) IncrementPhoneAttempts(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "IncrementPhoneAttempts", u.ID)(&err)
+	return r.next.IncrementPhoneAttempts(ctx, u)
+}
+
+func (r *instrumentedUserRepository) ConfirmPhoneChange(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "ConfirmPhoneChange", u.ID)(&err)
+	return r.next.ConfirmPhoneChange(ctx, u)
+}
+
+func (r *instrumentedUserRepository) DeletePhone(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "DeletePhone", u.ID)(&err)
+	return r.next.DeletePhone(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateSmsLoginCode(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateSmsLoginCode", u.ID)(&err)
+	return r.next.UpdateSmsLoginCode(ctx, u)
+}
+
+func (r *instrumentedUserRepository) IncrementSmsLoginAttempts(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "IncrementSmsLoginAttempts", u.ID)(&err)
+	return r.next.IncrementSmsLoginAttempts(ctx, u)
+}
+
+func (r *instrumentedUserRepository) ConsumeSmsLoginCode(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "ConsumeSmsLoginCode", u.ID)(&err)
+	return r.next.ConsumeSmsLoginCode(ctx, u)
+}
+
+func (r *instrumentedUserRepository) Delete(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "Delete", u.ID)(&err)
+	return r.next.Delete(ctx, u)
+}
+
+func (r *instrumentedUserRepository) Purge(ctx context.Context, id entity.UserID) (err error) {
+	defer r.observe(ctx, "Purge", id)(&err)
+	return r.next.Purge(ctx, id)
+}
+
+func (r *instrumentedUserRepository) Activate(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "Activate", u.ID)(&err)
+	return r.next.Activate(ctx, u)
+}
+
+func (r *instrumentedUserRepository) Get(ctx context.Context, uid entity.UserID) (_ *entity.User, err error) {
+	defer r.observe(ctx, "Get", uid)(&err)
+	return r.next.Get(ctx, uid)
+}
+
+func (r *instrumentedUserRepository) List(ctx context.Context, opts ListOptions) (_ entity.Users, _ int64, err error) {
+	defer r.observe(ctx, "List", 0)(&err)
+	return r.next.List(ctx, opts)
+}
+
+func (r *instrumentedUserRepository) UpdateActivateToken(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateActivateToken", u.ID)(&err)
+	return r.next.UpdateActivateToken(ctx, u)
+}
+
+func (r *instrumentedUserRepository) IncrementActivateAttempts(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "IncrementActivateAttempts", u.ID)(&err)
+	return r.next.IncrementActivateAttempts(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdatePassword(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdatePassword", u.ID)(&err)
+	return r.next.UpdatePassword(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdatePasswordHash(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdatePasswordHash", u.ID)(&err)
+	return r.next.UpdatePasswordHash(ctx, u)
+}
+
+func (r *instrumentedUserRepository) RequestEmailChange(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "RequestEmailChange", u.ID)(&err)
+	return r.next.RequestEmailChange(ctx, u)
+}
+
+func (r *instrumentedUserRepository) IncrementEmailChangeAttempts(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "IncrementEmailChangeAttempts", u.ID)(&err)
+	return r.next.IncrementEmailChangeAttempts(ctx, u)
+}
+
+func (r *instrumentedUserRepository) ConfirmEmailChange(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "ConfirmEmailChange", u.ID)(&err)
+	return r.next.ConfirmEmailChange(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateEmailStatus(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateEmailStatus", u.ID)(&err)
+	return r.next.UpdateEmailStatus(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateState(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateState", u.ID)(&err)
+	return r.next.UpdateState(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateProfile(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateProfile", u.ID)(&err)
+	return r.next.UpdateProfile(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateAvatar(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateAvatar", u.ID)(&err)
+	return r.next.UpdateAvatar(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdateNotifyOnLogin(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdateNotifyOnLogin", u.ID)(&err)
+	return r.next.UpdateNotifyOnLogin(ctx, u)
+}
+
+func (r *instrumentedUserRepository) UpdatePreferences(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "UpdatePreferences", u.ID)(&err)
+	return r.next.UpdatePreferences(ctx, u)
+}
+
+func (r *instrumentedUserRepository) RevokeTokens(ctx context.Context, u *entity.User) (err error) {
+	defer r.observe(ctx, "RevokeTokens", u.ID)(&err)
+	return r.next.RevokeTokens(ctx, u)
+}
+
+func (r *instrumentedUserRepository) Restore(ctx context.Context, uid entity.UserID, deletedSince time.Time) (err error) {
+	defer r.observe(ctx, "Restore", uid)(&err)
+	return r.next.Restore(ctx, uid, deletedSince)
+}
+
+func (r *instrumentedUserRepository) PurgeOlderThan(ctx context.Context, before time.Time) (_ int64, err error) {
+	defer r.observe(ctx, "PurgeOlderThan", 0)(&err)
+	return r.next.PurgeOlderThan(ctx, before)
+}
+
+type instrumentedSessionRepository struct {
+	next ISessionRepository
+	in   *Instrumentation
+}
+
+// ISessionRepositoryの全てのメソッドを計測するデコレーター
+func NewInstrumentedSessionRepository(sr ISessionRepository, in *Instrumentation) ISessionRepository {
+	return &instrumentedSessionRepository{next: sr, in: in}
+}
+
+func (r *instrumentedSessionRepository) observe(ctx context.Context, method string, uid entity.UserID) func(*error) {
+	return r.in.observe(ctx, "session", method, uid)
+}
+
+func (r *instrumentedSessionRepository) Create(ctx context.Context, s *entity.Session) (err error) {
+	defer r.observe(ctx, "Create", s.UserID)(&err)
+	return r.next.Create(ctx, s)
+}
+
+func (r *instrumentedSessionRepository) Get(ctx context.Context, id entity.SessionID) (_ *entity.Session, err error) {
+	defer r.observe(ctx, "Get", 0)(&err)
+	return r.next.Get(ctx, id)
+}
+
+func (r *instrumentedSessionRepository) ListByUserID(ctx context.Context, uid entity.UserID) (_ entity.Sessions, err error) {
+	defer r.observe(ctx, "ListByUserID", uid)(&err)
+	return r.next.ListByUserID(ctx, uid)
+}
+
+func (r *instrumentedSessionRepository) Touch(ctx context.Context, id entity.SessionID) (err error) {
+	defer r.observe(ctx, "Touch", 0)(&err)
+	return r.next.Touch(ctx, id)
+}
+
+func (r *instrumentedSessionRepository) Delete(ctx context.Context, uid entity.UserID, id entity.SessionID) (err error) {
+	defer r.observe(ctx, "Delete", uid)(&err)
+	return r.next.Delete(ctx, uid, id)
+}
+
+func (r *instrumentedSessionRepository) DeleteByUserID(ctx context.Context, uid entity.UserID) (err error) {
+	defer r.observe(ctx, "DeleteByUserID", uid)(&err)
+	return r.next.DeleteByUserID(ctx, uid)
+}
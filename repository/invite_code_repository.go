@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IInviteCodeRepository interface {
+	Create(ctx context.Context, c *entity.InviteCode) error
+	// 新しいものから順に取得する。使えなくなった招待コードも含む
+	List(ctx context.Context) (entity.InviteCodes, error)
+	// コードのハッシュで取得する。存在しない場合はsql.ErrNoRowsを返す
+	GetByHash(ctx context.Context, hash string) (*entity.InviteCode, error)
+	// 使用回数を1つ増やす。使えない招待コードの場合はsql.ErrNoRowsを返す
+	Consume(ctx context.Context, id entity.InviteCodeID) error
+	// 取り消す。存在しないか、取り消し済みの場合はsql.ErrNoRowsを返す
+	Revoke(ctx context.Context, id entity.InviteCodeID) error
+}
+
+type inviteCodeRepository struct {
+	db *sqlx.DB
+}
+
+func NewInviteCodeRepository(db *sqlx.DB) IInviteCodeRepository {
+	return &inviteCodeRepository{db: db}
+}
+
+func (r *inviteCodeRepository) Create(ctx context.Context, c *entity.InviteCode) error {
+	c.CreatedAt = time.Now()
+
+	query := `INSERT INTO invite_code (
+		code_hash, note, max_uses, use_count, expires_at, created_by, created_at
+	) VALUES (:code_hash, :note, :max_uses, :use_count, :expires_at, :created_by, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, c)
+	if err != nil {
+		return err
+	}
+
+	c.ID = entity.InviteCodeID(id)
+	return nil
+}
+
+func (r *inviteCodeRepository) List(ctx context.Context) (entity.InviteCodes, error) {
+	query := `SELECT id, code_hash, note, max_uses, use_count, expires_at, revoked_at, created_by, created_at
+		FROM invite_code ORDER BY id DESC`
+	cs := entity.InviteCodes{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &cs, query); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return cs, nil
+}
+
+func (r *inviteCodeRepository) GetByHash(ctx context.Context, hash string) (*entity.InviteCode, error) {
+	query := `SELECT id, code_hash, note, max_uses, use_count, expires_at, revoked_at, created_by, created_at
+		FROM invite_code WHERE code_hash = ?`
+	c := &entity.InviteCode{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), c, r.db.Rebind(query), hash); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return c, nil
+}
+
+// 同時に登録された場合でも上限を超えないように、条件付きのUPDATEで増やす
+func (r *inviteCodeRepository) Consume(ctx context.Context, id entity.InviteCodeID) error {
+	query := `UPDATE invite_code SET use_count = use_count + 1
+		WHERE id = ? AND use_count < max_uses AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`
+	return r.execAffected(ctx, query, id, time.Now())
+}
+
+func (r *inviteCodeRepository) Revoke(ctx context.Context, id entity.InviteCodeID) error {
+	query := `UPDATE invite_code SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	return r.execAffected(ctx, query, time.Now(), id)
+}
+
+// 更新した行がない場合はsql.ErrNoRowsを返す
+func (r *inviteCodeRepository) execAffected(ctx context.Context, query string, args ...any) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ILoginHistoryRepository interface {
+	Create(ctx context.Context, h *entity.LoginHistory) error
+	ListByUserID(ctx context.Context, uid entity.UserID, limit int) (entity.LoginHistories, error)
+	CountClient(ctx context.Context, h *entity.LoginHistory) (*LoginClientCount, error)
+	GetLatestByUserID(ctx context.Context, uid entity.UserID) (*entity.LoginHistory, error)
+}
+
+// 過去のログインのうち、IPアドレスとUser-Agent、国がそれぞれ一致したものの件数
+type LoginClientCount struct {
+	Total         int64 `db:"total"`
+	SameIP        int64 `db:"same_ip"`
+	SameUserAgent int64 `db:"same_user_agent"`
+	SameCountry   int64 `db:"same_country"`
+}
+
+type loginHistoryRepository struct {
+	db *sqlx.DB
+}
+
+func NewLoginHistoryRepository(db *sqlx.DB) ILoginHistoryRepository {
+	return &loginHistoryRepository{db: db}
+}
+
+func (r *loginHistoryRepository) Create(ctx context.Context, h *entity.LoginHistory) error {
+	h.CreatedAt = time.Now()
+
+	query := `INSERT INTO login_history (
+		user_id, method, ip_address, user_agent, country, city, latitude, longitude, created_at
+	) VALUES (:user_id, :method, :ip_address, :user_agent, :country, :city, :latitude, :longitude, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, h)
+	if err != nil {
+		return err
+	}
+
+	h.ID = entity.LoginHistoryID(id)
+	return nil
+}
+
+// ユーザーのログイン履歴を新しいものから順にlimit件取得する
+func (r *loginHistoryRepository) ListByUserID(ctx context.Context, uid entity.UserID, limit int) (entity.LoginHistories, error) {
+	if limit <= 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	query := `SELECT id, user_id, method, ip_address, user_agent, country, city, latitude, longitude, created_at
+		FROM login_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	hs := entity.LoginHistories{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &hs, r.db.Rebind(query), uid, limit); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return hs, nil
+}
+
+// hと同じユーザーの過去のログインから、同じIPアドレスやUser-Agent、国のものを数える。h自身は数えない
+func (r *loginHistoryRepository) CountClient(ctx context.Context, h *entity.LoginHistory) (*LoginClientCount, error) {
+	query := `SELECT COUNT(*) AS total,
+			COALESCE(SUM(CASE WHEN ip_address = ? THEN 1 ELSE 0 END), 0) AS same_ip,
+			COALESCE(SUM(CASE WHEN user_agent = ? THEN 1 ELSE 0 END), 0) AS same_user_agent,
+			COALESCE(SUM(CASE WHEN country = ? THEN 1 ELSE 0 END), 0) AS same_country
+		FROM login_history WHERE user_id = ? AND id <> ?`
+	var c LoginClientCount
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), &c, r.db.Rebind(query), h.IPAddress, h.UserAgent, h.Country, h.UserID, h.ID); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return &c, nil
+}
+
+// ユーザーの最後のログインを取得する。ログインしたことがない場合はsql.ErrNoRowsを返す
+func (r *loginHistoryRepository) GetLatestByUserID(ctx context.Context, uid entity.UserID) (*entity.LoginHistory, error) {
+	query := `SELECT id, user_id, method, ip_address, user_agent, country, city, latitude, longitude, created_at
+		FROM login_history WHERE user_id = ? ORDER BY id DESC LIMIT 1`
+	var h entity.LoginHistory
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), &h, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return &h, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/logging"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 使用済みのマジックリンクのトークンを使おうとした
+var ErrMagicLinkUsed = errors.New("magic link already used")
+
+type IMagicLinkRepository interface {
+	Consume(ctx context.Context, jti string, exp time.Time) error
+}
+
+type magicLinkRepository struct {
+	db *sqlx.DB
+}
+
+func NewMagicLinkRepository(db *sqlx.DB) IMagicLinkRepository {
+	return &magicLinkRepository{db: db}
+}
+
+// マジックリンクのトークンを使用済みにする。すでに使用済みの場合はエラーを返す
+func (r *magicLinkRepository) Consume(ctx context.Context, jti string, exp time.Time) error {
+	// 有効期限の切れたトークンは再利用できないので削除しておく
+	res, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(`DELETE FROM used_magic_token WHERE expires_at < ?`), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		logging.FromContext(ctx).DebugContext(ctx, "deleted expired magic tokens", slog.Int64("count", n))
+	}
+
+	query := `INSERT INTO used_magic_token (jti, expires_at, created_at) VALUES (?, ?, ?)`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), jti, exp, time.Now()); err != nil {
+		if isDuplicateKey(err) {
+			// 使用済みのリンクが再度使われた。リンクの漏洩の可能性があるので記録しておく
+			logging.FromContext(ctx).WarnContext(ctx, "magic link reused", slog.String("jti", jti))
+			return ErrMagicLinkUsed
+		}
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
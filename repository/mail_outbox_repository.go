@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IMailOutboxRepository interface {
+	Create(ctx context.Context, m *entity.OutboxMail) error
+	ListPending(ctx context.Context, maxAttempts, limit int) (entity.OutboxMails, error)
+	MarkSent(ctx context.Context, id entity.OutboxMailID) error
+	MarkFailed(ctx context.Context, id entity.OutboxMailID, reason string, nextAttemptAt time.Time) error
+}
+
+type mailOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewMailOutboxRepository(db *sqlx.DB) IMailOutboxRepository {
+	return &mailOutboxRepository{db: db}
+}
+
+// 送信待ちのメールを保存する。ユーザーの更新と同じトランザクションで呼び出す
+func (r *mailOutboxRepository) Create(ctx context.Context, m *entity.OutboxMail) error {
+	m.CreatedAt = time.Now()
+
+	query := `INSERT INTO mail_outbox (
+		kind, recipient, token, link, created_at
+	) VALUES (:kind, :recipient, :token, :link, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, m)
+	if err != nil {
+		return err
+	}
+
+	m.ID = entity.OutboxMailID(id)
+	return nil
+}
+
+// 未送信で、送信の試行回数がmaxAttempts未満のメールのうち、再送する時刻になったものを古い順に取得する
+// maxAttempts回失敗したメールはデッドレターとして残しておく
+// トランザクション内では、複数のサーバーで同じメールを送らないように取得した行をロックする
+func (r *mailOutboxRepository) ListPending(ctx context.Context, maxAttempts, limit int) (entity.OutboxMails, error) {
+	query := `SELECT id, kind, recipient, token, link, attempts, last_error, next_attempt_at, sent_at, created_at
+		FROM mail_outbox WHERE sent_at IS NULL AND attempts < ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		ORDER BY id LIMIT ?`
+	if inTx(ctx) {
+		query += dialectOf(r.db).forUpdateSkipLocked()
+	}
+	ms := entity.OutboxMails{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ms, r.db.Rebind(query), maxAttempts, time.Now(), limit); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ms, nil
+}
+
+func (r *mailOutboxRepository) MarkSent(ctx context.Context, id entity.OutboxMailID) error {
+	query := `UPDATE mail_outbox SET sent_at = ?, token = '', link = '' WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), time.Now(), id); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
+
+// 送信に失敗した回数を増やして、最後のエラーと次に送信する時刻を記録する
+func (r *mailOutboxRepository) MarkFailed(ctx context.Context, id entity.OutboxMailID, reason string, nextAttemptAt time.Time) error {
+	// last_errorのカラムの長さに収める。途中で切れたマルチバイト文字は削除する
+	if len(reason) > 255 {
+		reason = strings.ToValidUTF8(reason[:255], "")
+	}
+	query := `UPDATE mail_outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), reason, nextAttemptAt, id); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
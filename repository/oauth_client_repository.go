@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IOAuthClientRepository interface {
+	Create(ctx context.Context, cl *entity.OAuthClient) error
+	Get(ctx context.Context, id string) (*entity.OAuthClient, error)
+}
+
+type oauthClientRepository struct {
+	db *sqlx.DB
+}
+
+func NewOAuthClientRepository(db *sqlx.DB) IOAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(ctx context.Context, cl *entity.OAuthClient) error {
+	cl.CreatedAt = time.Now()
+
+	query := `INSERT INTO oauth_client (
+		id, name, secret_hash, scopes, redirect_uris, created_at
+	) VALUES (:id, :name, :secret_hash, :scopes, :redirect_uris, :created_at)`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, cl); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// クライアントを取得する。存在しない場合はsql.ErrNoRowsを返す
+func (r *oauthClientRepository) Get(ctx context.Context, id string) (*entity.OAuthClient, error) {
+	query := `SELECT id, name, secret_hash, scopes, redirect_uris, created_at FROM oauth_client WHERE id = ?`
+	cl := &entity.OAuthClient{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), cl, r.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return cl, nil
+}
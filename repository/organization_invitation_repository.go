@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IOrganizationInvitationRepository interface {
+	Create(ctx context.Context, i *entity.OrganizationInvitation) error
+	// トークンのハッシュで取得する。存在しない場合はsql.ErrNoRowsを返す
+	GetByHash(ctx context.Context, hash string) (*entity.OrganizationInvitation, error)
+	// 承諾済みにする。すでに承諾済みの場合はsql.ErrNoRowsを返す
+	MarkAccepted(ctx context.Context, id entity.OrganizationInvitationID) error
+	// 同じemailへの、まだ承諾していない招待を削除する。招待し直した場合は古いリンクを使えなくする
+	DeletePending(ctx context.Context, orgID entity.OrganizationID, email string) error
+}
+
+type organizationInvitationRepository struct {
+	db *sqlx.DB
+}
+
+func NewOrganizationInvitationRepository(db *sqlx.DB) IOrganizationInvitationRepository {
+	return &organizationInvitationRepository{db: db}
+}
+
+func (r *organizationInvitationRepository) Create(ctx context.Context, i *entity.OrganizationInvitation) error {
+	i.CreatedAt = time.Now()
+
+	query := `INSERT INTO organization_invitation (
+		organization_id, email, role, token_hash, invited_by, expires_at, created_at
+	) VALUES (:organization_id, :email, :role, :token_hash, :invited_by, :expires_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, i)
+	if err != nil {
+		return err
+	}
+
+	i.ID = entity.OrganizationInvitationID(id)
+	return nil
+}
+
+func (r *organizationInvitationRepository) GetByHash(ctx context.Context, hash string) (*entity.OrganizationInvitation, error) {
+	query := `SELECT id, organization_id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at
+		FROM organization_invitation WHERE token_hash = ?`
+	i := &entity.OrganizationInvitation{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), i, r.db.Rebind(query), hash); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return i, nil
+}
+
+func (r *organizationInvitationRepository) MarkAccepted(ctx context.Context, id entity.OrganizationInvitationID) error {
+	query := `UPDATE organization_invitation SET accepted_at = ? WHERE id = ? AND accepted_at IS NULL`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *organizationInvitationRepository) DeletePending(ctx context.Context, orgID entity.OrganizationID, email string) error {
+	query := `DELETE FROM organization_invitation WHERE organization_id = ? AND email = ? AND accepted_at IS NULL`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), orgID, email); err != nil {
+		return fmt.Errorf("failed to delete organization invitation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// すでに組織のメンバーになっているユーザーを追加しようとした
+var ErrAlreadyMember = errors.New("already a member of the organization")
+
+type IOrganizationRepository interface {
+	Create(ctx context.Context, o *entity.Organization) error
+	Get(ctx context.Context, id entity.OrganizationID) (*entity.Organization, error)
+	// ユーザーが所属する組織を、作成した順に取得する
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.Memberships, error)
+	AddMember(ctx context.Context, m *entity.OrganizationMember) error
+	GetMember(ctx context.Context, id entity.OrganizationID, uid entity.UserID) (*entity.OrganizationMember, error)
+	ListMembers(ctx context.Context, id entity.OrganizationID) (entity.OrganizationMembers, error)
+	RemoveMember(ctx context.Context, id entity.OrganizationID, uid entity.UserID) error
+	CountMembersByRole(ctx context.Context, id entity.OrganizationID, role entity.OrganizationRole) (int64, error)
+}
+
+type organizationRepository struct {
+	db *sqlx.DB
+	// メンバーのemailを取得するためにJOINするユーザーのテーブル
+	userTable string
+}
+
+func NewOrganizationRepository(db *sqlx.DB) IOrganizationRepository {
+	return &organizationRepository{db: db, userTable: dialectOf(db).table("user")}
+}
+
+func (r *organizationRepository) Create(ctx context.Context, o *entity.Organization) error {
+	o.CreatedAt = time.Now()
+	o.UpdatedAt = o.CreatedAt
+
+	query := `INSERT INTO organization (name, created_at, updated_at) VALUES (:name, :created_at, :updated_at)`
+	id, err := insertReturningID(ctx, r.db, query, o)
+	if err != nil {
+		return err
+	}
+
+	o.ID = entity.OrganizationID(id)
+	return nil
+}
+
+// 存在しない場合はsql.ErrNoRowsを返す
+func (r *organizationRepository) Get(ctx context.Context, id entity.OrganizationID) (*entity.Organization, error) {
+	query := `SELECT id, name, created_at, updated_at FROM organization WHERE id = ?`
+	o := &entity.Organization{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), o, r.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return o, nil
+}
+
+func (r *organizationRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.Memberships, error) {
+	query := `SELECT o.id, o.name, o.created_at, o.updated_at, m.role
+		FROM organization o JOIN organization_member m ON m.organization_id = o.id
+		WHERE m.user_id = ? ORDER BY o.id`
+	ms := entity.Memberships{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ms, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ms, nil
+}
+
+func (r *organizationRepository) AddMember(ctx context.Context, m *entity.OrganizationMember) error {
+	m.CreatedAt = time.Now()
+
+	query := `INSERT INTO organization_member (organization_id, user_id, role, created_at)
+		VALUES (:organization_id, :user_id, :role, :created_at)`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, m); err != nil {
+		if isDuplicateKey(err) {
+			return ErrAlreadyMember
+		}
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// メンバーでない場合はsql.ErrNoRowsを返す
+func (r *organizationRepository) GetMember(ctx context.Context, id entity.OrganizationID, uid entity.UserID) (*entity.OrganizationMember, error) {
+	query := `SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_member m JOIN ` + r.userTable + ` u ON u.id = m.user_id
+		WHERE m.organization_id = ? AND m.user_id = ? AND u.deleted_at IS NULL`
+	m := &entity.OrganizationMember{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), m, r.db.Rebind(query), id, uid); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return m, nil
+}
+
+// 退会したユーザーは含めない
+func (r *organizationRepository) ListMembers(ctx context.Context, id entity.OrganizationID) (entity.OrganizationMembers, error) {
+	query := `SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		FROM organization_member m JOIN ` + r.userTable + ` u ON u.id = m.user_id
+		WHERE m.organization_id = ? AND u.deleted_at IS NULL ORDER BY m.created_at, m.user_id`
+	ms := entity.OrganizationMembers{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ms, r.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ms, nil
+}
+
+func (r *organizationRepository) RemoveMember(ctx context.Context, id entity.OrganizationID, uid entity.UserID) error {
+	query := `DELETE FROM organization_member WHERE organization_id = ? AND user_id = ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), id, uid)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization member: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *organizationRepository) CountMembersByRole(ctx context.Context, id entity.OrganizationID, role entity.OrganizationRole) (int64, error) {
+	query := `SELECT COUNT(*) FROM organization_member WHERE organization_id = ? AND role = ?`
+	var n int64
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), &n, r.db.Rebind(query), id, role); err != nil {
+		return 0, fmt.Errorf("failed to count: %w", err)
+	}
+	return n, nil
+}
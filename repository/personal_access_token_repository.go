@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IPersonalAccessTokenRepository interface {
+	Create(ctx context.Context, t *entity.PersonalAccessToken) error
+	GetByHash(ctx context.Context, hash string) (*entity.PersonalAccessToken, error)
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.PersonalAccessTokens, error)
+	Touch(ctx context.Context, id entity.PersonalAccessTokenID) error
+	Delete(ctx context.Context, uid entity.UserID, id entity.PersonalAccessTokenID) error
+}
+
+type personalAccessTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewPersonalAccessTokenRepository(db *sqlx.DB) IPersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{db: db}
+}
+
+func (r *personalAccessTokenRepository) Create(ctx context.Context, t *entity.PersonalAccessToken) error {
+	t.CreatedAt = time.Now()
+
+	query := `INSERT INTO personal_access_token (
+		user_id, name, token_hash, scopes, expires_at, created_at
+	) VALUES (:user_id, :name, :token_hash, :scopes, :expires_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, t)
+	if err != nil {
+		return err
+	}
+
+	t.ID = entity.PersonalAccessTokenID(id)
+	return nil
+}
+
+// トークンのハッシュで取得する。存在しない場合はsql.ErrNoRowsを返す
+func (r *personalAccessTokenRepository) GetByHash(ctx context.Context, hash string) (*entity.PersonalAccessToken, error) {
+	query := `SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_token WHERE token_hash = ?`
+	t := &entity.PersonalAccessToken{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), t, r.db.Rebind(query), hash); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return t, nil
+}
+
+// ユーザーのトークンを、新しいものから順に取得する。期限切れのトークンも含む
+func (r *personalAccessTokenRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.PersonalAccessTokens, error) {
+	query := `SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_token WHERE user_id = ? ORDER BY id DESC`
+	ts := entity.PersonalAccessTokens{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ts, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ts, nil
+}
+
+// トークンの最終利用日時を更新する
+func (r *personalAccessTokenRepository) Touch(ctx context.Context, id entity.PersonalAccessTokenID) error {
+	query := `UPDATE personal_access_token SET last_used_at = ? WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), time.Now(), id); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
+
+// ユーザーのトークンを削除する。他のユーザーのトークンは削除できない
+func (r *personalAccessTokenRepository) Delete(ctx context.Context, uid entity.UserID, id entity.PersonalAccessTokenID) error {
+	query := `DELETE FROM personal_access_token WHERE id = ? AND user_id = ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), id, uid)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal access token: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
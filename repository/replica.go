@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type primaryKey struct{}
+
+// 以降の読み込みをレプリカではなくプライマリで行う
+// 書き込んだ直後に読み込む場合など、レプリカの遅延で古い値を読むと困る場合に使う
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	force, _ := ctx.Value(primaryKey{}).(bool)
+	return force
+}
+
+// 読み込みを振り分けるレプリカ。ラウンドロビンで選ぶ
+type replicaSet struct {
+	dbs  []*sqlx.DB
+	next atomic.Uint64
+}
+
+// 読み込みに使う接続を返す
+// レプリカがない場合、トランザクション中の場合、WithPrimaryが指定された場合はプライマリを使う
+func (rs *replicaSet) conn(ctx context.Context, primary *sqlx.DB) sqlx.ExtContext {
+	if len(rs.dbs) == 0 || inTx(ctx) {
+		return conn(ctx, primary)
+	}
+	if usePrimary(ctx) {
+		return primary
+	}
+	i := rs.next.Add(1) % uint64(len(rs.dbs))
+	return rs.dbs[i]
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ISessionRepository interface {
+	Create(ctx context.Context, s *entity.Session) error
+	Get(ctx context.Context, id entity.SessionID) (*entity.Session, error)
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.Sessions, error)
+	Touch(ctx context.Context, id entity.SessionID) error
+	Delete(ctx context.Context, uid entity.UserID, id entity.SessionID) error
+	DeleteByUserID(ctx context.Context, uid entity.UserID) error
+}
+
+type sessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(db *sqlx.DB) ISessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, s *entity.Session) error {
+	s.CreatedAt = time.Now()
+	s.LastUsedAt = s.CreatedAt
+
+	query := `INSERT INTO session (
+		id, user_id, ip_address, user_agent, expires_at, last_used_at, created_at
+	) VALUES (:id, :user_id, :ip_address, :user_agent, :expires_at, :last_used_at, :created_at)`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, s); err != nil {
+		return fmt.Errorf("failed to Exec: %w", err)
+	}
+	return nil
+}
+
+// セッションを取得する。存在しない場合はsql.ErrNoRowsを返す
+func (r *sessionRepository) Get(ctx context.Context, id entity.SessionID) (*entity.Session, error) {
+	query := `SELECT id, user_id, ip_address, user_agent, expires_at, last_used_at, created_at
+		FROM session WHERE id = ?`
+	s := &entity.Session{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), s, r.db.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return s, nil
+}
+
+// ユーザーの有効なセッションを、最後に使われたものから順に取得する
+func (r *sessionRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.Sessions, error) {
+	query := `SELECT id, user_id, ip_address, user_agent, expires_at, last_used_at, created_at
+		FROM session WHERE user_id = ? AND expires_at > ? ORDER BY last_used_at DESC`
+	ss := entity.Sessions{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ss, r.db.Rebind(query), uid, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ss, nil
+}
+
+// セッションの最終利用日時を更新する
+func (r *sessionRepository) Touch(ctx context.Context, id entity.SessionID) error {
+	query := `UPDATE session SET last_used_at = ? WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), time.Now(), id); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
+
+// ユーザーのセッションを削除する。他のユーザーのセッションは削除できない
+func (r *sessionRepository) Delete(ctx context.Context, uid entity.UserID, id entity.SessionID) error {
+	query := `DELETE FROM session WHERE id = ? AND user_id = ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), id, uid)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ユーザーの全てのセッションを削除する
+func (r *sessionRepository) DeleteByUserID(ctx context.Context, uid entity.UserID) error {
+	query := `DELETE FROM session WHERE user_id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), uid); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ITrustedDeviceRepository interface {
+	Create(ctx context.Context, d *entity.TrustedDevice) error
+	Get(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) (*entity.TrustedDevice, error)
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.TrustedDevices, error)
+	Rename(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID, name string) error
+	Touch(ctx context.Context, id entity.TrustedDeviceID) error
+	Delete(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) error
+}
+
+type trustedDeviceRepository struct {
+	db *sqlx.DB
+}
+
+func NewTrustedDeviceRepository(db *sqlx.DB) ITrustedDeviceRepository {
+	return &trustedDeviceRepository{db: db}
+}
+
+func (r *trustedDeviceRepository) Create(ctx context.Context, d *entity.TrustedDevice) error {
+	d.CreatedAt = time.Now()
+
+	query := `INSERT INTO trusted_device (
+		user_id, name, ip_address, user_agent, expires_at, created_at
+	) VALUES (:user_id, :name, :ip_address, :user_agent, :expires_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, d)
+	if err != nil {
+		return err
+	}
+
+	d.ID = entity.TrustedDeviceID(id)
+	return nil
+}
+
+// ユーザーの端末を取得する。他のユーザーの端末の場合はsql.ErrNoRowsを返す
+func (r *trustedDeviceRepository) Get(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) (*entity.TrustedDevice, error) {
+	query := `SELECT id, user_id, name, ip_address, user_agent, expires_at, last_used_at, created_at
+		FROM trusted_device WHERE id = ? AND user_id = ?`
+	d := &entity.TrustedDevice{}
+	if err := sqlx.GetContext(ctx, conn(ctx, r.db), d, r.db.Rebind(query), id, uid); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return d, nil
+}
+
+// ユーザーの端末を、新しいものから順に取得する。期限切れの端末も含む
+func (r *trustedDeviceRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.TrustedDevices, error) {
+	query := `SELECT id, user_id, name, ip_address, user_agent, expires_at, last_used_at, created_at
+		FROM trusted_device WHERE user_id = ? ORDER BY id DESC`
+	ds := entity.TrustedDevices{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &ds, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return ds, nil
+}
+
+// ユーザーの端末の名前を変更する。他のユーザーの端末は変更できない
+func (r *trustedDeviceRepository) Rename(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID, name string) error {
+	query := `UPDATE trusted_device SET name = ? WHERE id = ? AND user_id = ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), name, id, uid)
+	if err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// 端末の最終利用日時を更新する
+func (r *trustedDeviceRepository) Touch(ctx context.Context, id entity.TrustedDeviceID) error {
+	query := `UPDATE trusted_device SET last_used_at = ? WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), time.Now(), id); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
+
+// ユーザーの端末を削除する。他のユーザーの端末は削除できない
+func (r *trustedDeviceRepository) Delete(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) error {
+	query := `DELETE FROM trusted_device WHERE id = ? AND user_id = ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), id, uid)
+	if err != nil {
+		return fmt.Errorf("failed to delete trusted device: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
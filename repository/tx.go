@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// 複数のリポジトリの操作を1つのトランザクションで実行する
+// トランザクションはctxで引き回すので、fnの中ではfnに渡されたctxでリポジトリを呼び出す
+type ITransactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactor struct {
+	db *sqlx.DB
+}
+
+func NewTransactor(db *sqlx.DB) ITransactor {
+	return &transactor{db: db}
+}
+
+type txKey struct{}
+
+// ctxで引き回すトランザクションと、コミットした後に実行する処理
+type txState struct {
+	tx          *sqlx.Tx
+	afterCommit []func(ctx context.Context)
+}
+
+// fnがエラーを返した場合とpanicした場合はロールバックする
+// すでにトランザクション中の場合は、新しく開始せずにそのトランザクションで実行する
+func (t *transactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if inTx(ctx) {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	st := &txState{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, st)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	for _, f := range st.afterCommit {
+		f(ctx)
+	}
+	return nil
+}
+
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// トランザクション中の場合は、fnをコミットした後に実行するように登録してtrueを返す。ロールバックした場合は実行しない
+// トランザクション中でない場合は、何もせずにfalseを返す
+func afterCommit(ctx context.Context, fn func(ctx context.Context)) bool {
+	st, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return false
+	}
+	st.afterCommit = append(st.afterCommit, fn)
+	return true
+}
+
+// ctxにトランザクションがあればトランザクションを、なければDBを返す
+// リポジトリはクエリを実行する時に必ずこれを使う
+func conn(ctx context.Context, db *sqlx.DB) sqlx.ExtContext {
+	if st, ok := ctx.Value(txKey{}).(*txState); ok {
+		return st.tx
+	}
+	return db
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IDからユーザーを引くためのキャッシュ
+// パスワードのハッシュや確認用トークンなどの秘密の値は保存しないので、それらを検証する場合はWithPrimaryでDBから取得する
+type IUserCache interface {
+	// キャッシュにない場合はnilを返す
+	Get(ctx context.Context, uid entity.UserID) (*entity.User, error)
+	Set(ctx context.Context, u *entity.User) error
+	Delete(ctx context.Context, uid entity.UserID) error
+}
+
+// IUserRepositoryのGetの結果をキャッシュするデコレーター
+// 認証が必要なリクエストは必ずユーザーを取得するので、DBへの問い合わせを減らす
+// ユーザーを更新するメソッドは、更新後にキャッシュを削除する
+type cachedUserRepository struct {
+	IUserRepository
+	cache IUserCache
+}
+
+func NewCachedUserRepository(ur IUserRepository, cache IUserCache) IUserRepository {
+	return &cachedUserRepository{IUserRepository: ur, cache: cache}
+}
+
+func (r *cachedUserRepository) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	// トランザクション中はコミット前の値をキャッシュしないように、DBから取得する
+	// WithPrimaryが指定された場合も、最新の値が必要なのでDBから取得する
+	if inTx(ctx) || usePrimary(ctx) {
+		return r.IUserRepository.Get(ctx, uid)
+	}
+
+	// キャッシュの障害でログインできなくならないように、キャッシュのエラーは無視してDBから取得する
+	if u, err := r.cache.Get(ctx, uid); err == nil && u != nil {
+		return u, nil
+	}
+	u, err := r.IUserRepository.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.cache.Set(ctx, withoutSecrets(u))
+	return u, nil
+}
+
+// Redisなどの外部のキャッシュに漏れても困らないように、秘密の値を除いたコピーを返す
+func withoutSecrets(u *entity.User) *entity.User {
+	cp := *u
+	cp.Password = ""
+	cp.Salt = ""
+	cp.ActivateToken = ""
+	cp.PendingEmailToken = ""
+	cp.PendingPhoneCode = ""
+	cp.SmsLoginCode = ""
+	return &cp
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.Delete(ctx, u))
+}
+
+func (r *cachedUserRepository) Purge(ctx context.Context, id entity.UserID) error {
+	return r.invalidate(ctx, id, r.IUserRepository.Purge(ctx, id))
+}
+
+func (r *cachedUserRepository) Activate(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.Activate(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateActivateToken(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateActivateToken(ctx, u))
+}
+
+func (r *cachedUserRepository) IncrementActivateAttempts(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.IncrementActivateAttempts(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdatePassword(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdatePassword(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdatePasswordHash(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdatePasswordHash(ctx, u))
+}
+
+func (r *cachedUserRepository) RequestEmailChange(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.RequestEmailChange(ctx, u))
+}
+
+func (r *cachedUserRepository) IncrementEmailChangeAttempts(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.IncrementEmailChangeAttempts(ctx, u))
+}
+
+func (r *cachedUserRepository) ConfirmEmailChange(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.ConfirmEmailChange(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateEmailKey(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateEmailKey(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateEmailStatus(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateEmailStatus(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateState(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateState(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateProfile(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateProfile(ctx, u))
+}
+
+func (r *cachedUserRepository) RequestPhoneChange(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.RequestPhoneChange(ctx, u))
+}
+
+func (r *cachedUserRepository) IncrementPhoneAttempts(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.IncrementPhoneAttempts(ctx, u))
+}
+
+func (r *cachedUserRepository) ConfirmPhoneChange(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.ConfirmPhoneChange(ctx, u))
+}
+
+func (r *cachedUserRepository) DeletePhone(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.DeletePhone(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateSmsLoginCode(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateSmsLoginCode(ctx, u))
+}
+
+func (r *cachedUserRepository) IncrementSmsLoginAttempts(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.IncrementSmsLoginAttempts(ctx, u))
+}
+
+func (r *cachedUserRepository) ConsumeSmsLoginCode(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.ConsumeSmsLoginCode(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateAvatar(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateAvatar(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateNotifyOnLogin(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateNotifyOnLogin(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdateUsername(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdateUsername(ctx, u))
+}
+
+func (r *cachedUserRepository) UpdatePreferences(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.UpdatePreferences(ctx, u))
+}
+
+func (r *cachedUserRepository) RevokeTokens(ctx context.Context, u *entity.User) error {
+	return r.invalidate(ctx, u.ID, r.IUserRepository.RevokeTokens(ctx, u))
+}
+
+func (r *cachedUserRepository) Restore(ctx context.Context, uid entity.UserID, deletedSince time.Time) error {
+	return r.invalidate(ctx, uid, r.IUserRepository.Restore(ctx, uid, deletedSince))
+}
+
+// 更新に失敗した場合も、DBの状態が分からないのでキャッシュは削除する
+// キャッシュの削除に失敗すると古い値を返し続けるので、その場合はエラーにする
+// トランザクション中は、コミット前に削除しても他のリクエストが古い値をキャッシュし直すので、コミットした後に削除する
+func (r *cachedUserRepository) invalidate(ctx context.Context, uid entity.UserID, err error) error {
+	if afterCommit(ctx, func(ctx context.Context) {
+		if cerr := r.cache.Delete(ctx, uid); cerr != nil {
+			// コミット済みなので、呼び出し元には返さずにログだけ出す
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to delete cached user", slog.Any("user_id", uid), logging.Err(cerr))
+		}
+	}) {
+		return err
+	}
+	if cerr := r.cache.Delete(ctx, uid); cerr != nil {
+		return errors.Join(err, cerr)
+	}
+	return err
+}
+
+type memoryUserCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[entity.UserID]*list.Element
+}
+
+type memoryUserCacheItem struct {
+	u   *entity.User
+	exp time.Time
+}
+
+// 単一のサーバーで動かす場合のインメモリのLRUキャッシュ。sizeを超えたら最も古く使われたユーザーから削除する
+func NewMemoryUserCache(size int, ttl time.Duration) IUserCache {
+	return &memoryUserCache{size: size, ttl: ttl, ll: list.New(), items: map[entity.UserID]*list.Element{}}
+}
+
+func (c *memoryUserCache) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[uid]
+	if !ok {
+		return nil, nil
+	}
+	item := e.Value.(*memoryUserCacheItem)
+	if !item.exp.After(time.Now()) {
+		c.ll.Remove(e)
+		delete(c.items, uid)
+		return nil, nil
+	}
+	c.ll.MoveToFront(e)
+	// 呼び出し元が変更してもキャッシュに影響しないようにコピーを返す
+	u := *item.u
+	return &u, nil
+}
+
+func (c *memoryUserCache) Set(ctx context.Context, u *entity.User) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp := *u
+	item := &memoryUserCacheItem{u: &cp, exp: time.Now().Add(c.ttl)}
+	if e, ok := c.items[u.ID]; ok {
+		e.Value = item
+		c.ll.MoveToFront(e)
+		return nil
+	}
+	c.items[u.ID] = c.ll.PushFront(item)
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryUserCacheItem).u.ID)
+	}
+	return nil
+}
+
+func (c *memoryUserCache) Delete(ctx context.Context, uid entity.UserID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[uid]; ok {
+		c.ll.Remove(e)
+		delete(c.items, uid)
+	}
+	return nil
+}
+
+type redisUserCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// 複数のサーバーでキャッシュを共有する場合のRedisのキャッシュ
+func NewRedisUserCache(client *redis.Client, ttl time.Duration) IUserCache {
+	return &redisUserCache{client: client, ttl: ttl}
+}
+
+func (c *redisUserCache) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	b, err := c.client.Get(ctx, userCacheKey(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get cached user: %w", err)
+	}
+	u := &entity.User{}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached user: %w", err)
+	}
+	return u, nil
+}
+
+func (c *redisUserCache) Set(ctx context.Context, u *entity.User) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+	if err := c.client.Set(ctx, userCacheKey(u.ID), b, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache user: %w", err)
+	}
+	return nil
+}
+
+func (c *redisUserCache) Delete(ctx context.Context, uid entity.UserID) error {
+	if err := c.client.Del(ctx, userCacheKey(uid)).Err(); err != nil {
+		return fmt.Errorf("failed to delete cached user: %w", err)
+	}
+	return nil
+}
+
+func userCacheKey(uid entity.UserID) string {
+	return "user:" + strconv.FormatUint(uint64(uid), 10)
+}
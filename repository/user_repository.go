@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"login-example/entity"
 	"time"
@@ -9,20 +11,130 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// SELECTで取得するuserテーブルのカラム
+const userColumns = `id, email, email_key, username, password, salt, state, role, name, display_name, bio, avatar_url, activate_token, activate_attempts, token_revoked_at, token_version,
+		pending_email, pending_email_token, pending_email_requested_at, pending_email_attempts, phone, pending_phone, pending_phone_code, pending_phone_requested_at, pending_phone_attempts,
+		sms_login_code, sms_login_code_sent_at, sms_login_attempts, email_status, email_status_at, notify_on_login, locale, timezone, notify_on_new_client, provisioned_by, deleted_at, state_before_delete, version, updated_at, created_at`
+
+// 読み込んだ後に、他のリクエストでユーザーが更新されていた
+var ErrVersionConflict = errors.New("user was modified concurrently")
+
+// 他のユーザーが使っているusername。退会済みのユーザーのものも含む
+var ErrUsernameTaken = errors.New("username already taken")
+
+// 他のユーザーと正規化したemailが同じ。退会済みのユーザーのものも含む
+var ErrEmailTaken = errors.New("email already taken")
+
 type IUserRepository interface {
 	PreRegister(ctx context.Context, u *entity.User) error
+	Register(ctx context.Context, u *entity.User) error
 	GetByEmail(ctx context.Context, email string) (*entity.User, error)
-	Delete(ctx context.Context, id entity.UserID) error
+	GetByEmailKey(ctx context.Context, key string) (*entity.User, error)
+	ListEmailKeys(ctx context.Context, after entity.UserID, limit int) (entity.Users, error)
+	UpdateEmailKey(ctx context.Context, u *entity.User) error
+	Delete(ctx context.Context, u *entity.User) error
+	Purge(ctx context.Context, id entity.UserID) error
 	Activate(ctx context.Context, u *entity.User) error
 	Get(ctx context.Context, uid entity.UserID) (*entity.User, error)
+	List(ctx context.Context, opts ListOptions) (entity.Users, int64, error)
+	UpdateActivateToken(ctx context.Context, u *entity.User) error
+	IncrementActivateAttempts(ctx context.Context, u *entity.User) error
+	UpdatePassword(ctx context.Context, u *entity.User) error
+	UpdatePasswordHash(ctx context.Context, u *entity.User) error
+	RequestEmailChange(ctx context.Context, u *entity.User) error
+	IncrementEmailChangeAttempts(ctx context.Context, u *entity.User) error
+	ConfirmEmailChange(ctx context.Context, u *entity.User) error
+	GetByPhone(ctx context.Context, phone string) (*entity.User, error)
+	GetByUsername(ctx context.Context, username string) (*entity.User, error)
+	UpdateUsername(ctx context.Context, u *entity.User) error
+	RequestPhoneChange(ctx context.Context, u *entity.User) error
+	IncrementPhoneAttempts(ctx context.Context, u *entity.User) error
+	ConfirmPhoneChange(ctx context.Context, u *entity.User) error
+	DeletePhone(ctx context.Context, u *entity.User) error
+	UpdateSmsLoginCode(ctx context.Context, u *entity.User) error
+	IncrementSmsLoginAttempts(ctx context.Context, u *entity.User) error
+	ConsumeSmsLoginCode(ctx context.Context, u *entity.User) error
+	UpdateEmailStatus(ctx context.Context, u *entity.User) error
+	UpdateState(ctx context.Context, u *entity.User) error
+	UpdateNotifyOnLogin(ctx context.Context, u *entity.User) error
+	UpdatePreferences(ctx context.Context, u *entity.User) error
+	UpdateProfile(ctx context.Context, u *entity.User) error
+	UpdateAvatar(ctx context.Context, u *entity.User) error
+	RevokeTokens(ctx context.Context, u *entity.User) error
+	Restore(ctx context.Context, uid entity.UserID, deletedSince time.Time) error
+	PurgeOlderThan(ctx context.Context, before time.Time) (int64, error)
+}
+
+type UserSortKey string
+
+const (
+	SortByID        = UserSortKey("id")
+	SortByEmail     = UserSortKey("email")
+	SortByCreatedAt = UserSortKey("created_at")
+	SortByUpdatedAt = UserSortKey("updated_at")
+)
+
+type SortOrder string
+
+const (
+	SortAsc  = SortOrder("ASC")
+	SortDesc = SortOrder("DESC")
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// ユーザー一覧を取得する時の条件
+type ListOptions struct {
+	Limit     int
+	Offset    int
+	SortBy    UserSortKey
+	SortOrder SortOrder
+	// 空の場合は退会済み以外の全てのstateのユーザーを取得する
+	State entity.UserState
+	// 空の場合はemailの状態で絞り込まない
+	EmailStatus entity.EmailStatus
+	// 空の場合はユーザーを作成したディレクトリで絞り込まない
+	ProvisionedBy string
+}
+
+// 不正な値をデフォルト値に置き換える。SortByとSortOrderはSQLに埋め込むので必ず検証する
+func (o ListOptions) Normalize() ListOptions {
+	if o.Limit <= 0 {
+		o.Limit = defaultListLimit
+	}
+	if o.Limit > maxListLimit {
+		o.Limit = maxListLimit
+	}
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+	switch o.SortBy {
+	case SortByID, SortByEmail, SortByCreatedAt, SortByUpdatedAt:
+	default:
+		o.SortBy = SortByID
+	}
+	switch o.SortOrder {
+	case SortAsc, SortDesc:
+	default:
+		o.SortOrder = SortAsc
+	}
+	return o
 }
 
 type userRepository struct {
 	db *sqlx.DB
+	// GetByEmail, Get, Listの読み込みはレプリカに振り分ける
+	replicas *replicaSet
+	// userはPostgreSQLの予約語なので、方言に合わせてクォートしたテーブル名を使う
+	table string
 }
 
-func NewUserRepository(db *sqlx.DB) IUserRepository {
-	return &userRepository{db: db}
+// dbはプライマリ。replicasを指定した場合は、読み込みをレプリカに振り分ける
+func NewUserRepository(db *sqlx.DB, replicas ...*sqlx.DB) IUserRepository {
+	return &userRepository{db: db, replicas: &replicaSet{dbs: replicas}, table: dialectOf(db).table("user")}
 }
 
 // ユーザーをstate=inactiveで保存する
@@ -30,17 +142,53 @@ func (r *userRepository) PreRegister(ctx context.Context, u *entity.User) error
 	u.UpdatedAt = time.Now()
 	u.CreatedAt = time.Now()
 	u.State = entity.UserInactive
+	u.EmailStatus = entity.EmailDeliverable
+	u.NotifyOnNewClient = true
+	u.Version = 1
+	if u.Role == "" {
+		u.Role = entity.RoleUser
+	}
+	if u.EmailKey == "" {
+		u.EmailKey = u.Email
+	}
 
-	query := `INSERT INTO user (
-		email, password, salt, activate_token, state, updated_at, created_at
-	) VALUES (:email, :password, :salt, :activate_token, :state, :updated_at, :created_at)`
-	result, err := r.db.NamedExecContext(ctx, query, u)
-	if err != nil {
-		return fmt.Errorf("failed to Exec: %w", err)
+	query := `INSERT INTO ` + r.table + ` (
+		email, email_key, password, salt, activate_token, state, role, notify_on_new_client, updated_at, created_at
+	) VALUES (:email, :email_key, :password, :salt, :activate_token, :state, :role, :notify_on_new_client, :updated_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, u)
+	if isDuplicateKey(err) {
+		return ErrEmailTaken
+	} else if err != nil {
+		return err
 	}
-	id, err := result.LastInsertId()
-	if err != nil {
-		return fmt.Errorf("failed to LastInsertId: %w", err)
+
+	u.ID = entity.UserID(id)
+	return nil
+}
+
+// 本人確認済みのユーザーをstate=activeで保存する
+func (r *userRepository) Register(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.CreatedAt = time.Now()
+	u.State = entity.UserActive
+	u.EmailStatus = entity.EmailDeliverable
+	u.NotifyOnNewClient = true
+	u.Version = 1
+	if u.Role == "" {
+		u.Role = entity.RoleUser
+	}
+	if u.EmailKey == "" {
+		u.EmailKey = u.Email
+	}
+
+	query := `INSERT INTO ` + r.table + ` (
+		email, email_key, password, salt, activate_token, state, role, notify_on_new_client, provisioned_by, updated_at, created_at
+	) VALUES (:email, :email_key, :password, :salt, :activate_token, :state, :role, :notify_on_new_client, :provisioned_by, :updated_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, u)
+	if isDuplicateKey(err) {
+		return ErrEmailTaken
+	} else if err != nil {
+		return err
 	}
 
 	u.ID = entity.UserID(id)
@@ -48,23 +196,70 @@ func (r *userRepository) PreRegister(ctx context.Context, u *entity.User) error
 }
 
 // emailからユーザーを取得する、対象のユーザーが存在しなかった場合、user=nilではないので注意
+// 退会済みのユーザーは取得しない
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
-	query := `SELECT 
-		id, email, password, salt, state, activate_token, updated_at, created_at
-		FROM user WHERE email = ?`
+	query := `SELECT ` + userColumns + `
+		FROM ` + r.table + ` WHERE email = ? AND deleted_at IS NULL`
 	u := &entity.User{}
 	// 対象のユーザーが存在しない場合、sql.ErrNoRowsがエラーで返ってくる
-	if err := r.db.GetContext(ctx, u, query, email); err != nil {
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), u, r.db.Rebind(query), email); err != nil {
 		return nil, fmt.Errorf("failed to get: %w", err)
 	}
 	return u, nil
 }
 
-// ユーザーを削除する
-func (r *userRepository) Delete(ctx context.Context, id entity.UserID) error {
-	query := `DELETE FROM user WHERE id = ?`
+// 正規化したemailからユーザーを取得する。退会済みのユーザーは取得しない
+func (r *userRepository) GetByEmailKey(ctx context.Context, key string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + `
+		FROM ` + r.table + ` WHERE email_key = ? AND deleted_at IS NULL`
+	u := &entity.User{}
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), u, r.db.Rebind(query), key); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return u, nil
+}
 
-	_, err := r.db.ExecContext(ctx, query, id)
+// email_keyを作り直すために、idがafterより大きいユーザーをid順に取得する。退会済みのユーザーも含む
+func (r *userRepository) ListEmailKeys(ctx context.Context, after entity.UserID, limit int) (entity.Users, error) {
+	query := `SELECT id, email, email_key FROM ` + r.table + ` WHERE id > ? ORDER BY id LIMIT ?`
+	us := entity.Users{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &us, r.db.Rebind(query), after, limit); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return us, nil
+}
+
+// email_keyを保存する。emailは変わらないので、versionは確認しない
+func (r *userRepository) UpdateEmailKey(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	err := r.update(ctx, `email_key = :email_key, updated_at = :updated_at`, u)
+	if isDuplicateKey(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// ユーザーを退会済みにする。行は削除せず、発行済みのリフレッシュトークンを無効にする
+// 退会済みのユーザーはGetやGetByEmailで取得できなくなる
+func (r *userRepository) Delete(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.DeletedAt = &now
+	u.TokenRevokedAt = &now
+	u.StateBeforeDelete = u.State
+	u.State = entity.UserDeleted
+
+	return r.update(ctx, `state = :state, state_before_delete = :state_before_delete, deleted_at = :deleted_at,
+		token_revoked_at = :token_revoked_at, updated_at = :updated_at`, u)
+}
+
+// ユーザーの行を削除する。関連するテーブルの行もCASCADEで削除される
+// 仮登録のままのユーザーを作り直す時に使う
+func (r *userRepository) Purge(ctx context.Context, id entity.UserID) error {
+	query := `DELETE FROM ` + r.table + ` WHERE id = ?`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -72,24 +267,363 @@ func (r *userRepository) Delete(ctx context.Context, id entity.UserID) error {
 }
 
 // ユーザーのstateをactivateに更新する
+// 本登録の時に入力されたプロフィールも保存する
 func (r *userRepository) Activate(ctx context.Context, u *entity.User) error {
 	u.UpdatedAt = time.Now()
 	u.State = entity.UserActive
 
-	query := `UPDATE user SET state = :state, updated_at = :updated_at WHERE email = :email`
-	if _, err := r.db.NamedExecContext(ctx, query, u); err != nil {
-		return fmt.Errorf("failed to exec update: %v", err)
+	return r.updateWithVersion(ctx, `state = :state, name = :name, display_name = :display_name, bio = :bio, updated_at = :updated_at`, u)
+}
+
+func (r *userRepository) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	query := `SELECT ` + userColumns + `
+		FROM ` + r.table + ` WHERE id = ? AND deleted_at IS NULL`
+	u := &entity.User{}
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), u, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return u, nil
+}
+
+// 条件に一致するユーザーの一覧と、ページングする前の総件数を取得する
+func (r *userRepository) List(ctx context.Context, opts ListOptions) (entity.Users, int64, error) {
+	opts = opts.Normalize()
+
+	where := "WHERE deleted_at IS NULL"
+	args := []any{}
+	if opts.State == entity.UserDeleted {
+		where = "WHERE deleted_at IS NOT NULL"
+	} else if opts.State != "" {
+		where += " AND state = ?"
+		args = append(args, opts.State)
+	}
+	if opts.EmailStatus != "" {
+		where += " AND email_status = ?"
+		args = append(args, opts.EmailStatus)
+	}
+	if opts.ProvisionedBy != "" {
+		where += " AND provisioned_by = ?"
+		args = append(args, opts.ProvisionedBy)
+	}
+
+	var total int64
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), &total, r.db.Rebind(`SELECT COUNT(*) FROM `+r.table+` `+where), args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count: %w", err)
+	}
+
+	// 同じ値の行があってもページ間で順番が変わらないように、idでも並び替える
+	query := fmt.Sprintf(`SELECT %s FROM `+r.table+` %s ORDER BY %s %s, id %s LIMIT ? OFFSET ?`,
+		userColumns, where, opts.SortBy, opts.SortOrder, opts.SortOrder)
+	us := entity.Users{}
+	if err := sqlx.SelectContext(ctx, r.replicas.conn(ctx, r.db), &us, r.db.Rebind(query), append(args, opts.Limit, opts.Offset)...); err != nil {
+		return nil, 0, fmt.Errorf("failed to select: %w", err)
+	}
+	return us, total, nil
+}
+
+// 本人確認用のトークンを更新する。トークンの有効期限はupdated_atから計算する
+// 新しいトークンになるので、検証に失敗した回数もリセットする
+func (r *userRepository) UpdateActivateToken(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.ActivateAttempts = 0
+
+	return r.update(ctx, `activate_token = :activate_token, activate_attempts = :activate_attempts, updated_at = :updated_at`, u)
+}
+
+// 本人確認用トークンの検証に失敗した回数を増やす
+// updated_atからトークンの有効期限を計算しているので、updated_atは更新しない
+func (r *userRepository) IncrementActivateAttempts(ctx context.Context, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET activate_attempts = activate_attempts + 1 WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), u.ID); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
 	}
+	u.ActivateAttempts++
 	return nil
 }
 
-func (r *userRepository) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
-	query := `SELECT 
-		id, email, password, salt, state, activate_token, updated_at, created_at
-		FROM user WHERE id = ?`
+// パスワードを更新し、それ以前に発行されたリフレッシュトークンを無効にする
+func (r *userRepository) UpdatePassword(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.TokenRevokedAt = &now
+
+	return r.updateWithVersion(ctx, `password = :password, salt = :salt, token_revoked_at = :token_revoked_at, updated_at = :updated_at`, u)
+}
+
+// パスワードは変えずにハッシュだけを更新する。パスワード変更ではないのでトークンは無効にしない
+func (r *userRepository) UpdatePasswordHash(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	return r.update(ctx, `password = :password, updated_at = :updated_at`, u)
+}
+
+// 変更後のemailと確認用トークンを保存する。確認されるまではemailは変更しない。検証に失敗した回数はリセットする
+func (r *userRepository) RequestEmailChange(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.PendingEmailRequestedAt = &now
+	u.PendingEmailAttempts = 0
+
+	return r.updateWithVersion(ctx, `pending_email = :pending_email, pending_email_token = :pending_email_token,
+		pending_email_requested_at = :pending_email_requested_at, pending_email_attempts = :pending_email_attempts, updated_at = :updated_at`, u)
+}
+
+func (r *userRepository) IncrementEmailChangeAttempts(ctx context.Context, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET pending_email_attempts = pending_email_attempts + 1 WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), u.ID); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	u.PendingEmailAttempts++
+	return nil
+}
+
+// 確認済みの変更後のemailをemailに反映する。email_keyは呼び出し元で変更後のemailから作っておく
+// 新しいemailには届くことを確認済みなので、emailの状態もリセットする
+func (r *userRepository) ConfirmEmailChange(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Email = u.PendingEmail
+	u.PendingEmail = ""
+	u.PendingEmailToken = ""
+	u.PendingEmailRequestedAt = nil
+	u.PendingEmailAttempts = 0
+	u.EmailStatus = entity.EmailDeliverable
+	u.EmailStatusAt = nil
+
+	err := r.updateWithVersion(ctx, `email = :email, email_key = :email_key, pending_email = :pending_email, pending_email_token = :pending_email_token,
+		pending_email_requested_at = :pending_email_requested_at, pending_email_attempts = :pending_email_attempts, email_status = :email_status, email_status_at = :email_status_at,
+		updated_at = :updated_at`, u)
+	if isDuplicateKey(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// 確認済みの電話番号からユーザーを取得する。退会済みのユーザーは取得しない
+func (r *userRepository) GetByPhone(ctx context.Context, phone string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + `
+		FROM ` + r.table + ` WHERE phone = ? AND deleted_at IS NULL`
+	u := &entity.User{}
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), u, r.db.Rebind(query), phone); err != nil {
+		return nil, fmt.Errorf("failed to get: %w", err)
+	}
+	return u, nil
+}
+
+// usernameからユーザーを取得する。退会済みのユーザーは取得しない
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + `
+		FROM ` + r.table + ` WHERE username = ? AND deleted_at IS NULL`
 	u := &entity.User{}
-	if err := r.db.GetContext(ctx, u, query, uid); err != nil {
+	if err := sqlx.GetContext(ctx, r.replicas.conn(ctx, r.db), u, r.db.Rebind(query), username); err != nil {
 		return nil, fmt.Errorf("failed to get: %w", err)
 	}
 	return u, nil
 }
+
+// usernameを保存する。nilの場合は削除する
+func (r *userRepository) UpdateUsername(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	err := r.updateWithVersion(ctx, `username = :username, updated_at = :updated_at`, u)
+	if isDuplicateKey(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// 確認待ちの電話番号と確認コードを保存する。検証に失敗した回数はリセットする
+func (r *userRepository) RequestPhoneChange(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.PendingPhoneRequestedAt = &now
+	u.PendingPhoneAttempts = 0
+
+	return r.updateWithVersion(ctx, `pending_phone = :pending_phone, pending_phone_code = :pending_phone_code,
+		pending_phone_requested_at = :pending_phone_requested_at, pending_phone_attempts = :pending_phone_attempts, updated_at = :updated_at`, u)
+}
+
+func (r *userRepository) IncrementPhoneAttempts(ctx context.Context, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET pending_phone_attempts = pending_phone_attempts + 1 WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), u.ID); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	u.PendingPhoneAttempts++
+	return nil
+}
+
+// SMSで確認した電話番号をphoneに反映する
+func (r *userRepository) ConfirmPhoneChange(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Phone = u.PendingPhone
+	clearPendingPhone(u)
+
+	return r.updateWithVersion(ctx, `phone = :phone, pending_phone = :pending_phone, pending_phone_code = :pending_phone_code,
+		pending_phone_requested_at = :pending_phone_requested_at, pending_phone_attempts = :pending_phone_attempts, updated_at = :updated_at`, u)
+}
+
+// 電話番号と、確認待ちの電話番号を削除する
+func (r *userRepository) DeletePhone(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+	u.Phone = ""
+	clearPendingPhone(u)
+
+	return r.updateWithVersion(ctx, `phone = :phone, pending_phone = :pending_phone, pending_phone_code = :pending_phone_code,
+		pending_phone_requested_at = :pending_phone_requested_at, pending_phone_attempts = :pending_phone_attempts, updated_at = :updated_at`, u)
+}
+
+// SMSで送ったログイン用コードを保存する。検証に失敗した回数はリセットする
+// 同時にログインしようとしても失敗しないように、楽観的ロックはしない
+func (r *userRepository) UpdateSmsLoginCode(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.SmsLoginCodeSentAt = &now
+	u.SmsLoginAttempts = 0
+
+	return r.update(ctx, `sms_login_code = :sms_login_code, sms_login_code_sent_at = :sms_login_code_sent_at, sms_login_attempts = :sms_login_attempts`, u)
+}
+
+func (r *userRepository) IncrementSmsLoginAttempts(ctx context.Context, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET sms_login_attempts = sms_login_attempts + 1 WHERE id = ?`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), u.ID); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	u.SmsLoginAttempts++
+	return nil
+}
+
+// ログイン用コードを使用済みにする。同じコードで同時にログインされた場合は、片方だけ成功してもう片方はErrVersionConflictを返す
+func (r *userRepository) ConsumeSmsLoginCode(ctx context.Context, u *entity.User) error {
+	u.SmsLoginCode = ""
+
+	return r.updateWithVersion(ctx, `sms_login_code = :sms_login_code`, u)
+}
+
+func clearPendingPhone(u *entity.User) {
+	u.PendingPhone = ""
+	u.PendingPhoneCode = ""
+	u.PendingPhoneRequestedAt = nil
+	u.PendingPhoneAttempts = 0
+}
+
+// メール配信サービスから通知されたemailの状態を保存する
+// ユーザー自身の操作ではないので、updated_atは更新しない
+func (r *userRepository) UpdateEmailStatus(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.EmailStatusAt = &now
+
+	return r.update(ctx, `email_status = :email_status, email_status_at = :email_status_at`, u)
+}
+
+// 管理者の操作でユーザーを無効化、または再び有効にする
+// 無効にする場合は、発行済みのリフレッシュトークンも失効させる
+func (r *userRepository) UpdateState(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	if !u.IsActive() {
+		u.TokenRevokedAt = &now
+	}
+
+	return r.updateWithVersion(ctx, `state = :state, token_revoked_at = :token_revoked_at, updated_at = :updated_at`, u)
+}
+
+// プロフィールを更新する。読み込んだ後に他のリクエストで更新されていればErrVersionConflictを返す
+func (r *userRepository) UpdateProfile(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	return r.updateWithVersion(ctx, `name = :name, display_name = :display_name, bio = :bio, updated_at = :updated_at`, u)
+}
+
+// アバター画像のURLを保存する
+func (r *userRepository) UpdateAvatar(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	return r.updateWithVersion(ctx, `avatar_url = :avatar_url, updated_at = :updated_at`, u)
+}
+
+// ログインのたびにメールで通知するかの設定を保存する
+func (r *userRepository) UpdateNotifyOnLogin(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	return r.updateWithVersion(ctx, `notify_on_login = :notify_on_login, updated_at = :updated_at`, u)
+}
+
+// 言語やタイムゾーン、通知の設定を保存する
+func (r *userRepository) UpdatePreferences(ctx context.Context, u *entity.User) error {
+	u.UpdatedAt = time.Now()
+
+	return r.updateWithVersion(ctx, `locale = :locale, timezone = :timezone, notify_on_login = :notify_on_login,
+		notify_on_new_client = :notify_on_new_client, updated_at = :updated_at`, u)
+}
+
+// 全端末からのログアウトで、発行済みのリフレッシュトークンとアクセストークンを全て無効にする
+// アクセストークンはtoken_versionを1増やして、古いバージョンのトークンをミドルウェアで拒否させる
+func (r *userRepository) RevokeTokens(ctx context.Context, u *entity.User) error {
+	now := time.Now()
+	u.UpdatedAt = now
+	u.TokenRevokedAt = &now
+	u.TokenVersion++
+
+	return r.updateWithVersion(ctx, `token_revoked_at = :token_revoked_at, token_version = :token_version, updated_at = :updated_at`, u)
+}
+
+// deletedSince以降に退会したユーザーを元に戻す。猶予期間を過ぎたユーザーは戻せない
+// stateは退会する前の値に戻す。退会前のstateを保存していない古い行はactiveにする
+func (r *userRepository) Restore(ctx context.Context, uid entity.UserID, deletedSince time.Time) error {
+	query := `UPDATE ` + r.table + ` SET state = CASE WHEN state_before_delete = '' THEN ? ELSE state_before_delete END,
+		state_before_delete = '', deleted_at = NULL, version = version + 1, updated_at = ?
+		WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at >= ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), entity.UserActive, time.Now(), uid, deletedSince)
+	if err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// before より前に退会したユーザーの行を削除して、削除した件数を返す
+// 退会済みのユーザーはキャッシュされないので、キャッシュの削除は不要
+func (r *userRepository) PurgeOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM ` + r.table + ` WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	result, err := conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(query), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge users: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	return n, nil
+}
+
+// setで指定したカラムを更新して、バージョンを1増やす
+func (r *userRepository) update(ctx context.Context, set string, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET ` + set + `, version = version + 1 WHERE id = :id`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, u); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	u.Version++
+	return nil
+}
+
+// 楽観的ロックで更新する。読み込んだ時からバージョンが変わっていればErrVersionConflictを返す
+func (r *userRepository) updateWithVersion(ctx context.Context, set string, u *entity.User) error {
+	query := `UPDATE ` + r.table + ` SET ` + set + `, version = version + 1 WHERE id = :id AND version = :version`
+	result, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, u)
+	if err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+	u.Version++
+	return nil
+}
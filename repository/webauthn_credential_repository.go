@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"login-example/entity"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IWebAuthnCredentialRepository interface {
+	Create(ctx context.Context, c *entity.WebAuthnCredential) error
+	ListByUserID(ctx context.Context, uid entity.UserID) (entity.WebAuthnCredentials, error)
+	UpdateSignCount(ctx context.Context, c *entity.WebAuthnCredential) error
+}
+
+type webAuthnCredentialRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebAuthnCredentialRepository(db *sqlx.DB) IWebAuthnCredentialRepository {
+	return &webAuthnCredentialRepository{db: db}
+}
+
+// 認証器の公開鍵情報を保存する
+func (r *webAuthnCredentialRepository) Create(ctx context.Context, c *entity.WebAuthnCredential) error {
+	c.UpdatedAt = time.Now()
+	c.CreatedAt = time.Now()
+
+	query := `INSERT INTO webauthn_credential (
+		user_id, credential_id, public_key, attestation_type, aaguid, sign_count, updated_at, created_at
+	) VALUES (:user_id, :credential_id, :public_key, :attestation_type, :aaguid, :sign_count, :updated_at, :created_at)`
+	id, err := insertReturningID(ctx, r.db, query, c)
+	if err != nil {
+		return err
+	}
+
+	c.ID = entity.WebAuthnCredentialID(id)
+	return nil
+}
+
+// ユーザーに紐づく認証器を全て取得する
+func (r *webAuthnCredentialRepository) ListByUserID(ctx context.Context, uid entity.UserID) (entity.WebAuthnCredentials, error) {
+	query := `SELECT
+		id, user_id, credential_id, public_key, attestation_type, aaguid, sign_count, updated_at, created_at
+		FROM webauthn_credential WHERE user_id = ?`
+	cs := entity.WebAuthnCredentials{}
+	if err := sqlx.SelectContext(ctx, conn(ctx, r.db), &cs, r.db.Rebind(query), uid); err != nil {
+		return nil, fmt.Errorf("failed to select: %w", err)
+	}
+	return cs, nil
+}
+
+// ログイン成功時に認証器の署名カウンタを更新する
+func (r *webAuthnCredentialRepository) UpdateSignCount(ctx context.Context, c *entity.WebAuthnCredential) error {
+	c.UpdatedAt = time.Now()
+
+	query := `UPDATE webauthn_credential SET sign_count = :sign_count, updated_at = :updated_at
+		WHERE credential_id = :credential_id`
+	if _, err := sqlx.NamedExecContext(ctx, conn(ctx, r.db), query, c); err != nil {
+		return fmt.Errorf("failed to exec update: %w", err)
+	}
+	return nil
+}
@@ -1,33 +1,360 @@
 package main
 
 import (
+	"fmt"
+	"log/slog"
 	"login-example/auth"
+	"login-example/captcha"
+	"login-example/config"
+	"login-example/disposable"
+	"login-example/geoip"
 	"login-example/handler"
+	"login-example/ldap"
 	"login-example/mail"
+	"login-example/oauth"
+	"login-example/pwned"
 	myMiddleware "login-example/middleware"
 	"login-example/repository"
+	"login-example/saml"
+	"login-example/sms"
+	"login-example/storage"
 	"login-example/usecase"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
-func NewRouter(db *sqlx.DB, mailer mail.IMailer, jwter *auth.JwtBuilder) *echo.Echo {
+func NewRouter(cfg *config.Config, db *sqlx.DB, replicas []*sqlx.DB, mailer mail.IMailer, mails usecase.IMailDispatcher, captured *mail.CaptureMailer, jwter auth.IJwtBuilder, rateStore myMiddleware.IRateLimitStore, revocations auth.IRevocationStore, userCache repository.IUserCache, disposables disposable.IChecker, st storage.IStorage, smsSender sms.ISmsSender, logger *slog.Logger) (*echo.Echo, error) {
 	e := echo.New()
 
-	ur := repository.NewUserRepository(db)
-	uu := usecase.NewUserUsecase(ur, mailer, jwter)
-	uh := handler.NewUserHandler(uu)
+	// ログやエラーレスポンスに含めるため、リクエストIDは他のミドルウェアより先に決めておく
+	e.Use(myMiddleware.RequestID())
 
-	a := e.Group("/api/auth")
-	a.POST("/register/initial", uh.PreRegister)
-	a.POST("/register/complete", uh.Activate)
-	a.POST("/login", uh.Login)
-	a.GET("/refresh", uh.Refresh)
+	// リクエストごとにサーバースパンを作成して、contextでusecase以下に伝搬させる
+	// ヘルスチェックとメトリクスは頻繁に呼ばれるのでトレースしない
+	// 内側のミドルウェアでエラーハンドラーが呼ばれてから、レスポンスのステータスコードを記録する
+	e.Use(otelecho.Middleware("login-example", otelecho.WithSkipper(func(c echo.Context) bool {
+		switch c.Path() {
+		case "/healthz", "/readyz", "/metrics":
+			return true
+		}
+		return false
+	})))
 
-	r := e.Group("/api/restricted")
-	r.Use(myMiddleware.AuthMiddleware(jwter))
-	r.GET("/user/me", uh.GetMe)
+	// 全てのリクエストのアクセスログを出力する。エラーハンドラーのログにも同じ属性を付与するため、Metricsより先に登録する
+	e.Use(myMiddleware.RequestLogger(logger))
 
-	return e
-}
\ No newline at end of file
+	// 全てのルートのリクエストを計測する。DBのコネクションプールの状態も合わせて公開する
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db.DB, "login_example"),
+	)
+	e.Use(myMiddleware.Metrics(reg))
+
+	// DBへの問い合わせを計測する。キャッシュにヒットした場合は計測しない
+	ri := repository.NewInstrumentation(reg, cfg.DB.SlowQueryThreshold)
+	ur := repository.NewInstrumentedUserRepository(repository.NewUserRepository(db, replicas...), ri)
+	// userCacheがnilの場合はキャッシュしない
+	if userCache != nil {
+		ur = repository.NewCachedUserRepository(ur, userCache)
+	}
+	mr := repository.NewMagicLinkRepository(db)
+	ar := repository.NewAuditRepository(db)
+	lr := repository.NewLoginHistoryRepository(db)
+	sr := repository.NewInstrumentedSessionRepository(repository.NewSessionRepository(db), ri)
+	tx := repository.NewTransactor(db)
+	// LDAPのURLが設定されていない場合は、ローカルのパスワードで認証する
+	var dir ldap.IAuthenticator
+	if cfg.LDAP.URL != "" {
+		dir = ldap.NewAuthenticator(ldap.Config{
+			URL:            cfg.LDAP.URL,
+			StartTLS:       cfg.LDAP.StartTLS,
+			BindDN:         cfg.LDAP.BindDN,
+			BindPassword:   cfg.LDAP.BindPassword,
+			BaseDN:         cfg.LDAP.BaseDN,
+			UserFilter:     cfg.LDAP.UserFilter,
+			EmailAttribute: cfg.LDAP.EmailAttribute,
+			Timeout:        cfg.LDAP.Timeout,
+		})
+	}
+	icr := repository.NewInviteCodeRepository(db)
+	// ログインのたびの通知はユーザーが設定するので、新しい環境からのログインの通知が無効でも作成する
+	la := usecase.NewLoginAlerter(lr, ar, mailer, jwter, cfg.LoginAlert.Enabled)
+	// GeoIPのDBが設定されていない場合は、接続元の位置を調べない
+	ld := usecase.NewNopLoginAnomalyDetector()
+	if cfg.GeoIP.DatabasePath != "" {
+		loc, err := geoip.OpenMaxMind(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		ld = usecase.NewLoginAnomalyDetector(lr, ar, loc, cfg.GeoIP.MaxTravelSpeed)
+	}
+	dr := repository.NewTrustedDeviceRepository(db)
+	du := usecase.NewTrustedDeviceUsecase(ur, dr, ar, jwter, cfg.TrustedDevice.TTL)
+	tdh := handler.NewTrustedDeviceHandler(du)
+	// SMSの送信が設定されていない場合は、NewPhoneHandlerが404を返す
+	var phu usecase.IPhoneUsecase
+	if smsSender != nil {
+		phu = usecase.NewPhoneUsecase(ur, ar, tx, smsSender, cfg.Mail.ProductName)
+	}
+	phh := handler.NewPhoneHandler(phu)
+	unh := handler.NewUsernameHandler(usecase.NewUsernameUsecase(ur, ar, cfg.Registration.ReservedUsernames))
+	prh := handler.NewPreferencesHandler(usecase.NewPreferencesUsecase(ur, ar))
+	avh := handler.NewAvatarHandler(usecase.NewAvatarUsecase(ur, ar, st, cfg.Storage.MaxUploadSize), cfg.Storage.MaxUploadSize)
+	// 登録の経路によらず同じemail_keyになるように、emailを扱う全てのusecaseで共有する
+	ek := usecase.EmailKeyer{FoldGmailAliases: cfg.Registration.FoldGmailAliases}
+	uu := usecase.NewUserUsecase(ur, mr, ar, lr, la, ld, du, sr, tx, mailer, mails, jwter, revocations, pwned.NewChecker(), disposables, dir, icr, usecase.UserUsecaseConfig{
+		ActivateTokenMode:   usecase.ActivateTokenMode(cfg.Token.ActivateMode),
+		ActivateTokenLength: cfg.Token.ActivateLength,
+		ActivateTokenTTL:    cfg.Token.ActivateTTL,
+		EmailChangeTokenTTL: cfg.Token.EmailChangeTTL,
+		MinPasswordScore:    cfg.Password.MinScore,
+		InviteOnly:          cfg.Registration.InviteOnly,
+		AllowedEmailDomains: cfg.Registration.AllowedDomains,
+		BlockedEmailDomains: cfg.Registration.BlockedDomains,
+		DisposableEmail:     usecase.DisposableEmailPolicy(cfg.Registration.DisposableEmail),
+		EmailKeys:           ek,
+		LoginStepUp:         cfg.GeoIP.StepUp,
+
+		SkipStepUpOnTrustedDevice: cfg.TrustedDevice.SkipStepUp,
+	})
+	// CAPTCHAのプロバイダーが設定されていない場合は検証しない
+	cv := captcha.NewNopVerifier()
+	if cfg.Captcha.Provider != "" {
+		v, err := captcha.NewVerifier(captcha.Config{
+			Provider: cfg.Captcha.Provider,
+			Secret:   cfg.Captcha.Secret,
+			MinScore: cfg.Captcha.MinScore,
+			Hostname: cfg.Captcha.Hostname,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cv = v
+	}
+	uh := handler.NewUserHandler(uu, cv)
+	// SMSの送信が設定されていない場合は、SMSでのログインも404を返す
+	var slu usecase.ISmsLoginUsecase
+	if smsSender != nil {
+		slu = usecase.NewSmsLoginUsecase(ur, ar, lr, la, ld, sr, jwter, smsSender, cfg.Mail.ProductName)
+	}
+	slh := handler.NewSmsLoginHandler(slu, cv)
+
+	wr := repository.NewWebAuthnCredentialRepository(db)
+	wu, err := usecase.NewWebAuthnUsecase(ur, wr, ar, lr, la, ld, sr, jwter, ek)
+	if err != nil {
+		return nil, err
+	}
+	wh := handler.NewWebAuthnHandler(wu)
+
+	ir := repository.NewIdentityRepository(db)
+	ou := usecase.NewOAuthUsecase(ur, ir, ar, lr, la, ld, sr, tx, jwter, oauth.NewProviders(), ek)
+	oh := handler.NewOAuthHandler(ou)
+
+	// SAMLのentity_idが設定されていない場合は、SAMLのエンドポイントは404を返す
+	var su usecase.ISAMLUsecase
+	if cfg.SAML.EntityID != "" {
+		sp, err := saml.NewServiceProvider(saml.Config{
+			EntityID:        cfg.SAML.EntityID,
+			BaseURL:         cfg.SAML.BaseURL,
+			CertificatePath: cfg.SAML.CertificatePath,
+			KeyPath:         cfg.SAML.KeyPath,
+			IDPMetadataURL:  cfg.SAML.IDPMetadataURL,
+			IDPMetadataPath: cfg.SAML.IDPMetadataPath,
+			EmailAttribute:  cfg.SAML.EmailAttribute,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create saml service provider: %w", err)
+		}
+		su = usecase.NewSAMLUsecase(ur, ar, lr, la, ld, sr, tx, jwter, sp, cfg.SAML.JITProvisioning, ek)
+	}
+	sh := handler.NewSAMLHandler(su)
+
+	er := repository.NewDataExportRepository(db)
+	eu := usecase.NewExportUsecase(ur, ir, wr, lr, sr, er, mailer, jwter)
+	eh := handler.NewExportHandler(eu)
+
+	adu := usecase.NewAdminUsecase(ur, ar, sr, tx, revocations)
+	adh := handler.NewAdminHandler(adu)
+	ich := handler.NewInviteCodeHandler(usecase.NewInviteCodeUsecase(ur, icr, ar))
+
+	meu := usecase.NewMailEventUsecase(ur, ar)
+	mwh := handler.NewMailWebhookHandler(meu, cfg.Mail.WebhookSecret)
+
+	clients := map[string]string{}
+	for _, cl := range cfg.Introspection.Clients {
+		clients[cl.ID] = cl.Secret
+	}
+	iu := usecase.NewIntrospectionUsecase(ur, sr, revocations, jwter)
+	ih := handler.NewIntrospectionHandler(iu, clients)
+
+	cr := repository.NewOAuthClientRepository(db)
+	cu := usecase.NewClientCredentialsUsecase(cr, jwter)
+	// OpenID Connectのissuerが設定されていない場合は、認可コードフローを受け付けない
+	var oidcu usecase.IOIDCUsecase
+	if cfg.OIDC.Issuer != "" {
+		oidcu = usecase.NewOIDCUsecase(ur, cr, repository.NewAuthorizationCodeRepository(db), ar, jwter)
+	}
+	th := handler.NewTokenHandler(cu, oidcu)
+	oidch := handler.NewOIDCHandler(oidcu, handler.OIDCHandlerConfig{
+		Issuer:    cfg.OIDC.Issuer,
+		LoginURL:  cfg.OIDC.LoginURL,
+		Algorithm: cfg.Keys.Algorithm,
+	})
+
+	// SCIMのトークンが設定されていない場合は、RequireProvisioningTokenが404を返す
+	scimh := handler.NewSCIMHandler(usecase.NewSCIMUsecase(ur, ar, tx, ek))
+
+	or := repository.NewOrganizationRepository(db)
+	oir := repository.NewOrganizationInvitationRepository(db)
+	orgh := handler.NewOrganizationHandler(usecase.NewOrganizationUsecase(ur, or, oir, ar, tx, mailer, jwter, ek))
+
+	pr := repository.NewPersonalAccessTokenRepository(db)
+	pu := usecase.NewPersonalAccessTokenUsecase(ur, pr, ar)
+	ph := handler.NewPersonalAccessTokenHandler(pu)
+	// AuthMiddlewareでパーソナルアクセストークンも受け付ける
+	authn := auth.WithPersonalAccessTokens(jwter, pu)
+
+	dh := handler.NewDocsHandler()
+	jh := handler.NewJWKSHandler(jwter)
+
+	checks := map[string]handler.HealthCheckFunc{
+		"db":  db.PingContext,
+		"jwt": jwter.Check,
+	}
+	for i, replica := range replicas {
+		checks[fmt.Sprintf("db_replica_%d", i)] = replica.PingContext
+	}
+	hh := handler.NewHealthHandler(checks)
+
+	h := &handlers{
+		uh:          uh,
+		wh:          wh,
+		oh:          oh,
+		eh:          eh,
+		adh:         adh,
+		ich:         ich,
+		mwh:         mwh,
+		ih:          ih,
+		th:          th,
+		oidch:       oidch,
+		sh:          sh,
+		ph:          ph,
+		tdh:         tdh,
+		avh:         avh,
+		prh:         prh,
+		unh:         unh,
+		phh:         phh,
+		slh:         slh,
+		orgh:        orgh,
+		jwter:       authn,
+		revocations: revocations,
+		rateStore:   rateStore,
+		rateLimit:   rateLimitConfig(ek),
+		idempotency: repository.NewIdempotencyRepository(db),
+	}
+	// バージョンごとにルートを登録する
+	for version, register := range apiVersions {
+		register(e.Group("/api/"+version), h)
+	}
+	// バージョン導入前のクライアントのために、/api直下にもv1のルートを登録しておく
+	registerV1Routes(e.Group("/api"), h)
+
+	// ロードバランサーやKubernetesのヘルスチェック用
+	e.GET("/healthz", hh.Liveness)
+	e.GET("/readyz", hh.Readiness)
+
+	// Prometheusのスクレイピング用
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+
+	// 他のサービスがアクセストークンを検証するための公開鍵
+	e.GET("/.well-known/jwks.json", jh.JWKS)
+	// OpenID ConnectのRPがエンドポイントを知るためのメタデータ
+	e.GET("/.well-known/openid-configuration", oidch.Discovery)
+
+	// 企業のディレクトリからのユーザーのプロビジョニング(SCIM 2.0)。ディレクトリが決まったパスを使うので/apiの外に置く
+	scim := e.Group("/scim/v2", myMiddleware.RequireProvisioningToken(cfg.SCIM.Token))
+	scim.POST("/Users", scimh.Create)
+	scim.GET("/Users", scimh.List)
+	scim.GET("/Users/:id", scimh.Get)
+	scim.PUT("/Users/:id", scimh.Replace)
+	scim.PATCH("/Users/:id", scimh.Patch)
+	scim.DELETE("/Users/:id", scimh.Delete)
+
+	// ローカルに保存したアバター画像などを配信する。S3の場合はバケットかCDNから配信する
+	if cfg.Storage.Provider == "local" {
+		e.Static("/uploads", cfg.Storage.Local.Dir)
+	}
+
+	// APIドキュメント
+	e.GET("/api/docs", dh.SwaggerUI)
+	e.GET("/api/docs/openapi.yaml", dh.OpenAPI)
+
+	// 開発環境でメールをキャプチャしている場合は、送信したメールを確認できるようにする
+	if captured != nil {
+		dmh := handler.NewDevMailHandler(captured)
+		e.GET("/dev/mails", dmh.ListMails)
+		e.DELETE("/dev/mails", dmh.ClearMails)
+	}
+	if fs, ok := smsSender.(*sms.FakeSender); ok {
+		dsh := handler.NewDevSmsHandler(fs)
+		e.GET("/dev/sms", dsh.ListMessages)
+		e.DELETE("/dev/sms", dsh.ClearMessages)
+	}
+
+	return e, nil
+}
+
+// ルートの登録に必要なハンドラーとミドルウェアの依存
+type handlers struct {
+	uh          handler.IUserHandler
+	wh          handler.IWebAuthnHandler
+	oh          handler.IOAuthHandler
+	eh          handler.IExportHandler
+	adh         handler.IAdminHandler
+	ich         handler.IInviteCodeHandler
+	mwh         handler.IMailWebhookHandler
+	ih          handler.IIntrospectionHandler
+	th          handler.ITokenHandler
+	oidch       handler.IOIDCHandler
+	sh          handler.ISAMLHandler
+	ph          handler.IPersonalAccessTokenHandler
+	tdh         handler.ITrustedDeviceHandler
+	avh         handler.IAvatarHandler
+	prh         handler.IPreferencesHandler
+	unh         handler.IUsernameHandler
+	phh         handler.IPhoneHandler
+	slh         handler.ISmsLoginHandler
+	orgh        handler.IOrganizationHandler
+	jwter       auth.IJwtParser
+	revocations auth.IRevocationStore
+	rateStore   myMiddleware.IRateLimitStore
+	rateLimit   myMiddleware.RateLimitConfig
+	idempotency myMiddleware.IIdempotencyStore
+}
+
+// レートリミットの設定。emailはユーザーの検索と同じキーで数える
+func rateLimitConfig(ek usecase.EmailKeyer) myMiddleware.RateLimitConfig {
+	conf := myMiddleware.DefaultRateLimitConfig
+	conf.EmailKey = ek.Key
+	return conf
+}
+
+// scopeごとにカウンターを分けたレートリミット
+func (h *handlers) rateLimitFor(scope string) echo.MiddlewareFunc {
+	conf := h.rateLimit
+	conf.Scope = scope
+	return myMiddleware.RateLimit(h.rateStore, conf)
+}
+
+// APIのバージョンと、そのバージョンのルートを登録する関数
+// レスポンスの形式などに破壊的な変更をする場合は、新しいバージョンを追加して古いバージョンは残しておく
+var apiVersions = map[string]func(g *echo.Group, h *handlers){
+	"v1": registerV1Routes,
+}
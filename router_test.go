@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/handler"
+	myMiddleware "login-example/middleware"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// ミドルウェアを通過したかだけを確認するため、200を返すパスキーのハンドラー
+type okWebAuthnHandler struct{}
+
+func (okWebAuthnHandler) BeginRegistration(c echo.Context) error  { return c.NoContent(http.StatusOK) }
+func (okWebAuthnHandler) FinishRegistration(c echo.Context) error { return c.NoContent(http.StatusOK) }
+func (okWebAuthnHandler) BeginLogin(c echo.Context) error         { return c.NoContent(http.StatusOK) }
+func (okWebAuthnHandler) FinishLogin(c echo.Context) error        { return c.NoContent(http.StatusOK) }
+
+// 認可を確認するためのルーター。ミドルウェアで拒否されるリクエストはusecaseまで届かないので、usecaseはnilにする
+func newAuthzTestRouter(t *testing.T, jwter auth.IJwtParser) *echo.Echo {
+	t.Helper()
+	h := &handlers{
+		uh:          handler.NewUserHandler(nil, nil),
+		wh:          okWebAuthnHandler{},
+		oh:          handler.NewOAuthHandler(nil),
+		eh:          handler.NewExportHandler(nil),
+		adh:         handler.NewAdminHandler(nil),
+		ich:         handler.NewInviteCodeHandler(nil),
+		mwh:         handler.NewMailWebhookHandler(nil, ""),
+		ih:          handler.NewIntrospectionHandler(nil, nil),
+		th:          handler.NewTokenHandler(nil, nil),
+		oidch:       handler.NewOIDCHandler(nil, handler.OIDCHandlerConfig{}),
+		sh:          handler.NewSAMLHandler(nil),
+		ph:          handler.NewPersonalAccessTokenHandler(nil),
+		tdh:         handler.NewTrustedDeviceHandler(nil),
+		avh:         handler.NewAvatarHandler(nil, 0),
+		prh:         handler.NewPreferencesHandler(nil),
+		unh:         handler.NewUsernameHandler(nil),
+		phh:         handler.NewPhoneHandler(nil),
+		slh:         handler.NewSmsLoginHandler(nil, nil),
+		orgh:        handler.NewOrganizationHandler(nil),
+		jwter:       jwter,
+		revocations: auth.NewMemoryRevocationStore(),
+		rateStore:   myMiddleware.NewMemoryRateLimitStore(),
+		rateLimit:   myMiddleware.DefaultRateLimitConfig,
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = customHTTPErrorHandler
+	// usecaseがnilのハンドラーに届いた場合は500にする
+	e.Use(middleware.Recover())
+	registerV1Routes(e.Group("/api/v1"), h)
+	return e
+}
+
+func newTestJwtBuilder(t *testing.T) *auth.JwtBuilder {
+	t.Helper()
+	j, err := auth.NewJwtBuilderWithSecret([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func serveAuthz(e *echo.Echo, method, path, token, sudoToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	if sudoToken != "" {
+		req.Header.Set(myMiddleware.HeaderSudoToken, sudoToken)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPasskeyRegistrationAuthz(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	e := newAuthzTestRouter(t, j)
+	u := &entity.User{ID: 100001, Role: entity.RoleUser}
+
+	access, err := j.GenerateAccessToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OpenID ConnectのRPに発行するアクセストークン
+	rp, err := j.GenerateScopedAccessToken(u, entity.OIDCScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sudo, err := j.GenerateSudoToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := j.GenerateSudoToken(&entity.User{ID: 100002, Role: entity.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		sudo  string
+		want  int
+	}{
+		{"no token", "", "", http.StatusUnauthorized},
+		{"rp token", string(rp), string(sudo), http.StatusForbidden},
+		{"no sudo token", string(access), "", http.StatusForbidden},
+		{"sudo token for another user", string(access), string(other), http.StatusForbidden},
+		{"user token with sudo", string(access), string(sudo), http.StatusOK},
+	}
+	for _, path := range []string{"/api/v1/auth/webauthn/register/begin", "/api/v1/auth/webauthn/register/finish"} {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				if rec := serveAuthz(e, http.MethodPost, path, tt.token, tt.sudo); rec.Code != tt.want {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+// 鍵を共有する他のサービス向けのトークンでは、/authのルートも使えない
+func TestPasskeyRegistrationAuthz_AudienceMismatch(t *testing.T) {
+	orig := auth.Audience
+	t.Cleanup(func() { auth.Audience = orig })
+
+	j := newTestJwtBuilder(t)
+	e := newAuthzTestRouter(t, j)
+	u := &entity.User{ID: 100001, Role: entity.RoleUser}
+	sudo, err := j.GenerateSudoToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.Audience = "other-service"
+	access, err := j.GenerateAccessToken(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.Audience = orig
+
+	if rec := serveAuthz(e, http.MethodPost, "/api/v1/auth/webauthn/register/begin", string(access), string(sudo)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+// user:readのscopeだけを持つパーソナルアクセストークンを受け付ける
+type readOnlyTokenVerifier struct{}
+
+func (readOnlyTokenVerifier) VerifyPersonalAccessToken(ctx context.Context, token string) (*auth.TokenInfo, error) {
+	return &auth.TokenInfo{
+		Type:   auth.PersonalAccessTokenType,
+		UserID: 100001,
+		Role:   entity.RoleUser,
+		Scopes: []string{entity.ScopeUserRead},
+	}, nil
+}
+
+// 認証なしで受け付ける変更のルート。クライアントの認証やCSRFトークンなど、アクセストークン以外で確認する
+var publicWriteRoutes = map[string]bool{
+	"POST /api/v1/auth/register/initial":      true,
+	"POST /api/v1/auth/register/complete":     true,
+	"POST /api/v1/auth/register/resend":       true,
+	"POST /api/v1/auth/login":                 true,
+	"POST /api/v1/auth/login/magic":           true,
+	"POST /api/v1/auth/login/sms":             true,
+	"POST /api/v1/auth/login/sms/verify":      true,
+	"POST /api/v1/auth/webauthn/login/begin":  true,
+	"POST /api/v1/auth/webauthn/login/finish": true,
+	"POST /api/v1/auth/saml/acs":              true,
+	"POST /api/v1/auth/introspect":            true,
+	"POST /api/v1/auth/token":                 true,
+	"POST /api/v1/webhooks/mail/:provider":    true,
+}
+
+// 読み取り専用のトークンでは、認証が必要な変更のルートを全て使えない
+func TestReadOnlyTokenCannotWrite(t *testing.T) {
+	j := newTestJwtBuilder(t)
+	e := newAuthzTestRouter(t, auth.WithPersonalAccessTokens(j, readOnlyTokenVerifier{}))
+	// sudoトークンがあっても、scopeが足りなければ拒否する
+	sudo, err := j.GenerateSudoToken(&entity.User{ID: 100001, Role: entity.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serveAuthz(e, http.MethodPost, "/api/v1/auth/webauthn/register/begin", auth.PersonalAccessTokenPrefix+"read-only", string(sudo)); rec.Code != http.StatusForbidden {
+		t.Errorf("passkey registration status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	for _, r := range e.Routes() {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == echo.RouteNotFound {
+			continue
+		}
+		if publicWriteRoutes[r.Method+" "+r.Path] {
+			continue
+		}
+		t.Run(r.Method+" "+r.Path, func(t *testing.T) {
+			rec := serveAuthz(e, r.Method, r.Path, auth.PersonalAccessTokenPrefix+"read-only", string(sudo))
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body.String())
+			}
+		})
+	}
+}
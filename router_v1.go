@@ -0,0 +1,150 @@
+package main
+
+import (
+	"login-example/entity"
+	myMiddleware "login-example/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// v1のルートを登録する
+func registerV1Routes(g *echo.Group, h *handlers) {
+	a := g.Group("/auth")
+	// ブルートフォース攻撃対策として、IPとemailごとにリクエスト数を制限する
+	a.Use(h.rateLimitFor("auth"))
+	// Idempotency-Keyでの再送も、レートリミットの対象にするためRateLimitの後に置く
+	a.Use(myMiddleware.Idempotency(h.idempotency, myMiddleware.DefaultIdempotencyConfig))
+	a.POST("/register/initial", h.uh.PreRegister)
+	a.POST("/register/complete", h.uh.Activate)
+	a.GET("/register/activate", h.uh.ActivateWithLink)
+	a.POST("/register/resend", h.uh.ResendActivateToken)
+	a.POST("/login", h.uh.Login)
+	a.POST("/login/magic", h.uh.RequestMagicLink)
+	a.GET("/login/magic", h.uh.LoginWithMagicLink)
+	a.POST("/login/sms", h.slh.RequestCode)
+	a.POST("/login/sms/verify", h.slh.Login)
+	a.GET("/login/deny", h.uh.DenyLogin)
+
+	// cookieで認証するルートはCSRF対策をする
+	cs := a.Group("", myMiddleware.CSRF(myMiddleware.DefaultCSRFConfig))
+	cs.GET("/refresh", h.uh.Refresh)
+	// リフレッシュトークンのcookieを受け取れるように、/authの下に置く
+	// セッションを失効させる変更の操作なので、/restrictedと同じくuser:writeのscopeが必要
+	a.POST("/logout", h.uh.Logout, myMiddleware.AuthMiddleware(h.jwter, h.revocations), myMiddleware.RequireScope(entity.ScopeUserWrite))
+
+	// パスキーの登録はログイン済みのユーザーのみ行える。登録したパスキーでログインできるので、乗っ取りにつながる操作としてsudoトークンも必要
+	// user:writeのscopeを確認して、RPに発行したアクセストークンでは登録できないようにする
+	registerPasskey := []echo.MiddlewareFunc{
+		myMiddleware.AuthMiddleware(h.jwter, h.revocations),
+		myMiddleware.RequireScope(entity.ScopeUserWrite),
+		myMiddleware.RequireSudo(h.jwter),
+	}
+	a.POST("/webauthn/register/begin", h.wh.BeginRegistration, registerPasskey...)
+	a.POST("/webauthn/register/finish", h.wh.FinishRegistration, registerPasskey...)
+	a.POST("/webauthn/login/begin", h.wh.BeginLogin)
+	a.POST("/webauthn/login/finish", h.wh.FinishLogin, myMiddleware.CSRF(myMiddleware.HeaderOnlyCSRFConfig))
+
+	a.GET("/oauth/:provider", h.oh.Redirect)
+	a.GET("/oauth/:provider/callback", h.oh.Callback)
+
+	// SAMLのSP。ACSはIdPからのクロスサイトのPOSTなので、CSRFトークンではなくAuthnRequestのIDで確認する
+	a.GET("/saml/metadata", h.sh.Metadata)
+	a.GET("/saml/login", h.sh.Login)
+	a.POST("/saml/acs", h.sh.ACS)
+
+	a.GET("/export/download", h.eh.Download)
+	// 組織への招待メールのリンク
+	a.GET("/invitations", h.orgh.GetInvitation)
+
+	// ゲートウェイなどのサービスから頻繁に呼ばれるので、IPごとのレートリミットの対象外にする
+	// クライアントの認証はハンドラーで行う
+	g.POST("/auth/introspect", h.ih.Introspect)
+	// サービス間の呼び出し用のアクセストークン。client credentialsグラントのみ
+	g.POST("/auth/token", h.th.Token)
+
+	// OpenID Connectのプロバイダー。GETはRPからのリダイレクトを検証して、フロントエンドのログイン画面に引き継ぐ
+	// ログインしたフロントエンドがPOSTで許可すると、認可コードを付与したRPのURLを返す
+	o := g.Group("/oauth2")
+	o.GET("/authorize", h.oidch.Authorize)
+	o.POST("/authorize", h.oidch.Approve, myMiddleware.AuthMiddleware(h.jwter, h.revocations), myMiddleware.RequireScope(entity.ScopeUserWrite))
+	// RPに発行したアクセストークンはopenidのscopeだけを持ち、user:writeなどのscopeが必要なAPIは使えない
+	userinfo := []echo.MiddlewareFunc{myMiddleware.AuthMiddleware(h.jwter, h.revocations), myMiddleware.RequireScope(entity.ScopeOpenID)}
+	o.GET("/userinfo", h.oidch.UserInfo, userinfo...)
+	o.POST("/userinfo", h.oidch.UserInfo, userinfo...)
+
+	// メール配信サービスからのバウンスなどの通知
+	g.POST("/webhooks/mail/:provider", h.mwh.Receive)
+
+	// 参照はuser:read、変更はuser:writeのscopeが必要
+	read := myMiddleware.RequireScope(entity.ScopeUserRead)
+	write := myMiddleware.RequireScope(entity.ScopeUserWrite)
+	r := g.Group("/restricted")
+	r.Use(myMiddleware.AuthMiddleware(h.jwter, h.revocations))
+	// アカウントの削除やemailの変更など、乗っ取りにつながる操作はパスワードの再入力が必要
+	sudo := myMiddleware.RequireSudo(h.jwter)
+	r.GET("/user/me", h.uh.GetMe, read)
+	r.PATCH("/user/me", h.uh.UpdateMe, write)
+	// 画像をアップロードして、アバターのURLを設定する
+	r.POST("/user/me/avatar", h.avh.Upload, write, h.rateLimitFor("avatar"))
+	r.DELETE("/user/me", h.uh.Delete, write, sudo)
+	r.GET("/user/me/logins", h.uh.ListLogins, read)
+	r.GET("/user/me/sessions", h.uh.ListSessions, read)
+	r.DELETE("/user/me/sessions/:id", h.uh.RevokeSession, write, sudo)
+	r.POST("/user/me/logout-all", h.uh.LogoutAll, write)
+	r.PUT("/user/me/password", h.uh.ChangePassword, write)
+	r.PUT("/user/me/login-notification", h.uh.SetLoginNotification, write)
+	// 言語やタイムゾーン、メールでの通知の設定
+	r.GET("/user/me/preferences", h.prh.Get, read)
+	r.PUT("/user/me/preferences", h.prh.Update, write)
+	// パスワードの総当たりを防ぐため、IPごとにリクエスト数を制限する
+	r.POST("/user/me/sudo", h.uh.Sudo, write, h.rateLimitFor("sudo"))
+	r.POST("/user/me/email", h.uh.RequestEmailChange, write, sudo)
+	r.POST("/user/me/email/confirm", h.uh.ConfirmEmailChange, write)
+	// emailの代わりにログインに使えるusername
+	r.PUT("/user/me/username", h.unh.Set, write)
+	r.DELETE("/user/me/username", h.unh.Delete, write)
+	// SMSで確認コードを送って、電話番号を登録する
+	r.POST("/user/me/phone", h.phh.RequestVerification, write, sudo, h.rateLimitFor("phone"))
+	r.POST("/user/me/phone/confirm", h.phh.Verify, write)
+	r.DELETE("/user/me/phone", h.phh.Delete, write, sudo)
+	r.GET("/user/me/export", h.eh.RequestExport, write)
+	// APIを使うためのトークン。発行にはパスワードの再入力が必要
+	r.GET("/user/me/tokens", h.ph.List, read)
+	r.POST("/user/me/tokens", h.ph.Create, write, sudo)
+	r.DELETE("/user/me/tokens/:id", h.ph.Revoke, write)
+	// 信頼済みの端末。登録すると、端末を識別するcookieをセットする
+	r.GET("/user/me/devices", h.tdh.List, read)
+	r.POST("/user/me/devices", h.tdh.Trust, write, sudo)
+	r.PATCH("/user/me/devices/:id", h.tdh.Rename, write)
+	r.DELETE("/user/me/devices/:id", h.tdh.Revoke, write)
+	// 所属する組織。組織のAPIを使うには、組織のトークンを発行して切り替える
+	r.GET("/orgs", h.orgh.List, read)
+	r.POST("/orgs", h.orgh.Create, write)
+	r.POST("/orgs/:id/token", h.orgh.IssueToken, write)
+	// 招待されたemailのユーザーでログインして承諾する
+	r.POST("/invitations/accept", h.orgh.AcceptInvitation, write)
+	// 組織のトークンの組織に対する操作
+	org := r.Group("/org", myMiddleware.RequireOrg())
+	org.GET("", h.orgh.GetCurrent, read)
+	org.GET("/members", h.orgh.ListMembers, read)
+	org.DELETE("/members/:user_id", h.orgh.RemoveMember, write)
+	org.POST("/invitations", h.orgh.Invite, write)
+
+	// admin:readはadminのユーザーと、許可されたクライアントのトークンにだけ付与される
+	ad := g.Group("/admin")
+	ad.Use(myMiddleware.AuthMiddleware(h.jwter, h.revocations))
+	ad.Use(myMiddleware.RequireScope(entity.ScopeAdminRead))
+	ad.GET("/audit-logs", h.adh.ListAuditLogs)
+	ad.GET("/users", h.adh.ListUsers)
+	// 変更はadminのユーザーのみ。admin:writeはadminのユーザーにだけ付与するが、クライアントのトークンで変更できないようにroleも確認する
+	adminWrite := []echo.MiddlewareFunc{
+		myMiddleware.RequireScope(entity.ScopeAdminWrite),
+		myMiddleware.RequireRole(entity.RoleAdmin),
+	}
+	// ユーザーの利用停止や禁止。理由は監査ログに記録する
+	ad.PUT("/users/:id/state", h.adh.SetUserState, adminWrite...)
+	// 招待制の登録のための招待コード。発行と取り消しはadminのユーザーのみ
+	ad.GET("/invite-codes", h.ich.List)
+	ad.POST("/invite-codes", h.ich.Create, adminWrite...)
+	ad.DELETE("/invite-codes/:id", h.ich.Revoke, adminWrite...)
+}
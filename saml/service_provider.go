@@ -0,0 +1,188 @@
+package saml
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// IdPのアサーションから取り出したユーザー情報
+type UserInfo struct {
+	// IdP内でユーザーを識別するNameID
+	NameID string
+	Email  string
+}
+
+type IServiceProvider interface {
+	// IdPの認証画面へのリダイレクトURLと、ACSで照合するAuthnRequestのID
+	AuthnRequestURL(relayState string) (string, string, error)
+	// ACSに送られたSAMLResponse(base64)の署名などを検証して、ユーザー情報を取り出す
+	ParseResponse(samlResponse string, requestIDs []string) (*UserInfo, error)
+	// IdPに登録するSPのメタデータ(XML)
+	Metadata() ([]byte, error)
+}
+
+type Config struct {
+	EntityID string
+	// このサービスの外部から見たURL。ACSとメタデータのURLはこのURLの下になる
+	BaseURL string
+	// AuthnRequestの署名とアサーションの復号に使う、SPの証明書と秘密鍵(PEM)
+	CertificatePath string
+	KeyPath         string
+	// IdPのメタデータ。URLが設定されていれば起動時に取得する
+	IDPMetadataURL  string
+	IDPMetadataPath string
+	// emailを取り出す属性名。属性がない場合はNameIDを使う
+	EmailAttribute string
+}
+
+// IdPのメタデータを取得する時のタイムアウト
+var fetchMetadataTimeout = 10 * time.Second
+
+type serviceProvider struct {
+	sp             *gosaml.ServiceProvider
+	emailAttribute string
+}
+
+func NewServiceProvider(cfg Config) (IServiceProvider, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base url: %w", err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(cfg.CertificatePath, cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sp key pair: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sp certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported sp key: %T", pair.PrivateKey)
+	}
+
+	idp, err := loadIDPMetadata(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &gosaml.ServiceProvider{
+		EntityID:    cfg.EntityID,
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *base.JoinPath("/api/v1/auth/saml/metadata"),
+		AcsURL:      *base.JoinPath("/api/v1/auth/saml/acs"),
+		IDPMetadata: idp,
+		// IdPから直接送られたアサーションは、ログインCSRFに使えるので受け付けない
+		AllowIDPInitiated: false,
+		AuthnNameIDFormat: gosaml.EmailAddressNameIDFormat,
+	}
+	return &serviceProvider{sp: sp, emailAttribute: cfg.EmailAttribute}, nil
+}
+
+func loadIDPMetadata(cfg Config) (*gosaml.EntityDescriptor, error) {
+	if cfg.IDPMetadataURL != "" {
+		u, err := url.Parse(cfg.IDPMetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse idp metadata url: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), fetchMetadataTimeout)
+		defer cancel()
+		md, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch idp metadata: %w", err)
+		}
+		return md, nil
+	}
+
+	b, err := os.ReadFile(cfg.IDPMetadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idp metadata: %w", err)
+	}
+	md, err := samlsp.ParseMetadata(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse idp metadata: %w", err)
+	}
+	return md, nil
+}
+
+func (s *serviceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	req, err := s.sp.MakeAuthenticationRequest(
+		s.sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding), gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to make authn request: %w", err)
+	}
+	u, err := req.Redirect(relayState, s.sp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to make redirect url: %w", err)
+	}
+	return u.String(), req.ID, nil
+}
+
+func (s *serviceProvider) ParseResponse(samlResponse string, requestIDs []string) (*UserInfo, error) {
+	b, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode saml response: %w", err)
+	}
+	a, err := s.sp.ParseXMLResponse(b, requestIDs, s.sp.AcsURL)
+	if err != nil {
+		// 検証に失敗した詳細な理由はPrivateErrにしか入っていない
+		var ire *gosaml.InvalidResponseError
+		if errors.As(err, &ire) {
+			return nil, fmt.Errorf("invalid saml response: %w", ire.PrivateErr)
+		}
+		return nil, fmt.Errorf("invalid saml response: %w", err)
+	}
+	if a.Subject == nil || a.Subject.NameID == nil {
+		return nil, errors.New("saml assertion has no name id")
+	}
+
+	info := &UserInfo{NameID: a.Subject.NameID.Value}
+	info.Email = s.attribute(a, s.emailAttribute)
+	if info.Email == "" {
+		info.Email = info.NameID
+	}
+	// NameIDがemail形式でないIdPで、emailの属性も送られていない
+	if !strings.Contains(info.Email, "@") {
+		return nil, fmt.Errorf("saml assertion has no email: %q", info.Email)
+	}
+	return info, nil
+}
+
+// アサーションの属性の最初の値。IdPによってNameかFriendlyNameのどちらかで送られる
+func (s *serviceProvider) attribute(a *gosaml.Assertion, name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, st := range a.AttributeStatements {
+		for _, attr := range st.Attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return attr.Values[0].Value
+			}
+		}
+	}
+	return ""
+}
+
+func (s *serviceProvider) Metadata() ([]byte, error) {
+	b, err := xml.MarshalIndent(s.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sp metadata: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,61 @@
+package sms
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 保持しておくSMSの上限。超えた場合は古いものから捨てる
+var fakeLimit = 100
+
+// FakeSenderで送信したSMS
+type SentMessage struct {
+	To     string
+	Body   string
+	SentAt time.Time
+}
+
+// SMSを送信せずにメモリ上に保持するISmsSender
+// 開発環境でTwilioのアカウントを用意せずに、送信された確認コードを確認するために使う
+type FakeSender struct {
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+func NewFakeSender() *FakeSender {
+	return &FakeSender{}
+}
+
+func (s *FakeSender) Send(_ context.Context, to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, SentMessage{To: to, Body: body, SentAt: time.Now()})
+	if len(s.messages) > fakeLimit {
+		s.messages = s.messages[len(s.messages)-fakeLimit:]
+	}
+	return nil
+}
+
+// 保持しているSMSを新しい順に返す。toが空でない場合はその宛先のSMSだけを返す
+func (s *FakeSender) Messages(to string) []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := make([]SentMessage, 0, len(s.messages))
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if to == "" || s.messages[i].To == to {
+			ms = append(ms, s.messages[i])
+		}
+	}
+	return ms
+}
+
+// 保持しているSMSを全て削除する
+func (s *FakeSender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
@@ -0,0 +1,36 @@
+package sms
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("login-example/sms")
+
+// 宛先が電話番号として正しくないか、SMSを受け取れない番号
+var ErrInvalidNumber = errors.New("invalid phone number")
+
+// SMSを送信する。toはE.164形式(+819012345678)の電話番号
+type ISmsSender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// 外部への送信のスパンを開始する。本文には確認コードが含まれるので、属性には記録しない
+func startSendSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// 送信に失敗した場合はスパンにエラーを記録する
+func endSendSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	return err
+}
@@ -0,0 +1,95 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const twilioDefaultBaseURL = "https://api.twilio.com"
+
+// 宛先が不正な場合のTwilioのエラーコード
+// https://www.twilio.com/docs/api/errors
+var twilioInvalidNumberCodes = map[int]bool{
+	21211: true, // Invalid 'To' Phone Number
+	21214: true, // 'To' phone number cannot be reached
+	21408: true, // Permission to send an SMS has not been enabled for the region
+	21614: true, // 'To' number is not a valid mobile number
+}
+
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	// 送信元の電話番号。MessagingServiceSIDが設定されている場合はそちらを使う
+	From                string
+	MessagingServiceSID string
+	// 空の場合はhttps://api.twilio.com
+	BaseURL string
+}
+
+type twilioSender struct {
+	cfg    TwilioConfig
+	client *http.Client
+}
+
+func NewTwilioSender(cfg TwilioConfig) ISmsSender {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = twilioDefaultBaseURL
+	}
+	return &twilioSender{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// https://www.twilio.com/docs/messaging/api/message-resource#create-a-message-resource
+func (s *twilioSender) Send(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	if s.cfg.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", s.cfg.MessagingServiceSID)
+	} else {
+		form.Set("From", s.cfg.From)
+	}
+
+	ctx, span := startSendSpan(ctx, "twilio.send", attribute.String("sms.provider", "twilio"))
+	endpoint := s.cfg.BaseURL + "/2010-04-01/Accounts/" + url.PathEscape(s.cfg.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return endSendSpan(span, err)
+	}
+	req.SetBasicAuth(s.cfg.AccountSID, s.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return endSendSpan(span, s.call(req))
+}
+
+func (s *twilioSender) call(req *http.Request) error {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call twilio api: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		// コネクションを再利用できるように、ボディは読み捨てる
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	var e struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		return fmt.Errorf("twilio: %d: %s", res.StatusCode, body)
+	}
+	if twilioInvalidNumberCodes[e.Code] {
+		return fmt.Errorf("%w: twilio: %d: %s", ErrInvalidNumber, e.Code, e.Message)
+	}
+	return fmt.Errorf("twilio: %d: %s", e.Code, e.Message)
+}
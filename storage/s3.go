@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// アップロードしたファイルはキーが変わるので、長くキャッシュさせる
+const s3CacheControl = "public, max-age=31536000, immutable"
+
+type S3Config struct {
+	// 空の場合はAWS_REGIONなど、AWS SDKのデフォルトの設定を使う
+	Region string
+	Bucket string
+	// CloudFrontなどで配信する場合のURL。空の場合はバケットの仮想ホスト形式のURLを使う
+	PublicURL string
+}
+
+// S3のバケットに保存する。公開URLから読めるように、バケットポリシーかCDNを設定しておく
+type S3Storage struct {
+	client    *s3.Client
+	bucket    string
+	publicURL string
+}
+
+// 認証情報はAWS SDKのデフォルトの方法(環境変数、共有設定ファイル、IAMロールなど)で取得する
+func NewS3Storage(ctx context.Context, cfg S3Config) (*S3Storage, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, awsCfg.Region)
+	}
+	return &S3Storage{client: s3.NewFromConfig(awsCfg), bucket: cfg.Bucket, publicURL: publicURL}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body []byte, contentType string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		Body:         bytes.NewReader(body),
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String(s3CacheControl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to put s3 object: %w", err)
+	}
+	return s.publicURL + "/" + key, nil
+}
+
+// S3のDeleteObjectは、存在しないキーでも成功する
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3 object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) KeyFromURL(u string) (string, bool) {
+	return keyFromURL(s.publicURL, u)
+}
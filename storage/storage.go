@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// キーにディレクトリの外を指すパスなどが含まれている
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// アップロードされたファイルを保存して、公開URLを返す
+type IStorage interface {
+	// keyはスラッシュ区切りの相対パス。同じキーのファイルは上書きする
+	Put(ctx context.Context, key string, body []byte, contentType string) (string, error)
+	// 存在しないキーを削除してもエラーにしない
+	Delete(ctx context.Context, key string) error
+	// Putで返した公開URLからキーを返す。このストレージのURLでない場合はfalseを返す
+	KeyFromURL(u string) (string, bool)
+}
+
+func validKey(key string) bool {
+	return key != "" && !strings.Contains(key, "\\") && filepath.IsLocal(filepath.FromSlash(key)) && path.Clean(key) == key
+}
+
+// ローカルのディレクトリに保存する。公開URLはbaseURLの下で配信されることを前提にする
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalStorage{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStorage) Put(_ context.Context, key string, body []byte, _ string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	// 書き込み途中のファイルが配信されないように、一時ファイルに書いてからリネームする
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return s.baseURL + "/" + key, nil
+}
+
+func (s *LocalStorage) Delete(_ context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) KeyFromURL(u string) (string, bool) {
+	return keyFromURL(s.baseURL, u)
+}
+
+func keyFromURL(baseURL, u string) (string, bool) {
+	key, ok := strings.CutPrefix(u, baseURL+"/")
+	if !ok {
+		return "", false
+	}
+	key, err := url.PathUnescape(key)
+	if err != nil || !validKey(key) {
+		return "", false
+	}
+	return key, true
+}
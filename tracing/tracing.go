@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// OTEL_SERVICE_NAMEが設定されていない場合のサービス名
+const defaultServiceName = "login-example"
+
+// トレースのエクスポーターを設定して、終了時に呼ぶ関数を返す
+// OTEL_EXPORTER_OTLP_ENDPOINTが設定されていればOTLP/HTTPで送信し、なければ何もしない
+// エンドポイント以外の設定も、OTEL_EXPORTER_OTLP_*の環境変数で上書きできる
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	// トレースを送信しない場合でも、上流から受け取ったトレースコンテキストは引き継ぐ
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+	}
+
+	// 後に指定したものが優先されるので、環境変数のOTEL_SERVICE_NAMEなどで上書きできる
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(defaultServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"login-example/random"
+	"strings"
+)
+
+// 本人確認用トークンの形式
+type ActivateTokenMode string
+
+const (
+	// 英数字。コピー&ペーストで入力してもらう想定
+	ActivateTokenAlphanumeric = ActivateTokenMode("alphanumeric")
+	// 数字のみ。SMSやメールのワンタイムパスワードのように手入力してもらう想定
+	ActivateTokenNumeric = ActivateTokenMode("numeric")
+)
+
+const (
+	alphanumericLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	numericLetters      = "0123456789"
+)
+
+// 形式ごとの、トークンの長さのデフォルト値
+func (m ActivateTokenMode) defaultLength() int {
+	if m == ActivateTokenNumeric {
+		return 6
+	}
+	return 8
+}
+
+// 形式に合わせて、lengthの長さの本人確認用トークンを作成する
+func (m ActivateTokenMode) generate(length int) string {
+	if m == ActivateTokenNumeric {
+		return random.Numeric(length)
+	}
+	return random.Alphanumeric(length)
+}
+
+// トークンが形式と長さに合っているか
+func (m ActivateTokenMode) valid(token string, length int) bool {
+	if len(token) != length {
+		return false
+	}
+	letters := alphanumericLetters
+	if m == ActivateTokenNumeric {
+		letters = numericLetters
+	}
+	for _, r := range token {
+		if !strings.ContainsRune(letters, r) {
+			return false
+		}
+	}
+	return true
+}
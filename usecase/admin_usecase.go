@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/repository"
+	"time"
+)
+
+type IAdminUsecase interface {
+	ListAuditLogs(ctx context.Context, opts repository.AuditListOptions) (entity.AuditLogs, int64, error)
+	ListUsers(ctx context.Context, opts repository.ListOptions) (entity.Users, int64, error)
+	// ユーザーの利用を停止、禁止するか、UserActiveを渡して解除する。理由は監査ログに記録する
+	SetUserState(ctx context.Context, adminID, uid entity.UserID, state entity.UserState, reason string) (*entity.User, error)
+}
+
+type adminUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+	sr repository.ISessionRepository
+	tx repository.ITransactor
+	rs auth.IRevocationStore
+}
+
+func NewAdminUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, sr repository.ISessionRepository, tx repository.ITransactor, rs auth.IRevocationStore) IAdminUsecase {
+	return &adminUsecase{ur: ur, ar: ar, sr: sr, tx: tx, rs: rs}
+}
+
+func (au *adminUsecase) ListAuditLogs(ctx context.Context, opts repository.AuditListOptions) (entity.AuditLogs, int64, error) {
+	ctx, span := tracer.Start(ctx, "AdminUsecase.ListAuditLogs")
+	defer span.End()
+
+	return au.ar.List(ctx, opts)
+}
+
+func (au *adminUsecase) ListUsers(ctx context.Context, opts repository.ListOptions) (entity.Users, int64, error) {
+	ctx, span := tracer.Start(ctx, "AdminUsecase.ListUsers")
+	defer span.End()
+
+	return au.ur.List(ctx, opts)
+}
+
+func (au *adminUsecase) SetUserState(ctx context.Context, adminID, uid entity.UserID, state entity.UserState, reason string) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "AdminUsecase.SetUserState")
+	defer span.End()
+
+	// 自分自身を停止すると、解除できる管理者がいなくなるおそれがある
+	if adminID == uid {
+		return nil, ErrInvalidUserState
+	}
+	u, err := au.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	// 仮登録のユーザーや、SCIMで無効化されたユーザーは対象外
+	if !u.IsActive() && !u.IsRestricted() {
+		return nil, ErrInvalidUserState
+	}
+	if u.State == state {
+		return u, nil
+	}
+
+	var event entity.AuditEvent
+	switch state {
+	case entity.UserSuspended:
+		event = entity.AuditUserSuspend
+	case entity.UserBanned:
+		event = entity.AuditUserBan
+	case entity.UserActive:
+		event = entity.AuditUserReinstate
+	default:
+		return nil, ErrInvalidUserState
+	}
+
+	u.State = state
+	if err := au.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := au.ur.UpdateState(ctx, u); err != nil {
+			return err
+		}
+		if !u.IsRestricted() {
+			return nil
+		}
+		// 停止や禁止の場合は、全端末からのログアウトと同じく発行済みのトークンを全て無効にする
+		if err := au.ur.RevokeTokens(ctx, u); err != nil {
+			return err
+		}
+		if err := revokeUserSessions(ctx, au.sr, au.rs, u.ID); err != nil {
+			return err
+		}
+		return au.sr.DeleteByUserID(ctx, u.ID)
+	}); err != nil {
+		return nil, err
+	}
+	if u.IsRestricted() {
+		if err := au.rs.RevokeUserTokens(ctx, u.ID, u.TokenVersion, time.Now().Add(auth.AccessTokenTTL+auth.ClockSkew)); err != nil {
+			return nil, err
+		}
+	}
+
+	writeAuditLog(ctx, au.ar, event, u.ID, u.Email, fmt.Sprintf("admin_id=%d reason=%s", adminID, reason))
+	return u, nil
+}
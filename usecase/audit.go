@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/repository"
+)
+
+// 監査ログを記録する。記録に失敗しても本来の処理は継続させる
+func writeAuditLog(ctx context.Context, ar repository.IAuditRepository, event entity.AuditEvent, uid entity.UserID, email, detail string) {
+	l := &entity.AuditLog{
+		UserID: uid,
+		Email:  email,
+		Event:  event,
+		Detail: detail,
+	}
+	if err := ar.Create(ctx, l); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to write audit log", slog.Any("event", event), slog.Any("user_id", uid), logging.Err(err))
+	}
+}
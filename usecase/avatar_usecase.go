@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/random"
+	"login-example/repository"
+	"login-example/storage"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// 保存するアバター画像の縦横のピクセル数
+	avatarSize = 256
+	// デコードする前に確認する縦横のピクセル数の上限。小さいファイルで大量のメモリを使わせないため
+	maxAvatarSourcePixels = 4096
+)
+
+type IAvatarUsecase interface {
+	// 画像を正方形に切り抜いて縮小し、PNGで保存する。保存した画像の公開URLをユーザーに設定する
+	Upload(ctx context.Context, uid entity.UserID, r io.Reader) (*entity.User, error)
+}
+
+type avatarUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+	st storage.IStorage
+	// アップロードできるファイルの最大サイズ(バイト)
+	maxSize int64
+}
+
+func NewAvatarUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, st storage.IStorage, maxSize int64) IAvatarUsecase {
+	return &avatarUsecase{ur: ur, ar: ar, st: st, maxSize: maxSize}
+}
+
+func (au *avatarUsecase) Upload(ctx context.Context, uid entity.UserID, r io.Reader) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "AvatarUsecase.Upload")
+	defer span.End()
+
+	data, err := io.ReadAll(io.LimitReader(r, au.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > au.maxSize {
+		return nil, ErrImageTooLarge
+	}
+	img, err := resizeAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := au.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	// CDNなどにキャッシュされた古い画像が表示されないように、アップロードのたびに別のキーにする
+	key := fmt.Sprintf("avatars/%d/%s.png", u.ID, random.Alphanumeric(16))
+	url, err := au.st.Put(ctx, key, img, "image/png")
+	if err != nil {
+		return nil, err
+	}
+	prev := u.AvatarURL
+	u.AvatarURL = url
+	if err := au.ur.UpdateAvatar(ctx, u); err != nil {
+		au.delete(ctx, key)
+		return nil, err
+	}
+
+	// 前の画像はもう参照されないので、削除できなくても更新は成功させる
+	if prevKey, ok := au.st.KeyFromURL(prev); ok {
+		au.delete(ctx, prevKey)
+	}
+	writeAuditLog(ctx, au.ar, entity.AuditAvatarUpdate, u.ID, u.Email, "key="+key)
+	return u, nil
+}
+
+func (au *avatarUsecase) delete(ctx context.Context, key string) {
+	if err := au.st.Delete(ctx, key); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to delete avatar", slog.String("key", key), logging.Err(err))
+	}
+}
+
+// 画像の中央を正方形に切り抜いて、avatarSizeに縮小したPNGを返す
+func resizeAvatar(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width > maxAvatarSourcePixels || cfg.Height > maxAvatarSourcePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	// 元の画像が小さい場合は拡大しない
+	size := min(side, avatarSize)
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
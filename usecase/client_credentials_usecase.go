@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// OAuth 2.0のclient credentialsグラント
+const GrantTypeClientCredentials = "client_credentials"
+
+// クライアントのシークレットの長さ
+const clientSecretLength = 40
+
+// client credentialsグラントで発行したアクセストークン
+type ClientToken struct {
+	AccessToken []byte
+	Scopes      []string
+}
+
+type IClientCredentialsUsecase interface {
+	// クライアントを登録する。シークレットは返り値の文字列でのみ返す
+	// redirectURIsはOpenID Connectの認可コードフローを使う場合のみ指定する
+	Register(ctx context.Context, name string, scopes, redirectURIs []string) (*entity.OAuthClient, string, error)
+	// scopesが空の場合は、クライアントに許可された全てのscopeを付与する
+	IssueToken(ctx context.Context, grantType, clientID, secret string, scopes []string) (*ClientToken, error)
+}
+
+type clientCredentialsUsecase struct {
+	cr    repository.IOAuthClientRepository
+	jwter auth.IJwtGenerator
+}
+
+func NewClientCredentialsUsecase(cr repository.IOAuthClientRepository, jwter auth.IJwtGenerator) IClientCredentialsUsecase {
+	return &clientCredentialsUsecase{cr: cr, jwter: jwter}
+}
+
+func (cu *clientCredentialsUsecase) Register(ctx context.Context, name string, scopes, redirectURIs []string) (*entity.OAuthClient, string, error) {
+	ctx, span := tracer.Start(ctx, "ClientCredentialsUsecase.Register")
+	defer span.End()
+
+	for _, s := range scopes {
+		if !slices.Contains(entity.ClientScopes, s) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+	}
+	// RPのURLはhttpsのみ。開発環境のためにlocalhostだけはhttpを許可する
+	for _, uri := range redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Fragment != "" || !(u.Scheme == "https" || u.Scheme == "http" && u.Hostname() == "localhost") {
+			return nil, "", fmt.Errorf("invalid redirect uri: %s", uri)
+		}
+	}
+
+	secret := random.Alphanumeric(clientSecretLength)
+	cl := &entity.OAuthClient{
+		ID:         "cl_" + random.Alphanumeric(16),
+		Name:       name,
+		SecretHash: hashToken(secret),
+		Scopes:     strings.Join(scopes, " "),
+		// 完全一致で比較するので、登録したURLをそのまま保存する
+		RedirectURIs: strings.Join(redirectURIs, " "),
+	}
+	if err := cu.cr.Create(ctx, cl); err != nil {
+		return nil, "", err
+	}
+	return cl, secret, nil
+}
+
+// クライアントを認証して、サービス間の呼び出し用のアクセストークンを発行する
+func (cu *clientCredentialsUsecase) IssueToken(ctx context.Context, grantType, clientID, secret string, scopes []string) (*ClientToken, error) {
+	ctx, span := tracer.Start(ctx, "ClientCredentialsUsecase.IssueToken")
+	defer span.End()
+
+	if grantType != GrantTypeClientCredentials {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	cl, err := authenticateClient(ctx, cu.cr, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := strings.Fields(cl.Scopes)
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+	}
+
+	token, err := cu.jwter.GenerateClientToken(cl.ID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientToken{AccessToken: token, Scopes: scopes}, nil
+}
+
+// クライアントIDとシークレットを確認する。どちらが間違っていても同じErrInvalidClientを返す
+func authenticateClient(ctx context.Context, cr repository.IOAuthClientRepository, clientID, secret string) (*entity.OAuthClient, error) {
+	cl, err := cr.Get(ctx, clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+	if !compareTokenHash(secret, cl.SecretHash) {
+		return nil, ErrInvalidClient
+	}
+	return cl, nil
+}
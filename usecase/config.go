@@ -0,0 +1,40 @@
+package usecase
+
+import "time"
+
+// userUsecaseの設定。環境ごとに調整できるように、configの値からNewUserUsecaseに渡す
+type UserUsecaseConfig struct {
+	// 本人確認用トークンの形式と長さ。長さが0の場合は形式ごとのデフォルト値を使う
+	ActivateTokenMode   ActivateTokenMode
+	ActivateTokenLength int
+	// 本人確認用トークンの有効期限
+	ActivateTokenTTL time.Duration
+	// emailの変更の確認用トークンの有効期限
+	EmailChangeTokenTTL time.Duration
+	// パスワード強度の最低スコア(0〜4)
+	MinPasswordScore int
+	// trueの場合は、仮登録に招待コードが必要
+	InviteOnly bool
+	// 仮登録できるemailのドメイン。空の場合は全てのドメインを許可する
+	AllowedEmailDomains []string
+	// 仮登録できないemailのドメイン。AllowedEmailDomainsより優先する
+	BlockedEmailDomains []string
+	// 使い捨てメールアドレスでの仮登録の扱い。空の場合はallowと同じ
+	DisposableEmail DisposableEmailPolicy
+	// email_keyの作り方。外部のログインなど、他のusecaseと同じ設定を使う
+	EmailKeys EmailKeyer
+	// trueの場合は、不審なパスワードでのログインでトークンを発行せず、マジックリンクで本人確認させる
+	LoginStepUp bool
+	// trueの場合は、信頼済みの端末からのログインでは本人確認しない
+	SkipStepUpOnTrustedDevice bool
+}
+
+func DefaultUserUsecaseConfig() UserUsecaseConfig {
+	return UserUsecaseConfig{
+		ActivateTokenMode:   ActivateTokenAlphanumeric,
+		ActivateTokenLength: ActivateTokenAlphanumeric.defaultLength(),
+		ActivateTokenTTL:    30 * time.Minute,
+		EmailChangeTokenTTL: 30 * time.Minute,
+		MinPasswordScore:    3,
+	}
+}
@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/repository"
+	"strings"
+)
+
+// 同じ受信箱に届くGmailのドメイン
+var gmailDomains = []string{"gmail.com", "googlemail.com"}
+
+// 入力されたemailを保存・検索する形にする。前後の空白を除いて小文字にする
+// ローカル部の大文字と小文字を区別するメールサーバーはほぼないので、全体を小文字にする
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// 同じ人のemailかを確認するためのキー。emailは正規化済みのもの
+// foldGmailがtrueの場合は、Gmailのローカル部の.と+以降を無視して、ドメインをgmail.comにそろえる
+func emailKey(email string, foldGmail bool) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !foldGmail || !ok {
+		return email
+	}
+	for _, d := range gmailDomains {
+		if domain == d {
+			local, _, _ = strings.Cut(local, "+")
+			return strings.ReplaceAll(local, ".", "") + "@" + gmailDomains[0]
+		}
+	}
+	return email
+}
+
+// ユーザーのemail_keyを作る。登録の経路によらず同じキーになるように、emailを保存・検索する全てのusecaseで同じ設定を使う
+type EmailKeyer struct {
+	// trueの場合は、Gmailの.や+によるエイリアスを同じemailとして扱う
+	FoldGmailAliases bool
+}
+
+// 正規化していないemailも受け付ける
+func (k EmailKeyer) Key(email string) string {
+	return emailKey(normalizeEmail(email), k.FoldGmailAliases)
+}
+
+// RekeyEmailsの結果
+type RekeyResult struct {
+	Updated int
+	// 他のユーザーと同じキーになるため、更新できなかったユーザー。手動で統合する
+	Conflicts []entity.UserID
+}
+
+// 既存のユーザーのemail_keyを、現在の設定で作り直す。fold_gmail_aliasesを変更した後に実行する
+// dryRunがtrueの場合は、更新せずに件数だけを数える
+func RekeyEmails(ctx context.Context, ur repository.IUserRepository, k EmailKeyer, dryRun bool) (RekeyResult, error) {
+	var res RekeyResult
+	// 作り直したキー。更新前の行との重複も、DBの一意制約に頼らずに検出する
+	owners := map[string]entity.UserID{}
+	var after entity.UserID
+	for {
+		us, err := ur.ListEmailKeys(ctx, after, 500)
+		if err != nil {
+			return res, err
+		}
+		if len(us) == 0 {
+			return res, nil
+		}
+		for _, u := range us {
+			after = u.ID
+			key := k.Key(u.Email)
+			if owner, ok := owners[key]; ok && owner != u.ID {
+				logging.FromContext(ctx).WarnContext(ctx, "email key conflict", slog.Any("user_id", u.ID), slog.Any("other_user_id", owner))
+				res.Conflicts = append(res.Conflicts, u.ID)
+				continue
+			}
+			if key == u.EmailKey {
+				owners[key] = u.ID
+				continue
+			}
+			if !dryRun {
+				u.EmailKey = key
+				if err := ur.UpdateEmailKey(ctx, u); errors.Is(err, repository.ErrEmailTaken) {
+					res.Conflicts = append(res.Conflicts, u.ID)
+					continue
+				} else if err != nil {
+					return res, err
+				}
+			}
+			owners[key] = u.ID
+			res.Updated++
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 登録が許可されていないドメインのemailで登録しようとした場合のエラー
+type EmailDomainError struct {
+	Domain string
+}
+
+func (e *EmailDomainError) Error() string {
+	return fmt.Sprintf("email domain not allowed: %s", e.Domain)
+}
+
+// 登録できるemailのドメインを確認する
+// allowedが空の場合は、blockedに含まれないドメインを全て許可する。サブドメインも一致として扱う
+func checkEmailDomain(email string, allowed, blocked []string) error {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return &EmailDomainError{}
+	}
+	domain = strings.ToLower(domain)
+
+	if matchDomain(domain, blocked) {
+		return &EmailDomainError{Domain: domain}
+	}
+	if len(allowed) > 0 && !matchDomain(domain, allowed) {
+		return &EmailDomainError{Domain: domain}
+	}
+	return nil
+}
+
+// domainがdomainsのいずれかか、そのサブドメインか
+func matchDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// 使い捨てメールアドレスで登録しようとした場合の扱い
+type DisposableEmailPolicy string
+
+const (
+	// 判定しない
+	DisposableEmailAllow = DisposableEmailPolicy("allow")
+	// 登録は許可して、監査ログに記録する。adminがあとで確認できる
+	DisposableEmailFlag = DisposableEmailPolicy("flag")
+	// 登録させない
+	DisposableEmailBlock = DisposableEmailPolicy("block")
+)
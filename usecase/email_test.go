@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"login-example/entity"
+	"login-example/inmem"
+)
+
+func TestEmailKeyer_Key(t *testing.T) {
+	tests := []struct {
+		email string
+		fold  bool
+		want  string
+	}{
+		{" User@Example.com ", false, "user@example.com"},
+		{"f.o.o+news@gmail.com", false, "f.o.o+news@gmail.com"},
+		{"F.o.o+news@Gmail.com", true, "foo@gmail.com"},
+		{"foo@googlemail.com", true, "foo@gmail.com"},
+		{"f.o.o+news@example.com", true, "f.o.o+news@example.com"},
+		{"no-at-sign", true, "no-at-sign"},
+	}
+	for _, tt := range tests {
+		if got := (EmailKeyer{FoldGmailAliases: tt.fold}).Key(tt.email); got != tt.want {
+			t.Errorf("Key(%q) fold=%v = %q, want %q", tt.email, tt.fold, got, tt.want)
+		}
+	}
+}
+
+func registerUsers(t *testing.T, ur *inmem.UserRepository, emails ...string) []*entity.User {
+	t.Helper()
+	var us []*entity.User
+	for _, email := range emails {
+		u := &entity.User{Email: email}
+		if err := ur.Register(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+		us = append(us, u)
+	}
+	return us
+}
+
+func TestRekeyEmails(t *testing.T) {
+	ctx := context.Background()
+	ur := inmem.NewUserRepository()
+	us := registerUsers(t, ur, "foo@gmail.com", "f.o.o+news@googlemail.com", "bar.baz@gmail.com", "a.b@example.com")
+	k := EmailKeyer{FoldGmailAliases: true}
+
+	res, err := RekeyEmails(ctx, ur, k, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated != 1 || !slices.Equal(res.Conflicts, []entity.UserID{us[1].ID}) {
+		t.Errorf("dry run = %+v, want 1 updated and conflict %v", res, us[1].ID)
+	}
+	if u, _ := ur.Get(ctx, us[2].ID); u.EmailKey != "bar.baz@gmail.com" {
+		t.Errorf("dry run updated email_key to %q", u.EmailKey)
+	}
+
+	res, err = RekeyEmails(ctx, ur, k, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated != 1 || !slices.Equal(res.Conflicts, []entity.UserID{us[1].ID}) {
+		t.Errorf("RekeyEmails() = %+v, want 1 updated and conflict %v", res, us[1].ID)
+	}
+	want := []string{"foo@gmail.com", "f.o.o+news@googlemail.com", "barbaz@gmail.com", "a.b@example.com"}
+	for i, u := range us {
+		got, err := ur.Get(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.EmailKey != want[i] {
+			t.Errorf("email_key of %s = %q, want %q", u.Email, got.EmailKey, want[i])
+		}
+	}
+
+	// 作り直した後は、エイリアスのemailでも同じユーザーが見つかる
+	if u, err := ur.GetByEmailKey(ctx, k.Key("Bar.Baz+x@googlemail.com")); err != nil || u.ID != us[2].ID {
+		t.Errorf("GetByEmailKey() = %v, %v, want user %v", u, err, us[2].ID)
+	}
+}
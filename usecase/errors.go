@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"errors"
+	"login-example/entity"
+)
+
+// usecaseが返すエラー。ハンドラーではこれらのエラーをHTTPステータスコードに変換する
+var (
+	ErrUserAlreadyActive = errors.New("user already active")
+	ErrUserInactive      = errors.New("user inactive")
+	// 管理者に利用を停止、または禁止されている
+	ErrUserSuspended = errors.New("user suspended")
+	ErrUserBanned    = errors.New("user banned")
+	// 管理者が、仮登録や退会済みなど変更できない状態のユーザーの状態を変えようとした
+	ErrInvalidUserState = errors.New("invalid user state transition")
+	// emailかパスワードが間違っている。どちらが間違っているかは知られないようにする
+	ErrInvalidCredential = errors.New("invalid credential")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token expired")
+	// リフレッシュトークンのセッションが失効している
+	ErrSessionExpired     = errors.New("session expired")
+	ErrTooManyAttempts    = errors.New("too many attempts")
+	ErrResendTooSoon      = errors.New("resend too soon")
+	ErrPasswordBreached   = errors.New("password found in data breach")
+	ErrEmailAlreadyInUse  = errors.New("email already in use")
+	ErrEmailNotChanged    = errors.New("email not changed")
+	ErrEmailNotVerified   = errors.New("email not verified by provider")
+	ErrNoEmailChange      = errors.New("email change not requested")
+	ErrUnknownProvider    = errors.New("unknown oauth provider")
+	ErrAuthenticatorClone = errors.New("authenticator may be cloned")
+	// OAuthのコールバックのstateが、リダイレクト時にcookieにセットしたものと一致しない。cookieの期限切れも含む
+	ErrInvalidOAuthState = errors.New("invalid oauth state")
+	// ユーザーのroleで許可されていないscope
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrTooManyTokens = errors.New("too many personal access tokens")
+	// トークンエンドポイントで、クライアントIDかシークレットが間違っている
+	ErrInvalidClient        = errors.New("invalid client")
+	ErrUnsupportedGrantType = errors.New("unsupported grant type")
+	// OpenID Connectの認可リクエストのパラメーターが不正
+	ErrInvalidAuthorizationRequest = errors.New("invalid authorization request")
+	// 認可コードが存在しない、使用済み、期限切れ、または発行時のリクエストと一致しない
+	ErrInvalidGrant = errors.New("invalid grant")
+	// SAMLのIdPで認証されたemailのユーザーが存在せず、自動作成も無効
+	ErrUserNotProvisioned = errors.New("user not provisioned")
+	// 組織のメンバーではない。存在しない組織も同じエラーにする
+	ErrNotOrgMember = errors.New("not a member of the organization")
+	// 組織でのroleで許可されていない操作
+	ErrOrgPermissionDenied = errors.New("organization permission denied")
+	// 組織の最後のownerは外せない
+	ErrLastOwner = errors.New("organization must have an owner")
+	// 招待されたemailと、承諾しようとしたユーザーのemailが違う
+	ErrInvitationEmailMismatch = errors.New("invitation email mismatch")
+	// 招待制の登録で、招待コードがない、または使えない
+	ErrInvalidInviteCode = errors.New("invalid invite code")
+	// 使い捨てメールアドレスでは登録できない
+	ErrDisposableEmail = errors.New("disposable email address not allowed")
+	// 不審なログインのため、メールで送ったマジックリンクで本人確認する必要がある
+	ErrStepUpRequired = errors.New("step-up verification required")
+	ErrTooManyDevices = errors.New("too many trusted devices")
+	// 同時に有効なセッションの数が上限に達していて、新しくログインできない
+	ErrTooManySessions = errors.New("too many sessions")
+	// アップロードされたファイルが、対応している形式の画像として読めない
+	ErrInvalidImage = errors.New("invalid image")
+	// アップロードされた画像のファイルサイズか、縦横のピクセル数が大きすぎる
+	ErrImageTooLarge = errors.New("image too large")
+	// SMSを受け取れない電話番号
+	ErrInvalidPhone = errors.New("invalid phone number")
+	// 他のユーザーが確認済みの電話番号
+	ErrPhoneAlreadyInUse = errors.New("phone number already in use")
+	ErrPhoneNotChanged   = errors.New("phone number not changed")
+	ErrNoPhoneChange     = errors.New("phone number change not requested")
+	// usernameに使えない文字を含むか、長さが範囲外
+	ErrInvalidUsername = errors.New("invalid username")
+	// サービスで予約しているusername
+	ErrUsernameReserved = errors.New("username is reserved")
+	// 他のユーザーが使っているusername
+	ErrUsernameAlreadyInUse = errors.New("username already in use")
+	// メールのテンプレートがない言語
+	ErrUnsupportedLocale = errors.New("unsupported locale")
+	// IANAのタイムゾーンの名前として読めない
+	ErrInvalidTimeZone = errors.New("invalid time zone")
+)
+
+// アクティブでないユーザーがログインしようとした時のエラー
+// 利用停止や禁止の場合は、クライアントが理由を表示できるように別のエラーにする
+func inactiveError(u *entity.User) error {
+	switch u.State {
+	case entity.UserSuspended:
+		return ErrUserSuspended
+	case entity.UserBanned:
+		return ErrUserBanned
+	}
+	return ErrUserInactive
+}
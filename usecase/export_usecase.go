@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/mail"
+	"login-example/repository"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// データエクスポートのダウンロードURL。トークンはクエリパラメータとして付与する
+	exportDownloadURL = "http://localhost:8000/api/v1/auth/export/download"
+	// エクスポートしたデータの保存期間
+	exportRetention = 24 * time.Hour
+	// エクスポート処理のタイムアウト
+	exportTimeout = 5 * time.Minute
+)
+
+type IExportUsecase interface {
+	RequestExport(ctx context.Context, uid entity.UserID) error
+	Download(ctx context.Context, token []byte) (*entity.DataExport, error)
+}
+
+type exportUsecase struct {
+	ur     repository.IUserRepository
+	ir     repository.IIdentityRepository
+	cr     repository.IWebAuthnCredentialRepository
+	lr     repository.ILoginHistoryRepository
+	sr     repository.ISessionRepository
+	er     repository.IDataExportRepository
+	mailer mail.IMailer
+	jwter  auth.IJwtBuilder
+}
+
+func NewExportUsecase(
+	ur repository.IUserRepository,
+	ir repository.IIdentityRepository,
+	cr repository.IWebAuthnCredentialRepository,
+	lr repository.ILoginHistoryRepository,
+	sr repository.ISessionRepository,
+	er repository.IDataExportRepository,
+	mailer mail.IMailer,
+	jwter auth.IJwtBuilder,
+) IExportUsecase {
+	return &exportUsecase{ur: ur, ir: ir, cr: cr, lr: lr, sr: sr, er: er, mailer: mailer, jwter: jwter}
+}
+
+// エクスポートに含める個人データ
+type userExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Profile    struct {
+		ID          entity.UserID    `json:"id"`
+		Email       string           `json:"email"`
+		Username    *string          `json:"username"`
+		Phone       string           `json:"phone"`
+		Name        string           `json:"name"`
+		DisplayName string           `json:"display_name"`
+		Bio         string           `json:"bio"`
+		AvatarURL   string           `json:"avatar_url"`
+		State       entity.UserState `json:"state"`
+		UpdatedAt   time.Time        `json:"updated_at"`
+		CreatedAt   time.Time        `json:"created_at"`
+	} `json:"profile"`
+	Preferences preferencesExport `json:"preferences"`
+	Identities  []identityExport  `json:"identities"`
+	Passkeys    []passkeyExport   `json:"passkeys"`
+	Logins      []loginExport     `json:"logins"`
+	Sessions    []sessionExport   `json:"sessions"`
+}
+
+type preferencesExport struct {
+	Locale            string `json:"locale"`
+	TimeZone          string `json:"timezone"`
+	NotifyOnLogin     bool   `json:"notify_on_login"`
+	NotifyOnNewClient bool   `json:"notify_on_new_client"`
+}
+
+type identityExport struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type passkeyExport struct {
+	AttestationType string    `json:"attestation_type"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type loginExport struct {
+	Method    string    `json:"method"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type sessionExport struct {
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// データエクスポートを受け付ける。エクスポートは非同期で行い、完了したらダウンロードリンクをメールで送信する
+func (eu *exportUsecase) RequestExport(ctx context.Context, uid entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "ExportUsecase.RequestExport")
+	defer span.End()
+
+	u, err := eu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+
+	// リクエストのcontextはレスポンスを返すとキャンセルされるので、新しいcontextで実行する
+	// リクエストのスパンとはリンクでつなげて、トレースから辿れるようにする
+	link := trace.LinkFromContext(ctx)
+	logger := logging.FromContext(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(logging.WithLogger(context.Background(), logger), exportTimeout)
+		defer cancel()
+		ctx, span := tracer.Start(ctx, "ExportUsecase.export", trace.WithLinks(link))
+		defer span.End()
+		if err := eu.export(ctx, u); err != nil {
+			logger.ErrorContext(ctx, "failed to export user data", slog.Any("user_id", u.ID), logging.Err(err))
+		}
+	}()
+	return nil
+}
+
+func (eu *exportUsecase) export(ctx context.Context, u *entity.User) error {
+	ue := userExport{ExportedAt: time.Now()}
+	ue.Profile.ID = u.ID
+	ue.Profile.Email = u.Email
+	ue.Profile.Username = u.Username
+	ue.Profile.Phone = u.Phone
+	ue.Profile.Name = u.Name
+	ue.Profile.DisplayName = u.DisplayName
+	ue.Profile.Bio = u.Bio
+	ue.Profile.AvatarURL = u.AvatarURL
+	ue.Profile.State = u.State
+	ue.Profile.UpdatedAt = u.UpdatedAt
+	ue.Profile.CreatedAt = u.CreatedAt
+	ue.Preferences = preferencesExport(u.Preferences)
+
+	is, err := eu.ir.ListByUserID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	ue.Identities = make([]identityExport, 0, len(is))
+	for _, i := range is {
+		ue.Identities = append(ue.Identities, identityExport{
+			Provider:  i.Provider,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	cs, err := eu.cr.ListByUserID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	ue.Passkeys = make([]passkeyExport, 0, len(cs))
+	for _, c := range cs {
+		ue.Passkeys = append(ue.Passkeys, passkeyExport{
+			AttestationType: c.AttestationType,
+			UpdatedAt:       c.UpdatedAt,
+			CreatedAt:       c.CreatedAt,
+		})
+	}
+
+	hs, err := eu.lr.ListByUserID(ctx, u.ID, 0)
+	if err != nil {
+		return err
+	}
+	ue.Logins = make([]loginExport, 0, len(hs))
+	for _, h := range hs {
+		ue.Logins = append(ue.Logins, loginExport{
+			Method:    h.Method,
+			IPAddress: h.IPAddress,
+			UserAgent: h.UserAgent,
+			Country:   h.Country,
+			City:      h.City,
+			CreatedAt: h.CreatedAt,
+		})
+	}
+
+	ss, err := eu.sr.ListByUserID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	ue.Sessions = make([]sessionExport, 0, len(ss))
+	for _, s := range ss {
+		ue.Sessions = append(ue.Sessions, sessionExport{
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+			ExpiresAt:  s.ExpiresAt,
+			LastUsedAt: s.LastUsedAt,
+			CreatedAt:  s.CreatedAt,
+		})
+	}
+
+	data, err := json.MarshalIndent(ue, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	e := &entity.DataExport{
+		UserID:    u.ID,
+		Data:      data,
+		ExpiresAt: time.Now().Add(exportRetention),
+	}
+	if err := eu.er.Create(ctx, e); err != nil {
+		return err
+	}
+
+	tok, err := eu.jwter.GenerateExportToken(e)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(exportDownloadURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", string(tok))
+	link.RawQuery = q.Encode()
+
+	return eu.mailer.SendWithExportLink(ctx, u.Email, link.String())
+}
+
+// ダウンロードリンクのトークンを検証して、エクスポートしたデータを取得する
+func (eu *exportUsecase) Download(ctx context.Context, token []byte) (*entity.DataExport, error) {
+	ctx, span := tracer.Start(ctx, "ExportUsecase.Download")
+	defer span.End()
+
+	et, err := eu.jwter.ParseExportToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	e, err := eu.er.Get(ctx, et.ExportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	// 別のユーザーのエクスポートは取得できない
+	if e.UserID != et.UserID {
+		return nil, ErrInvalidToken
+	}
+	if e.IsExpired() {
+		return nil, ErrTokenExpired
+	}
+	return e, nil
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/repository"
+)
+
+// イントロスペクションの結果。Activeがfalseの場合、他のフィールドは空になる
+type Introspection struct {
+	Active bool
+	Token  *auth.TokenInfo
+}
+
+type IIntrospectionUsecase interface {
+	Introspect(ctx context.Context, token []byte) (*Introspection, error)
+}
+
+type introspectionUsecase struct {
+	ur    repository.IUserRepository
+	sr    repository.ISessionRepository
+	rs    auth.IRevocationStore
+	jwter auth.IJwtParser
+}
+
+func NewIntrospectionUsecase(ur repository.IUserRepository, sr repository.ISessionRepository, rs auth.IRevocationStore, jwter auth.IJwtParser) IIntrospectionUsecase {
+	return &introspectionUsecase{ur: ur, sr: sr, rs: rs, jwter: jwter}
+}
+
+var inactive = &Introspection{Active: false}
+
+// トークンが今も使えるかを確認する。署名や有効期限だけでなく、失効やユーザーの状態も確認する
+// 使えない理由はトークンを提示した相手に教えないので、全てActive: falseで返す
+func (iu *introspectionUsecase) Introspect(ctx context.Context, token []byte) (*Introspection, error) {
+	ctx, span := tracer.Start(ctx, "IntrospectionUsecase.Introspect")
+	defer span.End()
+
+	info, err := iu.jwter.ParseToken(token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	u, err := iu.ur.Get(ctx, info.UserID)
+	// 退会済みのユーザーは取得できない
+	if errors.Is(err, sql.ErrNoRows) {
+		return inactive, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// パスワード変更などで失効させられたトークン
+	if !u.IsActive() || u.IsTokenRevoked(info.IssuedAt) {
+		return inactive, nil
+	}
+
+	active, err := iu.checkRevocation(ctx, u, info)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return inactive, nil
+	}
+	return &Introspection{Active: true, Token: info}, nil
+}
+
+// トークンの種類ごとに、個別に失効させられていないか確認する
+func (iu *introspectionUsecase) checkRevocation(ctx context.Context, u *entity.User, info *auth.TokenInfo) (bool, error) {
+	if info.Type == auth.AccessTokenType {
+		// jtiのないアクセストークンは個別に失効させられない
+		if info.JwtID == "" {
+			return true, nil
+		}
+		revoked, err := iu.rs.IsAccessTokenRevoked(ctx, info.JwtID)
+		return !revoked, err
+	}
+
+	revoked, err := iu.rs.IsSessionRevoked(ctx, info.SessionID)
+	if err != nil || revoked {
+		return false, err
+	}
+	s, err := iu.sr.Get(ctx, info.SessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return s.UserID == u.ID && !s.IsExpired(), nil
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"time"
+)
+
+// 招待コードの長さ。ユーザーが手で入力するので、トークンより短くする
+const inviteCodeLength = 16
+
+// adminが招待制の登録のための招待コードを管理する
+type IInviteCodeUsecase interface {
+	// ttlが0の場合は無期限。コード自体は返り値の文字列でのみ返す
+	Create(ctx context.Context, uid entity.UserID, note string, maxUses int, ttl time.Duration) (*entity.InviteCode, string, error)
+	List(ctx context.Context) (entity.InviteCodes, error)
+	// 取り消した招待コードでは登録できなくなる。登録済みのユーザーには影響しない
+	Revoke(ctx context.Context, uid entity.UserID, id entity.InviteCodeID) error
+}
+
+type inviteCodeUsecase struct {
+	ur  repository.IUserRepository
+	icr repository.IInviteCodeRepository
+	ar  repository.IAuditRepository
+}
+
+func NewInviteCodeUsecase(ur repository.IUserRepository, icr repository.IInviteCodeRepository, ar repository.IAuditRepository) IInviteCodeUsecase {
+	return &inviteCodeUsecase{ur: ur, icr: icr, ar: ar}
+}
+
+func (iu *inviteCodeUsecase) Create(ctx context.Context, uid entity.UserID, note string, maxUses int, ttl time.Duration) (*entity.InviteCode, string, error) {
+	ctx, span := tracer.Start(ctx, "InviteCodeUsecase.Create")
+	defer span.End()
+
+	u, err := iu.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	code := random.Alphanumeric(inviteCodeLength)
+	c := &entity.InviteCode{
+		CodeHash:  hashToken(code),
+		Note:      note,
+		MaxUses:   maxUses,
+		CreatedBy: uid,
+	}
+	if ttl > 0 {
+		exp := time.Now().Add(ttl)
+		c.ExpiresAt = &exp
+	}
+	if err := iu.icr.Create(ctx, c); err != nil {
+		return nil, "", err
+	}
+
+	writeAuditLog(ctx, iu.ar, entity.AuditInviteCodeCreate, u.ID, u.Email, fmt.Sprintf("id=%d max_uses=%d", c.ID, maxUses))
+	return c, code, nil
+}
+
+func (iu *inviteCodeUsecase) List(ctx context.Context) (entity.InviteCodes, error) {
+	ctx, span := tracer.Start(ctx, "InviteCodeUsecase.List")
+	defer span.End()
+
+	return iu.icr.List(ctx)
+}
+
+func (iu *inviteCodeUsecase) Revoke(ctx context.Context, uid entity.UserID, id entity.InviteCodeID) error {
+	ctx, span := tracer.Start(ctx, "InviteCodeUsecase.Revoke")
+	defer span.End()
+
+	u, err := iu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if err := iu.icr.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	writeAuditLog(ctx, iu.ar, entity.AuditInviteCodeRevoke, u.ID, u.Email, fmt.Sprintf("id=%d", id))
+	return nil
+}
+
+// 仮登録で入力された招待コードを1回分使う。存在しない場合も使えない場合も同じエラーにする
+func consumeInviteCode(ctx context.Context, icr repository.IInviteCodeRepository, code string) (*entity.InviteCode, error) {
+	if code == "" {
+		return nil, ErrInvalidInviteCode
+	}
+	c, err := icr.GetByHash(ctx, hashToken(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidInviteCode
+	} else if err != nil {
+		return nil, err
+	}
+	if err := icr.Consume(ctx, c.ID); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidInviteCode
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/mail"
+	"login-example/repository"
+	"net/url"
+)
+
+// ログイン通知の「心当たりがない」リンクのURL。tokenクエリにトークンを付ける
+var loginAlertURL = "http://localhost:8000/api/v1/auth/login/deny"
+
+// ログインをユーザーに通知する
+type ILoginAlerter interface {
+	// 記録したログイン履歴が、これまでにないIPアドレスかUser-Agentからのものならメールで通知する
+	// ユーザーが新しい環境からの通知を停止している場合は通知しない
+	// ユーザーがログインのたびの通知を有効にしている場合は、それ以外のログインも通知する
+	// 通知に失敗してもログインは継続させるので、エラーは返さない
+	Alert(ctx context.Context, u *entity.User, h *entity.LoginHistory)
+}
+
+type loginAlerter struct {
+	lr     repository.ILoginHistoryRepository
+	ar     repository.IAuditRepository
+	mailer mail.IMailer
+	jwter  auth.IJwtGenerator
+	// falseの場合は新しい環境からのログインを検知せず、ログインのたびの通知だけを送る
+	newClients bool
+}
+
+// mailerには非同期のものを渡して、通知の送信でログインのレスポンスを遅らせないようにする
+func NewLoginAlerter(lr repository.ILoginHistoryRepository, ar repository.IAuditRepository, mailer mail.IMailer, jwter auth.IJwtGenerator, newClients bool) ILoginAlerter {
+	return &loginAlerter{lr: lr, ar: ar, mailer: mailer, jwter: jwter, newClients: newClients}
+}
+
+func (la *loginAlerter) Alert(ctx context.Context, u *entity.User, h *entity.LoginHistory) {
+	ctx, span := tracer.Start(ctx, "LoginAlerter.Alert")
+	defer span.End()
+
+	if err := la.alert(ctx, u, h); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to send login alert", slog.Any("user_id", u.ID), logging.Err(err))
+	}
+}
+
+func (la *loginAlerter) alert(ctx context.Context, u *entity.User, h *entity.LoginHistory) error {
+	if u.Email == "" {
+		return nil
+	}
+	if la.newClients && u.NotifyOnNewClient {
+		c, err := la.lr.CountClient(ctx, h)
+		if err != nil {
+			return err
+		}
+		// 初めてのログインは比べる履歴がないので通知しない
+		if c.Total > 0 && (c.SameIP == 0 || c.SameUserAgent == 0) {
+			return la.sendAlert(ctx, u, h)
+		}
+	}
+	if u.NotifyOnLogin {
+		return la.sendNotice(ctx, u, h)
+	}
+	return nil
+}
+
+// 新しい環境からのログインを、心当たりがない場合に全端末をログアウトさせるリンクを付けて通知する
+func (la *loginAlerter) sendAlert(ctx context.Context, u *entity.User, h *entity.LoginHistory) error {
+	tok, err := la.jwter.GenerateLoginAlertToken(h)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(loginAlertURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", string(tok))
+	link.RawQuery = q.Encode()
+
+	if err := la.mailer.SendLoginAlert(ctx, u.Email, newLoginNotice(h), link.String()); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, la.ar, entity.AuditLoginAlert, u.ID, u.Email, fmt.Sprintf("login_id=%d ip=%s", h.ID, h.IPAddress))
+	return nil
+}
+
+// ユーザーが有効にしている、ログインのたびの通知を送る。毎回のことなので監査ログには記録しない
+func (la *loginAlerter) sendNotice(ctx context.Context, u *entity.User, h *entity.LoginHistory) error {
+	return la.mailer.SendLoginNotice(ctx, u.Email, newLoginNotice(h))
+}
+
+func newLoginNotice(h *entity.LoginHistory) mail.LoginNotice {
+	return mail.LoginNotice{
+		Time:      h.CreatedAt,
+		IPAddress: h.IPAddress,
+		UserAgent: h.UserAgent,
+		Location:  loginLocation(h),
+	}
+}
+
+// 通知に表示する接続元の場所。GeoIPで調べられなかった場合は空
+func loginLocation(h *entity.LoginHistory) string {
+	if h.City != "" {
+		return h.City + ", " + h.Country
+	}
+	return h.Country
+}
@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/entity"
+	"login-example/geoip"
+	"login-example/logging"
+	"login-example/repository"
+	"time"
+)
+
+// これより近い移動は、GeoIPの誤差とみなしてありえない移動として扱わない
+const minTravelDistanceKm = 300.0
+
+// 接続元の位置から、不審なログインを検知する
+type ILoginAnomalyDetector interface {
+	// まだ記録していないログイン履歴hに接続元の位置を設定して、過去のログイン履歴と比べる
+	// 初めての国からのログインか、ありえない移動であれば監査ログに記録してtrueを返す
+	// 位置を調べられなくてもログインは継続させるので、エラーは返さない
+	Detect(ctx context.Context, u *entity.User, h *entity.LoginHistory) bool
+}
+
+type loginAnomalyDetector struct {
+	lr  repository.ILoginHistoryRepository
+	ar  repository.IAuditRepository
+	loc geoip.ILocator
+	// ありえない移動とみなす速度(km/h)
+	maxSpeed float64
+}
+
+func NewLoginAnomalyDetector(lr repository.ILoginHistoryRepository, ar repository.IAuditRepository, loc geoip.ILocator, maxSpeed float64) ILoginAnomalyDetector {
+	return &loginAnomalyDetector{lr: lr, ar: ar, loc: loc, maxSpeed: maxSpeed}
+}
+
+func (ld *loginAnomalyDetector) Detect(ctx context.Context, u *entity.User, h *entity.LoginHistory) bool {
+	ctx, span := tracer.Start(ctx, "LoginAnomalyDetector.Detect")
+	defer span.End()
+
+	anomalous, err := ld.detect(ctx, u, h)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to detect login anomaly", slog.Any("user_id", u.ID), logging.Err(err))
+	}
+	return anomalous
+}
+
+func (ld *loginAnomalyDetector) detect(ctx context.Context, u *entity.User, h *entity.LoginHistory) (bool, error) {
+	loc, err := ld.loc.Lookup(h.IPAddress)
+	if errors.Is(err, geoip.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	h.Country, h.City, h.Latitude, h.Longitude = loc.Country, loc.City, loc.Latitude, loc.Longitude
+
+	prev, err := ld.lr.GetLatestByUserID(ctx, u.ID)
+	// 初めてのログインは比べる履歴がない
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	// GeoIPを有効にする前の履歴とは比べられない
+	if prev.Country == "" {
+		return false, nil
+	}
+
+	anomalous := false
+	if prev.Country != h.Country {
+		c, err := ld.lr.CountClient(ctx, h)
+		if err != nil {
+			return false, err
+		}
+		if c.SameCountry == 0 {
+			writeAuditLog(ctx, ld.ar, entity.AuditLoginNewCountry, u.ID, u.Email,
+				fmt.Sprintf("country=%s previous=%s ip=%s", h.Country, prev.Country, h.IPAddress))
+			anomalous = true
+		}
+	}
+
+	prevLoc := &geoip.Location{Latitude: prev.Latitude, Longitude: prev.Longitude}
+	if km, ok := geoip.Distance(prevLoc, loc); ok && km >= minTravelDistanceKm {
+		hours := time.Since(prev.CreatedAt).Hours()
+		if hours <= 0 || km/hours > ld.maxSpeed {
+			writeAuditLog(ctx, ld.ar, entity.AuditImpossibleTravel, u.ID, u.Email,
+				fmt.Sprintf("distance=%.0fkm elapsed=%s previous_ip=%s ip=%s", km, time.Since(prev.CreatedAt).Round(time.Second), prev.IPAddress, h.IPAddress))
+			anomalous = true
+		}
+	}
+	return anomalous, nil
+}
+
+// GeoIPが無効な場合に使う
+type nopLoginAnomalyDetector struct{}
+
+func NewNopLoginAnomalyDetector() ILoginAnomalyDetector {
+	return nopLoginAnomalyDetector{}
+}
+
+func (nopLoginAnomalyDetector) Detect(context.Context, *entity.User, *entity.LoginHistory) bool {
+	return false
+}
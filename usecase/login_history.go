@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/repository"
+	"strings"
+)
+
+// user_agentのカラムの長さ
+const maxUserAgentLength = 512
+
+// ログインの接続元の位置を調べてログイン履歴を記録し、新しい環境からのログインであれば通知する
+// 記録に失敗してもログインは継続させる
+func writeLoginHistory(ctx context.Context, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, u *entity.User, method string, ci entity.ClientInfo) {
+	h := newLoginHistory(u, method, ci)
+	ld.Detect(ctx, u, h)
+	recordLogin(ctx, lr, la, u, h)
+}
+
+// まだ記録していないログイン履歴を作成する
+func newLoginHistory(u *entity.User, method string, ci entity.ClientInfo) *entity.LoginHistory {
+	return &entity.LoginHistory{
+		UserID:    u.ID,
+		Method:    method,
+		IPAddress: ci.IPAddress,
+		UserAgent: truncateUserAgent(ci.UserAgent),
+	}
+}
+
+// 作成したログイン履歴を記録して、新しい環境からのログインであれば通知する
+func recordLogin(ctx context.Context, lr repository.ILoginHistoryRepository, la ILoginAlerter, u *entity.User, h *entity.LoginHistory) {
+	if err := lr.Create(ctx, h); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to write login history", slog.Any("user_id", u.ID), logging.Err(err))
+		return
+	}
+	la.Alert(ctx, u, h)
+}
+
+// user_agentをカラムの長さに収まるように切り詰める
+func truncateUserAgent(ua string) string {
+	if len(ua) > maxUserAgentLength {
+		return strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return ua
+}
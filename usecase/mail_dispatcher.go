@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/mail"
+	"login-example/repository"
+	"time"
+)
+
+var (
+	// 送信待ちのメールを確認する間隔
+	outboxPollInterval = 5 * time.Second
+	// 1回で送信するメールの上限
+	outboxBatchSize = 20
+	// この回数失敗したメールは送信を諦めて、デッドレターとしてアウトボックスに残す
+	outboxMaxAttempts = 10
+	// 再送までの待ち時間。失敗するたびに2倍にして、outboxMaxBackoffを上限にする
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+)
+
+type IMailDispatcher interface {
+	// 送信待ちのメールを保存する。ユーザーの更新と同じトランザクションで呼び出す
+	Enqueue(ctx context.Context, m *entity.OutboxMail) error
+	// コミットした後に呼び出して、次の確認を待たずに送信させる
+	Notify()
+	// ctxがキャンセルされるまで、送信待ちのメールを送信し続ける
+	Run(ctx context.Context)
+}
+
+type mailDispatcher struct {
+	or     repository.IMailOutboxRepository
+	tx     repository.ITransactor
+	mailer mail.IMailer
+	wake   chan struct{}
+}
+
+func NewMailDispatcher(or repository.IMailOutboxRepository, tx repository.ITransactor, mailer mail.IMailer) IMailDispatcher {
+	return &mailDispatcher{or: or, tx: tx, mailer: mailer, wake: make(chan struct{}, 1)}
+}
+
+func (d *mailDispatcher) Enqueue(ctx context.Context, m *entity.OutboxMail) error {
+	return d.or.Create(ctx, m)
+}
+
+func (d *mailDispatcher) Notify() {
+	// すでに通知済みなら、まとめて1回送信すればよい
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *mailDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		if err := d.dispatch(ctx); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to dispatch outbox mails", logging.Err(err))
+		}
+	}
+}
+
+// 送信待ちのメールを送信して、送信済みにする
+// 送信してからコミットするまでに失敗した場合は、同じメールを再送することがある
+func (d *mailDispatcher) dispatch(ctx context.Context) error {
+	return d.tx.WithTx(ctx, func(ctx context.Context) error {
+		ms, err := d.or.ListPending(ctx, outboxMaxAttempts, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			if err := d.send(ctx, m); err != nil {
+				if err := d.fail(ctx, m, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.or.MarkSent(ctx, m.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 送信に失敗したメールを、待ち時間を空けてから再送するようにする
+func (d *mailDispatcher) fail(ctx context.Context, m *entity.OutboxMail, err error) error {
+	attempts := m.Attempts + 1
+	logger := logging.FromContext(ctx).With(slog.Any("outbox_id", m.ID), slog.Int("attempts", attempts))
+	if attempts >= outboxMaxAttempts {
+		logger.ErrorContext(ctx, "failed to send outbox mail, giving up", logging.Err(err))
+	} else {
+		logger.WarnContext(ctx, "failed to send outbox mail, retrying", logging.Err(err))
+	}
+	return d.or.MarkFailed(ctx, m.ID, err.Error(), time.Now().Add(outboxBackoff(attempts)))
+}
+
+// attempts回失敗した後の待ち時間
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBaseBackoff << (attempts - 1)
+	if d <= 0 || d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
+
+func (d *mailDispatcher) send(ctx context.Context, m *entity.OutboxMail) error {
+	ctx, span := tracer.Start(ctx, "MailDispatcher.send")
+	defer span.End()
+
+	switch m.Kind {
+	case entity.OutboxActivateToken:
+		return d.mailer.SendWithActivateToken(ctx, m.Recipient, m.Token, m.Link)
+	case entity.OutboxActivateCode:
+		return d.mailer.SendWithActivateCode(ctx, m.Recipient, m.Token, m.Link)
+	default:
+		return fmt.Errorf("unknown outbox mail kind: %q", m.Kind)
+	}
+}
@@ -0,0 +1,84 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/mail"
+	"login-example/repository"
+)
+
+type IMailEventUsecase interface {
+	HandleDeliveryEvents(ctx context.Context, events []mail.DeliveryEvent) error
+}
+
+type mailEventUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+}
+
+func NewMailEventUsecase(ur repository.IUserRepository, ar repository.IAuditRepository) IMailEventUsecase {
+	return &mailEventUsecase{ur: ur, ar: ar}
+}
+
+// バウンスと迷惑メールの報告があったユーザーのemailの状態を更新して、以降はメールを送信しないようにする
+func (mu *mailEventUsecase) HandleDeliveryEvents(ctx context.Context, events []mail.DeliveryEvent) error {
+	ctx, span := tracer.Start(ctx, "MailEventUsecase.HandleDeliveryEvents")
+	defer span.End()
+
+	for _, e := range events {
+		if err := mu.handle(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mu *mailEventUsecase) handle(ctx context.Context, e mail.DeliveryEvent) error {
+	// 直前の通知で更新した状態を読むため、プライマリから取得する
+	// プロバイダーによっては大文字を含むemailで通知されるので、正規化してから取得する
+	u, err := mu.ur.GetByEmail(repository.WithPrimary(ctx), normalizeEmail(e.Email))
+	// 退会済みや、emailを変更したユーザーの通知は無視する
+	if errors.Is(err, sql.ErrNoRows) {
+		logging.FromContext(ctx).InfoContext(ctx, "ignored delivery event for unknown email", slog.String("kind", string(e.Kind)))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	status, event := entity.EmailBouncing, entity.AuditEmailBounce
+	if e.Kind == mail.DeliveryComplaint {
+		status, event = entity.EmailComplained, entity.AuditEmailComplaint
+	}
+	// 同じ通知が再送されることがあるので、状態が変わらない場合は何もしない
+	// 迷惑メールの報告の方が重いので、後からバウンスが届いてもcomplainedのままにする
+	if u.EmailStatus == status || u.EmailStatus == entity.EmailComplained {
+		return nil
+	}
+
+	u.EmailStatus = status
+	if err := mu.ur.UpdateEmailStatus(ctx, u); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, mu.ar, event, u.ID, u.Email, e.Reason)
+	return nil
+}
+
+// バウンスや迷惑メールの報告があったユーザーのemailを送信対象から外すmail.SuppressFunc
+// 登録されていないemail(変更後のemailなど)には送信する
+func SuppressUndeliverable(ur repository.IUserRepository) mail.SuppressFunc {
+	return func(ctx context.Context, email string) (bool, error) {
+		u, err := ur.GetByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return !u.CanReceiveMail(), nil
+	}
+}
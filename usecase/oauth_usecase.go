@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/oauth"
+	"login-example/random"
+	"login-example/repository"
+	"net/http"
+)
+
+type IOAuthUsecase interface {
+	AuthCodeURL(provider string) (string, string, error)
+	Login(ctx context.Context, provider, code string, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
+}
+
+type oauthUsecase struct {
+	ur        repository.IUserRepository
+	ir        repository.IIdentityRepository
+	ar        repository.IAuditRepository
+	lr        repository.ILoginHistoryRepository
+	la        ILoginAlerter
+	ld        ILoginAnomalyDetector
+	sr        repository.ISessionRepository
+	tx        repository.ITransactor
+	jwter     auth.IJwtGenerator
+	providers oauth.Providers
+	ek        EmailKeyer
+}
+
+func NewOAuthUsecase(ur repository.IUserRepository, ir repository.IIdentityRepository, ar repository.IAuditRepository, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, sr repository.ISessionRepository, tx repository.ITransactor, jwter auth.IJwtGenerator, providers oauth.Providers, ek EmailKeyer) IOAuthUsecase {
+	return &oauthUsecase{ur: ur, ir: ir, ar: ar, lr: lr, la: la, ld: ld, sr: sr, tx: tx, jwter: jwter, providers: providers, ek: ek}
+}
+
+// プロバイダーの認可画面のURLと、CSRF対策のstateを作成する
+func (ou *oauthUsecase) AuthCodeURL(provider string) (string, string, error) {
+	p, err := ou.providers.Get(provider)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrUnknownProvider, err)
+		return "", "", err
+	}
+	state := random.Alphanumeric(32)
+	return p.AuthCodeURL(state), state, nil
+}
+
+// 認可コードからプロバイダーのユーザー情報を取得して、パスワードログインと同じくJWTを発行する
+func (ou *oauthUsecase) Login(ctx context.Context, provider, code string, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "OAuthUsecase.Login")
+	defer span.End()
+
+	p, err := ou.providers.Get(provider)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrUnknownProvider, err)
+		return nil, nil, err
+	}
+	info, err := p.Exchange(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var u *entity.User
+	// ユーザーの作り直しと紐付けの途中で失敗しても、不整合な状態が残らないようにする
+	if err := ou.tx.WithTx(ctx, func(ctx context.Context) error {
+		u, err = ou.findOrCreateUser(ctx, p.Name(), info)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	if !u.IsActive() {
+		writeAuditLog(ctx, ou.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
+	}
+	writeAuditLog(ctx, ou.ar, entity.AuditLoginSuccess, u.ID, u.Email, p.Name())
+	writeLoginHistory(ctx, ou.lr, ou.la, ou.ld, u, p.Name(), ci)
+
+	return issueTokens(ctx, ou.jwter, ou.sr, u, ci, false)
+}
+
+// 紐付け済みのユーザーを取得する。紐付けがなければ、emailが一致するユーザーに紐付けるか新規にユーザーを作成する
+func (ou *oauthUsecase) findOrCreateUser(ctx context.Context, provider string, info *oauth.UserInfo) (*entity.User, error) {
+	i, err := ou.ir.GetByProvider(ctx, provider, info.Subject)
+	if err == nil {
+		return ou.ur.Get(ctx, i.UserID)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// プロバイダーで本人確認されていないemailは信用しない
+	if !info.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	email := normalizeEmail(info.Email)
+	u, err := ou.ur.GetByEmailKey(ctx, ou.ek.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		if u, err = registerExternalUser(ctx, ou.ur, ou.ek, email); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if u.IsPending() {
+		// 仮登録のままのユーザーは、プロバイダーで本人確認できたので作り直す
+		if err := ou.ur.Purge(ctx, u.ID); err != nil {
+			return nil, err
+		}
+		if u, err = registerExternalUser(ctx, ou.ur, ou.ek, email); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ou.ir.Create(ctx, &entity.Identity{
+		UserID:   u.ID,
+		Provider: provider,
+		Subject:  info.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ソーシャルログインやSAMLのログイン専用のユーザーを作成する。パスワードはランダムなのでパスワードログインはできない
+// emailは正規化済みのもの。email_keyは自分で登録したユーザーと同じく、ekの設定で作る
+func registerExternalUser(ctx context.Context, ur repository.IUserRepository, ek EmailKeyer, email string) (*entity.User, error) {
+	return registerProvisionedUser(ctx, ur, ek, email, "")
+}
+
+// provisionedByに、ユーザーを作成した外部のディレクトリを記録する
+func registerProvisionedUser(ctx context.Context, ur repository.IUserRepository, ek EmailKeyer, email, provisionedBy string) (*entity.User, error) {
+	salt := random.Alphanumeric(30)
+
+	u := &entity.User{}
+	hashed, err := u.CreateHashedPassword(random.Alphanumeric(20), salt)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Email = email
+	u.EmailKey = ek.Key(email)
+	u.Salt = salt
+	u.Password = hashed
+	u.ActivateToken = hashToken(random.Alphanumeric(8))
+	u.ProvisionedBy = provisionedBy
+
+	err = ur.Register(ctx, u)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return nil, ErrEmailAlreadyInUse
+	} else if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,219 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 認可コードの有効期限。RPはリダイレクトを受けてすぐに交換するので短くてよい。configの値で上書きする
+var AuthorizationCodeTTL = time.Minute
+
+// OpenID Connectの認可コードフローのみ対応する
+const (
+	ResponseTypeCode           = "code"
+	GrantTypeAuthorizationCode = "authorization_code"
+	CodeChallengeS256          = "S256"
+)
+
+// RPから受け取った認可リクエスト(OpenID Connect Core 3.1.2.1)
+type AuthorizationRequest struct {
+	ResponseType string
+	ClientID     string
+	RedirectURI  string
+	// スペース区切り。openidを含む必要がある
+	Scope string
+	State string
+	Nonce string
+	// PKCE(RFC 7636)。S256のみ対応する
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// 認可コードと交換したトークン
+type OIDCToken struct {
+	AccessToken []byte
+	IDToken     []byte
+	Scopes      []string
+}
+
+type IOIDCUsecase interface {
+	// 認可リクエストを検証する。ログイン画面に進む前に、登録されていないクライアントやリダイレクト先を弾く
+	ValidateAuthorizationRequest(ctx context.Context, req *AuthorizationRequest) error
+	// ログイン済みのユーザーに認可コードを発行して、RPへのリダイレクト先のURLを返す
+	Authorize(ctx context.Context, uid entity.UserID, req *AuthorizationRequest) (string, error)
+	// 認可コードをアクセストークンとIDトークンに交換する
+	ExchangeCode(ctx context.Context, clientID, secret, code, redirectURI, codeVerifier string) (*OIDCToken, error)
+	UserInfo(ctx context.Context, uid entity.UserID) (*entity.User, error)
+}
+
+type oidcUsecase struct {
+	ur    repository.IUserRepository
+	cr    repository.IOAuthClientRepository
+	acr   repository.IAuthorizationCodeRepository
+	ar    repository.IAuditRepository
+	jwter auth.IJwtGenerator
+}
+
+func NewOIDCUsecase(ur repository.IUserRepository, cr repository.IOAuthClientRepository, acr repository.IAuthorizationCodeRepository, ar repository.IAuditRepository, jwter auth.IJwtGenerator) IOIDCUsecase {
+	return &oidcUsecase{ur: ur, cr: cr, acr: acr, ar: ar, jwter: jwter}
+}
+
+func (ou *oidcUsecase) ValidateAuthorizationRequest(ctx context.Context, req *AuthorizationRequest) error {
+	ctx, span := tracer.Start(ctx, "OIDCUsecase.ValidateAuthorizationRequest")
+	defer span.End()
+
+	_, err := ou.validate(ctx, req)
+	return err
+}
+
+// 認可リクエストを検証して、要求されたscopeを返す
+func (ou *oidcUsecase) validate(ctx context.Context, req *AuthorizationRequest) ([]string, error) {
+	cl, err := ou.cr.Get(ctx, req.ClientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown client_id", ErrInvalidAuthorizationRequest)
+	} else if err != nil {
+		return nil, err
+	}
+	// オープンリダイレクトにならないように、登録済みのURLにしかリダイレクトしない
+	if !cl.HasRedirectURI(req.RedirectURI) {
+		return nil, fmt.Errorf("%w: redirect_uri is not registered", ErrInvalidAuthorizationRequest)
+	}
+	if req.ResponseType != ResponseTypeCode {
+		return nil, fmt.Errorf("%w: unsupported response_type: %s", ErrInvalidAuthorizationRequest, req.ResponseType)
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != CodeChallengeS256 {
+		return nil, fmt.Errorf("%w: unsupported code_challenge_method: %s", ErrInvalidAuthorizationRequest, req.CodeChallengeMethod)
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, entity.ScopeOpenID) {
+		return nil, fmt.Errorf("%w: openid", ErrInvalidScope)
+	}
+	for _, s := range scopes {
+		if !slices.Contains(entity.OIDCScopes, s) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+	}
+	return scopes, nil
+}
+
+func (ou *oidcUsecase) Authorize(ctx context.Context, uid entity.UserID, req *AuthorizationRequest) (string, error) {
+	ctx, span := tracer.Start(ctx, "OIDCUsecase.Authorize")
+	defer span.End()
+
+	scopes, err := ou.validate(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := ou.ur.Get(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsActive() {
+		return "", ErrUserInactive
+	}
+
+	code := random.URLSafeToken(32)
+	ac := &entity.AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        u.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        strings.Join(scopes, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(AuthorizationCodeTTL),
+	}
+	if err := ou.acr.Create(ctx, ac); err != nil {
+		return "", err
+	}
+
+	writeAuditLog(ctx, ou.ar, entity.AuditOIDCAuthorize, u.ID, u.Email, req.ClientID)
+
+	// 登録済みのURLにクエリパラメータがあれば残したまま、codeとstateを付与する
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse redirect_uri: %w", err)
+	}
+	q := redirect.Query()
+	q.Set("code", code)
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	redirect.RawQuery = q.Encode()
+	return redirect.String(), nil
+}
+
+func (ou *oidcUsecase) ExchangeCode(ctx context.Context, clientID, secret, code, redirectURI, codeVerifier string) (*OIDCToken, error) {
+	ctx, span := tracer.Start(ctx, "OIDCUsecase.ExchangeCode")
+	defer span.End()
+
+	cl, err := authenticateClient(ctx, ou.cr, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// 検証に失敗しても、一度提示されたコードは使えなくする
+	ac, err := ou.acr.Consume(ctx, hashToken(code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidGrant
+	} else if err != nil {
+		return nil, err
+	}
+	if ac.IsExpired() || ac.ClientID != cl.ID || ac.RedirectURI != redirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if ac.CodeChallenge != "" && !verifyCodeChallenge(codeVerifier, ac.CodeChallenge) {
+		return nil, ErrInvalidGrant
+	}
+
+	u, err := ou.ur.Get(ctx, ac.UserID)
+	// コードを発行してから退会したユーザー
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidGrant
+	} else if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	scopes := strings.Fields(ac.Scopes)
+	accessToken, err := ou.jwter.GenerateScopedAccessToken(u, scopes)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := ou.jwter.GenerateIDToken(u, cl.ID, ac.Nonce, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCToken{AccessToken: accessToken, IDToken: idToken, Scopes: scopes}, nil
+}
+
+func (ou *oidcUsecase) UserInfo(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "OIDCUsecase.UserInfo")
+	defer span.End()
+
+	return ou.ur.Get(ctx, uid)
+}
+
+// PKCEのcode_verifierが、認可リクエストのcode_challengeと一致するか(S256)
+func verifyCodeChallenge(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	got := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(got), []byte(challenge)) == 1
+}
@@ -0,0 +1,326 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/mail"
+	"login-example/random"
+	"login-example/repository"
+	"net/url"
+	"time"
+)
+
+// 招待のトークンのランダムなバイト数
+const orgInvitationTokenBytes = 32
+
+// 招待のリンクの有効期限
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+// 招待メールのリンク。トークンはクエリパラメータとして付与する
+var orgInvitationURL = "http://localhost:8000/api/v1/auth/invitations"
+
+type IOrganizationUsecase interface {
+	// 組織を作成して、作成したユーザーをownerにする
+	Create(ctx context.Context, uid entity.UserID, name string) (*entity.Membership, error)
+	List(ctx context.Context, uid entity.UserID) (entity.Memberships, error)
+	// 組織のアクセストークンを発行する。組織のAPIはこのトークンでのみ使える
+	IssueToken(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) ([]byte, error)
+	Get(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) (*entity.Membership, error)
+	ListMembers(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) (entity.OrganizationMembers, error)
+	// 自分を外す場合は組織からの脱退になる。他のメンバーを外すにはownerかadminである必要がある
+	RemoveMember(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID, target entity.UserID) error
+	// emailに招待メールを送る。ownerかadminである必要がある。同じemailへの以前の招待は使えなくなる
+	Invite(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID, email string, role entity.OrganizationRole) (*entity.OrganizationInvitation, error)
+	// 招待メールのトークンから招待の内容を取得する。registeredはemailのアカウントが登録済みか
+	// 登録済みでない場合、クライアントは招待されたemailで登録してから招待を承諾する
+	GetInvitation(ctx context.Context, token string) (inv *entity.OrganizationInvitation, o *entity.Organization, registered bool, err error)
+	// 招待を承諾して組織のメンバーになる。招待されたemailのユーザーのみ承諾できる
+	AcceptInvitation(ctx context.Context, uid entity.UserID, token string) (*entity.Membership, error)
+}
+
+type organizationUsecase struct {
+	ur     repository.IUserRepository
+	or     repository.IOrganizationRepository
+	ir     repository.IOrganizationInvitationRepository
+	ar     repository.IAuditRepository
+	tx     repository.ITransactor
+	mailer mail.IMailer
+	jwter  auth.IJwtGenerator
+	ek     EmailKeyer
+}
+
+func NewOrganizationUsecase(ur repository.IUserRepository, or repository.IOrganizationRepository, ir repository.IOrganizationInvitationRepository, ar repository.IAuditRepository, tx repository.ITransactor, mailer mail.IMailer, jwter auth.IJwtGenerator, ek EmailKeyer) IOrganizationUsecase {
+	return &organizationUsecase{ur: ur, or: or, ir: ir, ar: ar, tx: tx, mailer: mailer, jwter: jwter, ek: ek}
+}
+
+func (ou *organizationUsecase) Create(ctx context.Context, uid entity.UserID, name string) (*entity.Membership, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.Create")
+	defer span.End()
+
+	u, err := ou.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	o := &entity.Organization{Name: name}
+	if err := ou.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := ou.or.Create(ctx, o); err != nil {
+			return err
+		}
+		return ou.or.AddMember(ctx, &entity.OrganizationMember{OrganizationID: o.ID, UserID: u.ID, Role: entity.OrgOwner})
+	}); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, ou.ar, entity.AuditOrgCreate, u.ID, u.Email, fmt.Sprintf("org=%d", o.ID))
+	return &entity.Membership{Organization: *o, Role: entity.OrgOwner}, nil
+}
+
+func (ou *organizationUsecase) List(ctx context.Context, uid entity.UserID) (entity.Memberships, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.List")
+	defer span.End()
+
+	return ou.or.ListByUserID(ctx, uid)
+}
+
+func (ou *organizationUsecase) IssueToken(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.IssueToken")
+	defer span.End()
+
+	if _, err := ou.member(ctx, orgID, uid); err != nil {
+		return nil, err
+	}
+	u, err := ou.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+	return ou.jwter.GenerateOrgAccessToken(u, orgID)
+}
+
+func (ou *organizationUsecase) Get(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) (*entity.Membership, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.Get")
+	defer span.End()
+
+	m, err := ou.member(ctx, orgID, uid)
+	if err != nil {
+		return nil, err
+	}
+	o, err := ou.or.Get(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.Membership{Organization: *o, Role: m.Role}, nil
+}
+
+func (ou *organizationUsecase) ListMembers(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID) (entity.OrganizationMembers, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.ListMembers")
+	defer span.End()
+
+	if _, err := ou.member(ctx, orgID, uid); err != nil {
+		return nil, err
+	}
+	return ou.or.ListMembers(ctx, orgID)
+}
+
+func (ou *organizationUsecase) RemoveMember(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID, target entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.RemoveMember")
+	defer span.End()
+
+	m, err := ou.member(ctx, orgID, uid)
+	if err != nil {
+		return err
+	}
+
+	var removed *entity.OrganizationMember
+	if err := ou.tx.WithTx(ctx, func(ctx context.Context) error {
+		removed, err = ou.or.GetMember(ctx, orgID, target)
+		if err != nil {
+			return err
+		}
+		if target != uid {
+			// adminはownerを外せない
+			if !m.Role.CanManageMembers() || (removed.Role == entity.OrgOwner && m.Role != entity.OrgOwner) {
+				return ErrOrgPermissionDenied
+			}
+		}
+		// ownerがいなくなると、誰も組織を管理できなくなる
+		if removed.Role == entity.OrgOwner {
+			n, err := ou.or.CountMembersByRole(ctx, orgID, entity.OrgOwner)
+			if err != nil {
+				return err
+			}
+			if n <= 1 {
+				return ErrLastOwner
+			}
+		}
+		return ou.or.RemoveMember(ctx, orgID, target)
+	}); err != nil {
+		return err
+	}
+
+	writeAuditLog(ctx, ou.ar, entity.AuditOrgMemberRemove, removed.UserID, removed.Email, fmt.Sprintf("org=%d by=%d", orgID, uid))
+	return nil
+}
+
+func (ou *organizationUsecase) Invite(ctx context.Context, uid entity.UserID, orgID entity.OrganizationID, email string, role entity.OrganizationRole) (*entity.OrganizationInvitation, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.Invite")
+	defer span.End()
+
+	email = normalizeEmail(email)
+	m, err := ou.member(ctx, orgID, uid)
+	if err != nil {
+		return nil, err
+	}
+	// ownerは招待できない。ownerは組織を作成したユーザーのみ
+	if !m.Role.CanManageMembers() || role == entity.OrgOwner {
+		return nil, ErrOrgPermissionDenied
+	}
+	o, err := ou.or.Get(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// すでにメンバーのユーザーを招待しても承諾できないので、招待する前に確認する
+	if u, err := ou.ur.GetByEmailKey(ctx, ou.ek.Key(email)); err == nil {
+		if _, err := ou.or.GetMember(ctx, orgID, u.ID); err == nil {
+			return nil, repository.ErrAlreadyMember
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	token := random.URLSafeToken(orgInvitationTokenBytes)
+	inv := &entity.OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      hashToken(token),
+		InvitedBy:      uid,
+		ExpiresAt:      time.Now().Add(orgInvitationTTL),
+	}
+	if err := ou.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := ou.ir.DeletePending(ctx, orgID, email); err != nil {
+			return err
+		}
+		return ou.ir.Create(ctx, inv)
+	}); err != nil {
+		return nil, err
+	}
+
+	link, err := url.Parse(orgInvitationURL)
+	if err != nil {
+		return nil, err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	if err := ou.mailer.SendWithInvitation(ctx, email, o.Name, link.String()); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, ou.ar, entity.AuditOrgInvite, uid, m.Email, fmt.Sprintf("org=%d email=%s role=%s", orgID, email, role))
+	return inv, nil
+}
+
+func (ou *organizationUsecase) GetInvitation(ctx context.Context, token string) (*entity.OrganizationInvitation, *entity.Organization, bool, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.GetInvitation")
+	defer span.End()
+
+	inv, err := ou.invitation(ctx, token)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	o, err := ou.or.Get(ctx, inv.OrganizationID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// 仮登録のままのユーザーは、登録を完了してから承諾する
+	registered := false
+	if u, err := ou.ur.GetByEmailKey(ctx, ou.ek.Key(inv.Email)); err == nil {
+		registered = !u.IsPending()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, false, err
+	}
+	return inv, o, registered, nil
+}
+
+func (ou *organizationUsecase) AcceptInvitation(ctx context.Context, uid entity.UserID, token string) (*entity.Membership, error) {
+	ctx, span := tracer.Start(ctx, "OrganizationUsecase.AcceptInvitation")
+	defer span.End()
+
+	u, err := ou.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+	inv, err := ou.invitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	// リンクを転送された他のユーザーが参加できないように、招待されたemailのユーザーに限る
+	if ou.ek.Key(u.Email) != ou.ek.Key(inv.Email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+	o, err := ou.or.Get(ctx, inv.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ou.tx.WithTx(ctx, func(ctx context.Context) error {
+		// 同時に承諾された場合に、片方だけ成功させる
+		if err := ou.ir.MarkAccepted(ctx, inv.ID); errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidToken
+		} else if err != nil {
+			return err
+		}
+		return ou.or.AddMember(ctx, &entity.OrganizationMember{OrganizationID: inv.OrganizationID, UserID: u.ID, Role: inv.Role})
+	}); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, ou.ar, entity.AuditOrgInviteAccept, u.ID, u.Email, fmt.Sprintf("org=%d role=%s", inv.OrganizationID, inv.Role))
+	return &entity.Membership{Organization: *o, Role: inv.Role}, nil
+}
+
+// 招待のトークンを検証する。承諾済みのトークンは存在しないものと同じエラーにする
+func (ou *organizationUsecase) invitation(ctx context.Context, token string) (*entity.OrganizationInvitation, error) {
+	inv, err := ou.ir.GetByHash(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if inv.AcceptedAt != nil {
+		return nil, ErrInvalidToken
+	}
+	if !inv.IsUsable() {
+		return nil, ErrTokenExpired
+	}
+	return inv, nil
+}
+
+// ユーザーが組織のメンバーであることを確認する。組織のトークンを発行した後に外されたユーザーもここで拒否する
+func (ou *organizationUsecase) member(ctx context.Context, orgID entity.OrganizationID, uid entity.UserID) (*entity.OrganizationMember, error) {
+	m, err := ou.or.GetMember(ctx, orgID, uid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotOrgMember
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// パスワードが弱すぎる場合のエラー。弱いと判定された理由の一覧を持つ
+type WeakPasswordError struct {
+	Score    int
+	MinScore int
+	Reasons  []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return fmt.Sprintf("password too weak: score %d, required %d: %s", e.Score, e.MinScore, strings.Join(e.Reasons, ", "))
+}
+
+// パスワードの強度を推定して、最低スコアに満たなければWeakPasswordErrorを返す
+// userInputsにはemailなど、パスワードに含めるべきでないユーザーの情報を渡す
+func CheckPasswordStrength(pw string, minScore int, userInputs ...string) error {
+	r := zxcvbn.PasswordStrength(pw, userInputs)
+	if r.Score >= minScore {
+		return nil
+	}
+
+	// 推定に使われたパターンから、弱いと判定された理由を組み立てる
+	reasons := []string{}
+	seen := map[string]bool{}
+	for _, m := range r.MatchSequence {
+		var reason string
+		switch {
+		case m.DictionaryName == "user_inputs":
+			reason = "contains personal information"
+		case m.Pattern == "dictionary":
+			reason = "contains a common word"
+		case m.Pattern == "spatial":
+			reason = "contains a keyboard pattern"
+		case m.Pattern == "repeat":
+			reason = "contains repeated characters"
+		case m.Pattern == "sequence":
+			reason = "contains a sequence"
+		case m.Pattern == "date":
+			reason = "contains a date"
+		default:
+			continue
+		}
+		if !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "too short or predictable")
+	}
+
+	return &WeakPasswordError{Score: r.Score, MinScore: minScore, Reasons: reasons}
+}
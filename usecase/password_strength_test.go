@@ -0,0 +1,42 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPasswordStrength(t *testing.T) {
+	tests := []struct {
+		name string
+		pw   string
+		ok   bool
+	}{
+		{"short", "abc123", false},
+		{"common word", "password1", false},
+		{"personal information", "user@example.com", false},
+		// 20文字を超える長いパスフレーズも受け付ける
+		{"long passphrase", "correct horse battery staple on the moon", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPasswordStrength(tt.pw, 3, "user@example.com")
+			var wpe *WeakPasswordError
+			if tt.ok && err != nil {
+				t.Errorf("CheckPasswordStrength() error = %v", err)
+			} else if !tt.ok && !errors.As(err, &wpe) {
+				t.Errorf("CheckPasswordStrength() error = %v, want WeakPasswordError", err)
+			}
+		})
+	}
+}
+
+// 上限の128文字でも、リクエストを処理できる時間で推定できる
+func TestCheckPasswordStrength_MaxLength(t *testing.T) {
+	start := time.Now()
+	CheckPasswordStrength(strings.Repeat("aZ3!", 32), 3)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("CheckPasswordStrength() took %v for 128 characters", d)
+	}
+}
@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/random"
+	"login-example/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+// パーソナルアクセストークンのランダムな部分の長さ
+const personalAccessTokenLength = 40
+
+// 1人のユーザーが持てるパーソナルアクセストークンの数
+const maxPersonalAccessTokens = 20
+
+type IPersonalAccessTokenUsecase interface {
+	auth.IPersonalAccessTokenVerifier
+	// ttlが0の場合は無期限。トークン自体は返り値の文字列でのみ返す
+	Create(ctx context.Context, uid entity.UserID, name string, scopes []string, ttl time.Duration) (*entity.PersonalAccessToken, string, error)
+	List(ctx context.Context, uid entity.UserID) (entity.PersonalAccessTokens, error)
+	Revoke(ctx context.Context, uid entity.UserID, id entity.PersonalAccessTokenID) error
+}
+
+type personalAccessTokenUsecase struct {
+	ur repository.IUserRepository
+	pr repository.IPersonalAccessTokenRepository
+	ar repository.IAuditRepository
+}
+
+func NewPersonalAccessTokenUsecase(ur repository.IUserRepository, pr repository.IPersonalAccessTokenRepository, ar repository.IAuditRepository) IPersonalAccessTokenUsecase {
+	return &personalAccessTokenUsecase{ur: ur, pr: pr, ar: ar}
+}
+
+// トークンを発行する。scopesはユーザーのroleで許可されたscopeの中から選ぶ
+func (pu *personalAccessTokenUsecase) Create(ctx context.Context, uid entity.UserID, name string, scopes []string, ttl time.Duration) (*entity.PersonalAccessToken, string, error) {
+	ctx, span := tracer.Start(ctx, "PersonalAccessTokenUsecase.Create")
+	defer span.End()
+
+	u, err := pu.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, "", err
+	}
+	if !u.IsActive() {
+		return nil, "", ErrUserInactive
+	}
+	allowed := u.Role.Scopes()
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+	}
+
+	ts, err := pu.pr.ListByUserID(ctx, uid)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(ts) >= maxPersonalAccessTokens {
+		return nil, "", ErrTooManyTokens
+	}
+
+	// トークンは十分に長いランダムな文字列なので、パスワードと違って高速なハッシュで保存してよい
+	token := auth.PersonalAccessTokenPrefix + random.Alphanumeric(personalAccessTokenLength)
+	t := &entity.PersonalAccessToken{
+		UserID:    uid,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(scopes, " "),
+	}
+	if ttl > 0 {
+		exp := time.Now().Add(ttl)
+		t.ExpiresAt = &exp
+	}
+	if err := pu.pr.Create(ctx, t); err != nil {
+		return nil, "", err
+	}
+
+	writeAuditLog(ctx, pu.ar, entity.AuditTokenCreate, u.ID, u.Email, name)
+	return t, token, nil
+}
+
+func (pu *personalAccessTokenUsecase) List(ctx context.Context, uid entity.UserID) (entity.PersonalAccessTokens, error) {
+	ctx, span := tracer.Start(ctx, "PersonalAccessTokenUsecase.List")
+	defer span.End()
+
+	return pu.pr.ListByUserID(ctx, uid)
+}
+
+// トークンを削除して、以降のリクエストで使えなくする
+func (pu *personalAccessTokenUsecase) Revoke(ctx context.Context, uid entity.UserID, id entity.PersonalAccessTokenID) error {
+	ctx, span := tracer.Start(ctx, "PersonalAccessTokenUsecase.Revoke")
+	defer span.End()
+
+	if err := pu.pr.Delete(ctx, uid, id); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, pu.ar, entity.AuditTokenRevoke, uid, "", fmt.Sprintf("id=%d", id))
+	return nil
+}
+
+// AuthMiddlewareから呼ばれる。トークンの期限とユーザーの状態を確認する
+// roleが変わった場合に備えて、scopeは今のroleで許可されたものだけに絞る
+func (pu *personalAccessTokenUsecase) VerifyPersonalAccessToken(ctx context.Context, token string) (*auth.TokenInfo, error) {
+	ctx, span := tracer.Start(ctx, "PersonalAccessTokenUsecase.VerifyPersonalAccessToken")
+	defer span.End()
+
+	t, err := pu.pr.GetByHash(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if t.IsExpired() {
+		return nil, ErrTokenExpired
+	}
+
+	u, err := pu.ur.Get(ctx, t.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	allowed := u.Role.Scopes()
+	scopes := slices.DeleteFunc(strings.Fields(t.Scopes), func(s string) bool {
+		return !slices.Contains(allowed, s)
+	})
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+
+	// 最終利用日時は目安なので、更新に失敗してもリクエストは通す
+	if err := pu.pr.Touch(ctx, t.ID); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to touch personal access token", slog.Any("id", t.ID), logging.Err(err))
+	}
+
+	info := &auth.TokenInfo{
+		Type:     auth.PersonalAccessTokenType,
+		UserID:   u.ID,
+		Role:     u.Role,
+		Scopes:   scopes,
+		IssuedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt != nil {
+		info.Expiration = *t.ExpiresAt
+	}
+	return info, nil
+}
@@ -0,0 +1,162 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"login-example/sms"
+	"time"
+)
+
+const (
+	// SMSで送る確認コードの桁数
+	phoneCodeLength = 6
+	// 確認コードの有効期限
+	phoneCodeTTL = 10 * time.Minute
+)
+
+var (
+	// 確認コードを再送できる間隔。SMSは送信ごとに費用がかかるので、メールより厳しくする
+	resendPhoneCodeCooldown = time.Minute
+	maxPhoneAttempts        = 5
+)
+
+// SMSで確認した電話番号を登録する。SMSでのアカウントの復旧や多要素認証で使う
+type IPhoneUsecase interface {
+	// 電話番号に確認コードをSMSで送る。確認するまでは登録済みの電話番号は変わらない
+	RequestVerification(ctx context.Context, uid entity.UserID, phone string) error
+	// 確認コードを検証して、確認待ちの電話番号を登録する
+	Verify(ctx context.Context, uid entity.UserID, code string) (*entity.User, error)
+	Delete(ctx context.Context, uid entity.UserID) error
+}
+
+type phoneUsecase struct {
+	ur     repository.IUserRepository
+	ar     repository.IAuditRepository
+	tx     repository.ITransactor
+	sender sms.ISmsSender
+	// SMSの本文に表示するサービス名
+	productName string
+}
+
+func NewPhoneUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, tx repository.ITransactor, sender sms.ISmsSender, productName string) IPhoneUsecase {
+	return &phoneUsecase{ur: ur, ar: ar, tx: tx, sender: sender, productName: productName}
+}
+
+func (pu *phoneUsecase) RequestVerification(ctx context.Context, uid entity.UserID, phone string) error {
+	ctx, span := tracer.Start(ctx, "PhoneUsecase.RequestVerification")
+	defer span.End()
+
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := pu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	if u.Phone == phone {
+		return ErrPhoneNotChanged
+	}
+	// 短い間隔で何度も送らせない。番号を変えて送り直す場合も同じ
+	if u.PendingPhoneRequestedAt != nil && u.PendingPhoneRequestedAt.Add(resendPhoneCodeCooldown).After(time.Now()) {
+		return ErrResendTooSoon
+	}
+	if err := pu.checkPhoneAvailable(ctx, u.ID, phone); err != nil {
+		return err
+	}
+
+	code := random.Numeric(phoneCodeLength)
+	u.PendingPhone = phone
+	u.PendingPhoneCode = hashToken(code)
+	if err := pu.ur.RequestPhoneChange(ctx, u); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%sの確認コード: %s\n%d分以内に入力してください。", pu.productName, code, int(phoneCodeTTL.Minutes()))
+	if err := pu.sender.Send(ctx, phone, body); errors.Is(err, sms.ErrInvalidNumber) {
+		return fmt.Errorf("%w: %v", ErrInvalidPhone, err)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pu *phoneUsecase) Verify(ctx context.Context, uid entity.UserID, code string) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "PhoneUsecase.Verify")
+	defer span.End()
+
+	// 確認コードの送信の直後に呼ばれるので、プライマリから取得する
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := pu.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if u.PendingPhone == "" || u.PendingPhoneRequestedAt == nil {
+		return nil, ErrNoPhoneChange
+	}
+
+	// 6桁のコードは総当たりしやすいので、失敗回数が上限に達したら検証しない
+	if u.PendingPhoneAttempts >= maxPhoneAttempts {
+		return nil, ErrTooManyAttempts
+	}
+	if !compareTokenHash(code, u.PendingPhoneCode) {
+		if err := pu.ur.IncrementPhoneAttempts(ctx, u); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if u.PendingPhoneRequestedAt.Add(phoneCodeTTL).Compare(time.Now()) != +1 {
+		return nil, ErrTokenExpired
+	}
+
+	if err := pu.tx.WithTx(ctx, func(ctx context.Context) error {
+		// 送信してから確認されるまでに、他のユーザーが同じ電話番号を登録していないか再度確認する
+		if err := pu.checkPhoneAvailable(ctx, u.ID, u.PendingPhone); err != nil {
+			return err
+		}
+		return pu.ur.ConfirmPhoneChange(ctx, u)
+	}); err != nil {
+		return nil, err
+	}
+	writeAuditLog(ctx, pu.ar, entity.AuditPhoneVerify, u.ID, u.Email, "phone="+u.Phone)
+	return u, nil
+}
+
+func (pu *phoneUsecase) Delete(ctx context.Context, uid entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "PhoneUsecase.Delete")
+	defer span.End()
+
+	u, err := pu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return err
+	}
+	if u.Phone == "" && u.PendingPhone == "" {
+		return nil
+	}
+	if err := pu.ur.DeletePhone(ctx, u); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, pu.ar, entity.AuditPhoneDelete, u.ID, u.Email, "")
+	return nil
+}
+
+// 電話番号を他のユーザーが確認済みでないか確認する
+func (pu *phoneUsecase) checkPhoneAvailable(ctx context.Context, uid entity.UserID, phone string) error {
+	other, err := pu.ur.GetByPhone(ctx, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if other.ID != uid {
+		return ErrPhoneAlreadyInUse
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"login-example/entity"
+	"login-example/mail"
+	"login-example/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 言語やタイムゾーン、メールでの通知など、ユーザーごとの設定
+type IPreferencesUsecase interface {
+	Get(ctx context.Context, uid entity.UserID) (*entity.Preferences, error)
+	// 設定を全て置き換える
+	Update(ctx context.Context, uid entity.UserID, p entity.Preferences) (*entity.Preferences, error)
+}
+
+type preferencesUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+}
+
+func NewPreferencesUsecase(ur repository.IUserRepository, ar repository.IAuditRepository) IPreferencesUsecase {
+	return &preferencesUsecase{ur: ur, ar: ar}
+}
+
+func (pu *preferencesUsecase) Get(ctx context.Context, uid entity.UserID) (*entity.Preferences, error) {
+	ctx, span := tracer.Start(ctx, "PreferencesUsecase.Get")
+	defer span.End()
+
+	u, err := pu.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return &u.Preferences, nil
+}
+
+func (pu *preferencesUsecase) Update(ctx context.Context, uid entity.UserID, p entity.Preferences) (*entity.Preferences, error) {
+	ctx, span := tracer.Start(ctx, "PreferencesUsecase.Update")
+	defer span.End()
+
+	p.Locale = strings.TrimSpace(p.Locale)
+	p.TimeZone = strings.TrimSpace(p.TimeZone)
+	if p.Locale != "" && !slices.Contains(mail.Locales, p.Locale) {
+		return nil, ErrUnsupportedLocale
+	}
+	if p.TimeZone != "" {
+		if _, err := loadTimeZone(p.TimeZone); err != nil {
+			return nil, ErrInvalidTimeZone
+		}
+	}
+
+	u, err := pu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	var changed []string
+	if u.Locale != p.Locale {
+		changed = append(changed, "locale")
+	}
+	if u.TimeZone != p.TimeZone {
+		changed = append(changed, "timezone")
+	}
+	if u.NotifyOnLogin != p.NotifyOnLogin {
+		changed = append(changed, "notify_on_login")
+	}
+	if u.NotifyOnNewClient != p.NotifyOnNewClient {
+		changed = append(changed, "notify_on_new_client")
+	}
+	if len(changed) == 0 {
+		return &u.Preferences, nil
+	}
+
+	u.Preferences = p
+	if err := pu.ur.UpdatePreferences(ctx, u); err != nil {
+		return nil, err
+	}
+	writeAuditLog(ctx, pu.ar, entity.AuditPreferenceUpdate, u.ID, u.Email, "fields="+strings.Join(changed, ","))
+	return &u.Preferences, nil
+}
+
+// IANAのタイムゾーンを読み込む。Localはサーバーのタイムゾーンになってしまうので受け付けない
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, ErrInvalidTimeZone
+	}
+	return time.LoadLocation(name)
+}
+
+// ユーザーが設定した言語とタイムゾーンでメールを作成させるmail.RecipientFunc
+// 登録されていないemailにはデフォルトの言語で送る
+func RecipientPreferences(ur repository.IUserRepository) mail.RecipientFunc {
+	return func(ctx context.Context, email string) (mail.Recipient, error) {
+		u, err := ur.GetByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return mail.Recipient{}, nil
+		}
+		if err != nil {
+			return mail.Recipient{}, err
+		}
+		r := mail.Recipient{Locale: u.Locale}
+		// 設定した後にタイムゾーンのデータベースから消えた場合は、変換せずに送る
+		if u.TimeZone != "" {
+			if loc, err := loadTimeZone(u.TimeZone); err == nil {
+				r.Location = loc
+			}
+		}
+		return r, nil
+	}
+}
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/repository"
+	"login-example/saml"
+	"net/http"
+)
+
+// ログイン履歴と監査ログに記録するログイン方法
+const samlLoginMethod = "saml"
+
+type ISAMLUsecase interface {
+	// IdPの認証画面のURLと、ACSで照合するAuthnRequestのID
+	AuthnRequestURL() (string, string, error)
+	// IdPのアサーションのemailでユーザーを特定して、パスワードログインと同じくJWTを発行する
+	Login(ctx context.Context, samlResponse string, requestIDs []string, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
+	Metadata() ([]byte, error)
+}
+
+type samlUsecase struct {
+	ur    repository.IUserRepository
+	ar    repository.IAuditRepository
+	lr    repository.ILoginHistoryRepository
+	la    ILoginAlerter
+	ld    ILoginAnomalyDetector
+	sr    repository.ISessionRepository
+	tx    repository.ITransactor
+	jwter auth.IJwtGenerator
+	sp    saml.IServiceProvider
+	// 存在しないemailのユーザーを自動で作成する(just-in-time provisioning)
+	jit bool
+	ek  EmailKeyer
+}
+
+func NewSAMLUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, sr repository.ISessionRepository, tx repository.ITransactor, jwter auth.IJwtGenerator, sp saml.IServiceProvider, jit bool, ek EmailKeyer) ISAMLUsecase {
+	return &samlUsecase{ur: ur, ar: ar, lr: lr, la: la, ld: ld, sr: sr, tx: tx, jwter: jwter, sp: sp, jit: jit, ek: ek}
+}
+
+func (su *samlUsecase) AuthnRequestURL() (string, string, error) {
+	return su.sp.AuthnRequestURL("")
+}
+
+func (su *samlUsecase) Login(ctx context.Context, samlResponse string, requestIDs []string, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "SAMLUsecase.Login")
+	defer span.End()
+
+	info, err := su.sp.ParseResponse(samlResponse, requestIDs)
+	if err != nil {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, 0, "", err.Error())
+		return nil, nil, ErrInvalidCredential
+	}
+
+	var u *entity.User
+	if err := su.tx.WithTx(ctx, func(ctx context.Context) error {
+		u, err = su.findOrCreateUser(ctx, info.Email)
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrUserNotProvisioned) {
+			writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, 0, info.Email, "saml user not provisioned")
+		}
+		return nil, nil, err
+	}
+	if !u.IsActive() {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
+	}
+	writeAuditLog(ctx, su.ar, entity.AuditLoginSuccess, u.ID, u.Email, samlLoginMethod)
+	writeLoginHistory(ctx, su.lr, su.la, su.ld, u, samlLoginMethod, ci)
+
+	return issueTokens(ctx, su.jwter, su.sr, u, ci, false)
+}
+
+// emailが一致する既存のユーザーを取得する。存在しない場合は、自動作成が有効なら作成する
+// IdPで認証済みのemailなので、仮登録のままのユーザーは作り直す
+func (su *samlUsecase) findOrCreateUser(ctx context.Context, email string) (*entity.User, error) {
+	email = normalizeEmail(email)
+	u, err := su.ur.GetByEmailKey(ctx, su.ek.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		if !su.jit {
+			return nil, ErrUserNotProvisioned
+		}
+		return registerExternalUser(ctx, su.ur, su.ek, email)
+	} else if err != nil {
+		return nil, err
+	}
+	if !u.IsPending() || !su.jit {
+		return u, nil
+	}
+	if err := su.ur.Purge(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	return registerExternalUser(ctx, su.ur, su.ek, email)
+}
+
+func (su *samlUsecase) Metadata() ([]byte, error) {
+	return su.sp.Metadata()
+}
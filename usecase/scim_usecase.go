@@ -0,0 +1,188 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/entity"
+	"login-example/repository"
+)
+
+// SCIM 2.0(RFC 7644)で、企業のディレクトリからユーザーを同期する
+// userNameはemailとして扱う。ディレクトリで本人確認済みなので、作成したユーザーはすぐに有効になる
+// SCIMで作成したユーザーだけを扱い、自分で登録したユーザーや管理者は存在しないものとして扱う
+type ISCIMUsecase interface {
+	Create(ctx context.Context, email string, active bool) (*entity.User, error)
+	Get(ctx context.Context, uid entity.UserID) (*entity.User, error)
+	// emailが空の場合はSCIMで作成した全てのユーザーを返す。無効化したユーザーも含む
+	List(ctx context.Context, email string, offset, limit int) (entity.Users, int64, error)
+	Replace(ctx context.Context, uid entity.UserID, email string, active bool) (*entity.User, error)
+	SetActive(ctx context.Context, uid entity.UserID, active bool) (*entity.User, error)
+}
+
+type scimUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+	tx repository.ITransactor
+	ek EmailKeyer
+}
+
+func NewSCIMUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, tx repository.ITransactor, ek EmailKeyer) ISCIMUsecase {
+	return &scimUsecase{ur: ur, ar: ar, tx: tx, ek: ek}
+}
+
+func (su *scimUsecase) Create(ctx context.Context, email string, active bool) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "SCIMUsecase.Create")
+	defer span.End()
+
+	email = normalizeEmail(email)
+	var u *entity.User
+	if err := su.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := su.checkEmailAvailable(ctx, 0, email); err != nil {
+			return err
+		}
+		var err error
+		if u, err = registerProvisionedUser(ctx, su.ur, su.ek, email, entity.ProvisionedBySCIM); err != nil {
+			return err
+		}
+		if !active {
+			u.State = entity.UserDisabled
+			return su.ur.UpdateState(ctx, u)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, su.ar, entity.AuditSCIMCreate, u.ID, u.Email, fmt.Sprintf("active=%t", active))
+	return u, nil
+}
+
+func (su *scimUsecase) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "SCIMUsecase.Get")
+	defer span.End()
+
+	return su.get(ctx, uid)
+}
+
+func (su *scimUsecase) List(ctx context.Context, email string, offset, limit int) (entity.Users, int64, error) {
+	ctx, span := tracer.Start(ctx, "SCIMUsecase.List")
+	defer span.End()
+
+	if email == "" {
+		return su.ur.List(ctx, repository.ListOptions{Limit: limit, Offset: offset, ProvisionedBy: entity.ProvisionedBySCIM})
+	}
+
+	u, err := su.ur.GetByEmailKey(ctx, su.ek.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Users{}, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	// SCIMで作成していないユーザーは、存在しないものとして扱う
+	if u.ProvisionedBy != entity.ProvisionedBySCIM {
+		return entity.Users{}, 0, nil
+	}
+	return entity.Users{u}, 1, nil
+}
+
+// ユーザーの属性をディレクトリの値で置き換える(PUT)
+func (su *scimUsecase) Replace(ctx context.Context, uid entity.UserID, email string, active bool) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "SCIMUsecase.Replace")
+	defer span.End()
+
+	email = normalizeEmail(email)
+	var u *entity.User
+	if err := su.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if u, err = su.get(ctx, uid); err != nil {
+			return err
+		}
+		if u.Email != email {
+			if err := su.checkEmailAvailable(ctx, u.ID, email); err != nil {
+				return err
+			}
+			// ディレクトリで確認済みのemailなので、確認メールを送らずに変更する
+			u.PendingEmail = email
+			u.EmailKey = su.ek.Key(email)
+			if err := su.ur.ConfirmEmailChange(ctx, u); errors.Is(err, repository.ErrEmailTaken) {
+				return ErrEmailAlreadyInUse
+			} else if err != nil {
+				return err
+			}
+		}
+		return su.updateState(ctx, u, active)
+	}); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, su.ar, entity.AuditSCIMUpdate, u.ID, u.Email, fmt.Sprintf("active=%t", active))
+	return u, nil
+}
+
+// ユーザーを無効化、または再び有効にする(PATCH, DELETE)
+func (su *scimUsecase) SetActive(ctx context.Context, uid entity.UserID, active bool) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "SCIMUsecase.SetActive")
+	defer span.End()
+
+	u, err := su.get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if err := su.updateState(ctx, u, active); err != nil {
+		return nil, err
+	}
+
+	writeAuditLog(ctx, su.ar, entity.AuditSCIMUpdate, u.ID, u.Email, fmt.Sprintf("active=%t", active))
+	return u, nil
+}
+
+// SCIMで作成したユーザーを取得する。他のユーザーはsql.ErrNoRowsを返し、404にする
+func (su *scimUsecase) get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	u, err := su.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if u.ProvisionedBy != entity.ProvisionedBySCIM {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+// 状態が変わる場合のみ更新する。仮登録のユーザーはディレクトリから有効にできない
+// 管理者が利用を停止、禁止したユーザーも、ディレクトリからは解除できない
+func (su *scimUsecase) updateState(ctx context.Context, u *entity.User, active bool) error {
+	if u.IsPending() {
+		return ErrUserInactive
+	}
+	if u.IsRestricted() {
+		return inactiveError(u)
+	}
+	if u.IsActive() == active {
+		return nil
+	}
+	u.State = entity.UserDisabled
+	if active {
+		u.State = entity.UserActive
+	}
+	return su.ur.UpdateState(ctx, u)
+}
+
+// uidのユーザーがemailを使用可能か確認する。仮登録のままのユーザーが使っている場合は削除する
+// 新しく作成する場合、uidは0
+func (su *scimUsecase) checkEmailAvailable(ctx context.Context, uid entity.UserID, email string) error {
+	other, err := su.ur.GetByEmailKey(ctx, su.ek.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if other.ID == uid {
+		return nil
+	}
+	if !other.IsPending() {
+		return ErrEmailAlreadyInUse
+	}
+	return su.ur.Purge(ctx, other.ID)
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"login-example/entity"
+	"login-example/inmem"
+	"login-example/repository"
+)
+
+// 監査ログを捨てるrepository.IAuditRepository
+type nopAuditRepository struct{}
+
+func (nopAuditRepository) Create(ctx context.Context, l *entity.AuditLog) error { return nil }
+func (nopAuditRepository) List(ctx context.Context, opts repository.AuditListOptions) (entity.AuditLogs, int64, error) {
+	return nil, 0, nil
+}
+
+// 自分で登録したユーザーや管理者は、SCIMのAPIでは読み取りも変更もできない
+func TestSCIMUsecase_OnlyProvisionedUsers(t *testing.T) {
+	ctx := context.Background()
+	ur := inmem.NewUserRepository()
+	su := NewSCIMUsecase(ur, nopAuditRepository{}, inmem.Transactor{}, EmailKeyer{})
+
+	admin := &entity.User{Email: "admin@example.com", Role: entity.RoleAdmin, State: entity.UserActive}
+	if err := ur.Register(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	local := append(registerUsers(t, ur, "local@example.com"), admin)
+	scim, err := su.Create(ctx, "scim@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range local {
+		if _, err := su.Get(ctx, u.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Get(%s) error = %v, want %v", u.Email, err, sql.ErrNoRows)
+		}
+		if _, err := su.Replace(ctx, u.ID, "taken@example.com", false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Replace(%s) error = %v, want %v", u.Email, err, sql.ErrNoRows)
+		}
+		if _, err := su.SetActive(ctx, u.ID, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("SetActive(%s) error = %v, want %v", u.Email, err, sql.ErrNoRows)
+		}
+		if us, n, err := su.List(ctx, u.Email, 0, 10); err != nil || n != 0 || len(us) != 0 {
+			t.Errorf("List(%s) = %v, %d, %v, want no users", u.Email, us, n, err)
+		}
+		if got, _ := ur.Get(ctx, u.ID); got.Email != u.Email || got.State != u.State {
+			t.Errorf("user %s was modified: %+v", u.Email, got)
+		}
+	}
+
+	if _, err := su.Get(ctx, scim.ID); err != nil {
+		t.Errorf("Get(scim) error = %v", err)
+	}
+	if u, err := su.SetActive(ctx, scim.ID, false); err != nil || u.IsActive() {
+		t.Errorf("SetActive(scim) = %v, %v, want disabled", u, err)
+	}
+	us, n, err := su.List(ctx, "", 0, 10)
+	if err != nil || n != 1 || len(us) != 1 || us[0].ID != scim.ID {
+		t.Errorf("List() = %v, %d, %v, want only %v", us, n, err, scim.ID)
+	}
+}
@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/repository"
+)
+
+// 同時に有効なセッションの数が上限に達しているときに、新しくログインした場合の扱い
+type SessionLimitAction string
+
+const (
+	// 最後に使われたのが最も古いセッションを削除して、新しいログインを許可する
+	SessionLimitEvictOldest = SessionLimitAction("evict_oldest")
+	// 新しいログインを拒否する。ユーザーは他の端末でログアウトする必要がある
+	SessionLimitReject = SessionLimitAction("reject")
+)
+
+// 1人のユーザーが同時に持てるセッション(リフレッシュトークン)の数と、超えた場合の扱い。configの値で上書きする
+// MaxSessionsが0の場合は制限しない
+var (
+	MaxSessions        = 0
+	SessionLimitPolicy = SessionLimitEvictOldest
+)
+
+// 新しいセッションを作成する前に、有効なセッションの数が上限を超えないようにする
+// 期限切れのセッションは数えない
+func enforceSessionLimit(ctx context.Context, sr repository.ISessionRepository, uid entity.UserID) error {
+	if MaxSessions <= 0 {
+		return nil
+	}
+	// 最後に使われたものから順に並んでいる
+	ss, err := sr.ListByUserID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if len(ss) < MaxSessions {
+		return nil
+	}
+	if SessionLimitPolicy == SessionLimitReject {
+		return ErrTooManySessions
+	}
+
+	// 新しいセッションの分を空ける。リフレッシュ時にDBのセッションを確認するので、削除すればすぐに使えなくなる
+	for _, s := range ss[MaxSessions-1:] {
+		if err := sr.Delete(ctx, uid, s.ID); err != nil {
+			return err
+		}
+		logging.FromContext(ctx).InfoContext(ctx, "evicted session over limit", slog.Any("user_id", uid), slog.Any("session_id", s.ID))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"login-example/sms"
+	"net/http"
+	"time"
+)
+
+const smsLoginMethod = "sms"
+
+// 確認済みの電話番号にSMSで送ったワンタイムコードでログインする
+type ISmsLoginUsecase interface {
+	// ログイン用コードをSMSで送る。電話番号が登録されていなくても成功として扱う
+	RequestCode(ctx context.Context, phone string) error
+	// ログイン用コードを検証して、アクセストークンとリフレッシュトークンを発行する
+	Login(ctx context.Context, phone, code string, rememberMe bool, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
+}
+
+type smsLoginUsecase struct {
+	ur     repository.IUserRepository
+	ar     repository.IAuditRepository
+	lr     repository.ILoginHistoryRepository
+	la     ILoginAlerter
+	ld     ILoginAnomalyDetector
+	sr     repository.ISessionRepository
+	jwter  auth.IJwtGenerator
+	sender sms.ISmsSender
+	// SMSの本文に表示するサービス名
+	productName string
+}
+
+func NewSmsLoginUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, sr repository.ISessionRepository, jwter auth.IJwtGenerator, sender sms.ISmsSender, productName string) ISmsLoginUsecase {
+	return &smsLoginUsecase{ur: ur, ar: ar, lr: lr, la: la, ld: ld, sr: sr, jwter: jwter, sender: sender, productName: productName}
+}
+
+func (su *smsLoginUsecase) RequestCode(ctx context.Context, phone string) error {
+	ctx, span := tracer.Start(ctx, "SmsLoginUsecase.RequestCode")
+	defer span.End()
+
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := su.ur.GetByPhone(ctx, phone)
+	// ユーザーが存在するかどうかを知られないように、存在しない場合も成功として扱う
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	// 短い間隔で何度も送らせない。電話番号が登録されているかを知られないように、送らなくても成功として扱う
+	if u.SmsLoginCodeSentAt != nil && u.SmsLoginCodeSentAt.Add(resendPhoneCodeCooldown).After(time.Now()) {
+		return nil
+	}
+
+	code := random.Numeric(phoneCodeLength)
+	u.SmsLoginCode = hashToken(code)
+	if err := su.ur.UpdateSmsLoginCode(ctx, u); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%sのログインコード: %s\n%d分以内に入力してください。", su.productName, code, int(phoneCodeTTL.Minutes()))
+	return su.sender.Send(ctx, u.Phone, body)
+}
+
+func (su *smsLoginUsecase) Login(ctx context.Context, phone, code string, rememberMe bool, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "SmsLoginUsecase.Login")
+	defer span.End()
+
+	// コードの送信の直後に呼ばれるので、プライマリから取得する
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := su.ur.GetByPhone(ctx, phone)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, 0, "", "phone not found")
+		return nil, nil, ErrInvalidCredential
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if u.SmsLoginCode == "" || u.SmsLoginCodeSentAt == nil {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "sms code not requested")
+		return nil, nil, ErrInvalidCredential
+	}
+
+	// 6桁のコードは総当たりしやすいので、失敗回数が上限に達したらコードを送り直すまで検証しない
+	if u.SmsLoginAttempts >= maxPhoneAttempts {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "too many sms code attempts")
+		return nil, nil, ErrTooManyAttempts
+	}
+	if !compareTokenHash(code, u.SmsLoginCode) {
+		if err := su.ur.IncrementSmsLoginAttempts(ctx, u); err != nil {
+			return nil, nil, err
+		}
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "invalid sms code")
+		return nil, nil, ErrInvalidCredential
+	}
+	if u.SmsLoginCodeSentAt.Add(phoneCodeTTL).Compare(time.Now()) != +1 {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "sms code expired")
+		return nil, nil, ErrTokenExpired
+	}
+	// コードを知らない人に利用停止などの状態を教えないように、コードを検証してから確認する
+	if !u.IsActive() {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
+	}
+
+	// コードは一度しか使えない
+	if err := su.ur.ConsumeSmsLoginCode(ctx, u); errors.Is(err, repository.ErrVersionConflict) {
+		writeAuditLog(ctx, su.ar, entity.AuditLoginFailure, u.ID, u.Email, "sms code already used")
+		return nil, nil, ErrInvalidCredential
+	} else if err != nil {
+		return nil, nil, err
+	}
+	writeAuditLog(ctx, su.ar, entity.AuditLoginSuccess, u.ID, u.Email, smsLoginMethod)
+	writeLoginHistory(ctx, su.lr, su.la, su.ld, u, smsLoginMethod, ci)
+
+	return issueTokens(ctx, su.jwter, su.sr, u, ci, rememberMe)
+}
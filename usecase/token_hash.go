@@ -0,0 +1,19 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// DBに保存するためにトークンをハッシュ化する
+// トークンはランダムに作成したもので、検証回数も制限しているのでソルトなしのSHA-256で十分
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// トークンがハッシュと一致するか、処理時間から推測されないように定数時間で比較する
+func compareTokenHash(token, hashed string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(hashed)) == 1
+}
@@ -0,0 +1,6 @@
+package usecase
+
+import "go.opentelemetry.io/otel"
+
+// usecaseの各メソッドのスパンを作成する
+var tracer = otel.Tracer("login-example/usecase")
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/logging"
+	"login-example/repository"
+	"time"
+)
+
+// 1人のユーザーが登録できる信頼済みの端末の数
+const maxTrustedDevices = 20
+
+type ITrustedDeviceUsecase interface {
+	// 今の端末を信頼済みとして登録する。端末のcookieに保存するトークンは返り値でのみ返す
+	Trust(ctx context.Context, uid entity.UserID, name string, ci entity.ClientInfo) (*entity.TrustedDevice, []byte, error)
+	List(ctx context.Context, uid entity.UserID) (entity.TrustedDevices, error)
+	Rename(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID, name string) error
+	Revoke(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) error
+	// cookieのトークンが、ユーザーの期限内の信頼済みの端末のものか確認する
+	IsTrusted(ctx context.Context, uid entity.UserID, token string) bool
+}
+
+type trustedDeviceUsecase struct {
+	ur    repository.IUserRepository
+	dr    repository.ITrustedDeviceRepository
+	ar    repository.IAuditRepository
+	jwter auth.IJwtBuilder
+	// 登録してから信頼済みとして扱う期間
+	ttl time.Duration
+}
+
+func NewTrustedDeviceUsecase(ur repository.IUserRepository, dr repository.ITrustedDeviceRepository, ar repository.IAuditRepository, jwter auth.IJwtBuilder, ttl time.Duration) ITrustedDeviceUsecase {
+	return &trustedDeviceUsecase{ur: ur, dr: dr, ar: ar, jwter: jwter, ttl: ttl}
+}
+
+func (du *trustedDeviceUsecase) Trust(ctx context.Context, uid entity.UserID, name string, ci entity.ClientInfo) (*entity.TrustedDevice, []byte, error) {
+	ctx, span := tracer.Start(ctx, "TrustedDeviceUsecase.Trust")
+	defer span.End()
+
+	u, err := du.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !u.IsActive() {
+		return nil, nil, ErrUserInactive
+	}
+
+	ds, err := du.dr.ListByUserID(ctx, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ds) >= maxTrustedDevices {
+		return nil, nil, ErrTooManyDevices
+	}
+
+	d := &entity.TrustedDevice{
+		UserID:    uid,
+		Name:      name,
+		IPAddress: ci.IPAddress,
+		UserAgent: truncateUserAgent(ci.UserAgent),
+		ExpiresAt: time.Now().Add(du.ttl),
+	}
+	if err := du.dr.Create(ctx, d); err != nil {
+		return nil, nil, err
+	}
+	tok, err := du.jwter.GenerateDeviceToken(d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writeAuditLog(ctx, du.ar, entity.AuditDeviceTrust, u.ID, u.Email, fmt.Sprintf("id=%d name=%s", d.ID, name))
+	return d, tok, nil
+}
+
+func (du *trustedDeviceUsecase) List(ctx context.Context, uid entity.UserID) (entity.TrustedDevices, error) {
+	ctx, span := tracer.Start(ctx, "TrustedDeviceUsecase.List")
+	defer span.End()
+
+	return du.dr.ListByUserID(ctx, uid)
+}
+
+func (du *trustedDeviceUsecase) Rename(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID, name string) error {
+	ctx, span := tracer.Start(ctx, "TrustedDeviceUsecase.Rename")
+	defer span.End()
+
+	return du.dr.Rename(ctx, uid, id, name)
+}
+
+// 端末を削除して、以降のログインで信頼済みとして扱わないようにする
+func (du *trustedDeviceUsecase) Revoke(ctx context.Context, uid entity.UserID, id entity.TrustedDeviceID) error {
+	ctx, span := tracer.Start(ctx, "TrustedDeviceUsecase.Revoke")
+	defer span.End()
+
+	if err := du.dr.Delete(ctx, uid, id); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, du.ar, entity.AuditDeviceRevoke, uid, "", fmt.Sprintf("id=%d", id))
+	return nil
+}
+
+// トークンの署名だけでなく、削除された端末でないことをDBで確認する
+func (du *trustedDeviceUsecase) IsTrusted(ctx context.Context, uid entity.UserID, token string) bool {
+	ctx, span := tracer.Start(ctx, "TrustedDeviceUsecase.IsTrusted")
+	defer span.End()
+
+	if token == "" {
+		return false
+	}
+	dt, err := du.jwter.ParseDeviceToken([]byte(token))
+	if err != nil || dt.UserID != uid {
+		return false
+	}
+	d, err := du.dr.Get(ctx, uid, dt.DeviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	} else if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to get trusted device", slog.Any("id", dt.DeviceID), logging.Err(err))
+		return false
+	}
+	if d.IsExpired() {
+		return false
+	}
+
+	// 最終利用日時は目安なので、更新に失敗しても信頼済みとして扱う
+	if err := du.dr.Touch(ctx, d.ID); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to touch trusted device", slog.Any("id", d.ID), logging.Err(err))
+	}
+	return true
+}
@@ -4,56 +4,201 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/auth"
+	"login-example/disposable"
 	"login-example/entity"
+	"login-example/ldap"
+	"login-example/logging"
 	"login-example/mail"
+	"login-example/pwned"
+	"login-example/random"
 	"login-example/repository"
-	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// ログインセッション(リフレッシュトークン)の有効期限。configの値で上書きする
+var (
+	SessionTTL = 3 * 24 * time.Hour
+	// ログイン状態を保持する(remember me)場合の有効期限
+	RememberMeSessionTTL = 30 * 24 * time.Hour
+)
+
+// LDAPでログインした場合に、ログイン履歴と監査ログに記録するログイン方法
+const ldapLoginMethod = "ldap"
+
+// 本人確認用トークンの検証に失敗できる回数。超えた場合はトークンを再送する必要がある
+var maxActivateAttempts = 5
+
+// emailの変更の確認用トークンの検証に失敗できる回数。超えた場合は変更をリクエストし直す必要がある
+var maxEmailChangeAttempts = 5
+
+// 本人確認用トークンを再送できる間隔
+var resendActivateTokenCooldown = 2 * time.Minute
+
+// 本人確認用リンクのURL。トークンはクエリパラメータとして付与する
+var activateLinkURL = "http://localhost:8000/api/v1/auth/register/activate"
+
+// マジックリンクのURL。トークンはクエリパラメータとして付与する
+var magicLinkURL = "http://localhost:8000/api/v1/auth/login/magic"
+
 type IUserUsecase interface {
-	PreRegister(ctx context.Context, email, pw string) (*entity.User, error)
-	Activate(ctx context.Context, email, token string) error
-	Login(ctx context.Context, email, password string) ([]byte, *http.Cookie, error)
+	// 招待制の場合はinviteCodeが必要。招待制でない場合は無視する
+	PreRegister(ctx context.Context, email, pw, inviteCode string) (*entity.User, error)
+	Activate(ctx context.Context, email, token string, p entity.Profile) error
+	ActivateWithLink(ctx context.Context, token []byte) error
+	ResendActivateToken(ctx context.Context, email string) error
+	// loginはemailかusername。@を含む場合はemailとして扱う
+	Login(ctx context.Context, login, password string, rememberMe bool, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
 	Get(ctx context.Context, uid entity.UserID) (*entity.User, error)
+	// プロフィールを部分的に更新する。versionが今のユーザーのバージョンと違う場合はErrVersionConflictを返す
+	UpdateProfile(ctx context.Context, uid entity.UserID, version int, p ProfileUpdate) (*entity.User, error)
+	ListLogins(ctx context.Context, uid entity.UserID) (entity.LoginHistories, error)
 	Refresh(ctx context.Context, token []byte) ([]byte, error)
+	Logout(ctx context.Context, uid entity.UserID, jti string, exp time.Time, refreshToken []byte) error
+	// 全ての端末からログアウトする。発行済みのリフレッシュトークンとアクセストークンを全て無効にする
+	LogoutAll(ctx context.Context, uid entity.UserID) error
+	ListSessions(ctx context.Context, uid entity.UserID) (entity.Sessions, error)
+	RevokeSession(ctx context.Context, uid entity.UserID, sid entity.SessionID) error
+	ChangePassword(ctx context.Context, uid entity.UserID, currentPw, newPw string) error
+	// ログインのたびにメールで通知するかを設定する
+	SetNotifyOnLogin(ctx context.Context, uid entity.UserID, enabled bool) error
+	Sudo(ctx context.Context, uid entity.UserID, pw string) ([]byte, error)
+	Delete(ctx context.Context, uid entity.UserID) error
+	RequestEmailChange(ctx context.Context, uid entity.UserID, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, uid entity.UserID, token string) error
+	RequestMagicLink(ctx context.Context, email string) error
+	LoginWithMagicLink(ctx context.Context, token []byte, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
+	DenyLogin(ctx context.Context, token []byte) error
 }
 
 type userUsecase struct {
 	ur     repository.IUserRepository
+	mr     repository.IMagicLinkRepository
+	ar     repository.IAuditRepository
+	lr     repository.ILoginHistoryRepository
+	la     ILoginAlerter
+	ld     ILoginAnomalyDetector
+	du     ITrustedDeviceUsecase
+	sr     repository.ISessionRepository
+	tx     repository.ITransactor
 	mailer mail.IMailer
+	md     IMailDispatcher
+	jwter  auth.IJwtBuilder
+	rs     auth.IRevocationStore
+	pc     pwned.IChecker
+	// 使い捨てメールアドレスのドメインか判定する
+	dc disposable.IChecker
+	// 設定されている場合は、ローカルのパスワードの代わりにLDAPのbindでパスワードを検証する
+	dir ldap.IAuthenticator
+	icr repository.IInviteCodeRepository
+	cfg UserUsecaseConfig
 }
 
-func NewUserUsecase(ur repository.IUserRepository, mailer mail.IMailer, jwter auth.IJwtGenerator) IUserUsecase {
-	return &userUsecase{ur: ur, mailer: mailer, jwter: jwter}
- }
+func NewUserUsecase(ur repository.IUserRepository, mr repository.IMagicLinkRepository, ar repository.IAuditRepository, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, du ITrustedDeviceUsecase, sr repository.ISessionRepository, tx repository.ITransactor, mailer mail.IMailer, md IMailDispatcher, jwter auth.IJwtBuilder, rs auth.IRevocationStore, pc pwned.IChecker, dc disposable.IChecker, dir ldap.IAuthenticator, icr repository.IInviteCodeRepository, cfg UserUsecaseConfig) IUserUsecase {
+	if cfg.ActivateTokenLength == 0 {
+		cfg.ActivateTokenLength = cfg.ActivateTokenMode.defaultLength()
+	}
+	return &userUsecase{
+		ur:     ur,
+		mr:     mr,
+		ar:     ar,
+		lr:     lr,
+		la:     la,
+		ld:     ld,
+		du:     du,
+		sr:     sr,
+		tx:     tx,
+		mailer: mailer,
+		md:     md,
+		jwter:  jwter,
+		rs:     rs,
+		pc:     pc,
+		dc:     dc,
+		dir:    dir,
+		icr:    icr,
+		cfg:    cfg,
+	}
+}
 
-func (uu *userUsecase) PreRegister(ctx context.Context, email, pw string) (*entity.User, error) {
-	u, err := uu.ur.GetByEmail(ctx, email)
+func (uu *userUsecase) PreRegister(ctx context.Context, email, pw, inviteCode string) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.PreRegister")
+	defer span.End()
 
-	// ユーザーが存在しない場合、sql.ErrNoRowsを受け取るはずなので、存在しない場合はそのまま仮登録処理を行う
-	if errors.Is(err, sql.ErrNoRows) {
-		return uu.preRegister(ctx, email, pw)
-		// それ以外のエラーの場合は想定外なのでそのまま返す
-	} else if err != nil {
+	email = normalizeEmail(email)
+	if err := checkEmailDomain(email, uu.cfg.AllowedEmailDomains, uu.cfg.BlockedEmailDomains); err != nil {
 		return nil, err
 	}
+	_, domain, _ := strings.Cut(email, "@")
+	isDisposable := uu.cfg.DisposableEmail != "" && uu.cfg.DisposableEmail != DisposableEmailAllow && uu.dc.IsDisposable(domain)
+	if isDisposable && uu.cfg.DisposableEmail == DisposableEmailBlock {
+		return nil, ErrDisposableEmail
+	}
 
-	// ユーザーがすでにアクティブの場合はエラーを返す
-	if u.IsActive() {
-		return nil, errors.New("user already active")
+	// 弱いパスワードや漏洩したパスワードでは登録させない
+	if err := uu.validateNewPassword(ctx, pw, email); err != nil {
+		return nil, err
 	}
 
-	// ユーザーがアクティブではない場合、ユーザーを削除して、再度仮登録処理を行う
-	if err := uu.ur.Delete(ctx, u.ID); err != nil {
+	// 削除と再登録の間で失敗してもユーザーが消えないように、1つのトランザクションで実行する
+	// 本人確認用のメールも同じトランザクションでアウトボックスに保存して、送信に失敗しても再送できるようにする
+	var u *entity.User
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		// 登録に失敗した場合は、招待コードの使用回数もロールバックする
+		detail := ""
+		if uu.cfg.InviteOnly {
+			ic, err := consumeInviteCode(ctx, uu.icr, inviteCode)
+			if err != nil {
+				return err
+			}
+			detail = fmt.Sprintf("invite_code=%d", ic.ID)
+		}
+
+		// 大文字小文字やエイリアスだけが違うemailも、同じemailとして扱う
+		old, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+
+		// ユーザーが存在しない場合、sql.ErrNoRowsを受け取るはずなので、存在しない場合はそのまま仮登録処理を行う
+		if errors.Is(err, sql.ErrNoRows) {
+			u, err = uu.preRegister(ctx, email, pw, detail)
+			return err
+			// それ以外のエラーの場合は想定外なのでそのまま返す
+		} else if err != nil {
+			return err
+		}
+
+		// ユーザーがすでにアクティブ(または無効化済み)の場合はエラーを返す
+		if !old.IsPending() {
+			return ErrUserAlreadyActive
+		}
+
+		// ユーザーが仮登録のままの場合、ユーザーを削除して、再度仮登録処理を行う
+		if err := uu.ur.Purge(ctx, old.ID); err != nil {
+			return err
+		}
+		u, err = uu.preRegister(ctx, email, pw, detail)
+		return err
+	}); err != nil {
 		return nil, err
 	}
-	return uu.preRegister(ctx, email, pw)
+
+	if isDisposable {
+		writeAuditLog(ctx, uu.ar, entity.AuditDisposableEmail, u.ID, email, "domain="+domain)
+	}
+
+	// メールの送信を待つ間DBをロックしないように、コミットしてから送信させる
+	uu.md.Notify()
+	return u, nil
 }
 
-// 仮登録処理を行う
-func (uu *userUsecase) preRegister(ctx context.Context, email, pw string) (*entity.User, error) {
-	salt := createRandomString(30)
-	activeToken := createRandomString(8)
+// 仮登録処理を行い、email宛の本人確認用のトークンをアウトボックスに保存する
+// detailは監査ログに記録する
+func (uu *userUsecase) preRegister(ctx context.Context, email, pw, detail string) (*entity.User, error) {
+	salt := random.Alphanumeric(30)
+	activeToken := uu.cfg.ActivateTokenMode.generate(uu.cfg.ActivateTokenLength)
 
 	u := &entity.User{}
 
@@ -64,83 +209,340 @@ func (uu *userUsecase) preRegister(ctx context.Context, email, pw string) (*enti
 	}
 
 	u.Email = email
+	u.EmailKey = uu.cfg.EmailKeys.Key(email)
 	u.Salt = salt
 	u.Password = hashed
-	u.ActivateToken = activeToken
+	// DBにはトークンのハッシュだけを保存する
+	u.ActivateToken = hashToken(activeToken)
 	u.State = entity.UserInactive
 
-	// DBへの仮登録処理を行う
-	if err := uu.ur.PreRegister(ctx, u); err != nil {
+	// DBへの仮登録処理を行う。退会済みのユーザーのemailは、完全に削除されるまで使えない
+	err = uu.ur.PreRegister(ctx, u)
+	if errors.Is(err, repository.ErrEmailTaken) {
+		return nil, ErrEmailAlreadyInUse
+	} else if err != nil {
 		return nil, err
 	}
-	// email宛に、本人確認用のトークンを送信する
-	if err := uu.mailer.SendWithActivateToken(email, u.ActivateToken); err != nil {
+	if err := uu.enqueueActivateToken(ctx, email, activeToken); err != nil {
 		return nil, err
 	}
-	return u, err
+	writeAuditLog(ctx, uu.ar, entity.AuditPreRegister, u.ID, email, detail)
+	return u, nil
 }
 
-// lengthの長さのランダムな文字列(a-zA-Z0-9)を作成する
-func createRandomString(length uint) string {
-	var letterBytes = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+// 再ハッシュ化に失敗してもログインはできるので、エラーはログに出すだけにする
+func (uu *userUsecase) rehashPassword(ctx context.Context, u *entity.User, pw string) {
+	hashed, err := u.CreateHashedPassword(pw, u.Salt)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to rehash password", slog.Any("user_id", u.ID), logging.Err(err))
+		return
+	}
+	u.Password = hashed
+	if err := uu.ur.UpdatePasswordHash(ctx, u); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to rehash password", slog.Any("user_id", u.ID), logging.Err(err))
+	}
+}
 
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+// 新しく設定するパスワードの強度と、漏洩データに含まれていないかを確認する
+func (uu *userUsecase) validateNewPassword(ctx context.Context, pw, email string) error {
+	if err := CheckPasswordStrength(pw, uu.cfg.MinPasswordScore, email); err != nil {
+		return err
+	}
+	found, err := uu.pc.IsPwned(ctx, pw)
+	// 外部APIの障害で登録できなくならないように、確認に失敗した場合はログだけ出して通す
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to check pwned password", logging.Err(err))
+		return nil
 	}
-	return string(b)
+	if found {
+		return ErrPasswordBreached
+	}
+	return nil
 }
 
 // ユーザーのstateをactivateに更新する
-func (uu *userUsecase) Activate(ctx context.Context, email, token string) error {
+// 本登録で入力されたプロフィールpも保存する
+func (uu *userUsecase) Activate(ctx context.Context, email, token string, p entity.Profile) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Activate")
+	defer span.End()
+
+	// 仮登録の直後に呼ばれるので、レプリカに反映される前でも読めるようにプライマリから取得する
+	ctx = repository.WithPrimary(ctx)
+
 	// emailをもとにDBからユーザーを取得する。
-	u, err := uu.ur.GetByEmail(ctx, email)
-	if err != nil {
+	// 登録されているemailかを知られないように、存在しない場合はトークンが一致しない場合と同じエラーにする
+	u, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidToken
+	} else if err != nil {
 		return err
 	}
 
-	// すでにユーザーがアクティブの場合、エラーを返す
-	if u.IsActive() {
-		return errors.New("user already active")
+	// すでにユーザーがアクティブ(または無効化済み)の場合、エラーを返す
+	if !u.IsPending() {
+		return ErrUserAlreadyActive
 	}
 
-	// トークンが一致しなければエラーをかえす
-	if token != u.ActivateToken {
-		return errors.New("invalid token")
+	// 総当たりされないように、失敗回数が上限に達したら検証しない
+	if u.ActivateAttempts >= maxActivateAttempts {
+		return ErrTooManyAttempts
 	}
 
-	// トークンが作成されて30分以上ならエラーをかえす
-	if u.UpdatedAt.Add(30*time.Minute).Compare(time.Now()) != +1 {
-		return errors.New("token expired")
+	// トークンが形式に合わない、または一致しなければエラーをかえす
+	if !uu.cfg.ActivateTokenMode.valid(token, uu.cfg.ActivateTokenLength) || !compareTokenHash(token, u.ActivateToken) {
+		if err := uu.ur.IncrementActivateAttempts(ctx, u); err != nil {
+			return err
+		}
+		return ErrInvalidToken
 	}
 
+	// トークンが作成されて有効期限を過ぎていればエラーをかえす
+	if u.UpdatedAt.Add(uu.cfg.ActivateTokenTTL).Compare(time.Now()) != +1 {
+		return ErrTokenExpired
+	}
+
+	u.Profile = p.Trim()
 	if err := uu.ur.Activate(ctx, u); err != nil {
 		return err
 	}
+	writeAuditLog(ctx, uu.ar, entity.AuditActivate, u.ID, u.Email, "")
+	return nil
+}
+
+// メールの本人確認用リンクからアクティベートする。リンクのトークンにはemailと本人確認用トークンが埋め込まれている
+func (uu *userUsecase) ActivateWithLink(ctx context.Context, token []byte) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ActivateWithLink")
+	defer span.End()
+
+	at, err := uu.jwter.ParseActivateToken(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	// リンクからはプロフィールを入力できないので、本登録の後に設定してもらう
+	return uu.Activate(ctx, at.Email, at.Token, entity.Profile{})
+}
+
+// 本人確認用のトークンを作り直して、再送する
+func (uu *userUsecase) ResendActivateToken(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ResendActivateToken")
+	defer span.End()
+
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+	// ユーザーが存在するかどうかを知られないように、存在しない場合も成功として扱う
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// すでにユーザーがアクティブ(または無効化済み)の場合、エラーを返す
+	if !u.IsPending() {
+		return ErrUserAlreadyActive
+	}
+
+	// 前回トークンを作成してから一定時間経っていなければエラーを返す
+	if u.UpdatedAt.Add(resendActivateTokenCooldown).After(time.Now()) {
+		return ErrResendTooSoon
+	}
+
+	token := uu.cfg.ActivateTokenMode.generate(uu.cfg.ActivateTokenLength)
+	u.ActivateToken = hashToken(token)
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.ur.UpdateActivateToken(ctx, u); err != nil {
+			return err
+		}
+		return uu.enqueueActivateToken(ctx, u.Email, token)
+	}); err != nil {
+		return err
+	}
+	uu.md.Notify()
 	return nil
 }
 
-func (uu *userUsecase) Login(ctx context.Context, email, password string) ([]byte, *http.Cookie, error) {
-	// emailからユーザー情報を取得する
-	u, err := uu.ur.GetByEmail(ctx, email)
+// トークンの形式に合わせたメールで、本人確認用トークンと、クリックするだけでアクティベートできるリンクを送信する
+// メールはアウトボックスに保存して、コミットした後にMailDispatcherが送信する
+func (uu *userUsecase) enqueueActivateToken(ctx context.Context, email, token string) error {
+	tok, err := uu.jwter.GenerateActivateToken(email, token, time.Now().Add(uu.cfg.ActivateTokenTTL))
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(activateLinkURL)
 	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", string(tok))
+	link.RawQuery = q.Encode()
+
+	kind := entity.OutboxActivateToken
+	if uu.cfg.ActivateTokenMode == ActivateTokenNumeric {
+		kind = entity.OutboxActivateCode
+	}
+	return uu.md.Enqueue(ctx, &entity.OutboxMail{
+		Kind:      kind,
+		Recipient: email,
+		Token:     token,
+		Link:      link.String(),
+	})
+}
+
+func (uu *userUsecase) Login(ctx context.Context, login, password string, rememberMe bool, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Login")
+	defer span.End()
+
+	// usernameもそのままディレクトリに渡して、ディレクトリのuser_filterで解決させる
+	if uu.dir != nil {
+		return uu.loginWithDirectory(ctx, login, password, rememberMe, ci)
+	}
+
+	// emailかusernameからユーザー情報を取得する
+	u, err := uu.getByLogin(ctx, login)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, 0, login, "user not found")
+		return nil, nil, ErrInvalidCredential
+	} else if err != nil {
 		return nil, nil, err
 	}
+	// ユーザーのパスワードを検証
+	if err := u.Authenticate(password); err != nil {
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "invalid password")
+		return nil, nil, ErrInvalidCredential
+	}
 	// ユーザーがアクティブでないならエラー
+	// パスワードを知らない人に利用停止などの状態を教えないように、パスワードを検証してから確認する
 	if !u.IsActive() {
-		return nil, nil, errors.New("user inactive")
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
 	}
-	// ユーザーのパスワードを検証
-	if err := u.Authenticate(password); err != nil {
+	// 古い方式でハッシュ化されたパスワードは、平文のパスワードがわかるログイン時に再ハッシュ化する
+	if u.NeedsRehash() {
+		uu.rehashPassword(ctx, u, password)
+	}
+	h := newLoginHistory(u, "password", ci)
+	if err := uu.stepUp(ctx, u, h, ci); err != nil {
 		return nil, nil, err
 	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLoginSuccess, u.ID, u.Email, "password")
+	recordLogin(ctx, uu.lr, uu.la, u, h)
+
 	// ユーザー情報からJWTを作成
-	tok, err := uu.jwter.GenerateAccessToken(u)
+	return issueTokens(ctx, uu.jwter, uu.sr, u, ci, rememberMe)
+}
+
+// usernameには@を使えないので、@を含む場合はemail、含まない場合はusernameとして取得する
+func (uu *userUsecase) getByLogin(ctx context.Context, login string) (*entity.User, error) {
+	if strings.Contains(login, "@") {
+		return uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(login))
+	}
+	return uu.ur.GetByUsername(ctx, normalizeUsername(login))
+}
+
+// LDAPのbindでパスワードを検証して、ディレクトリのemailと一致するローカルのユーザーでJWTを発行する
+// ローカルのユーザーが存在しない場合は、初回ログイン時に作成する(シャドウアカウント)
+func (uu *userUsecase) loginWithDirectory(ctx context.Context, email, password string, rememberMe bool, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	info, err := uu.dir.Authenticate(ctx, email, password)
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, 0, email, "invalid ldap credentials")
+		return nil, nil, ErrInvalidCredential
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var u *entity.User
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		u, err = uu.findOrCreateShadowUser(ctx, info.Email)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	// ディレクトリで認証できても、SCIMなどでローカルで無効化されたユーザーはログインさせない
+	// パスワードはbindで検証済みなので、ここで状態ごとのエラーを返してもパスワードを知らない人には伝わらない
+	if !u.IsActive() {
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
+	}
+	h := newLoginHistory(u, ldapLoginMethod, ci)
+	if err := uu.stepUp(ctx, u, h, ci); err != nil {
+		return nil, nil, err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLoginSuccess, u.ID, u.Email, ldapLoginMethod)
+	recordLogin(ctx, uu.lr, uu.la, u, h)
+
+	return issueTokens(ctx, uu.jwter, uu.sr, u, ci, rememberMe)
+}
+
+// パスワードが盗まれた可能性があるので、不審なログインではトークンを発行せずにマジックリンクで本人確認させる
+// マジックリンクでのログインは、メールアドレスの持ち主であることを確認できるので、本人確認はしない
+func (uu *userUsecase) stepUp(ctx context.Context, u *entity.User, h *entity.LoginHistory, ci entity.ClientInfo) error {
+	if !uu.ld.Detect(ctx, u, h) || !uu.cfg.LoginStepUp {
+		return nil
+	}
+	if uu.cfg.SkipStepUpOnTrustedDevice && uu.du.IsTrusted(ctx, u.ID, ci.DeviceToken) {
+		return nil
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "step-up required")
+	if err := uu.sendMagicLink(ctx, u); err != nil {
+		return err
+	}
+	return ErrStepUpRequired
+}
+
+// ディレクトリで認証済みのemailなので、仮登録のままのユーザーは作り直す
+func (uu *userUsecase) findOrCreateShadowUser(ctx context.Context, email string) (*entity.User, error) {
+	email = normalizeEmail(email)
+	u, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return registerExternalUser(ctx, uu.ur, uu.cfg.EmailKeys, email)
+	} else if err != nil {
+		return nil, err
+	}
+	if !u.IsPending() {
+		return u, nil
+	}
+	if err := uu.ur.Purge(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	return registerExternalUser(ctx, uu.ur, uu.cfg.EmailKeys, email)
+}
+
+// パスワードを検証する。LDAPを使う場合、ローカルのパスワードはランダムな値なのでディレクトリで検証する
+func (uu *userUsecase) verifyPassword(ctx context.Context, u *entity.User, pw string) error {
+	if uu.dir == nil {
+		return u.Authenticate(pw)
+	}
+	_, err := uu.dir.Authenticate(ctx, u.Email, pw)
+	return err
+}
+
+// ログインセッションを作成して、アクセストークンと、リフレッシュトークンをセットしたcookieを作成する
+// rememberMeがfalseの場合は、ブラウザを閉じると消えるセッションcookieにする
+func issueTokens(ctx context.Context, jwter auth.IJwtGenerator, sr repository.ISessionRepository, u *entity.User, ci entity.ClientInfo, rememberMe bool) ([]byte, *http.Cookie, error) {
+	exp := SessionTTL
+	if rememberMe {
+		exp = RememberMeSessionTTL
+	}
+	s := &entity.Session{
+		ID:        entity.SessionID(random.Alphanumeric(32)),
+		UserID:    u.ID,
+		IPAddress: ci.IPAddress,
+		UserAgent: truncateUserAgent(ci.UserAgent),
+		ExpiresAt: time.Now().Add(exp),
+	}
+	if err := enforceSessionLimit(ctx, sr, u.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := sr.Create(ctx, s); err != nil {
+		return nil, nil, err
+	}
+
+	tok, err := jwter.GenerateAccessToken(u)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	refreshToken, err := uu.jwter.GenerateRefreshToken(u)
+	refreshToken, err := jwter.GenerateRefreshToken(u, s)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -148,7 +550,9 @@ func (uu *userUsecase) Login(ctx context.Context, email, password string) ([]byt
 	cookie := new(http.Cookie)
 	cookie.Name = "refresh-token"
 	cookie.Value = string(refreshToken)
-	cookie.Expires = time.Now().Add(3 * 24 * time.Hour)
+	if rememberMe {
+		cookie.Expires = s.ExpiresAt
+	}
 	// cookieのsame-site属性。今回は使うとしてもlocalhostからなのでStrictを指定
 	cookie.SameSite = http.SameSiteStrictMode
 	// HttpOnlyを設定することでJavaScriptでCookie操作を禁止
@@ -161,6 +565,9 @@ func (uu *userUsecase) Login(ctx context.Context, email, password string) ([]byt
 }
 
 func (uu *userUsecase) Get(ctx context.Context, uid entity.UserID) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Get")
+	defer span.End()
+
 	u, err := uu.ur.Get(ctx, uid)
 	if err != nil {
 		return nil, err
@@ -168,18 +575,533 @@ func (uu *userUsecase) Get(ctx context.Context, uid entity.UserID) (*entity.User
 	return u, nil
 }
 
-func (uu *userUsecase) Refresh(ctx context.Context, token []byte) ([]byte, error) {
-	uid, err := uu.jwter.GetUserIDFromJWT(token)
+// 直近のログイン履歴を取得する
+func (uu *userUsecase) ListLogins(ctx context.Context, uid entity.UserID) (entity.LoginHistories, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ListLogins")
+	defer span.End()
+
+	return uu.lr.ListByUserID(ctx, uid, 50)
+}
+
+// ログイン中のセッション(デバイス)の一覧を取得する
+func (uu *userUsecase) ListSessions(ctx context.Context, uid entity.UserID) (entity.Sessions, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ListSessions")
+	defer span.End()
+
+	return uu.sr.ListByUserID(ctx, uid)
+}
+
+// セッションを削除して、そのセッションのリフレッシュトークンを使えなくする
+func (uu *userUsecase) RevokeSession(ctx context.Context, uid entity.UserID, sid entity.SessionID) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.RevokeSession")
+	defer span.End()
+
+	if err := uu.sr.Delete(ctx, uid, sid); err != nil {
+		return err
+	}
+	// 他のサーバーでもすぐに使えなくなるように、ストアにも記録する
+	// セッションの有効期限は最長でもRememberMeSessionTTLなので、その間だけ保持する
+	return uu.rs.RevokeSession(ctx, sid, time.Now().Add(RememberMeSessionTTL))
+}
+
+// ユーザーの全てのセッションを失効させる。セッションの削除の前に呼び出す
+func (uu *userUsecase) revokeSessions(ctx context.Context, uid entity.UserID) error {
+	return revokeUserSessions(ctx, uu.sr, uu.rs, uid)
+}
+
+// ユーザーの全てのセッションを失効させる。セッションの削除の前に呼び出す
+func revokeUserSessions(ctx context.Context, sr repository.ISessionRepository, rs auth.IRevocationStore, uid entity.UserID) error {
+	ss, err := sr.ListByUserID(ctx, uid)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	for _, s := range ss {
+		if err := rs.RevokeSession(ctx, s.ID, s.ExpiresAt); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// アクセストークンを有効期限まで失効させる。リフレッシュトークンが渡された場合は、そのセッションも失効させる
+func (uu *userUsecase) Logout(ctx context.Context, uid entity.UserID, jti string, exp time.Time, refreshToken []byte) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Logout")
+	defer span.End()
+
 	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// jtiを付ける前に発行されたトークンは個別に失効させられないので、有効期限まで待つ
+	if jti != "" {
+		if err := uu.rs.RevokeAccessToken(ctx, jti, exp); err != nil {
+			return err
+		}
+	}
+	if len(refreshToken) > 0 {
+		// 期限切れなどで検証できないリフレッシュトークンは、既に使えないので無視する
+		rt, err := uu.jwter.ParseRefreshToken(refreshToken)
+		if err == nil && rt.UserID == uid {
+			if err := uu.RevokeSession(ctx, uid, rt.SessionID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLogout, u.ID, u.Email, "")
+	return nil
+}
+
+func (uu *userUsecase) LogoutAll(ctx context.Context, uid entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.LogoutAll")
+	defer span.End()
+
+	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.ur.RevokeTokens(ctx, u); err != nil {
+			return err
+		}
+		if err := uu.revokeSessions(ctx, u.ID); err != nil {
+			return err
+		}
+		return uu.sr.DeleteByUserID(ctx, u.ID)
+	}); err != nil {
+		return err
+	}
+	// 今から発行するアクセストークンより前のものは、最長でもAccessTokenTTLで期限が切れる
+	if err := uu.rs.RevokeUserTokens(ctx, u.ID, u.TokenVersion, time.Now().Add(auth.AccessTokenTTL+auth.ClockSkew)); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLogoutAll, u.ID, u.Email, fmt.Sprintf("token_version=%d", u.TokenVersion))
+	return nil
+}
+
+func (uu *userUsecase) Refresh(ctx context.Context, token []byte) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Refresh")
+	defer span.End()
+
+	rt, err := uu.jwter.ParseRefreshToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSessionExpired, err)
+	}
+	// 失効させたセッションは、DBを参照する前に弾く
+	revoked, err := uu.rs.IsSessionRevoked(ctx, rt.SessionID)
 	if err != nil {
 		return nil, err
 	}
+	if revoked {
+		return nil, ErrSessionExpired
+	}
+	u, err := uu.ur.Get(ctx, rt.UserID)
+	// 退会済みのユーザーは取得できない
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionExpired
+	} else if err != nil {
+		return nil, err
+	}
+	// 管理者に利用を停止、または禁止されたユーザーはリフレッシュさせない
+	if u.IsRestricted() {
+		return nil, inactiveError(u)
+	}
+	// パスワード変更などで失効させられたトークンならエラー
+	if u.IsTokenRevoked(rt.IssuedAt) {
+		return nil, ErrSessionExpired
+	}
+	// セッションが削除されている、または期限切れならエラー
+	s, err := uu.sr.Get(ctx, rt.SessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionExpired
+	} else if err != nil {
+		return nil, err
+	}
+	if s.UserID != u.ID || s.IsExpired() {
+		return nil, ErrSessionExpired
+	}
+	if err := uu.sr.Touch(ctx, s.ID); err != nil {
+		return nil, err
+	}
 	tok, err := uu.jwter.GenerateAccessToken(u)
 	if err != nil {
 		return nil, err
 	}
+	writeAuditLog(ctx, uu.ar, entity.AuditRefresh, u.ID, u.Email, "")
 	return tok, nil
-}
\ No newline at end of file
+}
+
+// パスワードを再入力してもらい、機密性の高い操作に必要なsudoトークンを発行する
+func (uu *userUsecase) Sudo(ctx context.Context, uid entity.UserID, pw string) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Sudo")
+	defer span.End()
+
+	// パスワードのハッシュはキャッシュに保存しないので、プライマリから取得する
+	u, err := uu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+	if err := uu.verifyPassword(ctx, u, pw); err != nil {
+		writeAuditLog(ctx, uu.ar, entity.AuditSudo, u.ID, u.Email, "invalid password")
+		return nil, ErrInvalidCredential
+	}
+
+	token, err := uu.jwter.GenerateSudoToken(u)
+	if err != nil {
+		return nil, err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditSudo, u.ID, u.Email, "")
+	return token, nil
+}
+
+// プロフィールの部分的な更新。nilの項目は変更しない
+type ProfileUpdate struct {
+	Name        *string
+	DisplayName *string
+	Bio         *string
+}
+
+// クライアントが表示していたversionと一致する場合だけ、指定された項目を前後の空白を除いて更新する
+func (uu *userUsecase) UpdateProfile(ctx context.Context, uid entity.UserID, version int, p ProfileUpdate) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.UpdateProfile")
+	defer span.End()
+
+	// 他のリクエストでの更新を見落とさないように、キャッシュやレプリカではなくプライマリから取得する
+	u, err := uu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+	// クライアントが表示していたプロフィールが古ければ、上書きさせずに読み込み直してもらう
+	if u.Version != version {
+		return nil, repository.ErrVersionConflict
+	}
+
+	var changed []string
+	set := func(name string, dst *string, v *string) {
+		if v == nil {
+			return
+		}
+		if s := strings.TrimSpace(*v); s != *dst {
+			*dst = s
+			changed = append(changed, name)
+		}
+	}
+	set("name", &u.Name, p.Name)
+	set("display_name", &u.DisplayName, p.DisplayName)
+	set("bio", &u.Bio, p.Bio)
+	if len(changed) == 0 {
+		return u, nil
+	}
+
+	if err := uu.ur.UpdateProfile(ctx, u); err != nil {
+		return nil, err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditProfileUpdate, u.ID, u.Email, "fields="+strings.Join(changed, ","))
+	return u, nil
+}
+
+// trueの場合は、ログインのたびにメールで通知する
+func (uu *userUsecase) SetNotifyOnLogin(ctx context.Context, uid entity.UserID, enabled bool) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.SetNotifyOnLogin")
+	defer span.End()
+
+	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if u.NotifyOnLogin == enabled {
+		return nil
+	}
+	u.NotifyOnLogin = enabled
+	return uu.ur.UpdateNotifyOnLogin(ctx, u)
+}
+
+// 現在のパスワードを検証して、新しいソルトでパスワードを更新する
+// 更新前に発行されたリフレッシュトークンは全て無効になる
+func (uu *userUsecase) ChangePassword(ctx context.Context, uid entity.UserID, currentPw, newPw string) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ChangePassword")
+	defer span.End()
+
+	// パスワードのハッシュはキャッシュに保存しないので、プライマリから取得する
+	u, err := uu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	// 現在のパスワードを検証
+	if err := u.Authenticate(currentPw); err != nil {
+		writeAuditLog(ctx, uu.ar, entity.AuditPasswordChange, u.ID, u.Email, "invalid current password")
+		return ErrInvalidCredential
+	}
+
+	if err := uu.validateNewPassword(ctx, newPw, u.Email); err != nil {
+		return err
+	}
+
+	salt := random.Alphanumeric(30)
+	hashed, err := u.CreateHashedPassword(newPw, salt)
+	if err != nil {
+		return err
+	}
+	u.Salt = salt
+	u.Password = hashed
+
+	// パスワードを変更したのにセッションが残ることがないようにする
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.ur.UpdatePassword(ctx, u); err != nil {
+			return err
+		}
+		if err := uu.revokeSessions(ctx, u.ID); err != nil {
+			return err
+		}
+		return uu.sr.DeleteByUserID(ctx, u.ID)
+	}); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditPasswordChange, u.ID, u.Email, "")
+	return nil
+}
+
+// ユーザーを退会させる。発行済みのリフレッシュトークンは無効になる
+func (uu *userUsecase) Delete(ctx context.Context, uid entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.Delete")
+	defer span.End()
+
+	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.ur.Delete(ctx, u); err != nil {
+			return err
+		}
+		if err := uu.revokeSessions(ctx, u.ID); err != nil {
+			return err
+		}
+		return uu.sr.DeleteByUserID(ctx, u.ID)
+	}); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditDelete, u.ID, u.Email, "")
+	return nil
+}
+
+// 変更後のemail宛に確認用トークンを、変更前のemail宛にお知らせを送信する
+func (uu *userUsecase) RequestEmailChange(ctx context.Context, uid entity.UserID, newEmail string) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.RequestEmailChange")
+	defer span.End()
+
+	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	newEmail = normalizeEmail(newEmail)
+	if u.Email == newEmail {
+		return ErrEmailNotChanged
+	}
+
+	// トークンはハッシュだけを保存して、メールで送る値は保存しない
+	token := random.Alphanumeric(8)
+	u.PendingEmail = newEmail
+	u.PendingEmailToken = hashToken(token)
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.checkEmailAvailable(ctx, u.ID, newEmail); err != nil {
+			return err
+		}
+		return uu.ur.RequestEmailChange(ctx, u)
+	}); err != nil {
+		return err
+	}
+
+	if err := uu.mailer.SendWithEmailChangeToken(ctx, newEmail, token); err != nil {
+		return err
+	}
+	return uu.mailer.SendEmailChangeNotice(ctx, u.Email, newEmail)
+}
+
+// 確認用トークンを検証して、emailを変更する
+func (uu *userUsecase) ConfirmEmailChange(ctx context.Context, uid entity.UserID, token string) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.ConfirmEmailChange")
+	defer span.End()
+
+	// 変更のリクエストの直後に呼ばれるので、確認用トークンをプライマリから取得する
+	ctx = repository.WithPrimary(ctx)
+
+	u, err := uu.ur.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if u.PendingEmail == "" || u.PendingEmailRequestedAt == nil {
+		return ErrNoEmailChange
+	}
+
+	// 総当たりされないように、失敗回数が上限に達したら検証しない
+	if u.PendingEmailAttempts >= maxEmailChangeAttempts {
+		return ErrTooManyAttempts
+	}
+
+	// トークンが一致しなければエラーをかえす
+	if !compareTokenHash(token, u.PendingEmailToken) {
+		if err := uu.ur.IncrementEmailChangeAttempts(ctx, u); err != nil {
+			return err
+		}
+		return ErrInvalidToken
+	}
+
+	// トークンが作成されて有効期限を過ぎていればエラーをかえす
+	if u.PendingEmailRequestedAt.Add(uu.cfg.EmailChangeTokenTTL).Compare(time.Now()) != +1 {
+		return ErrTokenExpired
+	}
+
+	oldEmail := u.Email
+	u.PendingEmail = normalizeEmail(u.PendingEmail)
+	u.EmailKey = uu.cfg.EmailKeys.Key(u.PendingEmail)
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		// リクエストしてから確認されるまでに、他のユーザーが同じemailを使っていないか再度確認する
+		if err := uu.checkEmailAvailable(ctx, u.ID, u.PendingEmail); err != nil {
+			return err
+		}
+		if err := uu.ur.ConfirmEmailChange(ctx, u); errors.Is(err, repository.ErrEmailTaken) {
+			return ErrEmailAlreadyInUse
+		} else if err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditEmailChange, u.ID, u.Email, "from "+oldEmail)
+	return nil
+}
+
+// uidのユーザーがemailを使用可能か確認する。仮登録のままのユーザーが使っている場合は削除する
+// 大文字小文字やエイリアスだけが違うemailは同じemailとして扱うので、自分のemailのエイリアスには変更できる
+func (uu *userUsecase) checkEmailAvailable(ctx context.Context, uid entity.UserID, email string) error {
+	other, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if other.ID == uid {
+		return nil
+	}
+	if !other.IsPending() {
+		return ErrEmailAlreadyInUse
+	}
+	return uu.ur.Purge(ctx, other.ID)
+}
+
+// ログイン用のマジックリンクをメールで送信する
+func (uu *userUsecase) RequestMagicLink(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.RequestMagicLink")
+	defer span.End()
+
+	u, err := uu.ur.GetByEmailKey(ctx, uu.cfg.EmailKeys.Key(email))
+	// ユーザーが存在するかどうかを知られないように、存在しない場合も成功として扱う
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// ユーザーがアクティブでないならエラー
+	if !u.IsActive() {
+		return ErrUserInactive
+	}
+	return uu.sendMagicLink(ctx, u)
+}
+
+func (uu *userUsecase) sendMagicLink(ctx context.Context, u *entity.User) error {
+	tok, err := uu.jwter.GenerateMagicToken(u)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(magicLinkURL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", string(tok))
+	link.RawQuery = q.Encode()
+
+	return uu.mailer.SendWithMagicLink(ctx, u.Email, link.String())
+}
+
+// マジックリンクのトークンを検証して、アクセストークンとリフレッシュトークンを発行する
+func (uu *userUsecase) LoginWithMagicLink(ctx context.Context, token []byte, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "UserUsecase.LoginWithMagicLink")
+	defer span.End()
+
+	mt, err := uu.jwter.ParseMagicToken(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	u, err := uu.ur.Get(ctx, mt.UserID)
+	// 退会済みのユーザーは取得できない
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// トークンは一度しか使えない
+	if err := uu.mr.Consume(ctx, mt.JwtID, mt.Expiration); err != nil {
+		if errors.Is(err, repository.ErrMagicLinkUsed) {
+			writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "magic link already used")
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	// 使用済みのリンクで利用停止などの状態がわからないように、トークンを使ってから確認する
+	if !u.IsActive() {
+		writeAuditLog(ctx, uu.ar, entity.AuditLoginFailure, u.ID, u.Email, "user inactive")
+		return nil, nil, inactiveError(u)
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLoginSuccess, u.ID, u.Email, "magic-link")
+	writeLoginHistory(ctx, uu.lr, uu.la, uu.ld, u, "magic-link", ci)
+
+	return issueTokens(ctx, uu.jwter, uu.sr, u, ci, false)
+}
+
+// ログイン通知の「心当たりがない」リンクから、ユーザーの全てのセッションを失効させる
+func (uu *userUsecase) DenyLogin(ctx context.Context, token []byte) error {
+	ctx, span := tracer.Start(ctx, "UserUsecase.DenyLogin")
+	defer span.End()
+
+	lt, err := uu.jwter.ParseLoginAlertToken(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	u, err := uu.ur.Get(ctx, lt.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidToken
+	} else if err != nil {
+		return err
+	}
+
+	if err := uu.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uu.revokeSessions(ctx, u.ID); err != nil {
+			return err
+		}
+		return uu.sr.DeleteByUserID(ctx, u.ID)
+	}); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditLoginDenied, u.ID, u.Email, fmt.Sprintf("login_id=%d", lt.LoginID))
+	return nil
+}
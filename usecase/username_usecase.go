@@ -0,0 +1,116 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"login-example/entity"
+	"login-example/repository"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// usernameに使える文字。英小文字で始まる、英小文字と数字とアンダースコアの3〜32文字
+// @を含まないので、ログインではemailと区別できる
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,31}$`)
+
+// サービスの運営者やURLのパスと紛らわしいので、ユーザーには使わせないusername
+var reservedUsernames = []string{
+	"abuse", "admin", "administrator", "api", "auth", "billing", "help", "info", "login", "logout",
+	"mail", "moderator", "noreply", "no_reply", "null", "official", "postmaster", "register", "root",
+	"security", "settings", "signup", "staff", "support", "system", "undefined", "user", "users",
+	"webmaster", "www",
+}
+
+// emailの代わりにログインに使えるusernameを設定する。設定は任意
+type IUsernameUsecase interface {
+	// usernameを設定する。設定済みの場合は変更する
+	Set(ctx context.Context, uid entity.UserID, username string) (*entity.User, error)
+	Delete(ctx context.Context, uid entity.UserID) error
+}
+
+type usernameUsecase struct {
+	ur repository.IUserRepository
+	ar repository.IAuditRepository
+	// 使わせないusername。小文字で保持する
+	reserved map[string]bool
+}
+
+// reservedは、組み込みの予約済みのusernameに加えて使わせないusername
+func NewUsernameUsecase(ur repository.IUserRepository, ar repository.IAuditRepository, reserved []string) IUsernameUsecase {
+	m := make(map[string]bool, len(reservedUsernames)+len(reserved))
+	for _, name := range slices.Concat(reservedUsernames, reserved) {
+		m[normalizeUsername(name)] = true
+	}
+	return &usernameUsecase{ur: ur, ar: ar, reserved: m}
+}
+
+func (uu *usernameUsecase) Set(ctx context.Context, uid entity.UserID, username string) (*entity.User, error) {
+	ctx, span := tracer.Start(ctx, "UsernameUsecase.Set")
+	defer span.End()
+
+	username = normalizeUsername(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if uu.reserved[username] {
+		return nil, ErrUsernameReserved
+	}
+
+	u, err := uu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive() {
+		return nil, ErrUserInactive
+	}
+	if u.Username != nil && *u.Username == username {
+		return u, nil
+	}
+	other, err := uu.ur.GetByUsername(repository.WithPrimary(ctx), username)
+	if err == nil && other.ID != u.ID {
+		return nil, ErrUsernameAlreadyInUse
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	detail := "username=" + username
+	if u.Username != nil {
+		detail += " from " + *u.Username
+	}
+	u.Username = &username
+	// 退会済みのユーザーのusernameは取得できないので、一意制約の違反でも確認する
+	if err := uu.ur.UpdateUsername(ctx, u); errors.Is(err, repository.ErrUsernameTaken) {
+		return nil, ErrUsernameAlreadyInUse
+	} else if err != nil {
+		return nil, err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditUsernameChange, u.ID, u.Email, detail)
+	return u, nil
+}
+
+func (uu *usernameUsecase) Delete(ctx context.Context, uid entity.UserID) error {
+	ctx, span := tracer.Start(ctx, "UsernameUsecase.Delete")
+	defer span.End()
+
+	u, err := uu.ur.Get(repository.WithPrimary(ctx), uid)
+	if err != nil {
+		return err
+	}
+	if u.Username == nil {
+		return nil
+	}
+	detail := "from " + *u.Username
+	u.Username = nil
+	if err := uu.ur.UpdateUsername(ctx, u); err != nil {
+		return err
+	}
+	writeAuditLog(ctx, uu.ar, entity.AuditUsernameDelete, u.ID, u.Email, detail)
+	return nil
+}
+
+// usernameは大文字と小文字を区別しないので、小文字にして保存と検索をする
+func normalizeUsername(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
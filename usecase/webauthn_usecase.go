@@ -0,0 +1,317 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"login-example/auth"
+	"login-example/entity"
+	"login-example/random"
+	"login-example/repository"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// WebAuthnのRelying Partyの設定
+var (
+	rpDisplayName = "login-example"
+	rpID          = "localhost"
+	rpOrigins     = []string{"http://localhost:8000"}
+
+	// 登録・ログインのセレモニーを完了させるまでの有効期限
+	expWebAuthnSession = 5 * time.Minute
+)
+
+type IWebAuthnUsecase interface {
+	BeginRegistration(ctx context.Context, uid entity.UserID) (*protocol.CredentialCreation, string, error)
+	FinishRegistration(ctx context.Context, uid entity.UserID, sessionID string, res *protocol.ParsedCredentialCreationData) error
+	BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error)
+	FinishLogin(ctx context.Context, sessionID string, res *protocol.ParsedCredentialAssertionData, ci entity.ClientInfo) ([]byte, *http.Cookie, error)
+}
+
+type webAuthnUsecase struct {
+	ur       repository.IUserRepository
+	cr       repository.IWebAuthnCredentialRepository
+	ar       repository.IAuditRepository
+	lr       repository.ILoginHistoryRepository
+	la       ILoginAlerter
+	ld       ILoginAnomalyDetector
+	sr       repository.ISessionRepository
+	jwter    auth.IJwtGenerator
+	wa       *webauthn.WebAuthn
+	sessions *webAuthnSessionStore
+	ek       EmailKeyer
+}
+
+func NewWebAuthnUsecase(ur repository.IUserRepository, cr repository.IWebAuthnCredentialRepository, ar repository.IAuditRepository, lr repository.ILoginHistoryRepository, la ILoginAlerter, ld ILoginAnomalyDetector, sr repository.ISessionRepository, jwter auth.IJwtGenerator, ek EmailKeyer) (IWebAuthnUsecase, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: rpDisplayName,
+		RPID:          rpID,
+		RPOrigins:     rpOrigins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webauthn: %w", err)
+	}
+	return &webAuthnUsecase{
+		ur:       ur,
+		cr:       cr,
+		ar:       ar,
+		lr:       lr,
+		la:       la,
+		ld:       ld,
+		sr:       sr,
+		jwter:    jwter,
+		wa:       wa,
+		sessions: newWebAuthnSessionStore(),
+		ek:       ek,
+	}, nil
+}
+
+// ログイン中のユーザーに認証器を登録するためのチャレンジを作成する
+func (wu *webAuthnUsecase) BeginRegistration(ctx context.Context, uid entity.UserID) (*protocol.CredentialCreation, string, error) {
+	ctx, span := tracer.Start(ctx, "WebAuthnUsecase.BeginRegistration")
+	defer span.End()
+
+	wau, err := wu.getWebAuthnUser(ctx, uid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 登録済みの認証器は重複して登録できないようにする
+	options, session, err := wu.wa.BeginRegistration(wau,
+		webauthn.WithExclusions(wau.credentialDescriptors()))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	sessionID := wu.sessions.save(uid, session)
+	return options, sessionID, nil
+}
+
+// 認証器からのレスポンスを検証して、公開鍵を保存する
+func (wu *webAuthnUsecase) FinishRegistration(ctx context.Context, uid entity.UserID, sessionID string, res *protocol.ParsedCredentialCreationData) error {
+	ctx, span := tracer.Start(ctx, "WebAuthnUsecase.FinishRegistration")
+	defer span.End()
+
+	ws, err := wu.sessions.pop(sessionID)
+	if err != nil {
+		return err
+	}
+	// チャレンジを作成したユーザーと異なる場合はエラー
+	if ws.uid != uid {
+		return ErrInvalidToken
+	}
+
+	wau, err := wu.getWebAuthnUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	cred, err := wu.wa.CreateCredential(wau, *ws.data, res)
+	if err != nil {
+		return fmt.Errorf("failed to create credential: %w", err)
+	}
+
+	return wu.cr.Create(ctx, &entity.WebAuthnCredential{
+		UserID:          uid,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+	})
+}
+
+// emailに紐づく認証器でログインするためのチャレンジを作成する
+func (wu *webAuthnUsecase) BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error) {
+	ctx, span := tracer.Start(ctx, "WebAuthnUsecase.BeginLogin")
+	defer span.End()
+
+	u, err := wu.ur.GetByEmailKey(ctx, wu.ek.Key(email))
+	// 登録されているemailかを知られないように、存在しない場合はパスワードが一致しない場合と同じエラーにする
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrInvalidCredential
+	} else if err != nil {
+		return nil, "", err
+	}
+	// アクティブでないユーザーも、認証器の署名を検証するまではエラーにしない
+	wau, err := wu.newWebAuthnUser(ctx, u)
+	if err != nil {
+		return nil, "", err
+	}
+	// 認証器を登録していないユーザーも、存在しない場合と区別できないようにする
+	if len(wau.cs) == 0 {
+		return nil, "", ErrInvalidCredential
+	}
+
+	options, session, err := wu.wa.BeginLogin(wau)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	sessionID := wu.sessions.save(u.ID, session)
+	return options, sessionID, nil
+}
+
+// 認証器の署名を検証して、パスワードログインと同じくJWTを発行する
+func (wu *webAuthnUsecase) FinishLogin(ctx context.Context, sessionID string, res *protocol.ParsedCredentialAssertionData, ci entity.ClientInfo) ([]byte, *http.Cookie, error) {
+	ctx, span := tracer.Start(ctx, "WebAuthnUsecase.FinishLogin")
+	defer span.End()
+
+	ws, err := wu.sessions.pop(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wau, err := wu.getWebAuthnUser(ctx, ws.uid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cred, err := wu.wa.ValidateLogin(wau, *ws.data, res)
+	if err != nil {
+		writeAuditLog(ctx, wu.ar, entity.AuditLoginFailure, wau.u.ID, wau.u.Email, "invalid passkey assertion")
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+	// 署名を検証してから、ユーザーがアクティブか確認する
+	if !wau.u.IsActive() {
+		return nil, nil, inactiveError(wau.u)
+	}
+	// 認証器のクローンが疑われる場合はログインさせない
+	if cred.Authenticator.CloneWarning {
+		writeAuditLog(ctx, wu.ar, entity.AuditLoginFailure, wau.u.ID, wau.u.Email, "passkey clone warning")
+		return nil, nil, ErrAuthenticatorClone
+	}
+
+	if err := wu.cr.UpdateSignCount(ctx, &entity.WebAuthnCredential{
+		CredentialID: cred.ID,
+		SignCount:    cred.Authenticator.SignCount,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	writeAuditLog(ctx, wu.ar, entity.AuditLoginSuccess, wau.u.ID, wau.u.Email, "passkey")
+	writeLoginHistory(ctx, wu.lr, wu.la, wu.ld, wau.u, "passkey", ci)
+
+	return issueTokens(ctx, wu.jwter, wu.sr, wau.u, ci, false)
+}
+
+func (wu *webAuthnUsecase) getWebAuthnUser(ctx context.Context, uid entity.UserID) (*webAuthnUser, error) {
+	u, err := wu.ur.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return wu.newWebAuthnUser(ctx, u)
+}
+
+func (wu *webAuthnUsecase) newWebAuthnUser(ctx context.Context, u *entity.User) (*webAuthnUser, error) {
+	cs, err := wu.cr.ListByUserID(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{u: u, cs: cs}, nil
+}
+
+// webauthn.Userインターフェースを満たすためのアダプター
+type webAuthnUser struct {
+	u  *entity.User
+	cs entity.WebAuthnCredentials
+}
+
+func (wu *webAuthnUser) WebAuthnID() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(wu.u.ID))
+	return b
+}
+
+func (wu *webAuthnUser) WebAuthnName() string {
+	return wu.u.Email
+}
+
+func (wu *webAuthnUser) WebAuthnDisplayName() string {
+	return wu.u.Email
+}
+
+func (wu *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (wu *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(wu.cs))
+	for _, c := range wu.cs {
+		creds = append(creds, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return creds
+}
+
+func (wu *webAuthnUser) credentialDescriptors() []protocol.CredentialDescriptor {
+	descs := make([]protocol.CredentialDescriptor, 0, len(wu.cs))
+	for _, c := range wu.WebAuthnCredentials() {
+		descs = append(descs, c.Descriptor())
+	}
+	return descs
+}
+
+// セレモニー開始から完了までの間、チャレンジを保持しておくためのストア
+type webAuthnSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*webAuthnSession
+}
+
+type webAuthnSession struct {
+	uid  entity.UserID
+	data *webauthn.SessionData
+	exp  time.Time
+}
+
+func newWebAuthnSessionStore() *webAuthnSessionStore {
+	return &webAuthnSessionStore{sessions: map[string]*webAuthnSession{}}
+}
+
+func (s *webAuthnSessionStore) save(uid entity.UserID, data *webauthn.SessionData) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 期限切れのセッションを掃除する
+	now := time.Now()
+	for id, ws := range s.sessions {
+		if ws.exp.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+
+	id := random.Alphanumeric(32)
+	s.sessions[id] = &webAuthnSession{uid: uid, data: data, exp: now.Add(expWebAuthnSession)}
+	return id
+}
+
+// セッションを取り出す。チャレンジは一度しか使えないので取り出したセッションは削除する
+func (s *webAuthnSessionStore) pop(id string) (*webAuthnSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	delete(s.sessions, id)
+
+	if ws.exp.Before(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return ws, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"login-example/handler"
+)
+
+// パスワードの長さは上限だけを確認し、強度はusecaseで推定する
+func TestValidatePasswordLength(t *testing.T) {
+	v := &CustomValidator{validator: newValidator()}
+	passphrase := "correct horse battery staple on the moon"
+	tooLong := strings.Repeat("a", 129)
+
+	tests := []struct {
+		name string
+		req  any
+		ok   bool
+	}{
+		{"register passphrase", &handler.PreRegisterRequest{Email: "a@example.com", Password: passphrase}, true},
+		{"register too long", &handler.PreRegisterRequest{Email: "a@example.com", Password: tooLong}, false},
+		{"login short ldap password", &handler.LoginRequest{Username: "alice", Password: "abc"}, true},
+		{"login passphrase", &handler.LoginRequest{Email: "a@example.com", Password: passphrase}, true},
+		{"login too long", &handler.LoginRequest{Email: "a@example.com", Password: tooLong}, false},
+		{"change passphrase", &handler.ChangePasswordRequest{CurrentPassword: "x", NewPassword: passphrase}, true},
+		{"change too long", &handler.ChangePasswordRequest{CurrentPassword: "x", NewPassword: tooLong}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Validate(tt.req); (err == nil) != tt.ok {
+				t.Errorf("Validate() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
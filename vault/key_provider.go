@@ -0,0 +1,40 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"login-example/auth"
+)
+
+// Vaultに保存したJWTの鍵を読み込むauth.IKeyProviderを作成する
+// pathのsecret_keyとpublic_keyにPEM形式の鍵を、verify_keysに検証にだけ使う公開鍵の配列を保存する
+// 読み込むのは起動時だけなので、鍵を入れ替えた場合は再起動する
+func (c *Client) KeyProvider(path string) auth.IKeyProvider {
+	return &keyProvider{c: c, path: path}
+}
+
+type keyProvider struct {
+	c    *Client
+	path string
+}
+
+func (p *keyProvider) LoadKeys(ctx context.Context) (*auth.KeyMaterial, error) {
+	_, data, err := p.c.read(ctx, p.path)
+	if err != nil {
+		return nil, err
+	}
+	secretKey, _ := data["secret_key"].(string)
+	if secretKey == "" {
+		return nil, fmt.Errorf("secret_key not found in vault secret: %s", p.path)
+	}
+	publicKey, _ := data["public_key"].(string)
+
+	km := &auth.KeyMaterial{SecretKey: []byte(secretKey), PublicKey: []byte(publicKey)}
+	verifyKeys, _ := data["verify_keys"].([]any)
+	for _, vk := range verifyKeys {
+		if s, ok := vk.(string); ok && s != "" {
+			km.VerifyKeys = append(km.VerifyKeys, []byte(s))
+		}
+	}
+	return km, nil
+}
@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"login-example/logging"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/vault/api"
+)
+
+type Config struct {
+	Addr      string
+	Namespace string
+	// トークンで認証する。空の場合はRoleIDとSecretIDでAppRoleにログインする
+	Token    string
+	RoleID   string
+	SecretID string
+}
+
+// Vaultから秘密情報を読み込むクライアント
+// トークンと動的なシークレットのリースはバックグラウンドで更新し続けるので、終了時にCloseする
+type Client struct {
+	api    *api.Client
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	watchers []*api.LifetimeWatcher
+	closed   atomic.Bool
+}
+
+// DBやSMTPの認証情報
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Vaultにログインする。ctxのloggerに、リースの更新に失敗した時のログを出力する
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	ac := api.DefaultConfig()
+	ac.Address = cfg.Addr
+	client, err := api.NewClient(ac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+
+	c := &Client{api: client, logger: logging.FromContext(ctx)}
+	if err := c.login(ctx, cfg); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) login(ctx context.Context, cfg Config) error {
+	if cfg.Token != "" {
+		c.api.SetToken(cfg.Token)
+		s, err := c.api.Auth().Token().LookupSelfWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to lookup vault token: %w", err)
+		}
+		// rootトークンなど、期限のないトークンは更新しない
+		if renewable, _ := s.TokenIsRenewable(); !renewable {
+			return nil
+		}
+		s, err = c.api.Auth().Token().RenewSelfWithContext(ctx, 0)
+		if err != nil {
+			return fmt.Errorf("failed to renew vault token: %w", err)
+		}
+		return c.watch(s, "token")
+	}
+
+	s, err := c.api.Logical().WriteWithContext(ctx, "auth/approle/login", map[string]any{
+		"role_id":   cfg.RoleID,
+		"secret_id": cfg.SecretID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to login to vault: %w", err)
+	}
+	if s == nil || s.Auth == nil {
+		return errors.New("vault login returned no token")
+	}
+	c.api.SetToken(s.Auth.ClientToken)
+	if !s.Auth.Renewable {
+		return nil
+	}
+	return c.watch(s, "token")
+}
+
+// pathに保存されたusernameとpasswordを取得する
+// database/creds/<role>のような動的なシークレットの場合は、期限が切れないようにリースを更新し続ける
+func (c *Client) Credentials(ctx context.Context, path string) (*Credentials, error) {
+	s, data, err := c.read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	username, _ := data["username"].(string)
+	password, _ := data["password"].(string)
+	if username == "" {
+		return nil, fmt.Errorf("username not found in vault secret: %s", path)
+	}
+	if s.LeaseID != "" && s.Renewable {
+		if err := c.watch(s, path); err != nil {
+			return nil, err
+		}
+	}
+	return &Credentials{Username: username, Password: password}, nil
+}
+
+// シークレットを読み込む。KV v2の場合はdataの中に値が入っているので取り出す
+func (c *Client) read(ctx context.Context, path string) (*api.Secret, map[string]any, error) {
+	s, err := c.api.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	if s == nil || s.Data == nil {
+		return nil, nil, fmt.Errorf("vault secret not found: %s", path)
+	}
+	if data, ok := s.Data["data"].(map[string]any); ok {
+		if _, ok := s.Data["metadata"]; ok {
+			return s, data, nil
+		}
+	}
+	return s, s.Data, nil
+}
+
+// リースを更新し続ける。最大TTLに達するなどして更新できなくなったら、ログに出力する
+func (c *Client) watch(s *api.Secret, name string) error {
+	w, err := c.api.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: s})
+	if err != nil {
+		return fmt.Errorf("failed to watch vault lease: %w", err)
+	}
+	c.mu.Lock()
+	c.watchers = append(c.watchers, w)
+	c.mu.Unlock()
+
+	go w.Start()
+	go func() {
+		for {
+			select {
+			case err := <-w.DoneCh():
+				if c.closed.Load() {
+					return
+				}
+				// 期限が切れると認証情報が使えなくなるので、再起動して取得し直す必要がある
+				if err != nil {
+					c.logger.Error("failed to renew vault lease", slog.String("secret", name), logging.Err(err))
+				} else {
+					c.logger.Error("vault lease reached max ttl, restart to fetch new credentials", slog.String("secret", name))
+				}
+				return
+			case <-w.RenewCh():
+				c.logger.Debug("vault lease renewed", slog.String("secret", name))
+			}
+		}
+	}()
+	return nil
+}
+
+// リースの更新をやめる。取得した認証情報は、リースの期限が切れるまで使える
+func (c *Client) Close() {
+	c.closed.Store(true)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.watchers {
+		w.Stop()
+	}
+	c.watchers = nil
+}